@@ -1,13 +1,16 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/Renal37/goph-keeper/internal/agent/client"
 	"github.com/Renal37/goph-keeper/internal/agent/config"
 	"github.com/Renal37/goph-keeper/internal/agent/core"
 	"github.com/Renal37/goph-keeper/internal/logger"
+	"go.uber.org/zap"
 )
 
 var (
@@ -23,37 +26,103 @@ func main() {
 
 	lg, err := logger.Init("info")
 	if err != nil {
-		log.Fatalln(err)
+		log.Printf("failed init logger, using fallback stderr logger: %s", err)
 	}
 
-	fmt.Println("*************************************")
-	fmt.Println("Welcome GophKepeer client")
-	fmt.Printf("Build version: %v \n", buildVersion)
-	fmt.Printf("Build date: %v \n", buildDate)
-	fmt.Println("*************************************")
+	out := core.MessageWriter(eCfg)
+
+	fmt.Fprintln(out, "*************************************")
+	fmt.Fprintln(out, "Welcome GophKepeer client")
+	fmt.Fprintf(out, "Build version: %v \n", buildVersion)
+	fmt.Fprintf(out, "Build date: %v \n", buildDate)
+	fmt.Fprintln(out, "*************************************")
 
 	if eCfg.Command == "" {
-		fmt.Println("Support command -c:")
-		fmt.Println("sign-up - create new account")
-		fmt.Println("sign-in - sign in with your account")
-		fmt.Println("read-file - read all files on your account")
-		fmt.Println("write-file - write file on your account")
-		fmt.Println("delete-file - delete file from your account")
-		fmt.Println("*************************************")
+		fmt.Fprintln(out, "Support command -c:")
+		fmt.Fprintln(out, "sign-up - create new account")
+		fmt.Fprintln(out, "sign-in - sign in with your account")
+		fmt.Fprintln(out, "read-file - read all files on your account")
+		fmt.Fprintln(out, "write-file - write file on your account")
+		fmt.Fprintln(out, "delete-file - delete file from your account")
+		fmt.Fprintln(out, "transfer-file - hand a file over to another user")
+		fmt.Fprintln(out, "info-file - show name, type, size, MIME type, timestamps and tags of a file without reading it")
+		fmt.Fprintln(out, "update-file - replace the data of a file, keeping its ID")
+		fmt.Fprintln(out, "update-meta - add or remove tags of a file")
+		fmt.Fprintln(out, "tag-files - set tags and category of all files matching -category, -type or -name")
+		fmt.Fprintln(out, "shares-out - list the files you share with teams and stop sharing one")
+		fmt.Fprintln(out, "shares-in - list the files shared with you")
+		fmt.Fprintln(out, "diff-file - show changes between two versions of a file, with -local compare a local file with the stored one")
+		fmt.Fprintln(out, "rotate-password - replace a stored password with a generated one")
+		fmt.Fprintln(out, "audit-passwords - find reused and weak passwords")
+		fmt.Fprintln(out, "audit-expiry - find passwords older than their rotation interval")
+		fmt.Fprintln(out, "export - export credentials for KeePass, use -format keepass or keepass-xml, or all files with -format goph-json")
+		fmt.Fprintln(out, "import - import files exported with -format goph-json, use -format goph-json")
+		fmt.Fprintln(out, "categories - list categories of your files")
+		fmt.Fprintln(out, "list-folder - list the files of -folder and its nested folders grouped by folder")
+		fmt.Fprintln(out, "ids - print only the IDs of your files, one per line")
+		fmt.Fprintln(out, "token-info - show when the current token expires")
+		fmt.Fprintln(out, "doctor - check the config, certificate, connection, TLS and token step by step")
+		fmt.Fprintln(out, "healthcheck - check that the server answers, with -deep check its encryption")
+		fmt.Fprintln(out, "offline-stash - encrypt a file with a passphrase and keep it locally until sync")
+		fmt.Fprintln(out, "sync - upload the stashed files and remove them from the spool")
+		fmt.Fprintln(out, "rekey - re-encrypt the stashed files under a new passphrase")
+		fmt.Fprintln(out, "benchmark - measure the upload and download throughput and latency with throwaway records")
+		fmt.Fprintln(out, "*************************************")
+	}
+
+	// The doctor checks what the client needs, so it runs without one
+	if eCfg.Command == "doctor" {
+		if err := core.Doctor(eCfg); err != nil {
+			fatal(lg, eCfg, fmt.Errorf("doctor: %w", err))
+		}
+
+		return
+	}
+
+	var opts []client.Option
+	if eCfg.Compression {
+		opts = append(opts, client.WithCompression())
+	}
+	if eCfg.Fingerprint != "" {
+		opts = append(opts, client.WithFingerprint(eCfg.Fingerprint))
+	}
+	// A call rejected for an expired token is retried once with a refreshed one
+	opts = append(opts, core.RefreshOnUnauthenticated())
+	if eCfg.AutoRefresh {
+		opts = append(opts, core.AutoRefresh())
 	}
 
-	cl, err := client.NewClient(eCfg.ServerAddr, eCfg.Certificate, eCfg.JWT)
+	cl, err := client.NewClient(eCfg.ServerAddr, eCfg.Certificate, eCfg.JWT, opts...)
 	if err != nil {
-		lg.Sugar().Fatalf("failed create client: %s", err.Error())
+		fatal(lg, eCfg, fmt.Errorf("failed create client: %w", err))
+	}
+
+	err = core.Run(cl, eCfg)
+
+	// The exit code of the command of -exec is the exit code of the agent
+	var exitErr *core.ExitError
+	if errors.As(err, &exitErr) {
+		_ = cl.Close()
+		os.Exit(exitErr.Code)
 	}
 
-	err = core.Run(cl, eCfg.Command)
 	if err != nil {
-		lg.Sugar().Fatalf("failed command from client: %s", err.Error())
+		fatal(lg, eCfg, fmt.Errorf("failed command from client: %w", err))
 	}
 
 	err = cl.Close()
 	if err != nil {
-		lg.Sugar().Fatalf("failed close client: %s", err.Error())
+		fatal(lg, eCfg, fmt.Errorf("failed close client: %w", err))
 	}
 }
+
+// fatal reports the error and exits. With -json-errors the error is
+// written to stderr as JSON instead of the log.
+func fatal(lg *zap.Logger, cfg *config.ConfigENV, err error) {
+	if cfg.JSONErrors {
+		core.WriteError(os.Stderr, cfg, err)
+		os.Exit(1)
+	}
+
+	lg.Sugar().Fatal(err.Error())
+}
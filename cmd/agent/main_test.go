@@ -7,15 +7,18 @@ import (
 	"log"
 	"net"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/Renal37/goph-keeper/internal/agent/client"
+	"github.com/Renal37/goph-keeper/internal/agent/core"
 	"github.com/Renal37/goph-keeper/internal/logger"
 	handler "github.com/Renal37/goph-keeper/internal/server/adapters/handler/grpc"
 	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
 	interceptors "github.com/Renal37/goph-keeper/internal/server/adapters/middleware/grpc"
 	repository "github.com/Renal37/goph-keeper/internal/server/adapters/repository/pg"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
 	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
 	"github.com/Renal37/goph-keeper/internal/server/core/services"
 	"github.com/golang-jwt/jwt/v5"
@@ -26,6 +29,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
 	"google.golang.org/grpc/test/bufconn"
 
 	_ "github.com/lib/pq"
@@ -107,7 +111,7 @@ func TestMain(m *testing.M) {
 	os.Exit(code)
 }
 
-func testServer(ctx context.Context) (*client.Client, func()) {
+func testServer(ctx context.Context, opts ...grpc.DialOption) (*client.Client, func()) {
 	buffer := 101024 * 1024
 	lis := bufconn.Listen(buffer)
 
@@ -116,7 +120,7 @@ func testServer(ctx context.Context) (*client.Client, func()) {
 		log.Fatalln(err)
 	}
 
-	repo, err := repository.NewDB(context.Background(), lg, databaseURL)
+	repo, err := repository.NewDB(context.Background(), lg, databaseURL, "")
 	if err != nil {
 		lg.Fatal(err.Error())
 	}
@@ -124,13 +128,13 @@ func testServer(ctx context.Context) (*client.Client, func()) {
 	baseServer := grpc.NewServer(
 		grpc.ChainUnaryInterceptor(
 			selector.UnaryServerInterceptor(
-				auth.UnaryServerInterceptor(interceptors.GetAuthenticator(testJWTkey)),
+				auth.UnaryServerInterceptor(interceptors.GetAuthenticator(testJWTkey, 0)),
 				selector.MatchFunc(interceptors.AuthMatcher),
 			),
 		),
 		grpc.ChainStreamInterceptor(
 			selector.StreamServerInterceptor(
-				auth.StreamServerInterceptor(interceptors.GetAuthenticator(testJWTkey)),
+				auth.StreamServerInterceptor(interceptors.GetAuthenticator(testJWTkey, 0)),
 				selector.MatchFunc(interceptors.AuthMatcher),
 			),
 		),
@@ -158,14 +162,16 @@ func testServer(ctx context.Context) (*client.Client, func()) {
 		}
 	}()
 
-	conn, err := grpc.DialContext(ctx, "",
+	opts = append([]grpc.DialOption{
 		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
 			//nolint:wrapcheck // This legal return
 			return lis.Dial()
 		}),
 		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(testMaxMsgSize), grpc.MaxCallSendMsgSize(testMaxMsgSize)),
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
-	)
+	}, opts...)
+
+	conn, err := grpc.DialContext(ctx, "", opts...)
 	if err != nil {
 		log.Printf("error connecting to server: %v", err)
 	}
@@ -268,6 +274,101 @@ func TestReadFile(t *testing.T) {
 	assert.Equal(t, r.Type, "file")
 }
 
+func TestCompressedCall(t *testing.T) {
+	ctx := context.Background()
+
+	cl, closer := testServer(ctx, grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)))
+	defer closer()
+
+	_, err := cl.WriteFile("file", "test.zip", "../../assets/test.zip")
+	assert.NoError(t, err)
+
+	r, err := cl.ReadAllFile()
+	assert.NoError(t, err)
+	assert.NotZero(t, len(r.Units))
+}
+
+func TestWriteInvalidName(t *testing.T) {
+	ctx := context.Background()
+
+	cl, closer := testServer(ctx)
+	defer closer()
+
+	// The client rejects the name without calling the server
+	_, err := cl.WriteFile("text", "bad\nname", "data")
+	assert.ErrorIs(t, err, domain.ErrInvalidName)
+
+	_, err = cl.WriteFile("text", strings.Repeat("a", domain.DefaultMaxNameLength+1), "data")
+	assert.ErrorIs(t, err, domain.ErrInvalidName)
+}
+
+func TestRotatePassword(t *testing.T) {
+	ctx := context.Background()
+
+	cl, closer := testServer(ctx)
+	defer closer()
+
+	data := `{"login": "user", "password": "old-password", "url": "https://example.com"}`
+	w, err := cl.WriteFile("credentials", "site", data)
+	assert.NoError(t, err)
+
+	password, err := core.RotatePassword(cl, w.Id)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "old-password", password)
+
+	// The current version has the new password, the other fields are kept
+	r, err := cl.ReadFile(w.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), r.Version)
+	assert.Contains(t, string(r.Data), fmt.Sprintf(`"password": %q`, password))
+	assert.Contains(t, string(r.Data), `"url": "https://example.com"`)
+	assert.Contains(t, string(r.Data), `"password_changed_at": "`)
+
+	// The old password is kept in the history
+	old, err := cl.ReadFileVersion(w.Id, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, data, string(old.Data))
+
+	// Only credentials can be rotated
+	text, err := cl.WriteFile("text", "note", "text")
+	assert.NoError(t, err)
+	_, err = core.RotatePassword(cl, text.Id)
+	assert.Error(t, err)
+}
+
+func TestRawTextFidelity(t *testing.T) {
+	ctx := context.Background()
+
+	cl, closer := testServer(ctx)
+	defer closer()
+
+	text := "  leading spaces\n\ttabs and trailing spaces  \r\n\nlast line without break"
+
+	w, err := cl.WriteFile("text", "raw", text)
+	assert.NoError(t, err)
+
+	r, err := cl.ReadFile(w.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(text), r.Data)
+}
+
+func TestReadMany(t *testing.T) {
+	ctx := context.Background()
+
+	cl, closer := testServer(ctx)
+	defer closer()
+
+	w, err := cl.WriteFile("text", "many", "many text")
+	assert.NoError(t, err)
+
+	records, err := cl.ReadMany([]int32{w.Id, 999999})
+	assert.NoError(t, err)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "many text", string(records[0].Data))
+		assert.Equal(t, "record not found", records[1].Error)
+	}
+}
+
 /* UTILS. */
 func getJWT(jwtKey string, id int, login string) (*string, error) {
 	var DefaultSession = 30
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/Renal37/goph-keeper/internal/logger"
 	repository "github.com/Renal37/goph-keeper/internal/server/adapters/repository/pg"
@@ -23,28 +24,69 @@ func main() {
 		log.Fatalln(err)
 	}
 
-	lg, err := logger.Init("info")
+	lg, err := logger.Init("info", logger.WithEncoding(eCfg.LogEncoding), logger.WithFile(eCfg.LogFile))
 	if err != nil {
-		log.Fatalln(err)
+		log.Printf("failed init logger, using fallback stderr logger: %s", err)
 	}
 
 	lg.Info(fmt.Sprintf("Build version: %v", buildVersion))
 	lg.Info(fmt.Sprintf("Build date: %v", buildDate))
 
-	if eCfg.MasterKey == "" {
-		lg.Fatal("Master key not found! Please use flag -mk")
+	// The certificates are generated without the database
+	if eCfg.Command == "gen-cert" {
+		err = core.RunGenCert(lg, eCfg)
+		if err != nil {
+			lg.Fatal(err.Error())
+		}
+
+		return
 	}
 
-	if len(eCfg.MasterKey) < minimumCharMasterKey {
-		lg.Sugar().Fatalf("Minimum length master key %v characters!", minimumCharMasterKey)
+	// The admin token is signed without the database
+	if eCfg.Command == "admin-token" {
+		err = core.RunAdminToken(lg, eCfg, os.Stdout)
+		if err != nil {
+			lg.Fatal(err.Error())
+		}
+
+		return
 	}
 
-	repo, err := repository.NewDB(context.Background(), lg, eCfg.DSN)
+	// Commands copy the encrypted data as is and do not need the master key
+	if eCfg.Command == "" {
+		if eCfg.MasterKey == "" {
+			lg.Fatal("Master key not found! Please use flag -mk")
+		}
+
+		if len(eCfg.MasterKey) < minimumCharMasterKey {
+			lg.Sugar().Fatalf("Minimum length master key %v characters!", minimumCharMasterKey)
+		}
+
+		if err := config.CheckMasterKeyStrength(eCfg.MasterKey, eCfg.MasterKeyMinEntropy); err != nil {
+			lg.Sugar().Fatalf("%s! Use a random master key, e.g. openssl rand -base64 32", err)
+		}
+
+		// The previous keys keep their IDs, the primary key must not reuse one
+		if _, ok := eCfg.MasterKeys[eCfg.MasterKeyID]; ok {
+			lg.Sugar().Fatalf("Master key ID %q is used by a previous master key!", eCfg.MasterKeyID)
+		}
+	}
+
+	repo, err := repository.NewDB(context.Background(), lg, eCfg.DSN, eCfg.ReadDSN)
 	if err != nil {
 		lg.Fatal(err.Error())
 	}
 
-	err = core.RunGRPCserver(lg, eCfg.Host, eCfg.CertificatePath, eCfg.CertificateKeyPath, eCfg.JWTkey, eCfg.MasterKey, repo)
+	if eCfg.Command != "" {
+		err = core.RunCommand(lg, eCfg, repo)
+		if err != nil {
+			lg.Fatal(err.Error())
+		}
+
+		return
+	}
+
+	err = core.RunGRPCserver(lg, eCfg, repo)
 	if err != nil {
 		lg.Fatal(err.Error())
 	}
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -16,17 +24,22 @@ import (
 	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
 	interceptors "github.com/Renal37/goph-keeper/internal/server/adapters/middleware/grpc"
 	repository "github.com/Renal37/goph-keeper/internal/server/adapters/repository/pg"
+	"github.com/Renal37/goph-keeper/internal/server/adapters/webhook"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
 	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
 	"github.com/Renal37/goph-keeper/internal/server/core/services"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/auth"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/selector"
 	"github.com/ory/dockertest/v3"
 	"github.com/ory/dockertest/v3/docker"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 
 	_ "github.com/lib/pq"
@@ -112,9 +125,12 @@ func TestMain(m *testing.M) {
 type clients struct {
 	user    proto.UserClient
 	storage proto.StorageClient
+	admin   proto.AdminClient
 }
 
-func testServer(ctx context.Context) (clients, func()) {
+// testServer starts the server on an in-memory listener. The options change
+// the settings of the storage handler.
+func testServer(ctx context.Context, opts ...func(*handler.StorageHandler)) (clients, func()) {
 	buffer := 101024 * 1024
 	lis := bufconn.Listen(buffer)
 
@@ -123,7 +139,7 @@ func testServer(ctx context.Context) (clients, func()) {
 		log.Fatalln(err)
 	}
 
-	repo, err := repository.NewDB(context.Background(), lg, databaseURL)
+	repo, err := repository.NewDB(context.Background(), lg, databaseURL, "")
 	if err != nil {
 		lg.Fatal(err.Error())
 	}
@@ -131,13 +147,25 @@ func testServer(ctx context.Context) (clients, func()) {
 	baseServer := grpc.NewServer(
 		grpc.ChainUnaryInterceptor(
 			selector.UnaryServerInterceptor(
-				auth.UnaryServerInterceptor(interceptors.GetAuthenticator(testJWTkey)),
+				interceptors.MaxRequestSize(interceptors.DefaultMaxCredentialsSize),
+				selector.MatchFunc(interceptors.CredentialsMatcher),
+			),
+			selector.UnaryServerInterceptor(
+				auth.UnaryServerInterceptor(interceptors.GetAuthenticator(testJWTkey, 0)),
+				selector.MatchFunc(interceptors.AuthMatcher),
+			),
+			selector.UnaryServerInterceptor(
+				interceptors.PolicyUnaryInterceptor(interceptors.DefaultPolicy),
 				selector.MatchFunc(interceptors.AuthMatcher),
 			),
 		),
 		grpc.ChainStreamInterceptor(
 			selector.StreamServerInterceptor(
-				auth.StreamServerInterceptor(interceptors.GetAuthenticator(testJWTkey)),
+				auth.StreamServerInterceptor(interceptors.GetAuthenticator(testJWTkey, 0)),
+				selector.MatchFunc(interceptors.AuthMatcher),
+			),
+			selector.StreamServerInterceptor(
+				interceptors.PolicyStreamInterceptor(interceptors.DefaultPolicy),
 				selector.MatchFunc(interceptors.AuthMatcher),
 			),
 		),
@@ -153,10 +181,25 @@ func testServer(ctx context.Context) (clients, func()) {
 
 	// Create storage service
 	storageSvc := services.NewStorageService(repo)
-	proto.RegisterStorageServer(baseServer, &handler.StorageHandler{
-		Svc:       *storageSvc,
-		Logger:    lg,
-		MasterKey: testMasterKey,
+	readOnlyMode := handler.NewReadOnlyMode(lg, false)
+	storageHandler := &handler.StorageHandler{
+		Svc:          *storageSvc,
+		Logger:       lg,
+		MasterKey:    testMasterKey,
+		ReadOnlyMode: readOnlyMode,
+	}
+	for _, opt := range opts {
+		opt(storageHandler)
+	}
+	proto.RegisterStorageServer(baseServer, storageHandler)
+	// The records are written with the default algorithm and re-encrypted with another one
+	proto.RegisterAdminServer(baseServer, &handler.AdminHandler{
+		ReadOnlyMode: readOnlyMode,
+		Storage:      storageSvc,
+		Users:        userSvc,
+		Logger:       lg,
+		MasterKey:    testMasterKey,
+		Algorithm:    handler.AlgorithmChaCha20Poly1305,
 	})
 
 	go func() {
@@ -188,6 +231,7 @@ func testServer(ctx context.Context) (clients, func()) {
 	return clients{
 		user:    uClient,
 		storage: sClient,
+		admin:   proto.NewAdminClient(conn),
 	}, closer
 }
 
@@ -331,6 +375,52 @@ func TestLoginUser(t *testing.T) {
 	}
 }
 
+func TestLoginWithEmail(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	out, err := client.user.Register(ctx, &proto.RegiserRequest{Login: "email", Password: "secret", Email: "email@example.com"})
+	assert.NoError(t, err)
+	assert.Empty(t, out.Error)
+	assert.NotEmpty(t, out.Jwt)
+
+	// The user logs in with either identifier, the token has the login
+	for _, login := range []string{"email", "email@example.com"} {
+		out, err := client.user.Login(ctx, &proto.LoginRequest{Login: login, Password: "secret"})
+		assert.NoError(t, err)
+		assert.Empty(t, out.Error, login)
+		assert.NotEmpty(t, out.Jwt, login)
+
+		claims := middleware.JWTclaims{}
+		_, _, err = jwt.NewParser().ParseUnverified(out.Jwt, &claims)
+		assert.NoError(t, err)
+		assert.Equal(t, "email", claims.Login)
+	}
+
+	out, err = client.user.Register(ctx, &proto.RegiserRequest{Login: "email-other", Password: "secret", Email: "email@example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, "this email is used by another user", out.Error)
+
+	for _, email := range []string{"email", "Alice <alice@example.com>", "alice@localhost", "alice@"} {
+		out, err = client.user.Register(ctx, &proto.RegiserRequest{Login: "email-malformed", Password: "secret", Email: email})
+		assert.NoError(t, err)
+		assert.Contains(t, out.Error, "invalid email", email)
+	}
+
+	// The users without an email don't share the empty one
+	for _, login := range []string{"email-none-1", "email-none-2"} {
+		out, err = client.user.Register(ctx, &proto.RegiserRequest{Login: login, Password: "secret"})
+		assert.NoError(t, err)
+		assert.Empty(t, out.Error)
+	}
+
+	login, err := client.user.Login(ctx, &proto.LoginRequest{Login: "email@example.com", Password: "wrong"})
+	assert.NoError(t, err)
+	assert.Equal(t, "login or password incorrect", login.Error)
+}
+
 type WriteFileExp struct {
 	out *proto.WriteRecordResponse
 	err string
@@ -661,7 +751,2393 @@ func TestDeleteFileStorage(t *testing.T) {
 	}
 }
 
-/* UTILS. */
+func TestWriteFileIdempotency(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	tkn, err := getJWT(testJWTkey, testUserID, testUser)
+	assert.NoError(t, err)
+
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn))
+	ctx = metadata.NewOutgoingContext(context.Background(), md)
+
+	write := func(key string) *proto.WriteRecordResponse {
+		stream, err := client.storage.WriteRecord(ctx)
+		assert.NoError(t, err)
+
+		err = stream.Send(&proto.WriteRecordRequest{
+			Name:           "idempotent",
+			Type:           "text",
+			Data:           []byte("test string"),
+			IdempotencyKey: key,
+		})
+		assert.NoError(t, err)
+
+		out, err := stream.CloseAndRecv()
+		assert.NoError(t, err)
+		assert.Empty(t, out.Error)
+
+		return out
+	}
+
+	// Replaying the same key must return the same record
+	first := write("retry-key")
+	second := write("retry-key")
+	assert.NotZero(t, first.Id)
+	assert.Equal(t, first.Id, second.Id)
+
+	// Another key creates another record
+	third := write("other-key")
+	assert.NotEqual(t, first.Id, third.Id)
+
+	// Without a key every write creates a new record
+	assert.NotEqual(t, write("").Id, write("").Id)
+
+	// The key of a deleted record writes a new record
+	del, err := client.storage.DeleteRecord(ctx, &proto.DeleteRecordRequest{Id: first.Id})
+	assert.NoError(t, err)
+	assert.Empty(t, del.Error)
+
+	replayed := write("retry-key")
+	assert.NotZero(t, replayed.Id)
+	assert.NotEqual(t, first.Id, replayed.Id)
+
+	read, err := client.storage.ReadRecord(ctx, &proto.ReadRecordRequest{Id: replayed.Id})
+	assert.NoError(t, err)
+	assert.Empty(t, read.Error)
+	assert.Equal(t, []byte("test string"), read.Data)
+}
+
+func TestIdempotencyKeyWindow(t *testing.T) {
+	ctx := context.Background()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	id, err := repo.WriteRecordWithKey(domain.Storage{Name: "window", Type: "text", Value: "v", Key: "k", Owner: 97}, "window-key")
+	assert.NoError(t, err)
+
+	past := time.Now().Add(-time.Hour)
+	k, err := repo.FindIdempotencyKey("window-key", 97, past)
+	assert.NoError(t, err)
+	if assert.NotNil(t, k) {
+		assert.Equal(t, id, k.RecordID)
+	}
+
+	// A key older than the window is ignored even before it is purged
+	future := time.Now().Add(time.Hour)
+	k, err = repo.FindIdempotencyKey("window-key", 97, future)
+	assert.NoError(t, err)
+	assert.Nil(t, k)
+
+	// The purge removes only the keys of the owner
+	assert.NoError(t, repo.DeleteIdempotencyKeys(98, future))
+	k, err = repo.FindIdempotencyKey("window-key", 97, past)
+	assert.NoError(t, err)
+	assert.NotNil(t, k)
+
+	assert.NoError(t, repo.DeleteIdempotencyKeys(97, future))
+	k, err = repo.FindIdempotencyKey("window-key", 97, past)
+	assert.NoError(t, err)
+	assert.Nil(t, k)
+}
+
+func TestReadReplica(t *testing.T) {
+	ctx := context.Background()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	sqlDB, err := sql.Open("postgres", databaseURL)
+	assert.NoError(t, err)
+	defer sqlDB.Close()
+
+	_, err = sqlDB.Exec("CREATE DATABASE replica")
+	assert.NoError(t, err)
+
+	u, err := url.Parse(databaseURL)
+	assert.NoError(t, err)
+	u.Path = "/replica"
+	replicaURL := u.String()
+
+	// Migrate the replica schema, a real replica receives it from the primary
+	replica, err := repository.NewDB(ctx, lg, replicaURL, "")
+	assert.NoError(t, err)
+	assert.NoError(t, replica.Close())
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, replicaURL)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	// The write goes to the primary
+	id, err := repo.WriteRecord(domain.Storage{Name: "replica", Type: "text", Value: "v", Key: "k", Owner: 99})
+	assert.NoError(t, err)
+	assert.NotZero(t, id)
+
+	// Reads are served by the replica, which does not have the record
+	rec, err := repo.ReadRecord(id, 99)
+	assert.NoError(t, err)
+	assert.Nil(t, rec)
+
+	all, err := repo.ReadAllRecord(99, domain.RecordFilter{}, domain.RecordSort{})
+	assert.NoError(t, err)
+	assert.Empty(t, all)
+}
+
+func TestReadAllRecordEmpty(t *testing.T) {
+	ctx := context.Background()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer repo.Close()
+
+	// The owner has no records
+	all, err := repo.ReadAllRecord(987654, domain.RecordFilter{}, domain.RecordSort{})
+	assert.NoError(t, err)
+	assert.NotNil(t, all)
+	assert.Len(t, all, 0)
+
+	all, err = repo.ReadAllRecord(987654, domain.RecordFilter{Category: "none"}, domain.RecordSort{Keys: []string{domain.SortName}})
+	assert.NoError(t, err)
+	assert.NotNil(t, all)
+	assert.Len(t, all, 0)
+}
+
+func TestReadRecordConfirmation(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	tkn, err := getJWT(testJWTkey, 13, "confirm")
+	assert.NoError(t, err)
+
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn))
+	ctx = metadata.NewOutgoingContext(context.Background(), md)
+
+	stream, err := client.storage.WriteRecord(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, stream.Send(&proto.WriteRecordRequest{Name: "bank", Type: "text", Data: []byte("pin 1234"), RequiresConfirmation: true}))
+
+	written, err := stream.CloseAndRecv()
+	if !assert.NoError(t, err) || !assert.NotZero(t, written.Id) {
+		return
+	}
+
+	// The first read only gets the challenge
+	out, err := client.storage.ReadRecord(ctx, &proto.ReadRecordRequest{Id: written.Id})
+	assert.NoError(t, err)
+	assert.True(t, out.ConfirmationRequired)
+	assert.NotEmpty(t, out.Challenge)
+	assert.Empty(t, out.Data)
+
+	// A forged confirmation gets a new challenge
+	forged, err := client.storage.ReadRecord(ctx, &proto.ReadRecordRequest{Id: written.Id, Confirmation: "1.abc"})
+	assert.NoError(t, err)
+	assert.True(t, forged.ConfirmationRequired)
+	assert.Empty(t, forged.Data)
+
+	// The confirmed read gets the data
+	confirmed, err := client.storage.ReadRecord(ctx, &proto.ReadRecordRequest{Id: written.Id, Confirmation: out.Challenge})
+	assert.NoError(t, err)
+	assert.False(t, confirmed.ConfirmationRequired)
+	assert.Equal(t, []byte("pin 1234"), confirmed.Data)
+
+	// The batch read doesn't return the record
+	batch, err := client.storage.ReadRecords(ctx, &proto.ReadRecordsRequest{Ids: []int32{written.Id}})
+	if assert.NoError(t, err) && assert.Len(t, batch.Records, 1) {
+		assert.True(t, batch.Records[0].ConfirmationRequired)
+		assert.Empty(t, batch.Records[0].Data)
+	}
+
+	// The list shows the record requires confirmation
+	all, err := client.storage.ReadAllRecord(ctx, &proto.ReadAllRecordRequest{})
+	if assert.NoError(t, err) && assert.Len(t, all.Units, 1) {
+		assert.True(t, all.Units[0].RequiresConfirmation)
+	}
+}
+
+func TestCategoryStorage(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	// A separate owner keeps the counts independent of other tests
+	tkn, err := getJWT(testJWTkey, 2, "category")
+	assert.NoError(t, err)
+
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn))
+	ctx = metadata.NewOutgoingContext(context.Background(), md)
+
+	records := []*proto.WriteRecordRequest{
+		{Name: "aws", Type: "text", Data: []byte("secret"), Category: "work"},
+		{Name: "gitlab", Type: "text", Data: []byte("secret"), Category: "work"},
+		{Name: "bank", Type: "text", Data: []byte("secret"), Category: "banking"},
+		{Name: "note", Type: "text", Data: []byte("secret")},
+	}
+
+	for _, rec := range records {
+		stream, err := client.storage.WriteRecord(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, stream.Send(rec))
+
+		out, err := stream.CloseAndRecv()
+		assert.NoError(t, err)
+		assert.Empty(t, out.Error)
+	}
+
+	tests := []struct {
+		name     string
+		category string
+		exp      []string
+	}{
+		{name: "Without filter returns all records", category: "", exp: []string{"aws", "gitlab", "bank", "note"}},
+		{name: "Filter by work", category: "work", exp: []string{"aws", "gitlab"}},
+		{name: "Filter by banking", category: "banking", exp: []string{"bank"}},
+		{name: "Filter by unknown category", category: "personal", exp: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := client.storage.ReadAllRecord(ctx, &proto.ReadAllRecordRequest{Category: tt.category})
+			assert.NoError(t, err)
+			assert.Empty(t, out.Error)
+
+			names := make([]string, 0, len(out.Units))
+			for _, v := range out.Units {
+				names = append(names, v.Name)
+			}
+			assert.ElementsMatch(t, tt.exp, names)
+		})
+	}
+
+	out, err := client.storage.ReadCategories(ctx, &proto.ReadCategoriesRequest{})
+	assert.NoError(t, err)
+	assert.Empty(t, out.Error)
+	assert.Len(t, out.Categories, 2)
+	assert.Equal(t, "banking", out.Categories[0].Name)
+	assert.Equal(t, int32(1), out.Categories[0].Count)
+	assert.Equal(t, "work", out.Categories[1].Name)
+	assert.Equal(t, int32(2), out.Categories[1].Count)
+}
+
+func TestUpdateRecordConcurrent(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	tkn, err := getJWT(testJWTkey, 3, "update")
+	assert.NoError(t, err)
+
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn))
+	ctx = metadata.NewOutgoingContext(context.Background(), md)
+
+	// Create the record, its first version is 1
+	stream, err := client.storage.WriteRecord(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&proto.WriteRecordRequest{Name: "update", Type: "text", Data: []byte("v1")}))
+	written, err := stream.CloseAndRecv()
+	assert.NoError(t, err)
+	assert.Empty(t, written.Error)
+
+	update := func(data string) error {
+		stream, err := client.storage.UpdateRecord(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = stream.Send(&proto.UpdateRecordRequest{Id: written.Id, Version: 1, Name: "update", Type: "text", Data: []byte(data)})
+		if err != nil {
+			return err
+		}
+
+		out, err := stream.CloseAndRecv()
+		if err != nil {
+			return err
+		}
+
+		assert.Empty(t, out.Error)
+		assert.Equal(t, int32(2), out.Version)
+
+		return nil
+	}
+
+	// Both updates expect version 1, only one of them can win
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = update(fmt.Sprintf("v2-%d", i))
+		}(i)
+	}
+	wg.Wait()
+
+	conflicts := 0
+	for _, err := range errs {
+		if err != nil {
+			assert.Equal(t, codes.Aborted, status.Code(err))
+			conflicts++
+		}
+	}
+	assert.Equal(t, 1, conflicts)
+
+	// The record keeps its ID and has the new version
+	out, err := client.storage.ReadRecord(ctx, &proto.ReadRecordRequest{Id: written.Id})
+	assert.NoError(t, err)
+	assert.Empty(t, out.Error)
+	assert.Equal(t, int32(2), out.Version)
+}
+
+func TestUpdateMeta(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	tkn, err := getJWT(testJWTkey, 4, "meta")
+	assert.NoError(t, err)
+
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn))
+	ctx = metadata.NewOutgoingContext(context.Background(), md)
+
+	stream, err := client.storage.WriteRecord(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&proto.WriteRecordRequest{
+		Name: "meta",
+		Type: "text",
+		Data: []byte("secret"),
+		Meta: map[string]string{"env": "prod", "team": "ops"},
+	}))
+	written, err := stream.CloseAndRecv()
+	assert.NoError(t, err)
+	assert.Empty(t, written.Error)
+
+	tests := []struct {
+		name string
+		in   *proto.UpdateMetaRequest
+		exp  map[string]string
+	}{
+		{
+			name: "Merge adds and overwrites tags",
+			in: &proto.UpdateMetaRequest{
+				Id:   written.Id,
+				Meta: map[string]string{"env": "stage", "owner": "alice"},
+			},
+			exp: map[string]string{"env": "stage", "team": "ops", "owner": "alice"},
+		},
+		{
+			name: "Merge removes tags",
+			in: &proto.UpdateMetaRequest{
+				Id:     written.Id,
+				Remove: []string{"team"},
+			},
+			exp: map[string]string{"env": "stage", "owner": "alice"},
+		},
+		{
+			name: "Replace drops other tags",
+			in: &proto.UpdateMetaRequest{
+				Id:      written.Id,
+				Meta:    map[string]string{"archived": ""},
+				Replace: true,
+			},
+			exp: map[string]string{"archived": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := client.storage.UpdateMeta(ctx, tt.in)
+			assert.NoError(t, err)
+			assert.Empty(t, out.Error)
+			assert.Equal(t, tt.exp, out.Meta)
+		})
+	}
+
+	// The data and version of the record are untouched
+	rec, err := client.storage.ReadRecord(ctx, &proto.ReadRecordRequest{Id: written.Id})
+	assert.NoError(t, err)
+	assert.Empty(t, rec.Error)
+	assert.Equal(t, []byte("secret"), rec.Data)
+	assert.Equal(t, int32(1), rec.Version)
+	assert.Equal(t, map[string]string{"archived": ""}, rec.Meta)
+
+	// Someone else's record can't be changed
+	out, err := client.storage.UpdateMeta(ctx, &proto.UpdateMetaRequest{Id: 1, Meta: map[string]string{"a": "b"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "record not found", out.Error)
+}
+
+func TestReauthWindow(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	tkn, err := getJWT(testJWTkey, 5, "reauth")
+	assert.NoError(t, err)
+
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn))
+	stream, err := client.storage.WriteRecord(metadata.NewOutgoingContext(ctx, md))
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&proto.WriteRecordRequest{Name: "reauth", Type: "text", Data: []byte("secret")}))
+	written, err := stream.CloseAndRecv()
+	assert.NoError(t, err)
+	assert.Empty(t, written.Error)
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	h := handler.StorageHandler{
+		Svc:          *services.NewStorageService(repo),
+		Logger:       lg,
+		MasterKey:    testMasterKey,
+		ReauthWindow: 5 * time.Minute,
+	}
+
+	claims := func(authTime time.Time) context.Context {
+		pl := middleware.JWTclaims{ID: 5, Login: "reauth"}
+		if !authTime.IsZero() {
+			pl.AuthTime = authTime.Unix()
+		}
+
+		return middleware.SetTokenToContext(ctx, pl)
+	}
+
+	tests := []struct {
+		name     string
+		authTime time.Time
+		reauth   bool
+	}{
+		{
+			name:     "Password entered within the window",
+			authTime: time.Now().Add(-time.Minute),
+		},
+		{
+			name:     "Password entered outside the window",
+			authTime: time.Now().Add(-10 * time.Minute),
+			reauth:   true,
+		},
+		{
+			name:   "Token without authentication time",
+			reauth: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := h.ReadRecord(claims(tt.authTime), &proto.ReadRecordRequest{Id: written.Id})
+			if tt.reauth {
+				assert.Equal(t, codes.Unauthenticated, status.Code(err))
+				assert.Equal(t, handler.ErrReauthRequired, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Empty(t, out.Error)
+			assert.Equal(t, []byte("secret"), out.Data)
+		})
+	}
+
+	// A stale session can't delete the record
+	_, err = h.DeleteRecord(claims(time.Now().Add(-10*time.Minute)), &proto.DeleteRecordRequest{Id: written.Id})
+	assert.Equal(t, handler.ErrReauthRequired, err)
+
+	rec, err := repo.ReadRecord(int(written.Id), 5)
+	assert.NoError(t, err)
+	assert.NotNil(t, rec)
+}
+
+func TestRecordVersions(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	tkn, err := getJWT(testJWTkey, 6, "versions")
+	assert.NoError(t, err)
+
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn))
+	ctx = metadata.NewOutgoingContext(context.Background(), md)
+
+	stream, err := client.storage.WriteRecord(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&proto.WriteRecordRequest{Name: "v1", Type: "text", Data: []byte("first")}))
+	written, err := stream.CloseAndRecv()
+	assert.NoError(t, err)
+	assert.Empty(t, written.Error)
+
+	// Make versions 2 and 3
+	for i, data := range []string{"second", "third"} {
+		update, err := client.storage.UpdateRecord(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, update.Send(&proto.UpdateRecordRequest{
+			Id:      written.Id,
+			Version: int32(i + 1),
+			Name:    fmt.Sprintf("v%v", i+2),
+			Type:    "text",
+			Data:    []byte(data),
+		}))
+		out, err := update.CloseAndRecv()
+		assert.NoError(t, err)
+		assert.Empty(t, out.Error)
+	}
+
+	tests := []struct {
+		name    string
+		version int32
+		data    string
+		err     string
+	}{
+		{name: "Current version by default", data: "third"},
+		{name: "Current version by number", version: 3, data: "third"},
+		{name: "Previous version", version: 2, data: "second"},
+		{name: "First version", version: 1, data: "first"},
+		{name: "Unknown version", version: 9, err: "record not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := client.storage.ReadRecord(ctx, &proto.ReadRecordRequest{Id: written.Id, Version: tt.version})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.err, out.Error)
+			assert.Equal(t, tt.data, string(out.Data))
+		})
+	}
+
+	// Deleting the record drops its history
+	del, err := client.storage.DeleteRecord(ctx, &proto.DeleteRecordRequest{Id: written.Id})
+	assert.NoError(t, err)
+	assert.Empty(t, del.Error)
+
+	out, err := client.storage.ReadRecord(ctx, &proto.ReadRecordRequest{Id: written.Id, Version: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "record not found", out.Error)
+}
+
+func TestRecordNameValidation(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	tkn, err := getJWT(testJWTkey, 7, "names")
+	assert.NoError(t, err)
+
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn))
+	ctx = metadata.NewOutgoingContext(context.Background(), md)
+
+	tests := []struct {
+		name string
+		in   string
+		code codes.Code
+	}{
+		{name: "Name of maximum length", in: strings.Repeat("я", domain.DefaultMaxNameLength), code: codes.OK},
+		{name: "Oversized name", in: strings.Repeat("a", domain.DefaultMaxNameLength+1), code: codes.InvalidArgument},
+		{name: "Line break in name", in: "fake\nentry", code: codes.InvalidArgument},
+		{name: "Escape sequence in name", in: "\x1b[31mred", code: codes.InvalidArgument},
+		{name: "Invalid UTF-8", in: "\xff", code: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := client.storage.WriteRecord(ctx)
+			assert.NoError(t, err)
+			assert.NoError(t, stream.Send(&proto.WriteRecordRequest{Name: tt.in, Type: "text", Data: []byte("data")}))
+
+			_, err = stream.CloseAndRecv()
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+
+	// Renaming on update is checked as well
+	stream, err := client.storage.WriteRecord(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&proto.WriteRecordRequest{Name: "valid", Type: "text", Data: []byte("data")}))
+	written, err := stream.CloseAndRecv()
+	assert.NoError(t, err)
+
+	update, err := client.storage.UpdateRecord(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, update.Send(&proto.UpdateRecordRequest{Id: written.Id, Version: 1, Name: "bad\tname", Type: "text"}))
+	_, err = update.CloseAndRecv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestReadOnlyScope(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	// Unknown scopes are not issued
+	out, err := client.user.Login(ctx, &proto.LoginRequest{Login: "test", Password: "test", Scope: "admin"})
+	assert.NoError(t, err)
+	assert.Equal(t, "unknown token scope", out.Error)
+
+	out, err = client.user.Login(ctx, &proto.LoginRequest{Login: "test", Password: "test", Scope: middleware.ScopeRead})
+	assert.NoError(t, err)
+	assert.Empty(t, out.Error)
+
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", out.Jwt))
+	ctx = metadata.NewOutgoingContext(context.Background(), md)
+
+	// Reading is allowed
+	all, err := client.storage.ReadAllRecord(ctx, &proto.ReadAllRecordRequest{})
+	assert.NoError(t, err)
+	assert.Empty(t, all.Error)
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{
+			name: "Write record",
+			call: func() error {
+				stream, err := client.storage.WriteRecord(ctx)
+				if err != nil {
+					return err
+				}
+				if err := stream.Send(&proto.WriteRecordRequest{Name: "ro", Type: "text", Data: []byte("data")}); err != nil {
+					return err
+				}
+				_, err = stream.CloseAndRecv()
+				return err
+			},
+		},
+		{
+			name: "Update record",
+			call: func() error {
+				stream, err := client.storage.UpdateRecord(ctx)
+				if err != nil {
+					return err
+				}
+				if err := stream.Send(&proto.UpdateRecordRequest{Id: 1, Version: 1, Name: "ro", Type: "text"}); err != nil {
+					return err
+				}
+				_, err = stream.CloseAndRecv()
+				return err
+			},
+		},
+		{
+			name: "Update meta",
+			call: func() error {
+				_, err := client.storage.UpdateMeta(ctx, &proto.UpdateMetaRequest{Id: 1, Meta: map[string]string{"a": "b"}})
+				return err
+			},
+		},
+		{
+			name: "Delete record",
+			call: func() error {
+				_, err := client.storage.DeleteRecord(ctx, &proto.DeleteRecordRequest{Id: 1})
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, codes.PermissionDenied, status.Code(tt.call()))
+		})
+	}
+}
+
+func TestOversizedCredentials(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	big := strings.Repeat("a", interceptors.DefaultMaxCredentialsSize)
+
+	t.Run("Oversized password on register", func(t *testing.T) {
+		_, err := client.user.Register(ctx, &proto.RegiserRequest{Login: "oversized", Password: big})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("Oversized login on login", func(t *testing.T) {
+		_, err := client.user.Login(ctx, &proto.LoginRequest{Login: big, Password: "test"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("Credentials within the limit", func(t *testing.T) {
+		out, err := client.user.Login(ctx, &proto.LoginRequest{Login: "test", Password: "test"})
+		assert.NoError(t, err)
+		assert.Empty(t, out.Error)
+	})
+
+	// The user was not created
+	out, err := client.user.Login(ctx, &proto.LoginRequest{Login: "oversized", Password: "test"})
+	assert.NoError(t, err)
+	assert.Equal(t, "user not found", out.Error)
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	_, err = repo.WriteRecord(domain.Storage{Name: "backup", Type: "text", Value: "v", Key: "k", Owner: 8})
+	assert.NoError(t, err)
+
+	var backup bytes.Buffer
+	assert.NoError(t, services.NewBackupService(repo).Export(&backup))
+
+	sqlDB, err := sql.Open("postgres", databaseURL)
+	assert.NoError(t, err)
+	defer sqlDB.Close()
+
+	_, err = sqlDB.Exec("CREATE DATABASE restore")
+	assert.NoError(t, err)
+
+	u, err := url.Parse(databaseURL)
+	assert.NoError(t, err)
+	u.Path = "/restore"
+
+	restore, err := repository.NewDB(ctx, lg, u.String(), "")
+	assert.NoError(t, err)
+	defer restore.Close()
+
+	restoreSvc := services.NewBackupService(restore)
+	assert.NoError(t, restoreSvc.Import(bytes.NewReader(backup.Bytes())))
+
+	want, err := repo.ExportAll()
+	assert.NoError(t, err)
+	got, err := restore.ExportAll()
+	assert.NoError(t, err)
+	assert.Equal(t, len(want.Users), len(got.Users))
+	assert.Equal(t, len(want.Records), len(got.Records))
+	assert.Equal(t, len(want.Versions), len(got.Versions))
+
+	// New records continue after the imported ones
+	id, err := restore.WriteRecord(domain.Storage{Name: "after", Type: "text", Value: "v", Key: "k", Owner: 8})
+	assert.NoError(t, err)
+	assert.Greater(t, id, want.Records[len(want.Records)-1].ID)
+
+	// The restored database is not empty anymore
+	err = restoreSvc.Import(bytes.NewReader(backup.Bytes()))
+	assert.ErrorIs(t, err, repository.ErrNotEmpty)
+}
+
+func TestReadRecords(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	write := func(ctx context.Context, name string) int32 {
+		stream, err := client.storage.WriteRecord(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, stream.Send(&proto.WriteRecordRequest{Name: name, Type: "text", Data: []byte(name + " data")}))
+		out, err := stream.CloseAndRecv()
+		assert.NoError(t, err)
+		assert.Empty(t, out.Error)
+
+		return out.Id
+	}
+
+	ownerCtx := func(id int, login string) context.Context {
+		tkn, err := getJWT(testJWTkey, id, login)
+		assert.NoError(t, err)
+
+		return metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn)))
+	}
+
+	ctx = ownerCtx(9, "batch")
+	first := write(ctx, "first")
+	second := write(ctx, "second")
+	foreign := write(ownerCtx(10, "other"), "foreign")
+
+	out, err := client.storage.ReadRecords(ctx, &proto.ReadRecordsRequest{Ids: []int32{second, 999999, foreign, first}})
+	assert.NoError(t, err)
+	assert.Empty(t, out.Error)
+
+	if assert.Len(t, out.Records, 4) {
+		assert.Equal(t, second, out.Records[0].Id)
+		assert.Equal(t, "second data", string(out.Records[0].Data))
+		assert.Empty(t, out.Records[0].Error)
+
+		// Unknown and foreign records are indistinguishable
+		assert.Equal(t, int32(999999), out.Records[1].Id)
+		assert.Equal(t, "record not found", out.Records[1].Error)
+		assert.Equal(t, foreign, out.Records[2].Id)
+		assert.Equal(t, "record not found", out.Records[2].Error)
+		assert.Empty(t, out.Records[2].Data)
+
+		assert.Equal(t, first, out.Records[3].Id)
+		assert.Equal(t, "first", out.Records[3].Name)
+		assert.Equal(t, "first data", string(out.Records[3].Data))
+	}
+
+	// The number of records of one call is limited
+	_, err = client.storage.ReadRecords(ctx, &proto.ReadRecordsRequest{Ids: make([]int32, 101)})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestReadRecordLimit(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	tkn, err := getJWT(testJWTkey, 11, "preview")
+	assert.NoError(t, err)
+
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn))
+	ctx = metadata.NewOutgoingContext(context.Background(), md)
+
+	stream, err := client.storage.WriteRecord(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&proto.WriteRecordRequest{Name: "long", Type: "text", Data: []byte("0123456789")}))
+	written, err := stream.CloseAndRecv()
+	assert.NoError(t, err)
+
+	out, err := client.storage.ReadRecord(ctx, &proto.ReadRecordRequest{Id: written.Id, Limit: 4})
+	assert.NoError(t, err)
+	assert.Equal(t, "0123", string(out.Data))
+	assert.Equal(t, int64(10), out.Size)
+
+	// The limit above the size returns the whole data
+	out, err = client.storage.ReadRecord(ctx, &proto.ReadRecordRequest{Id: written.Id, Limit: 100})
+	assert.NoError(t, err)
+	assert.Equal(t, "0123456789", string(out.Data))
+}
+
+func TestServerReadOnlyMode(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	tkn, err := getJWT(testJWTkey, 12, "maintenance")
+	assert.NoError(t, err)
+
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn))
+	userCtx := metadata.NewOutgoingContext(context.Background(), md)
+
+	write := func() (*proto.WriteRecordResponse, error) {
+		stream, err := client.storage.WriteRecord(userCtx)
+		if err != nil {
+			return nil, err
+		}
+		if err := stream.Send(&proto.WriteRecordRequest{Name: "maintenance", Type: "text", Data: []byte("data")}); err != nil {
+			return nil, err
+		}
+		return stream.CloseAndRecv()
+	}
+
+	written, err := write()
+	assert.NoError(t, err)
+
+	mode, err := client.admin.SetReadOnly(adminContext(ctx), &proto.SetReadOnlyRequest{Enabled: true})
+	assert.NoError(t, err)
+	assert.True(t, mode.Enabled)
+
+	_, err = write()
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = client.storage.UpdateMeta(userCtx, &proto.UpdateMetaRequest{Id: written.Id, Meta: map[string]string{"a": "b"}})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = client.storage.DeleteRecord(userCtx, &proto.DeleteRecordRequest{Id: written.Id})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Equal(t, "server in read-only mode", status.Convert(err).Message())
+
+	// Reads continue
+	out, err := client.storage.ReadRecord(userCtx, &proto.ReadRecordRequest{Id: written.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, "data", string(out.Data))
+
+	mode, err = client.admin.SetReadOnly(adminContext(ctx), &proto.SetReadOnlyRequest{Enabled: false})
+	assert.NoError(t, err)
+	assert.False(t, mode.Enabled)
+
+	_, err = write()
+	assert.NoError(t, err)
+}
+
+func TestAdminAuthorization(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	// The admin service needs a token
+	_, err := client.admin.SetReadOnly(ctx, &proto.SetReadOnlyRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// The token of a user has no admin scope
+	tkn, err := getJWT(testJWTkey, 13, "not-admin")
+	assert.NoError(t, err)
+	userCtx := metadata.NewOutgoingContext(ctx, metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn)))
+
+	_, err = client.admin.SetReadOnly(userCtx, &proto.SetReadOnlyRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = client.admin.ReencryptAll(userCtx, &proto.ReencryptAllRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// The admin token gives no access to the records
+	_, err = client.storage.ReadAllRecord(adminContext(ctx), &proto.ReadAllRecordRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	mode, err := client.admin.SetReadOnly(adminContext(ctx), &proto.SetReadOnlyRequest{})
+	assert.NoError(t, err)
+	assert.False(t, mode.Enabled)
+}
+
+func TestTeamAccess(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	alice, err := repo.CreateUser("team-alice", "hash")
+	assert.NoError(t, err)
+	bob, err := repo.CreateUser("team-bob", "hash")
+	assert.NoError(t, err)
+	eve, err := repo.CreateUser("team-eve", "hash")
+	assert.NoError(t, err)
+
+	teamSvc := services.NewTeamService(repo, repo)
+	team, err := teamSvc.CreateTeam("vault")
+	assert.NoError(t, err)
+	assert.NoError(t, teamSvc.AddMember("vault", "team-alice"))
+	assert.NoError(t, teamSvc.AddMember("vault", "team-bob"))
+	// Adding twice is not an error
+	assert.NoError(t, teamSvc.AddMember("vault", "team-bob"))
+	assert.ErrorIs(t, teamSvc.AddMember("vault", "unknown"), domain.ErrUserNotFound)
+	assert.ErrorIs(t, teamSvc.AddMember("unknown", "team-eve"), domain.ErrTeamNotFound)
+
+	userCtx := func(u *domain.User) context.Context {
+		tkn, err := getJWT(testJWTkey, u.ID, u.Login)
+		assert.NoError(t, err)
+
+		return metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn)))
+	}
+
+	write := func(ctx context.Context, name string, team int) (*proto.WriteRecordResponse, error) {
+		stream, err := client.storage.WriteRecord(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := stream.Send(&proto.WriteRecordRequest{Name: name, Type: "text", Data: []byte(name), Team: int32(team)}); err != nil {
+			return nil, err
+		}
+		return stream.CloseAndRecv()
+	}
+
+	list := func(ctx context.Context) []string {
+		out, err := client.storage.ReadAllRecord(ctx, &proto.ReadAllRecordRequest{})
+		assert.NoError(t, err)
+
+		names := []string{}
+		for _, u := range out.Units {
+			names = append(names, u.Name)
+		}
+
+		return names
+	}
+
+	shared, err := write(userCtx(alice), "shared", team.ID)
+	assert.NoError(t, err)
+	_, err = write(userCtx(alice), "private", 0)
+	assert.NoError(t, err)
+
+	// Only members write to the team
+	_, err = write(userCtx(eve), "intruder", team.ID)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// A member lists and reads the team records, but not the private ones.
+	// The users may own records of other tests with the same IDs
+	assert.Contains(t, list(userCtx(bob)), "shared")
+	assert.NotContains(t, list(userCtx(bob)), "private")
+	assert.Subset(t, list(userCtx(alice)), []string{"shared", "private"})
+
+	out, err := client.storage.ReadRecord(userCtx(bob), &proto.ReadRecordRequest{Id: shared.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, "shared", string(out.Data))
+
+	// Other users don't see the team records
+	assert.NotContains(t, list(userCtx(eve)), "shared")
+
+	out, err = client.storage.ReadRecord(userCtx(eve), &proto.ReadRecordRequest{Id: shared.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, "record not found", out.Error)
+
+	// A removed member loses the access
+	assert.NoError(t, teamSvc.RemoveMember("vault", "team-bob"))
+	assert.NotContains(t, list(userCtx(bob)), "shared")
+}
+
+func TestShares(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	alice, err := repo.CreateUser("share-alice", "hash")
+	assert.NoError(t, err)
+	bob, err := repo.CreateUser("share-bob", "hash")
+	assert.NoError(t, err)
+	carol, err := repo.CreateUser("share-carol", "hash")
+	assert.NoError(t, err)
+
+	teamSvc := services.NewTeamService(repo, repo)
+	ops, err := teamSvc.CreateTeam("share-ops")
+	assert.NoError(t, err)
+	dev, err := teamSvc.CreateTeam("share-dev")
+	assert.NoError(t, err)
+	assert.NoError(t, teamSvc.AddMember("share-ops", "share-alice"))
+	assert.NoError(t, teamSvc.AddMember("share-ops", "share-bob"))
+	assert.NoError(t, teamSvc.AddMember("share-ops", "share-carol"))
+	assert.NoError(t, teamSvc.AddMember("share-dev", "share-alice"))
+	assert.NoError(t, teamSvc.AddMember("share-dev", "share-bob"))
+
+	userCtx := func(u *domain.User) context.Context {
+		tkn, err := getJWT(testJWTkey, u.ID, u.Login)
+		assert.NoError(t, err)
+
+		return metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn)))
+	}
+
+	write := func(ctx context.Context, name string, team int) int32 {
+		stream, err := client.storage.WriteRecord(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, stream.Send(&proto.WriteRecordRequest{Name: name, Type: "text", Data: []byte(name), Team: int32(team)}))
+		resp, err := stream.CloseAndRecv()
+		assert.NoError(t, err)
+
+		return resp.Id
+	}
+
+	shares := func(ctx context.Context, incoming bool) map[string]*proto.ShareUnit {
+		out, err := client.storage.ReadShares(ctx, &proto.ReadSharesRequest{Incoming: incoming})
+		assert.NoError(t, err)
+		assert.Empty(t, out.Error)
+
+		units := make(map[string]*proto.ShareUnit)
+		for _, u := range out.Shares {
+			units[u.Name] = u
+		}
+
+		return units
+	}
+
+	opsRecord := write(userCtx(alice), "ops-key", ops.ID)
+	write(userCtx(alice), "dev-key", dev.ID)
+	write(userCtx(alice), "private", 0)
+	write(userCtx(bob), "bob-key", ops.ID)
+
+	// Alice shares two records, each with the other members of its team
+	out := shares(userCtx(alice), false)
+	assert.Len(t, out, 2)
+	assert.Equal(t, opsRecord, out["ops-key"].Id)
+	assert.Equal(t, "share-ops", out["ops-key"].TeamName)
+	assert.Equal(t, []string{"share-bob", "share-carol"}, out["ops-key"].Logins)
+	assert.Equal(t, []string{"share-bob"}, out["dev-key"].Logins)
+
+	// Alice gets the record of Bob, Bob the records of Alice, with their owners
+	in := shares(userCtx(alice), true)
+	assert.Len(t, in, 1)
+	assert.Equal(t, []string{"share-bob"}, in["bob-key"].Logins)
+
+	in = shares(userCtx(bob), true)
+	assert.Len(t, in, 2)
+	assert.Equal(t, []string{"share-alice"}, in["ops-key"].Logins)
+	assert.Equal(t, "share-dev", in["dev-key"].TeamName)
+
+	// Carol is only in one team
+	in = shares(userCtx(carol), true)
+	assert.Len(t, in, 2)
+	assert.Contains(t, in, "ops-key")
+	assert.Contains(t, in, "bob-key")
+	assert.Empty(t, shares(userCtx(carol), false))
+
+	// Only the owner revokes the sharing
+	revoked, err := client.storage.RevokeShare(userCtx(bob), &proto.RevokeShareRequest{Id: opsRecord})
+	assert.NoError(t, err)
+	assert.Equal(t, "shared record not found", revoked.Error)
+
+	revoked, err = client.storage.RevokeShare(userCtx(alice), &proto.RevokeShareRequest{Id: opsRecord})
+	assert.NoError(t, err)
+	assert.Empty(t, revoked.Error)
+
+	assert.NotContains(t, shares(userCtx(alice), false), "ops-key")
+	assert.NotContains(t, shares(userCtx(carol), true), "ops-key")
+
+	read, err := client.storage.ReadRecord(userCtx(bob), &proto.ReadRecordRequest{Id: opsRecord})
+	assert.NoError(t, err)
+	assert.Equal(t, "record not found", read.Error)
+
+	// A private record can't be revoked again
+	revoked, err = client.storage.RevokeShare(userCtx(alice), &proto.RevokeShareRequest{Id: opsRecord})
+	assert.NoError(t, err)
+	assert.Equal(t, "shared record not found", revoked.Error)
+}
+
+func TestVaultKey(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	reg, err := client.user.Register(ctx, &proto.RegiserRequest{Login: "vault", Password: "old password"})
+	assert.NoError(t, err)
+	assert.Empty(t, reg.Error)
+
+	user, err := repo.FindUserByLogin("vault")
+	assert.NoError(t, err)
+
+	// The key is created at registration
+	key, err := repo.FindVaultKey(user.ID)
+	assert.NoError(t, err)
+	if !assert.NotNil(t, key) {
+		return
+	}
+
+	dek, err := handler.UnwrapVaultKey(*key, "old password")
+	assert.NoError(t, err)
+
+	// The current password is required
+	out, err := client.user.ChangePassword(ctx, &proto.ChangePasswordRequest{Login: "vault", Password: "wrong", NewPassword: "new password"})
+	assert.NoError(t, err)
+	assert.Equal(t, "login or password incorrect", out.Error)
+
+	out, err = client.user.ChangePassword(ctx, &proto.ChangePasswordRequest{Login: "vault", Password: "old password", NewPassword: "new password"})
+	assert.NoError(t, err)
+	assert.Empty(t, out.Error)
+
+	// The key is wrapped under the new password, the data encryption key stays
+	rotated, err := repo.FindVaultKey(user.ID)
+	assert.NoError(t, err)
+	assert.NotEqual(t, key.Salt, rotated.Salt)
+
+	got, err := handler.UnwrapVaultKey(*rotated, "new password")
+	assert.NoError(t, err)
+	assert.Equal(t, dek, got)
+
+	_, err = handler.UnwrapVaultKey(*rotated, "old password")
+	assert.Error(t, err)
+
+	login, err := client.user.Login(ctx, &proto.LoginRequest{Login: "vault", Password: "new password"})
+	assert.NoError(t, err)
+	assert.Empty(t, login.Error)
+
+	login, err = client.user.Login(ctx, &proto.LoginRequest{Login: "vault", Password: "old password"})
+	assert.NoError(t, err)
+	assert.Equal(t, "login or password incorrect", login.Error)
+}
+
+func TestRecordBinding(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	user, err := repo.CreateUser("bound", "hash")
+	assert.NoError(t, err)
+
+	tkn, err := getJWT(testJWTkey, user.ID, user.Login)
+	assert.NoError(t, err)
+	ctx = metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn)))
+
+	write := func(name string) int32 {
+		stream, err := client.storage.WriteRecord(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, stream.Send(&proto.WriteRecordRequest{Name: name, Type: "text", Data: []byte(name + " secret")}))
+		resp, err := stream.CloseAndRecv()
+		assert.NoError(t, err)
+
+		return resp.Id
+	}
+
+	source, target := write("source"), write("target")
+
+	// The ciphertext of a record copied into another record fails the authentication
+	sqlDB, err := sql.Open("postgres", databaseURL)
+	assert.NoError(t, err)
+	defer sqlDB.Close()
+
+	_, err = sqlDB.Exec("UPDATE storages SET value = s.value, key = s.key FROM storages s WHERE s.id = $1 AND storages.id = $2",
+		source, target)
+	assert.NoError(t, err)
+
+	resp, err := client.storage.ReadRecord(ctx, &proto.ReadRecordRequest{Id: source})
+	assert.NoError(t, err)
+	assert.Equal(t, "source secret", string(resp.Data))
+
+	resp, err = client.storage.ReadRecord(ctx, &proto.ReadRecordRequest{Id: target})
+	assert.NoError(t, err)
+	assert.Equal(t, "record could not be decrypted — master key may be incorrect", resp.Error)
+	assert.Empty(t, resp.Data)
+}
+
+func TestRecordMimeType(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	user, err := repo.CreateUser("mime", "hash")
+	assert.NoError(t, err)
+
+	tkn, err := getJWT(testJWTkey, user.ID, user.Login)
+	assert.NoError(t, err)
+	ctx = metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn)))
+
+	write := func(r *proto.WriteRecordRequest) int32 {
+		stream, err := client.storage.WriteRecord(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, stream.Send(r))
+		resp, err := stream.CloseAndRecv()
+		assert.NoError(t, err)
+
+		return resp.Id
+	}
+
+	png := write(&proto.WriteRecordRequest{Name: "photo.png", Type: "file", Data: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")})
+	pdf := write(&proto.WriteRecordRequest{Name: "report.pdf", Type: "file", Data: []byte("%PDF-1.7\n")})
+	yaml := write(&proto.WriteRecordRequest{Name: "app.yaml", Type: "file", Data: []byte("a: 1\n"), MimeType: "application/x-yaml"})
+	text := write(&proto.WriteRecordRequest{Name: "note", Type: "text", Data: []byte("hello")})
+
+	for id, want := range map[int32]string{png: "image/png", pdf: "application/pdf", yaml: "application/x-yaml", text: ""} {
+		resp, err := client.storage.ReadRecord(ctx, &proto.ReadRecordRequest{Id: id})
+		assert.NoError(t, err)
+		assert.Equal(t, want, resp.MimeType)
+
+		meta, err := client.storage.ReadRecordMeta(ctx, &proto.ReadRecordMetaRequest{Id: id})
+		assert.NoError(t, err)
+		assert.Equal(t, want, meta.MimeType)
+	}
+
+	all, err := client.storage.ReadAllRecord(ctx, &proto.ReadAllRecordRequest{Type: "file"})
+	assert.NoError(t, err)
+	for _, u := range all.Units {
+		assert.NotEmpty(t, u.MimeType)
+	}
+
+	stream, err := client.storage.WriteRecord(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&proto.WriteRecordRequest{Name: "bad", Type: "file", Data: []byte("a"), MimeType: "not a type/"}))
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestRecordNameBytes(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	user, err := repo.CreateUser("name-bytes", "hash")
+	assert.NoError(t, err)
+
+	tkn, err := getJWT(testJWTkey, user.ID, user.Login)
+	assert.NoError(t, err)
+	ctx = metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn)))
+
+	write := func(name string) (*proto.WriteRecordResponse, error) {
+		stream, err := client.storage.WriteRecord(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, stream.Send(&proto.WriteRecordRequest{Name: name, Type: "file", Data: []byte("data")}))
+
+		return stream.CloseAndRecv()
+	}
+
+	// The names are returned byte for byte, whatever the characters
+	names := []string{`отчёт "q1" ✓.pdf`, "résumé final.txt", "emoji 🔑.bin", "back`tick$HOME.sh", "percent%20_%.txt"}
+	for _, name := range names {
+		written, err := write(name)
+		assert.NoError(t, err)
+
+		out, err := client.storage.ReadRecord(ctx, &proto.ReadRecordRequest{Id: written.Id})
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(name), []byte(out.Name))
+	}
+
+	all, err := client.storage.ReadAllRecord(ctx, &proto.ReadAllRecordRequest{Type: "file"})
+	assert.NoError(t, err)
+
+	listed := []string{}
+	for _, u := range all.Units {
+		listed = append(listed, u.Name)
+	}
+	assert.ElementsMatch(t, names, listed)
+
+	// Names leading out of the download directory of a client are rejected
+	for _, name := range []string{"../../etc/passwd", "/etc/passwd", "..", `..\boot.ini`} {
+		_, err := write(name)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), name)
+	}
+}
+
+func TestRecordUUIDs(t *testing.T) {
+	ctx := context.Background()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	alice, err := repo.CreateUser("uuid-alice", "hash")
+	assert.NoError(t, err)
+	bob, err := repo.CreateUser("uuid-bob", "hash")
+	assert.NoError(t, err)
+
+	userCtx := func(u *domain.User) context.Context {
+		tkn, err := getJWT(testJWTkey, u.ID, u.Login)
+		assert.NoError(t, err)
+
+		return metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn)))
+	}
+
+	write := func(client clients, ctx context.Context, name string) *proto.WriteRecordResponse {
+		stream, err := client.storage.WriteRecord(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, stream.Send(&proto.WriteRecordRequest{Name: name, Type: "text", Data: []byte(name)}))
+		resp, err := stream.CloseAndRecv()
+		assert.NoError(t, err)
+
+		return resp
+	}
+
+	// A record written with the sequential IDs has no UUID
+	intClient, closeInt := testServer(ctx)
+	defer closeInt()
+
+	old := write(intClient, userCtx(alice), "old")
+	assert.NotZero(t, old.Id)
+	assert.Empty(t, old.Uid)
+
+	// Switching to UUIDs gives the old records a UUID as well
+	_, err = services.NewStorageService(repo).AssignRecordUIDs()
+	assert.NoError(t, err)
+
+	client, closer := testServer(ctx, func(h *handler.StorageHandler) {
+		h.RecordIDs = domain.RecordIDsUUID
+	})
+	defer closer()
+
+	written := write(client, userCtx(alice), "new")
+	assert.Zero(t, written.Id)
+	assert.NoError(t, uuid.Validate(written.Uid))
+
+	all, err := client.storage.ReadAllRecord(userCtx(alice), &proto.ReadAllRecordRequest{})
+	assert.NoError(t, err)
+
+	uids := map[string]string{}
+	for _, u := range all.Units {
+		assert.Zero(t, u.Id)
+		uids[u.Name] = u.Uid
+	}
+	assert.Equal(t, written.Uid, uids["new"])
+	assert.NotEmpty(t, uids["old"])
+
+	out, err := client.storage.ReadRecord(userCtx(alice), &proto.ReadRecordRequest{Uid: uids["old"]})
+	assert.NoError(t, err)
+	assert.Equal(t, "old", string(out.Data))
+	assert.Zero(t, out.Id)
+
+	// The sequential IDs are not accepted
+	_, err = client.storage.ReadRecord(userCtx(alice), &proto.ReadRecordRequest{Id: old.Id})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// The UUIDs are scoped by the owner
+	out, err = client.storage.ReadRecord(userCtx(bob), &proto.ReadRecordRequest{Uid: written.Uid})
+	assert.NoError(t, err)
+	assert.Equal(t, "record not found", out.Error)
+
+	deleted, err := client.storage.DeleteRecord(userCtx(bob), &proto.DeleteRecordRequest{Uid: written.Uid})
+	assert.NoError(t, err)
+	assert.Empty(t, deleted.Error)
+
+	out, err = client.storage.ReadRecord(userCtx(alice), &proto.ReadRecordRequest{Uid: written.Uid})
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(out.Data))
+
+	// The owner updates and deletes by UUID
+	stream, err := client.storage.UpdateRecord(userCtx(alice))
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&proto.UpdateRecordRequest{Uid: written.Uid, Version: 1, Name: "new", Type: "text", Data: []byte("newer")}))
+	updated, err := stream.CloseAndRecv()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), updated.Version)
+
+	deleted, err = client.storage.DeleteRecord(userCtx(alice), &proto.DeleteRecordRequest{Uid: written.Uid})
+	assert.NoError(t, err)
+	assert.Empty(t, deleted.Error)
+
+	out, err = client.storage.ReadRecord(userCtx(alice), &proto.ReadRecordRequest{Uid: written.Uid})
+	assert.NoError(t, err)
+	assert.Equal(t, "record not found", out.Error)
+
+	// The sequential IDs keep working with the default scheme
+	out, err = intClient.storage.ReadRecord(userCtx(alice), &proto.ReadRecordRequest{Id: old.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, "old", string(out.Data))
+	assert.Equal(t, old.Id, out.Id)
+	assert.Empty(t, out.Uid)
+}
+
+func TestRecordFolders(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	user, err := repo.CreateUser("folder-reader", "hash")
+	assert.NoError(t, err)
+
+	tkn, err := getJWT(testJWTkey, user.ID, user.Login)
+	assert.NoError(t, err)
+	ctx = metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn)))
+
+	records := []*proto.WriteRecordRequest{
+		{Name: "prod key", Folder: "work/aws/prod"},
+		{Name: "aws root", Folder: "work/aws"},
+		{Name: "old aws", Folder: "work/aws-old"},
+		{Name: "gitlab", Folder: "work"},
+		{Name: "underscore", Folder: "wo_k"},
+		{Name: "bank", Folder: "home"},
+		{Name: "loose"},
+	}
+	for _, r := range records {
+		r.Type, r.Data = "text", []byte("secret")
+
+		stream, err := client.storage.WriteRecord(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, stream.Send(r))
+		_, err = stream.CloseAndRecv()
+		assert.NoError(t, err)
+	}
+
+	names := func(folder string) []string {
+		out, err := client.storage.ReadAllRecord(ctx, &proto.ReadAllRecordRequest{Folder: folder, Sort: "name"})
+		assert.NoError(t, err)
+
+		var names []string
+		for _, u := range out.Units {
+			names = append(names, u.Name)
+		}
+
+		return names
+	}
+
+	// A folder lists its nested folders, but not the folders sharing its prefix
+	assert.Equal(t, []string{"aws root", "prod key"}, names("work/aws"))
+	assert.Equal(t, []string{"prod key"}, names("work/aws/prod"))
+	assert.Equal(t, []string{"aws root", "gitlab", "old aws", "prod key"}, names("work"))
+	assert.Equal(t, []string{"underscore"}, names("wo_k"))
+	assert.Empty(t, names("work/gcp"))
+	assert.Len(t, names(""), len(records))
+
+	out, err := client.storage.ReadAllRecord(ctx, &proto.ReadAllRecordRequest{Folder: "work/aws/prod"})
+	assert.NoError(t, err)
+	assert.Equal(t, "work/aws/prod", out.Units[0].Folder)
+
+	meta, err := client.storage.ReadRecordMeta(ctx, &proto.ReadRecordMetaRequest{Id: out.Units[0].Id})
+	assert.NoError(t, err)
+	assert.Equal(t, "work/aws/prod", meta.Folder)
+
+	// A folder with a wrong syntax is rejected
+	for _, folder := range []string{"/work", "work/", "work//aws", "work/../home"} {
+		_, err = client.storage.ReadAllRecord(ctx, &proto.ReadAllRecordRequest{Folder: folder})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), folder)
+
+		stream, err := client.storage.WriteRecord(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, stream.Send(&proto.WriteRecordRequest{Name: "bad", Type: "text", Data: []byte("secret"), Folder: folder}))
+		_, err = stream.CloseAndRecv()
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), folder)
+	}
+}
+
+func TestTransferRecord(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	sender, err := repo.CreateUser("transfer-sender", "hash")
+	assert.NoError(t, err)
+	recipient, err := repo.CreateUser("transfer-recipient", "hash")
+	assert.NoError(t, err)
+
+	userCtx := func(u *domain.User) context.Context {
+		tkn, err := getJWT(testJWTkey, u.ID, u.Login)
+		assert.NoError(t, err)
+
+		return metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn)))
+	}
+
+	stream, err := client.storage.WriteRecord(userCtx(sender))
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&proto.WriteRecordRequest{Name: "handover", Type: "text", Data: []byte("v1")}))
+	written, err := stream.CloseAndRecv()
+	assert.NoError(t, err)
+
+	// A previous version moves with the record
+	update, err := client.storage.UpdateRecord(userCtx(sender))
+	assert.NoError(t, err)
+	assert.NoError(t, update.Send(&proto.UpdateRecordRequest{Id: written.Id, Version: 1, Name: "handover", Type: "text", Data: []byte("v2")}))
+	_, err = update.CloseAndRecv()
+	assert.NoError(t, err)
+
+	out, err := client.storage.TransferRecord(userCtx(sender), &proto.TransferRecordRequest{Id: written.Id, Login: "unknown"})
+	assert.NoError(t, err)
+	assert.Equal(t, "user not found", out.Error)
+
+	// Only the owner hands the record over
+	out, err = client.storage.TransferRecord(userCtx(recipient), &proto.TransferRecordRequest{Id: written.Id, Login: "transfer-recipient"})
+	assert.NoError(t, err)
+	assert.Equal(t, "record not found", out.Error)
+
+	out, err = client.storage.TransferRecord(userCtx(sender), &proto.TransferRecordRequest{Id: written.Id, Login: "transfer-recipient"})
+	assert.NoError(t, err)
+	assert.Empty(t, out.Error)
+
+	read, err := client.storage.ReadRecord(userCtx(sender), &proto.ReadRecordRequest{Id: written.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, "record not found", read.Error)
+
+	read, err = client.storage.ReadRecord(userCtx(recipient), &proto.ReadRecordRequest{Id: written.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", string(read.Data))
+
+	read, err = client.storage.ReadRecord(userCtx(recipient), &proto.ReadRecordRequest{Id: written.Id, Version: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", string(read.Data))
+}
+
+func TestEncryptedNames(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx, func(h *handler.StorageHandler) {
+		h.EncryptNames = true
+	})
+	defer closer()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	user, err := repo.CreateUser("encrypted-names", "hash")
+	assert.NoError(t, err)
+
+	tkn, err := getJWT(testJWTkey, user.ID, user.Login)
+	assert.NoError(t, err)
+	ctx = metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn)))
+
+	stream, err := client.storage.WriteRecord(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&proto.WriteRecordRequest{Name: "My Bank Password", Type: "text", Data: []byte("v1")}))
+	written, err := stream.CloseAndRecv()
+	assert.NoError(t, err)
+
+	update, err := client.storage.UpdateRecord(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, update.Send(&proto.UpdateRecordRequest{Id: written.Id, Version: 1, Name: "My Card PIN", Type: "text", Data: []byte("v2")}))
+	_, err = update.CloseAndRecv()
+	assert.NoError(t, err)
+
+	// The names are not stored in plaintext
+	sqlDB, err := sql.Open("postgres", databaseURL)
+	assert.NoError(t, err)
+	defer sqlDB.Close()
+
+	var name, versionName string
+	assert.NoError(t, sqlDB.QueryRow("SELECT name FROM storages WHERE id = $1", written.Id).Scan(&name))
+	assert.NoError(t, sqlDB.QueryRow("SELECT name FROM storage_versions WHERE record_id = $1", written.Id).Scan(&versionName))
+	assert.NotContains(t, name, "Card")
+	assert.NotContains(t, versionName, "Bank")
+
+	// The server decrypts the names
+	all, err := client.storage.ReadAllRecord(ctx, &proto.ReadAllRecordRequest{})
+	assert.NoError(t, err)
+	if assert.Len(t, all.Units, 1) {
+		assert.Equal(t, "My Card PIN", all.Units[0].Name)
+	}
+
+	read, err := client.storage.ReadRecord(ctx, &proto.ReadRecordRequest{Id: written.Id, Version: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "My Bank Password", read.Name)
+
+	many, err := client.storage.ReadRecords(ctx, &proto.ReadRecordsRequest{Ids: []int32{written.Id}})
+	assert.NoError(t, err)
+	assert.Equal(t, "My Card PIN", many.Records[0].Name)
+}
+
+func TestReadAllRecordPages(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	user, err := repo.CreateUser("paged-reader", "hash")
+	assert.NoError(t, err)
+
+	tkn, err := getJWT(testJWTkey, user.ID, user.Login)
+	assert.NoError(t, err)
+	ctx = metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn)))
+
+	for i := 0; i < 5; i++ {
+		stream, err := client.storage.WriteRecord(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, stream.Send(&proto.WriteRecordRequest{Name: fmt.Sprintf("page-%d", i), Type: "text", Data: []byte("data")}))
+		_, err = stream.CloseAndRecv()
+		assert.NoError(t, err)
+	}
+
+	var names []string
+	token := ""
+	pages := 0
+	for {
+		page, err := client.storage.ReadAllRecord(ctx, &proto.ReadAllRecordRequest{PageSize: 2, PageToken: token})
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, len(page.Units), 2)
+
+		for _, u := range page.Units {
+			names = append(names, u.Name)
+		}
+
+		pages++
+		if page.NextPageToken == "" {
+			break
+		}
+
+		token = page.NextPageToken
+	}
+
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, []string{"page-0", "page-1", "page-2", "page-3", "page-4"}, names)
+
+	_, err = client.storage.ReadAllRecord(ctx, &proto.ReadAllRecordRequest{PageSize: 2, PageToken: "invalid!"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.storage.ReadAllRecord(ctx, &proto.ReadAllRecordRequest{PageSize: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestReadAllRecordSort(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	user, err := repo.CreateUser("sorted-reader", "hash")
+	assert.NoError(t, err)
+
+	tkn, err := getJWT(testJWTkey, user.ID, user.Login)
+	assert.NoError(t, err)
+	ctx = metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn)))
+
+	day := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	recs := []domain.Storage{
+		{Name: "delta", Type: "text", CreatedAt: day.Add(3 * time.Hour), AccessedAt: day.Add(time.Hour)},
+		{Name: "alpha", Type: "file", CreatedAt: day.Add(time.Hour), AccessedAt: day.Add(5 * time.Hour)},
+		{Name: "echo", Type: "text", CreatedAt: day.Add(5 * time.Hour), AccessedAt: day.Add(2 * time.Hour)},
+		{Name: "charlie", Type: "credentials", CreatedAt: day.Add(2 * time.Hour), AccessedAt: day.Add(4 * time.Hour)},
+		{Name: "bravo", Type: "text", CreatedAt: day.Add(4 * time.Hour), AccessedAt: day.Add(3 * time.Hour)},
+	}
+	for i := range recs {
+		recs[i].Value, recs[i].Key, recs[i].Owner = "value", "key", user.ID
+		recs[i].ID, err = repo.WriteRecord(recs[i])
+		assert.NoError(t, err)
+	}
+
+	keys := map[string]func(r domain.Storage) string{
+		domain.SortName:         func(r domain.Storage) string { return r.Name },
+		domain.SortType:         func(r domain.Storage) string { return r.Type },
+		domain.SortCreatedAt:    func(r domain.Storage) string { return r.CreatedAt.Format(time.RFC3339) },
+		domain.SortLastAccessed: func(r domain.Storage) string { return r.AccessedAt.Format(time.RFC3339) },
+	}
+
+	for _, sortKeys := range [][]string{{domain.SortName}, {domain.SortType}, {domain.SortCreatedAt}, {domain.SortLastAccessed}, {domain.SortType, domain.SortName}} {
+		for _, desc := range []bool{false, true} {
+			sortBy := strings.Join(sortKeys, ",")
+			t.Run(fmt.Sprintf("%s desc %v", sortBy, desc), func(t *testing.T) {
+				want := append([]domain.Storage{}, recs...)
+				sort.SliceStable(want, func(i, j int) bool {
+					a, b := want[i], want[j]
+					if desc {
+						a, b = b, a
+					}
+					for _, key := range sortKeys {
+						if ka, kb := keys[key](a), keys[key](b); ka != kb {
+							return ka < kb
+						}
+					}
+					return a.ID < b.ID
+				})
+
+				var wantIDs, ids []int32
+				for _, r := range want {
+					wantIDs = append(wantIDs, int32(r.ID))
+				}
+
+				token := ""
+				for {
+					page, err := client.storage.ReadAllRecord(ctx, &proto.ReadAllRecordRequest{Sort: sortBy, Desc: desc, PageSize: 2, PageToken: token})
+					if !assert.NoError(t, err) {
+						return
+					}
+
+					for _, u := range page.Units {
+						ids = append(ids, u.Id)
+					}
+
+					if page.NextPageToken == "" {
+						break
+					}
+					token = page.NextPageToken
+				}
+
+				assert.Equal(t, wantIDs, ids)
+
+				// The list without pages has the same order
+				all, err := client.storage.ReadAllRecord(ctx, &proto.ReadAllRecordRequest{Sort: sortBy, Desc: desc})
+				if !assert.NoError(t, err) {
+					return
+				}
+				ids = nil
+				for _, u := range all.Units {
+					ids = append(ids, u.Id)
+				}
+				assert.Equal(t, wantIDs, ids)
+			})
+		}
+	}
+
+	_, err = client.storage.ReadAllRecord(ctx, &proto.ReadAllRecordRequest{Sort: "owner"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.storage.ReadAllRecord(ctx, &proto.ReadAllRecordRequest{Sort: "name desc; DROP TABLE storages"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// A token of another sort is rejected
+	page, err := client.storage.ReadAllRecord(ctx, &proto.ReadAllRecordRequest{Sort: domain.SortName, PageSize: 2})
+	assert.NoError(t, err)
+	_, err = client.storage.ReadAllRecord(ctx, &proto.ReadAllRecordRequest{Sort: domain.SortType, PageSize: 2, PageToken: page.NextPageToken})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestRecordFilters(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	user, err := repo.CreateUser("filtered-reader", "hash")
+	assert.NoError(t, err)
+
+	tkn, err := getJWT(testJWTkey, user.ID, user.Login)
+	assert.NoError(t, err)
+	ctx = metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn)))
+
+	records := []*proto.WriteRecordRequest{
+		{Name: "Mail", Type: "credentials", Category: "work", Meta: map[string]string{"env": "prod", "team": "ops"}},
+		{Name: "mailbox", Type: "text", Category: "work", Meta: map[string]string{"env": "dev"}},
+		{Name: "100% bank", Type: "card", Category: "home", Meta: map[string]string{"env": "prod"}},
+		{Name: "100 bank", Type: "card", Category: "home"},
+	}
+	for _, r := range records {
+		r.Data = []byte("secret")
+
+		stream, err := client.storage.WriteRecord(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, stream.Send(r))
+		_, err = stream.CloseAndRecv()
+		assert.NoError(t, err)
+	}
+
+	names := func(in *proto.ReadAllRecordRequest) []string {
+		out, err := client.storage.ReadAllRecord(ctx, in)
+		assert.NoError(t, err)
+
+		var names []string
+		for _, u := range out.Units {
+			names = append(names, u.Name)
+		}
+
+		return names
+	}
+
+	assert.Equal(t, []string{"100% bank", "100 bank"}, names(&proto.ReadAllRecordRequest{Type: "card"}))
+	assert.Equal(t, []string{"Mail", "mailbox"}, names(&proto.ReadAllRecordRequest{Category: "work"}))
+	assert.Equal(t, []string{"Mail", "100% bank"}, names(&proto.ReadAllRecordRequest{Tags: map[string]string{"env": "prod"}}))
+	assert.Equal(t, []string{"Mail"}, names(&proto.ReadAllRecordRequest{Tags: map[string]string{"env": "prod", "team": "ops"}}))
+	assert.Equal(t, []string{"100% bank"}, names(&proto.ReadAllRecordRequest{Type: "card", Tags: map[string]string{"env": "prod"}}))
+	assert.Equal(t, []string{"Mail", "mailbox"}, names(&proto.ReadAllRecordRequest{Name: "MAIL"}))
+	assert.Equal(t, []string{"mailbox"}, names(&proto.ReadAllRecordRequest{Name: "mail", Type: "text"}))
+	assert.Equal(t, []string{"100% bank"}, names(&proto.ReadAllRecordRequest{Name: "0%"}))
+	assert.Empty(t, names(&proto.ReadAllRecordRequest{Name: "_"}))
+
+	// The secret data is encrypted, so it can't be matched by the filters
+	assert.Empty(t, names(&proto.ReadAllRecordRequest{Name: "secret"}))
+
+	encrypted, closeEncrypted := testServer(context.Background(), func(h *handler.StorageHandler) {
+		h.EncryptNames = true
+	})
+	defer closeEncrypted()
+
+	_, err = encrypted.storage.ReadAllRecord(ctx, &proto.ReadAllRecordRequest{Name: "mail"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestTagRecords(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	user, err := repo.CreateUser("tagger", "hash")
+	assert.NoError(t, err)
+
+	tkn, err := getJWT(testJWTkey, user.ID, user.Login)
+	assert.NoError(t, err)
+	ctx = metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn)))
+
+	records := []*proto.WriteRecordRequest{
+		{Name: "Mail", Type: "credentials", Category: "home", Meta: map[string]string{"env": "dev", "team": "ops"}},
+		{Name: "mailbox", Type: "credentials"},
+		{Name: "mail notes", Type: "text", Category: "home"},
+		{Name: "bank", Type: "credentials", Category: "home"},
+	}
+	for _, r := range records {
+		r.Data = []byte("secret")
+
+		stream, err := client.storage.WriteRecord(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, stream.Send(r))
+		_, err = stream.CloseAndRecv()
+		assert.NoError(t, err)
+	}
+
+	out, err := client.storage.TagRecords(ctx, &proto.TagRecordsRequest{
+		Type:        "credentials",
+		Name:        "mail",
+		SetMeta:     map[string]string{"env": "prod"},
+		SetCategory: "work",
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, out.Error)
+	assert.Equal(t, int32(2), out.Updated)
+
+	all, err := client.storage.ReadAllRecord(ctx, &proto.ReadAllRecordRequest{})
+	assert.NoError(t, err)
+
+	units := make(map[string]*proto.StorageUnit)
+	for _, u := range all.Units {
+		units[u.Name] = u
+	}
+
+	// The tags are merged with the tags of the records
+	assert.Equal(t, map[string]string{"env": "prod", "team": "ops"}, units["Mail"].Meta)
+	assert.Equal(t, "work", units["Mail"].Category)
+	assert.Equal(t, map[string]string{"env": "prod"}, units["mailbox"].Meta)
+	assert.Equal(t, "work", units["mailbox"].Category)
+
+	// The records out of the filter are untouched
+	assert.Empty(t, units["mail notes"].Meta)
+	assert.Equal(t, "home", units["mail notes"].Category)
+	assert.Empty(t, units["bank"].Meta)
+	assert.Equal(t, "home", units["bank"].Category)
+
+	_, err = client.storage.TagRecords(ctx, &proto.TagRecordsRequest{SetCategory: "work"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.storage.TagRecords(ctx, &proto.TagRecordsRequest{Type: "credentials"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestDeleteOlderThan(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	alice, err := repo.CreateUser("retention-alice", "hash")
+	assert.NoError(t, err)
+	bob, err := repo.CreateUser("retention-bob", "hash")
+	assert.NoError(t, err)
+
+	old := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	cutoff := old.AddDate(1, 0, 0)
+
+	write := func(owner int, created time.Time) int {
+		id, err := repo.WriteRecord(domain.Storage{
+			Name: "retention", Type: "text", Value: "value", Key: "key", Owner: owner,
+			CreatedAt: created, AccessedAt: created,
+		})
+		assert.NoError(t, err)
+
+		return id
+	}
+	exists := func(id int, owner int) bool {
+		rec, err := repo.ReadRecord(id, owner)
+		assert.NoError(t, err)
+
+		return rec != nil
+	}
+
+	oldAlice := write(alice.ID, old)
+	accessedAlice := write(alice.ID, old)
+	newAlice := write(alice.ID, time.Now())
+	oldBob := write(bob.ID, old)
+	assert.NoError(t, repo.TouchRecords([]int{accessedAlice}, time.Now()))
+
+	// The admin service needs no token
+	out, err := client.admin.DeleteOlderThan(adminContext(ctx), &proto.DeleteOlderThanRequest{
+		Cutoff: cutoff.Unix(), LastAccessed: true, Login: alice.Login, BatchSize: 1,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), out.Deleted)
+	assert.False(t, exists(oldAlice, alice.ID))
+	assert.True(t, exists(accessedAlice, alice.ID))
+	assert.True(t, exists(newAlice, alice.ID))
+	assert.True(t, exists(oldBob, bob.ID))
+
+	out, err = client.admin.DeleteOlderThan(adminContext(ctx), &proto.DeleteOlderThanRequest{Cutoff: cutoff.Unix(), Login: alice.Login})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), out.Deleted)
+	assert.False(t, exists(accessedAlice, alice.ID))
+	assert.True(t, exists(newAlice, alice.ID))
+	assert.True(t, exists(oldBob, bob.ID))
+
+	out, err = client.admin.DeleteOlderThan(adminContext(ctx), &proto.DeleteOlderThanRequest{Cutoff: cutoff.Unix()})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), out.Deleted)
+	assert.False(t, exists(oldBob, bob.ID))
+	assert.True(t, exists(newAlice, alice.ID))
+
+	// A read marks the record as accessed
+	assert.NoError(t, repo.TouchRecords([]int{newAlice}, old))
+	tkn, err := getJWT(testJWTkey, alice.ID, alice.Login)
+	assert.NoError(t, err)
+	userCtx := metadata.NewOutgoingContext(ctx, metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn)))
+	_, err = client.storage.ReadRecord(userCtx, &proto.ReadRecordRequest{Id: int32(newAlice)})
+	assert.NoError(t, err)
+
+	out, err = client.admin.DeleteOlderThan(adminContext(ctx), &proto.DeleteOlderThanRequest{Cutoff: cutoff.Unix(), LastAccessed: true, Login: alice.Login})
+	assert.NoError(t, err)
+	assert.Zero(t, out.Deleted)
+
+	_, err = client.admin.DeleteOlderThan(adminContext(ctx), &proto.DeleteOlderThanRequest{Cutoff: cutoff.Unix(), Login: "retention-nobody"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestReencryptAll(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer repo.Close()
+
+	user, err := repo.CreateUser("reencrypt", "hash")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tkn, err := getJWT(testJWTkey, user.ID, user.Login)
+	assert.NoError(t, err)
+	userCtx := metadata.NewOutgoingContext(ctx, metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn)))
+
+	ids := make([]int32, 0, 3)
+	for _, data := range []string{"first", "second", "third"} {
+		stream, err := client.storage.WriteRecord(userCtx)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NoError(t, stream.Send(&proto.WriteRecordRequest{Name: data, Type: "text", Data: []byte(data)}))
+
+		out, err := stream.CloseAndRecv()
+		if !assert.NoError(t, err) {
+			return
+		}
+		ids = append(ids, out.Id)
+	}
+
+	// A record with history, its previous version is re-encrypted too
+	stream, err := client.storage.WriteRecord(userCtx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, stream.Send(&proto.WriteRecordRequest{Name: "history", Type: "text", Data: []byte("old")}))
+
+	written, err := stream.CloseAndRecv()
+	if !assert.NoError(t, err) {
+		return
+	}
+	update, err := client.storage.UpdateRecord(userCtx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, update.Send(&proto.UpdateRecordRequest{Id: written.Id, Version: 1, Name: "history", Type: "text", Data: []byte("new")}))
+	_, err = update.CloseAndRecv()
+	assert.NoError(t, err)
+
+	// The records of other tests are skipped
+	out, err := client.admin.ReencryptAll(adminContext(ctx), &proto.ReencryptAllRequest{BatchSize: 2, AfterId: ids[0] - 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), out.Reencrypted)
+	assert.Empty(t, out.FailedIds)
+	assert.Equal(t, written.Id, out.LastId)
+	assert.GreaterOrEqual(t, out.ReencryptedVersions, int64(1))
+	for _, v := range out.FailedVersions {
+		assert.NotEqual(t, written.Id, v.Id)
+	}
+
+	prev, err := repo.ReadRecordVersion(int(written.Id), user.ID, 1)
+	if assert.NoError(t, err) && assert.NotNil(t, prev) {
+		assert.Equal(t, handler.AlgorithmChaCha20Poly1305, prev.Algorithm)
+	}
+
+	read, err := client.storage.ReadRecord(userCtx, &proto.ReadRecordRequest{Id: written.Id, Version: 1})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []byte("old"), read.Data)
+	}
+
+	for i, data := range []string{"first", "second", "third"} {
+		rec, err := repo.ReadRecord(int(ids[i]), user.ID)
+		if assert.NoError(t, err) && assert.NotNil(t, rec) {
+			assert.Equal(t, handler.AlgorithmChaCha20Poly1305, rec.Algorithm)
+			assert.Equal(t, 1, rec.Version)
+		}
+
+		read, err := client.storage.ReadRecord(userCtx, &proto.ReadRecordRequest{Id: ids[i]})
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(data), read.Data)
+	}
+
+	// The re-encrypted records are not read again
+	out, err = client.admin.ReencryptAll(adminContext(ctx), &proto.ReencryptAllRequest{AfterId: ids[0] - 1})
+	assert.NoError(t, err)
+	assert.Zero(t, out.Reencrypted)
+	assert.Zero(t, out.ReencryptedVersions)
+}
+
+func TestRepairRecordTypes(t *testing.T) {
+	ctx := context.Background()
+
+	client, closer := testServer(ctx)
+	defer closer()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer repo.Close()
+
+	user, err := repo.CreateUser("repair-types", "hash")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tkn, err := getJWT(testJWTkey, user.ID, user.Login)
+	assert.NoError(t, err)
+	userCtx := metadata.NewOutgoingContext(ctx, metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn)))
+
+	// Records with an empty or unknown type written by old clients
+	records := []*proto.WriteRecordRequest{
+		{Name: "note", Data: []byte("remember the milk")},
+		{Name: "bank", Data: []byte(`{"login":"alice","password":"secret"}`)},
+		{Name: "photo", Type: "image", Data: []byte{0xff, 0xd8, 0xff, 0xe0}},
+		{Name: "valid", Type: "text", Data: []byte("fine")},
+	}
+
+	ids := make([]int32, 0, len(records))
+	for _, rec := range records {
+		stream, err := client.storage.WriteRecord(userCtx)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NoError(t, stream.Send(rec))
+
+		out, err := stream.CloseAndRecv()
+		if !assert.NoError(t, err) {
+			return
+		}
+		ids = append(ids, out.Id)
+	}
+
+	// The report doesn't change the records
+	out, err := client.admin.RepairRecordTypes(adminContext(ctx), &proto.RepairRecordTypesRequest{AfterId: ids[0] - 1, BatchSize: 2})
+	if !assert.NoError(t, err) || !assert.Len(t, out.Issues, 3) {
+		return
+	}
+	for i, exp := range []string{"text", "credentials", "file"} {
+		assert.Equal(t, ids[i], out.Issues[i].Id)
+		assert.Equal(t, records[i].Type, out.Issues[i].Type)
+		assert.Equal(t, exp, out.Issues[i].InferredType)
+		assert.False(t, out.Issues[i].Repaired)
+		assert.Empty(t, out.Issues[i].Error)
+	}
+
+	rec, err := repo.ReadRecord(int(ids[0]), user.ID)
+	if assert.NoError(t, err) && assert.NotNil(t, rec) {
+		assert.Empty(t, rec.Type)
+	}
+
+	out, err = client.admin.RepairRecordTypes(adminContext(ctx), &proto.RepairRecordTypesRequest{AfterId: ids[0] - 1, Repair: true})
+	if assert.NoError(t, err) && assert.Len(t, out.Issues, 3) {
+		for _, issue := range out.Issues {
+			assert.True(t, issue.Repaired)
+		}
+	}
+
+	for i, exp := range []string{"text", "credentials", "file", "text"} {
+		rec, err := repo.ReadRecord(int(ids[i]), user.ID)
+		if assert.NoError(t, err) && assert.NotNil(t, rec) {
+			assert.Equal(t, exp, rec.Type)
+		}
+	}
+
+	out, err = client.admin.RepairRecordTypes(adminContext(ctx), &proto.RepairRecordTypesRequest{AfterId: ids[0] - 1})
+	assert.NoError(t, err)
+	assert.Empty(t, out.Issues)
+}
+
+func TestWebhookEvents(t *testing.T) {
+	ctx := context.Background()
+
+	events := make(chan webhook.Event, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e webhook.Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err == nil {
+			events <- e
+		}
+	}))
+	defer receiver.Close()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	notifier := webhook.New(webhook.Config{URL: receiver.URL}, lg)
+	defer notifier.Close(ctx)
+
+	client, closer := testServer(ctx, func(s *handler.StorageHandler) {
+		s.Notifier = notifier
+	})
+	defer closer()
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	user, err := repo.CreateUser("webhook-user", "hash")
+	if !assert.NoError(t, err) {
+		return
+	}
+	tkn, err := getJWT(testJWTkey, user.ID, user.Login)
+	assert.NoError(t, err)
+	userCtx := metadata.NewOutgoingContext(ctx, metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn)))
+
+	next := func() webhook.Event {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("webhook event not received")
+		}
+
+		return webhook.Event{}
+	}
+
+	stream, err := client.storage.WriteRecord(userCtx)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&proto.WriteRecordRequest{Name: "webhook", Type: "text", Data: []byte("secret")}))
+	out, err := stream.CloseAndRecv()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	e := next()
+	assert.Equal(t, webhook.EventWrite, e.Event)
+	assert.Equal(t, out.Id, e.RecordID)
+	assert.Equal(t, user.ID, e.UserID)
+
+	_, err = client.storage.ReadRecord(userCtx, &proto.ReadRecordRequest{Id: out.Id})
+	assert.NoError(t, err)
+
+	e = next()
+	assert.Equal(t, webhook.EventRead, e.Event)
+	assert.Equal(t, out.Id, e.RecordID)
+}
+
+func TestWebAuthnCredentials(t *testing.T) {
+	ctx := context.Background()
+
+	lg, err := logger.Init("error")
+	assert.NoError(t, err)
+
+	repo, err := repository.NewDB(ctx, lg, databaseURL, "")
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	user, err := repo.CreateUser("passkey-owner", "hash")
+	assert.NoError(t, err)
+
+	cred := &domain.WebAuthnCredential{UserID: user.ID, CredentialID: []byte("credential"), Data: []byte(`{"counter":1}`)}
+	assert.NoError(t, repo.CreateWebAuthnCredential(cred))
+
+	// A credential is registered only once
+	assert.Error(t, repo.CreateWebAuthnCredential(&domain.WebAuthnCredential{UserID: user.ID, CredentialID: []byte("credential"), Data: []byte("{}")}))
+
+	assert.NoError(t, repo.UpdateWebAuthnCredential(user.ID, []byte("credential"), []byte(`{"counter":2}`)))
+	assert.ErrorIs(t, repo.UpdateWebAuthnCredential(user.ID+1, []byte("credential"), []byte("{}")), domain.ErrNotFound)
+
+	creds, err := repo.FindWebAuthnCredentials(user.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, creds, 1) {
+		assert.Equal(t, `{"counter":2}`, string(creds[0].Data))
+	}
+}
+
+/* UTILS. */
+// adminContext returns the context with a token of the admin scope for the
+// calls of the Admin service.
+func adminContext(ctx context.Context) context.Context {
+	tkn, err := handler.GetAdminJWT(testJWTkey)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	return metadata.NewOutgoingContext(ctx, metadata.Pairs("authorization", fmt.Sprintf("bearer %s", *tkn)))
+}
+
 func getJWT(jwtKey string, id int, login string) (*string, error) {
 	var DefaultSession = 30
 	var DefaultExpTime = time.Now().Add(time.Duration(DefaultSession) * time.Minute)
@@ -2,48 +2,108 @@ package client
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
+	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
 	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/golang-jwt/jwt/v5"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 var maxMsgSize = 100000648
 var errorResponseFinished = "response finished error: %w"
 var errorEesponseReturn = "response return error: %w"
+var reauthRequiredMessage = "reauthentication required"
+
+// preflightSize is the size in bytes from which a file is validated with the
+// server before it is uploaded.
+var preflightSize int64 = 1 << 20
+
+// ErrRecordRejected is returned when the server's validation rejects a record
+// before it is written.
+var ErrRecordRejected = errors.New("record rejected by server")
+
+// ConfirmationRequiredError is returned by the reads of a record requiring
+// confirmation. The record is read by `ReadFileConfirmed` with the challenge
+// once the user confirmed the read.
+type ConfirmationRequiredError struct {
+	ID        int32
+	Challenge string
+}
+
+func (e *ConfirmationRequiredError) Error() string {
+	return fmt.Sprintf("record %v requires confirmation before read", e.ID)
+}
+
+// ErrFingerprintMismatch is returned when the server certificate does not
+// have the configured fingerprint.
+var ErrFingerprintMismatch = errors.New("server certificate fingerprint mismatch")
 
 type Client struct {
 	Conn  *grpc.ClientConn
 	Token string
+	// rateLimit keeps the quota reported with the calls of the connection.
+	rateLimit *rateLimitTracker
+	// refresher refreshes the token with `WithAutoRefresh` or
+	// `WithRefreshOnUnauthenticated`, nil otherwise.
+	refresher *tokenRefresher
 }
 
-func NewClient(addr string, certPath string, token string) (*Client, error) {
+func NewClient(addr string, certPath string, token string, opts ...Option) (*Client, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	// Get TLS cert
-	tlsCredentials, err := loadTLSCredentials(certPath)
+	tlsCredentials, err := loadTLSCredentials(certPath, o.fingerprint)
 	if err != nil {
 		return nil, fmt.Errorf("cannot load TLS credentials: %w", err)
 	}
 
-	// Connect to gRPC server
-	conn, err := grpc.Dial(
-		addr,
+	rateLimit := &rateLimitTracker{}
+	dialOptions := append([]grpc.DialOption{
 		grpc.WithTransportCredentials(tlsCredentials),
 		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxMsgSize), grpc.MaxCallSendMsgSize(maxMsgSize)),
-	)
+		grpc.WithChainUnaryInterceptor(rateLimit.unaryInterceptor),
+		grpc.WithChainStreamInterceptor(rateLimit.streamInterceptor),
+	}, o.dialOptions...)
+
+	var refresher *tokenRefresher
+	if o.refreshBefore > 0 || o.refreshRetry {
+		refresher = &tokenRefresher{before: o.refreshBefore, retry: o.refreshRetry, onRefresh: o.onRefresh}
+		dialOptions = append(dialOptions,
+			grpc.WithChainUnaryInterceptor(refresher.unaryInterceptor),
+			grpc.WithChainStreamInterceptor(refresher.streamInterceptor),
+		)
+	}
+
+	// Connect to gRPC server
+	conn, err := grpc.Dial(addr, dialOptions...)
 	if err != nil {
 		return nil, fmt.Errorf("failed start grpc server: %w", err)
 	}
 
 	return &Client{
-		Conn:  conn,
-		Token: token,
+		Conn:      conn,
+		Token:     token,
+		rateLimit: rateLimit,
+		refresher: refresher,
 	}, nil
 }
 
@@ -56,13 +116,42 @@ func (c Client) Close() error {
 	return nil
 }
 
-func (c Client) Register(login string, password string) (*proto.RegisterResponse, error) {
+func (c Client) Register(login string, password string, opts ...RegisterOption) (*proto.RegisterResponse, error) {
+	req := &proto.RegiserRequest{
+		Login:    login,
+		Password: password,
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+
 	// Create client
 	client := proto.NewUserClient(c.Conn)
-	resp, err := client.Register(context.Background(), &proto.RegiserRequest{
+	resp, err := client.Register(context.Background(), req)
+
+	if err != nil {
+		return nil, fmt.Errorf(errorResponseFinished, err)
+	}
+
+	if resp.Error != "" {
+		return nil, fmt.Errorf(errorEesponseReturn, resp.Error)
+	}
+
+	return resp, nil
+}
+
+func (c Client) Login(login string, password string, opts ...LoginOption) (*proto.LoginResponse, error) {
+	req := &proto.LoginRequest{
 		Login:    login,
 		Password: password,
-	})
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+
+	// Create client
+	client := proto.NewUserClient(c.Conn)
+	resp, err := client.Login(context.Background(), req)
 
 	if err != nil {
 		return nil, fmt.Errorf(errorResponseFinished, err)
@@ -75,12 +164,13 @@ func (c Client) Register(login string, password string) (*proto.RegisterResponse
 	return resp, nil
 }
 
-func (c Client) Login(login string, password string) (*proto.LoginResponse, error) {
+// Refresh exchanges the unexpired token of the client for a new token with a
+// new expiration time. The scope of the token is kept.
+func (c Client) Refresh() (*proto.RefreshResponse, error) {
 	// Create client
 	client := proto.NewUserClient(c.Conn)
-	resp, err := client.Login(context.Background(), &proto.LoginRequest{
-		Login:    login,
-		Password: password,
+	resp, err := client.Refresh(context.Background(), &proto.RefreshRequest{
+		Jwt: c.refresher.current(c.Token),
 	})
 
 	if err != nil {
@@ -94,14 +184,19 @@ func (c Client) Login(login string, password string) (*proto.LoginResponse, erro
 	return resp, nil
 }
 
-func (c Client) ReadAllFile() (*proto.ReadAllRecordResponse, error) {
+func (c Client) ReadAllFile(opts ...ListOption) (*proto.ReadAllRecordResponse, error) {
 	// Set authorization in gRPC metadata
 	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", c.Token))
 	ctx := metadata.NewOutgoingContext(context.Background(), md)
 
+	req := &proto.ReadAllRecordRequest{}
+	for _, opt := range opts {
+		opt(req)
+	}
+
 	// Create client
 	client := proto.NewStorageClient(c.Conn)
-	resp, err := client.ReadAllRecord(ctx, &proto.ReadAllRecordRequest{})
+	resp, err := client.ReadAllRecord(ctx, req)
 
 	if err != nil {
 		return nil, fmt.Errorf(errorResponseFinished, err)
@@ -131,11 +226,176 @@ func (c Client) ReadFile(id int32) (*proto.ReadRecordResponse, error) {
 	if resp.Error != "" {
 		return nil, fmt.Errorf(errorEesponseReturn, resp.Error)
 	}
+	if resp.ConfirmationRequired {
+		return nil, &ConfirmationRequiredError{ID: resp.Id, Challenge: resp.Challenge}
+	}
 
 	return resp, nil
 }
 
-func (c Client) WriteFile(typ string, name string, data string) (*proto.WriteRecordResponse, error) {
+// ReadFileConfirmed reads the record with the given ID requiring confirmation,
+// the challenge of the `ConfirmationRequiredError` confirms the read.
+func (c Client) ReadFileConfirmed(id int32, challenge string) (*proto.ReadRecordResponse, error) {
+	// Set authorization in gRPC metadata
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", c.Token))
+	ctx := metadata.NewOutgoingContext(context.Background(), md)
+
+	// Create client
+	client := proto.NewStorageClient(c.Conn)
+	resp, err := client.ReadRecord(ctx, &proto.ReadRecordRequest{
+		Id:           id,
+		Confirmation: challenge,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf(errorResponseFinished, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf(errorEesponseReturn, resp.Error)
+	}
+	if resp.ConfirmationRequired {
+		return nil, &ConfirmationRequiredError{ID: resp.Id, Challenge: resp.Challenge}
+	}
+
+	return resp, nil
+}
+
+// ReadFilePreview reads the record with the given ID, but only the first
+// `limit` bytes of its data are transferred. The size of the whole data is in `Size`.
+func (c Client) ReadFilePreview(id int32, limit int32) (*proto.ReadRecordResponse, error) {
+	// Set authorization in gRPC metadata
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", c.Token))
+	ctx := metadata.NewOutgoingContext(context.Background(), md)
+
+	// Create client
+	client := proto.NewStorageClient(c.Conn)
+	resp, err := client.ReadRecord(ctx, &proto.ReadRecordRequest{
+		Id:    id,
+		Limit: limit,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf(errorResponseFinished, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf(errorEesponseReturn, resp.Error)
+	}
+	if resp.ConfirmationRequired {
+		return nil, &ConfirmationRequiredError{ID: resp.Id, Challenge: resp.Challenge}
+	}
+
+	return resp, nil
+}
+
+// GetMeta reads the attributes of the record with the given ID without its
+// data, the server doesn't decrypt the data. The size of the data is in `Size`.
+func (c Client) GetMeta(id int32) (*proto.ReadRecordMetaResponse, error) {
+	// Set authorization in gRPC metadata
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", c.Token))
+	ctx := metadata.NewOutgoingContext(context.Background(), md)
+
+	// Create client
+	client := proto.NewStorageClient(c.Conn)
+	resp, err := client.ReadRecordMeta(ctx, &proto.ReadRecordMetaRequest{
+		Id: id,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf(errorResponseFinished, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf(errorEesponseReturn, resp.Error)
+	}
+
+	return resp, nil
+}
+
+// ReadMany reads several records in one call. The records are in the order
+// of the IDs, a record that was not found has only the ID and the error set.
+func (c Client) ReadMany(ids []int32) ([]*proto.ReadRecordResponse, error) {
+	// Set authorization in gRPC metadata
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", c.Token))
+	ctx := metadata.NewOutgoingContext(context.Background(), md)
+
+	// Create client
+	client := proto.NewStorageClient(c.Conn)
+	resp, err := client.ReadRecords(ctx, &proto.ReadRecordsRequest{
+		Ids: ids,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf(errorResponseFinished, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf(errorEesponseReturn, resp.Error)
+	}
+
+	return resp.Records, nil
+}
+
+// ReadFileVersion reads the given version of the record with the given ID.
+func (c Client) ReadFileVersion(id int32, version int32) (*proto.ReadRecordResponse, error) {
+	// Set authorization in gRPC metadata
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", c.Token))
+	ctx := metadata.NewOutgoingContext(context.Background(), md)
+
+	// Create client
+	client := proto.NewStorageClient(c.Conn)
+	resp, err := client.ReadRecord(ctx, &proto.ReadRecordRequest{
+		Id:      id,
+		Version: version,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf(errorResponseFinished, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf(errorEesponseReturn, resp.Error)
+	}
+	if resp.ConfirmationRequired {
+		return nil, &ConfirmationRequiredError{ID: resp.Id, Challenge: resp.Challenge}
+	}
+
+	return resp, nil
+}
+
+func (c Client) ReadCategories() (*proto.ReadCategoriesResponse, error) {
+	// Set authorization in gRPC metadata
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", c.Token))
+	ctx := metadata.NewOutgoingContext(context.Background(), md)
+
+	// Create client
+	client := proto.NewStorageClient(c.Conn)
+	resp, err := client.ReadCategories(ctx, &proto.ReadCategoriesRequest{})
+
+	if err != nil {
+		return nil, fmt.Errorf(errorResponseFinished, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf(errorEesponseReturn, resp.Error)
+	}
+
+	return resp, nil
+}
+
+func (c Client) WriteFile(typ string, name string, data string, opts ...WriteOption) (*proto.WriteRecordResponse, error) {
+	// Fail fast instead of sending the data to have it rejected
+	if err := domain.ValidateName(name, domain.DefaultMaxNameLength); err != nil {
+		//nolint:wrapcheck // This legal return
+		return nil, err
+	}
+
+	if err := validateData(typ, data); err != nil {
+		return nil, err
+	}
+
+	// Ask the server to check a large file before uploading it
+	if typ == "file" {
+		if err := c.preflightFile(name, data); err != nil {
+			return nil, err
+		}
+	}
+
 	// Set authorization in gRPC metadata
 	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", c.Token))
 	ctx := metadata.NewOutgoingContext(context.Background(), md)
@@ -147,36 +407,218 @@ func (c Client) WriteFile(typ string, name string, data string) (*proto.WriteRec
 		return nil, fmt.Errorf(errorResponseFinished, err)
 	}
 
-	var resp *proto.WriteRecordResponse
-	switch typ {
-	case "text":
-		// Send the gRPC data
-		err = stream.Send(&proto.WriteRecordRequest{Name: name, Data: []byte(data), Type: "text"})
-		if err != nil {
-			return nil, fmt.Errorf("stream send has error: %w", err)
+	// The key lets the server recognize a retried write and not duplicate the record
+	key, err := newIdempotencyKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed create idempotency key: %w", err)
+	}
+
+	err = sendData(typ, data, func(typ string, chunk []byte) error {
+		req := &proto.WriteRecordRequest{Name: name, Data: chunk, Type: typ, IdempotencyKey: key}
+		for _, opt := range opts {
+			opt(req)
 		}
 
-		// Close the stream and get a response
-		resp, err = stream.CloseAndRecv()
+		//nolint:wrapcheck // This legal return
+		return stream.Send(req)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Close the stream and get a response
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, fmt.Errorf("closed stream has error: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf(errorEesponseReturn, resp.Error)
+	}
+
+	return resp, nil
+}
+
+// ValidateFile asks the server whether it would accept the record without
+// storing it. When `data` is nil only the name and the size are checked.
+// The problems found are returned in the response.
+func (c Client) ValidateFile(typ string, name string, size int64, data []byte) (*proto.ValidateRecordResponse, error) {
+	// Set authorization in gRPC metadata
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", c.Token))
+	ctx := metadata.NewOutgoingContext(context.Background(), md)
+
+	// Create client
+	client := proto.NewStorageClient(c.Conn)
+	resp, err := client.ValidateRecord(ctx, &proto.ValidateRecordRequest{
+		Name: name,
+		Type: typ,
+		Data: data,
+		Size: size,
+	})
+	if err != nil {
+		return nil, fmt.Errorf(errorResponseFinished, err)
+	}
+
+	return resp, nil
+}
+
+// preflightFile validates the file at the path with the server before a
+// write when it is larger than preflightSize. A server without the
+// validation is not an error, the write itself is checked anyway.
+func (c Client) preflightFile(name string, path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed read stat file: %w", err)
+	}
+	if fi.Size() < preflightSize {
+		return nil
+	}
+
+	resp, err := c.ValidateFile("file", name, fi.Size(), nil)
+	if status.Code(err) == codes.Unimplemented {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !resp.Valid {
+		return fmt.Errorf("%w: %s", ErrRecordRejected, strings.Join(resp.Errors, "; "))
+	}
+
+	return nil
+}
+
+// UpdateFile replaces the data of the record with the given ID. The version
+// must be the current version of the record, otherwise the server rejects the
+// update with an `Aborted` status and the record should be read again.
+func (c Client) UpdateFile(id int32, version int32, typ string, name string, data string) (*proto.UpdateRecordResponse, error) {
+	if err := domain.ValidateName(name, domain.DefaultMaxNameLength); err != nil {
+		//nolint:wrapcheck // This legal return
+		return nil, err
+	}
+
+	if err := validateData(typ, data); err != nil {
+		return nil, err
+	}
+
+	// Set authorization in gRPC metadata
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", c.Token))
+	ctx := metadata.NewOutgoingContext(context.Background(), md)
+
+	// Create client
+	client := proto.NewStorageClient(c.Conn)
+	stream, err := client.UpdateRecord(ctx)
+	if err != nil {
+		return nil, fmt.Errorf(errorResponseFinished, err)
+	}
+
+	err = sendData(typ, data, func(typ string, chunk []byte) error {
+		//nolint:wrapcheck // This legal return
+		return stream.Send(&proto.UpdateRecordRequest{Id: id, Version: version, Name: name, Data: chunk, Type: typ})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Close the stream and get a response
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, fmt.Errorf("closed stream has error: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf(errorEesponseReturn, resp.Error)
+	}
+
+	return resp, nil
+}
+
+// UpdateMeta changes the metadata of the record with the given ID. With
+// `replace` the metadata is replaced by `set`, otherwise `set` is merged into
+// it. The `remove` keys are deleted in both cases.
+func (c Client) UpdateMeta(id int32, set map[string]string, remove []string, replace bool) (*proto.UpdateMetaResponse, error) {
+	// Set authorization in gRPC metadata
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", c.Token))
+	ctx := metadata.NewOutgoingContext(context.Background(), md)
+
+	// Create client
+	client := proto.NewStorageClient(c.Conn)
+	resp, err := client.UpdateMeta(ctx, &proto.UpdateMetaRequest{
+		Id:      id,
+		Meta:    set,
+		Remove:  remove,
+		Replace: replace,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf(errorResponseFinished, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf(errorEesponseReturn, resp.Error)
+	}
+
+	return resp, nil
+}
+
+// TagFiles merges the tags into the metadata of all records matching the
+// filter of the list options and sets their category, an empty category is
+// not changed. The server requires a filter. It returns the number of the
+// updated records.
+func (c Client) TagFiles(set map[string]string, category string, filter ...ListOption) (int32, error) {
+	// Set authorization in gRPC metadata
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", c.Token))
+	ctx := metadata.NewOutgoingContext(context.Background(), md)
+
+	// The filter has the fields of the list request
+	list := &proto.ReadAllRecordRequest{}
+	for _, opt := range filter {
+		opt(list)
+	}
+
+	// Create client
+	client := proto.NewStorageClient(c.Conn)
+	resp, err := client.TagRecords(ctx, &proto.TagRecordsRequest{
+		Category:    list.Category,
+		Type:        list.Type,
+		Tags:        list.Tags,
+		Name:        list.Name,
+		SetMeta:     set,
+		SetCategory: category,
+	})
+
+	if err != nil {
+		return 0, fmt.Errorf(errorResponseFinished, err)
+	}
+	if resp.Error != "" {
+		return 0, fmt.Errorf(errorEesponseReturn, resp.Error)
+	}
+
+	return resp.Updated, nil
+}
+
+// sendData sends the record data with the send function. Text and credentials
+// data is sent in a single chunk, while for the file type `data` is the path
+// of the file that is read and sent in chunks.
+func sendData(typ string, data string, send func(typ string, chunk []byte) error) error {
+	switch typ {
+	case "text", "credentials", "json":
+		// Send the gRPC data
+		err := send(typ, []byte(data))
 		if err != nil {
-			return nil, fmt.Errorf("closed stream has error: %w", err)
-		}
-		if resp.Error != "" {
-			return nil, fmt.Errorf(errorEesponseReturn, resp.Error)
+			return fmt.Errorf("stream send has error: %w", err)
 		}
 	case "file":
 		file, err := os.Open(data)
 		if err != nil {
-			return nil, fmt.Errorf("failed open file: %w", err)
+			return fmt.Errorf("failed open file: %w", err)
 		}
+		defer file.Close()
 
 		fi, err := file.Stat()
 		if err != nil {
-			return nil, fmt.Errorf("failed read stat file: %w", err)
+			return fmt.Errorf("failed read stat file: %w", err)
 		}
 
 		if fi.Size() > int64(maxMsgSize) {
-			return nil, fmt.Errorf("maximum file size should be less: %v bytes", maxMsgSize)
+			return fmt.Errorf("maximum file size should be less: %v bytes", maxMsgSize)
 		}
 
 		// Read the file in chunks and send
@@ -185,34 +627,23 @@ func (c Client) WriteFile(typ string, name string, data string) (*proto.WriteRec
 		for {
 			n, err := file.Read(buf)
 			if errors.Is(err, io.EOF) {
-				// End of file, close the stream
-				resp, err = stream.CloseAndRecv()
-				if err != nil {
-					return nil, fmt.Errorf("failed CloseAndRecv: %w", err)
-				}
-				if resp.Error != "" {
-					return nil, fmt.Errorf(errorEesponseReturn, resp.Error)
-				}
 				break
 			}
 			if err != nil {
-				return nil, fmt.Errorf("failed read file: %w", err)
+				return fmt.Errorf("failed read file: %w", err)
 			}
 
 			// Send a piece of data
-			err = stream.Send(&proto.WriteRecordRequest{Name: name, Data: buf[:n], Type: "file"})
+			err = send("file", buf[:n])
 			if err != nil {
-				return nil, fmt.Errorf("failed send stream: %w", err)
+				return fmt.Errorf("failed send stream: %w", err)
 			}
 		}
-
-		err = file.Close()
-		if err != nil {
-			return nil, fmt.Errorf("failed close file: %w", err)
-		}
+	default:
+		return fmt.Errorf("unsupported record type: %s", typ)
 	}
 
-	return resp, nil
+	return nil
 }
 
 //nolint:dupl // This legal duplicate
@@ -237,8 +668,126 @@ func (c Client) DeleteFile(id int32) (*proto.DeleteRecordResponse, error) {
 	return resp, nil
 }
 
-// loadTLSCredentials loading certificates.
-func loadTLSCredentials(cert string) (credentials.TransportCredentials, error) {
+// TransferFile makes the user with the login the owner of the record.
+// The record is removed from the vault of the client.
+func (c Client) TransferFile(id int32, login string) (*proto.TransferRecordResponse, error) {
+	// Set authorization in gRPC metadata
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", c.Token))
+	ctx := metadata.NewOutgoingContext(context.Background(), md)
+
+	// Create client
+	client := proto.NewStorageClient(c.Conn)
+	resp, err := client.TransferRecord(ctx, &proto.TransferRecordRequest{
+		Id:    id,
+		Login: login,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf(errorResponseFinished, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf(errorEesponseReturn, resp.Error)
+	}
+
+	return resp, nil
+}
+
+// ReadShares returns the records the user shared with the teams or, when
+// incoming is set, the records shared with the user.
+func (c Client) ReadShares(incoming bool) (*proto.ReadSharesResponse, error) {
+	// Set authorization in gRPC metadata
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", c.Token))
+	ctx := metadata.NewOutgoingContext(context.Background(), md)
+
+	// Create client
+	client := proto.NewStorageClient(c.Conn)
+	resp, err := client.ReadShares(ctx, &proto.ReadSharesRequest{
+		Incoming: incoming,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf(errorResponseFinished, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf(errorEesponseReturn, resp.Error)
+	}
+
+	return resp, nil
+}
+
+// RevokeShare stops sharing the record with its team.
+func (c Client) RevokeShare(id int32) (*proto.RevokeShareResponse, error) {
+	// Set authorization in gRPC metadata
+	md := metadata.Pairs("authorization", fmt.Sprintf("bearer %s", c.Token))
+	ctx := metadata.NewOutgoingContext(context.Background(), md)
+
+	// Create client
+	client := proto.NewStorageClient(c.Conn)
+	resp, err := client.RevokeShare(ctx, &proto.RevokeShareRequest{
+		Id: id,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf(errorResponseFinished, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf(errorEesponseReturn, resp.Error)
+	}
+
+	return resp, nil
+}
+
+// TokenInfo describes the token of the client.
+type TokenInfo struct {
+	Login string
+	Scope string
+}
+
+// TokenInfo returns the login and the scope the token was issued for.
+func (c Client) TokenInfo() (TokenInfo, error) {
+	claims, err := c.Claims()
+	if err != nil {
+		return TokenInfo{}, err
+	}
+
+	if claims.Login == "" {
+		return TokenInfo{}, fmt.Errorf("token has no login")
+	}
+
+	// A token without a scope has full access
+	return TokenInfo{Login: claims.Login, Scope: claims.Scope}, nil
+}
+
+// Claims returns the claims of the token, of the refreshed token with
+// `WithAutoRefresh`. The signature is not verified, only the server can do
+// it, and an expired token is parsed as well.
+func (c Client) Claims() (*middleware.JWTclaims, error) {
+	claims := &middleware.JWTclaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(c.refresher.current(c.Token), claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed parse token: %w", err)
+	}
+
+	return claims, nil
+}
+
+// IsReauthRequired reports whether the server rejected the call because the
+// password was entered too long ago. Logging in again issues a fresh token.
+func IsReauthRequired(err error) bool {
+	var gs interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &gs) {
+		return false
+	}
+
+	st := gs.GRPCStatus()
+
+	return st.Code() == codes.Unauthenticated && st.Message() == reauthRequiredMessage
+}
+
+// loadTLSCredentials trusts the server certificates signed by the CA. When the
+// fingerprint is set, the server certificate must also have this SHA-256
+// fingerprint, so a certificate issued by a compromised CA is rejected.
+func loadTLSCredentials(cert string, fingerprint string) (credentials.TransportCredentials, error) {
 	// Load certificate of the CA who signed server's certificate
 	pemServerCA, err := os.ReadFile(cert)
 	if err != nil {
@@ -256,5 +805,56 @@ func loadTLSCredentials(cert string) (credentials.TransportCredentials, error) {
 		MinVersion: tls.VersionTLS12,
 	}
 
+	if fingerprint != "" {
+		expected, err := parseFingerprint(fingerprint)
+		if err != nil {
+			return nil, err
+		}
+
+		config.VerifyPeerCertificate = verifyFingerprint(expected)
+	}
+
 	return credentials.NewTLS(config), nil
 }
+
+// parseFingerprint decodes a SHA-256 fingerprint in hex, the bytes may be
+// separated by colons as printed by openssl.
+func parseFingerprint(fingerprint string) ([]byte, error) {
+	b, err := hex.DecodeString(strings.ReplaceAll(fingerprint, ":", ""))
+	if err != nil {
+		return nil, fmt.Errorf("failed decode certificate fingerprint: %w", err)
+	}
+
+	if len(b) != sha256.Size {
+		return nil, fmt.Errorf("certificate fingerprint must be a SHA-256 hash of %v bytes", sha256.Size)
+	}
+
+	return b, nil
+}
+
+// verifyFingerprint checks that the certificate of the server has the expected fingerprint.
+func verifyFingerprint(expected []byte) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return ErrFingerprintMismatch
+		}
+
+		sum := sha256.Sum256(rawCerts[0])
+		if subtle.ConstantTimeCompare(sum[:], expected) != 1 {
+			return ErrFingerprintMismatch
+		}
+
+		return nil
+	}
+}
+
+// newIdempotencyKey generates a random key identifying a single write.
+func newIdempotencyKey() (string, error) {
+	//nolint:gomnd // This legal number
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed generate byte: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
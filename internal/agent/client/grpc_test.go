@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadTLSCredentialsFingerprint(t *testing.T) {
+	cert, certPath := testCertificate(t)
+
+	sum := sha256.Sum256(cert.Certificate[0])
+	fingerprint := hex.EncodeToString(sum[:])
+
+	other := sha256.Sum256([]byte("other certificate"))
+
+	tests := []struct {
+		name        string
+		fingerprint string
+		wantErr     error
+	}{
+		{name: "No fingerprint", fingerprint: ""},
+		{name: "Matching fingerprint", fingerprint: fingerprint},
+		{name: "Matching fingerprint with colons", fingerprint: colonHex(sum[:])},
+		{name: "Mismatching fingerprint", fingerprint: hex.EncodeToString(other[:]), wantErr: ErrFingerprintMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			creds, err := loadTLSCredentials(certPath, tt.fingerprint)
+			assert.NoError(t, err)
+
+			clientConn, serverConn := net.Pipe()
+			defer clientConn.Close()
+			defer serverConn.Close()
+
+			go func() {
+				server := tls.Server(serverConn, &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12})
+				_ = server.Handshake()
+			}()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, _, err = creds.ClientHandshake(ctx, "localhost", clientConn)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestParseFingerprintInvalid(t *testing.T) {
+	_, err := parseFingerprint("not hex")
+	assert.Error(t, err)
+
+	_, err = parseFingerprint("abcd")
+	assert.Error(t, err)
+}
+
+// testCertificate creates a self-signed certificate for localhost and writes it to a file.
+func testCertificate(t *testing.T) (tls.Certificate, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	certPath := filepath.Join(t.TempDir(), "ca-cert.pem")
+	err = os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	assert.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, certPath
+}
+
+// colonHex formats bytes like openssl: upper case hex separated by colons.
+func colonHex(b []byte) string {
+	s := ""
+	for i, v := range b {
+		if i > 0 {
+			s += ":"
+		}
+		s += strings.ToUpper(hex.EncodeToString([]byte{v}))
+	}
+
+	return s
+}
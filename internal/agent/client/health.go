@@ -0,0 +1,88 @@
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// The steps of the health check.
+const (
+	HealthStepList    = "list"
+	HealthStepWrite   = "write"
+	HealthStepRead    = "read"
+	HealthStepCompare = "compare"
+	HealthStepDelete  = "delete"
+)
+
+// healthCheckPrefix is the prefix of the name of the throwaway record.
+var healthCheckPrefix = "goph-keeper-healthcheck-"
+
+// ErrHealthCheckMismatch is returned when the record read back differs from
+// the written one, e.g. the server decrypts with another master key.
+var ErrHealthCheckMismatch = errors.New("read data differs from the written data")
+
+// HealthCheckError is the error of the failed step of the health check.
+type HealthCheckError struct {
+	Step string
+	Err  error
+}
+
+func (e *HealthCheckError) Error() string {
+	return fmt.Sprintf("health check failed on %s: %v", e.Step, e.Err)
+}
+
+func (e *HealthCheckError) Unwrap() error {
+	return e.Err
+}
+
+// HealthCheck checks that the server answers the calls of the client.
+// The deep check makes a round-trip through the encryption of the server:
+// it writes a small throwaway record, reads it back, compares the data and
+// deletes the record, so a misconfigured master key is found before a bulk
+// operation. The record is deleted even when it can't be read back.
+func (c Client) HealthCheck(deep bool) error {
+	if !deep {
+		if _, err := c.ReadAllFile(WithPage(1, "")); err != nil {
+			return &HealthCheckError{Step: HealthStepList, Err: err}
+		}
+
+		return nil
+	}
+
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return fmt.Errorf("failed create health check data: %w", err)
+	}
+	name := healthCheckPrefix + hex.EncodeToString(random[:8])
+	data := hex.EncodeToString(random[8:])
+
+	written, err := c.WriteFile("text", name, data)
+	if err != nil {
+		return &HealthCheckError{Step: HealthStepWrite, Err: err}
+	}
+
+	checkErr := c.checkRecord(written.Id, data)
+
+	if _, err := c.DeleteFile(written.Id); err != nil {
+		return errors.Join(checkErr, &HealthCheckError{Step: HealthStepDelete, Err: err})
+	}
+
+	return checkErr
+}
+
+// checkRecord reads the record back and compares its data.
+func (c Client) checkRecord(id int32, data string) error {
+	read, err := c.ReadFile(id)
+	if err != nil {
+		return &HealthCheckError{Step: HealthStepRead, Err: err}
+	}
+
+	if !bytes.Equal(read.Data, []byte(data)) {
+		return &HealthCheckError{Step: HealthStepCompare, Err: ErrHealthCheckMismatch}
+	}
+
+	return nil
+}
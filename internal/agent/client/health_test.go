@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// memoryStorage keeps the written records in memory. With a broken key the
+// read data is garbled, like the data decrypted with a wrong master key.
+type memoryStorage struct {
+	proto.UnimplementedStorageServer
+
+	brokenKey bool
+	readError string
+
+	mu      sync.Mutex
+	records map[int32][]byte
+	nextID  int32
+}
+
+func (s *memoryStorage) ReadAllRecord(_ context.Context, _ *proto.ReadAllRecordRequest) (*proto.ReadAllRecordResponse, error) {
+	return &proto.ReadAllRecordResponse{}, nil
+}
+
+func (s *memoryStorage) WriteRecord(stream proto.Storage_WriteRecordServer) error {
+	var data []byte
+	for {
+		in, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		data = append(data, in.Data...)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	s.records[s.nextID] = data
+
+	return stream.SendAndClose(&proto.WriteRecordResponse{Id: s.nextID})
+}
+
+func (s *memoryStorage) ReadRecord(_ context.Context, in *proto.ReadRecordRequest) (*proto.ReadRecordResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readError != "" {
+		return &proto.ReadRecordResponse{Error: s.readError}, nil
+	}
+
+	data := append([]byte{}, s.records[in.Id]...)
+	if s.brokenKey {
+		data[0] ^= 0xff
+	}
+
+	return &proto.ReadRecordResponse{Id: in.Id, Type: "text", Data: data}, nil
+}
+
+func (s *memoryStorage) DeleteRecord(_ context.Context, in *proto.DeleteRecordRequest) (*proto.DeleteRecordResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, in.Id)
+
+	return &proto.DeleteRecordResponse{}, nil
+}
+
+func TestHealthCheck(t *testing.T) {
+	cert, certPath := testCertificate(t)
+
+	tests := []struct {
+		name     string
+		storage  *memoryStorage
+		deep     bool
+		wantStep string
+	}{
+		{name: "Shallow", storage: &memoryStorage{brokenKey: true}},
+		{name: "Round-trip", storage: &memoryStorage{}, deep: true},
+		{name: "Wrong master key", storage: &memoryStorage{brokenKey: true}, deep: true, wantStep: HealthStepCompare},
+		{name: "Decryption failed", storage: &memoryStorage{readError: "failed decrypt data"}, deep: true, wantStep: HealthStepRead},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.storage.records = make(map[int32][]byte)
+
+			lis := bufconn.Listen(1024 * 1024)
+			server := grpc.NewServer(grpc.Creds(credentials.NewServerTLSFromCert(&cert)))
+			proto.RegisterStorageServer(server, tt.storage)
+			go func() {
+				_ = server.Serve(lis)
+			}()
+			defer server.Stop()
+
+			cl, err := NewClient("localhost", certPath, "token", WithDialOptions(grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return lis.DialContext(ctx)
+			})))
+			require.NoError(t, err)
+			defer cl.Close()
+
+			err = cl.HealthCheck(tt.deep)
+			if tt.wantStep == "" {
+				assert.NoError(t, err)
+			} else {
+				var healthErr *HealthCheckError
+				if assert.ErrorAs(t, err, &healthErr) {
+					assert.Equal(t, tt.wantStep, healthErr.Step)
+				}
+			}
+
+			// The throwaway record is deleted whatever the result
+			assert.Empty(t, tt.storage.records)
+			assert.Equal(t, tt.deep, tt.storage.nextID == 1)
+		})
+	}
+}
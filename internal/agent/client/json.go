@@ -0,0 +1,52 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// validateData checks the data of a record before it is sent to the server.
+func validateData(typ string, data string) error {
+	if typ == "json" {
+		return validateJSON(data)
+	}
+
+	return nil
+}
+
+// validateJSON checks that the data is well-formed JSON. The error of
+// malformed JSON tells the line and column where parsing failed.
+func validateJSON(data string) error {
+	var v any
+	err := json.Unmarshal([]byte(data), &v)
+	if err == nil {
+		return nil
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line, column := position(data, syntaxErr.Offset)
+		return fmt.Errorf("invalid JSON at line %v, column %v: %w", line, column, err)
+	}
+
+	return fmt.Errorf("invalid JSON: %w", err)
+}
+
+// position converts the offset of a syntax error, which is the number of
+// bytes read including the invalid one, into a line and a column.
+func position(data string, offset int64) (int, int) {
+	if offset > 0 {
+		offset--
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	prefix := data[:offset]
+	line := strings.Count(prefix, "\n") + 1
+	column := len(prefix) - strings.LastIndex(prefix, "\n")
+
+	return line, column
+}
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		// exp is the beginning of the error, empty if the JSON is valid
+		exp string
+	}{
+		{name: "Object", data: `{"url": "https://api", "retries": 3, "tags": ["a", "b"]}`},
+		{name: "Array", data: `[1, 2, 3]`},
+		{name: "Trailing comma", data: "{\n  \"a\": 1,\n}", exp: "invalid JSON at line 3, column 1"},
+		{name: "Unquoted key", data: `{a: 1}`, exp: "invalid JSON at line 1, column 2"},
+		{name: "Empty", data: ``, exp: "invalid JSON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateData("json", tt.data)
+			if tt.exp == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.exp)
+			}
+		})
+	}
+
+	// Other types are not checked
+	assert.NoError(t, validateData("text", "{a: 1}"))
+}
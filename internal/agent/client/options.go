@@ -0,0 +1,209 @@
+package client
+
+import (
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding/gzip"
+)
+
+// Option configures the connection created by `NewClient`.
+type Option func(*options)
+
+// options holds the settings of the connection.
+type options struct {
+	dialOptions   []grpc.DialOption
+	fingerprint   string
+	refreshBefore time.Duration
+	refreshRetry  bool
+	onRefresh     func(token string)
+}
+
+// WithCompression enables gzip compression of all calls on the wire.
+// It trades CPU time for bandwidth, so it is off by default.
+func WithCompression() Option {
+	return func(o *options) {
+		o.dialOptions = append(o.dialOptions, grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)))
+	}
+}
+
+// WithFingerprint pins the server certificate: the connection is rejected
+// unless the certificate has the given SHA-256 fingerprint in hex.
+func WithFingerprint(fingerprint string) Option {
+	return func(o *options) {
+		o.fingerprint = fingerprint
+	}
+}
+
+// WithDialOptions adds gRPC dial options to the connection, e.g. a custom
+// dialer or keepalive settings of an embedding application.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) {
+		o.dialOptions = append(o.dialOptions, opts...)
+	}
+}
+
+// WithAutoRefresh refreshes the token before a call when it expires within
+// `before`, so a long-running client doesn't have to log in again. The
+// refreshed token is sent instead of the token of the client and passed to
+// `onRefresh`, e.g. to save it. A nil `onRefresh` only keeps it in memory.
+func WithAutoRefresh(before time.Duration, onRefresh func(token string)) Option {
+	return func(o *options) {
+		o.refreshBefore = before
+		o.onRefresh = onRefresh
+	}
+}
+
+// WithRefreshOnUnauthenticated refreshes the token once when the server
+// rejects a call as unauthenticated and retries the call, and refreshes an
+// expired token before a stream, as a stream can't be retried. The server
+// refreshes a token expired within its grace window. The refreshed token is
+// passed to `onRefresh` as with `WithAutoRefresh`.
+func WithRefreshOnUnauthenticated(onRefresh func(token string)) Option {
+	return func(o *options) {
+		o.refreshRetry = true
+		o.onRefresh = onRefresh
+	}
+}
+
+// RegisterOption configures a registration request.
+type RegisterOption func(*proto.RegiserRequest)
+
+// WithEmail sets the email the user can log in with instead of the login.
+func WithEmail(email string) RegisterOption {
+	return func(r *proto.RegiserRequest) {
+		r.Email = email
+	}
+}
+
+// LoginOption configures a login request.
+type LoginOption func(*proto.LoginRequest)
+
+// WithScope requests a token with the given scope, "full" or "read".
+func WithScope(scope string) LoginOption {
+	return func(r *proto.LoginRequest) {
+		r.Scope = scope
+	}
+}
+
+// WithReadOnly requests a token that can only read records.
+func WithReadOnly() LoginOption {
+	return WithScope("read")
+}
+
+// ListOption configures the request for listing records.
+type ListOption func(*proto.ReadAllRecordRequest)
+
+// WithCategoryFilter lists only the records of the given category.
+func WithCategoryFilter(category string) ListOption {
+	return func(r *proto.ReadAllRecordRequest) {
+		r.Category = category
+	}
+}
+
+// WithFolderFilter lists only the records of the given folder and its
+// nested folders, e.g. "work/aws" lists "work/aws/prod" as well.
+func WithFolderFilter(folder string) ListOption {
+	return func(r *proto.ReadAllRecordRequest) {
+		r.Folder = folder
+	}
+}
+
+// WithTypeFilter lists only the records of the given type.
+func WithTypeFilter(typ string) ListOption {
+	return func(r *proto.ReadAllRecordRequest) {
+		r.Type = typ
+	}
+}
+
+// WithTagsFilter lists only the records having all the given tags.
+func WithTagsFilter(tags map[string]string) ListOption {
+	return func(r *proto.ReadAllRecordRequest) {
+		r.Tags = tags
+	}
+}
+
+// WithNameFilter lists only the records with the name containing the given
+// text, ignoring the case. It fails when the server encrypts the names.
+func WithNameFilter(name string) ListOption {
+	return func(r *proto.ReadAllRecordRequest) {
+		r.Name = name
+	}
+}
+
+// WithSort lists the records sorted by the comma separated keys: name, type,
+// created_at or last_accessed. The server rejects other keys.
+func WithSort(keys string, desc bool) ListOption {
+	return func(r *proto.ReadAllRecordRequest) {
+		r.Sort = keys
+		r.Desc = desc
+	}
+}
+
+// WithPage lists a page of at most `size` records ordered by ID. An empty
+// token is the first page, the next page token is in the response.
+func WithPage(size int32, token string) ListOption {
+	return func(r *proto.ReadAllRecordRequest) {
+		r.PageSize = size
+		r.PageToken = token
+	}
+}
+
+// WriteOption configures the request for writing a record.
+// Options are applied to every chunk sent to the server.
+type WriteOption func(*proto.WriteRecordRequest)
+
+// WithCategory sets the category of the written record.
+func WithCategory(category string) WriteOption {
+	return func(r *proto.WriteRecordRequest) {
+		r.Category = category
+	}
+}
+
+// WithFolder puts the written record into the folder, a path of folder
+// names separated by "/", e.g. "work/aws/prod". Empty means no folder.
+func WithFolder(folder string) WriteOption {
+	return func(r *proto.WriteRecordRequest) {
+		r.Folder = folder
+	}
+}
+
+// WithTeam shares the written record with the team. Zero keeps the record private.
+func WithTeam(team int) WriteOption {
+	return func(r *proto.WriteRecordRequest) {
+		r.Team = int32(team)
+	}
+}
+
+// WithMeta sets the metadata (tags) of the written record.
+func WithMeta(meta map[string]string) WriteOption {
+	return func(r *proto.WriteRecordRequest) {
+		r.Meta = meta
+	}
+}
+
+// WithIdempotencyKey sets the idempotency key of the write instead of a new
+// random one, so a write repeated by a later run of the agent doesn't
+// duplicate the record.
+func WithIdempotencyKey(key string) WriteOption {
+	return func(r *proto.WriteRecordRequest) {
+		r.IdempotencyKey = key
+	}
+}
+
+// WithRequiresConfirmation marks the written record as requiring confirmation,
+// it is only read after the user confirms the read.
+func WithRequiresConfirmation() WriteOption {
+	return func(r *proto.WriteRecordRequest) {
+		r.RequiresConfirmation = true
+	}
+}
+
+// WithMimeType sets the MIME type of the written file instead of the type
+// the server detects from the data.
+func WithMimeType(mimeType string) WriteOption {
+	return func(r *proto.WriteRecordRequest) {
+		r.MimeType = mimeType
+	}
+}
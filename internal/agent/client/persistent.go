@@ -0,0 +1,174 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+)
+
+// reconnectBaseDelay is the delay before the first attempt to reconnect,
+// it is doubled after every failed attempt up to reconnectMaxDelay.
+var reconnectBaseDelay = 100 * time.Millisecond
+
+// reconnectMaxDelay is the maximum delay between the attempts to reconnect.
+var reconnectMaxDelay = 30 * time.Second
+
+// waitReadyPoll is how often `WaitReady` checks for a replaced connection.
+var waitReadyPoll = 100 * time.Millisecond
+
+// PersistentClient keeps a connection to the server for long-running
+// processes, e.g. daemons embedding the client. It watches the state of the
+// connection and, when the connection fails or is shut down, dials the
+// server again with an exponential backoff. The token is kept by the
+// persistent client and applied to every new connection, so callers only
+// take the current `Client` for each call and never hold a dead connection.
+type PersistentClient struct {
+	dial func(token string) (*Client, error)
+
+	mu     sync.RWMutex
+	client *Client
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewPersistentClient connects to the server like `NewClient` and starts
+// watching the connection. Close it to stop watching.
+func NewPersistentClient(addr string, certPath string, token string, opts ...Option) (*PersistentClient, error) {
+	return newPersistentClient(func(token string) (*Client, error) {
+		return NewClient(addr, certPath, token, opts...)
+	}, token)
+}
+
+// newPersistentClient creates the client with the function dialing the server.
+func newPersistentClient(dial func(token string) (*Client, error), token string) (*PersistentClient, error) {
+	c, err := dial(token)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &PersistentClient{
+		dial:   dial,
+		client: c,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go p.watch()
+
+	return p, nil
+}
+
+// Client returns the client with the current connection. The connection
+// may be replaced after a failure, so take the client for every call
+// instead of keeping it. Don't close it, close the persistent client.
+func (p *PersistentClient) Client() Client {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return *p.client
+}
+
+// SetToken replaces the token of the calls, e.g. after a new login.
+// It is also used for the connections made later.
+func (p *PersistentClient) SetToken(token string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.client = &Client{Conn: p.client.Conn, Token: token, rateLimit: p.client.rateLimit}
+}
+
+// WaitReady blocks until the connection is ready or the context is done.
+func (p *PersistentClient) WaitReady(ctx context.Context) error {
+	for {
+		conn := p.Client().Conn
+
+		state := conn.GetState()
+		if state == connectivity.Ready {
+			return nil
+		}
+		if state == connectivity.Idle {
+			conn.Connect()
+		}
+
+		// The connection may be replaced, so it is checked again after a while
+		wait, cancel := context.WithTimeout(ctx, waitReadyPoll)
+		conn.WaitForStateChange(wait, state)
+		cancel()
+
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("connection not ready: %w", err)
+		}
+	}
+}
+
+// Close stops watching the connection and closes it.
+func (p *PersistentClient) Close() error {
+	p.cancel()
+	<-p.done
+
+	return p.Client().Close()
+}
+
+// watch follows the state of the connection until the client is closed.
+// An idle connection is connected at once, so a lost server is noticed
+// without waiting for a call. A failed connection is replaced.
+func (p *PersistentClient) watch() {
+	defer close(p.done)
+
+	delay := reconnectBaseDelay
+
+	for {
+		conn := p.Client().Conn
+
+		state := conn.GetState()
+		switch state {
+		case connectivity.Idle:
+			conn.Connect()
+		case connectivity.Ready:
+			delay = reconnectBaseDelay
+		case connectivity.TransientFailure, connectivity.Shutdown:
+			if !p.reconnect(delay) {
+				return
+			}
+
+			delay = min(2*delay, reconnectMaxDelay)
+
+			continue
+		}
+
+		if !conn.WaitForStateChange(p.ctx, state) {
+			return
+		}
+	}
+}
+
+// reconnect waits for the delay and replaces the connection with a new one
+// using the current token. It returns false when the client is closed.
+func (p *PersistentClient) reconnect(delay time.Duration) bool {
+	select {
+	case <-p.ctx.Done():
+		return false
+	case <-time.After(delay):
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c, err := p.dial(p.client.Token)
+	if err != nil {
+		// The old connection is kept, the next attempt is made after a longer delay
+		return true
+	}
+
+	_ = p.client.Close()
+	p.client = c
+
+	return true
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// tokenStorage answers ReadAllRecord with the token of the call as the name of a record.
+type tokenStorage struct {
+	proto.UnimplementedStorageServer
+}
+
+func (tokenStorage) ReadAllRecord(ctx context.Context, in *proto.ReadAllRecordRequest) (*proto.ReadAllRecordResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	return &proto.ReadAllRecordResponse{Units: []*proto.StorageUnit{{Name: md.Get("authorization")[0]}}}, nil
+}
+
+// restartableServer is a bufconn server that can be stopped and started again.
+type restartableServer struct {
+	cert tls.Certificate
+
+	mu     sync.Mutex
+	lis    *bufconn.Listener
+	server *grpc.Server
+}
+
+func (s *restartableServer) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lis = bufconn.Listen(1024 * 1024)
+	s.server = grpc.NewServer(grpc.Creds(credentials.NewServerTLSFromCert(&s.cert)))
+	proto.RegisterStorageServer(s.server, tokenStorage{})
+
+	go func(server *grpc.Server, lis net.Listener) {
+		_ = server.Serve(lis)
+	}(s.server, s.lis)
+}
+
+func (s *restartableServer) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.server.Stop()
+}
+
+func (s *restartableServer) dial(ctx context.Context, _ string) (net.Conn, error) {
+	s.mu.Lock()
+	lis := s.lis
+	s.mu.Unlock()
+
+	return lis.DialContext(ctx)
+}
+
+func TestPersistentClientReconnects(t *testing.T) {
+	reconnectBaseDelay = 10 * time.Millisecond
+
+	cert, certPath := testCertificate(t)
+	server := &restartableServer{cert: cert}
+	server.start()
+	defer server.stop()
+
+	pc, err := NewPersistentClient("localhost", certPath, "old", WithDialOptions(grpc.WithContextDialer(server.dial)))
+	require.NoError(t, err)
+	defer pc.Close()
+
+	read := func() string {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		require.NoError(t, pc.WaitReady(ctx))
+
+		resp, err := pc.Client().ReadAllFile()
+		require.NoError(t, err)
+
+		return resp.Units[0].Name
+	}
+
+	assert.Equal(t, "bearer old", read())
+
+	server.stop()
+	server.start()
+
+	// The token set while the server is down is used by the new connection
+	pc.SetToken("new")
+	assert.Equal(t, "bearer new", read())
+
+	// A failed connection is replaced
+	conn := pc.Client().Conn
+	server.stop()
+	assert.Eventually(t, func() bool {
+		return pc.Client().Conn != conn
+	}, 5*time.Second, 10*time.Millisecond)
+
+	server.start()
+	assert.Equal(t, "bearer new", read())
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Keys of the response trailers with the quota, as sent by the server.
+const (
+	rateLimitLimitKey     = "ratelimit-limit"
+	rateLimitRemainingKey = "ratelimit-remaining"
+	rateLimitResetKey     = "ratelimit-reset"
+)
+
+// RateLimit is the quota of calls reported by the server with the last call.
+type RateLimit struct {
+	// Limit is the number of calls allowed in a window.
+	Limit int
+	// Remaining is the number of calls left in the current window.
+	Remaining int
+	// Reset is the time the quota is restored at.
+	Reset time.Time
+}
+
+// rateLimitTracker keeps the quota from the trailers of the calls of a
+// connection.
+type rateLimitTracker struct {
+	mu    sync.Mutex
+	limit RateLimit
+	known bool
+}
+
+// RateLimit returns the quota reported by the server with the last call
+// made by the client. It returns false when the server doesn't limit the
+// calls or no call was made yet.
+func (c Client) RateLimit() (RateLimit, bool) {
+	if c.rateLimit == nil {
+		return RateLimit{}, false
+	}
+
+	c.rateLimit.mu.Lock()
+	defer c.rateLimit.mu.Unlock()
+
+	return c.rateLimit.limit, c.rateLimit.known
+}
+
+// record saves the quota of the trailer, a trailer without it is ignored.
+func (t *rateLimitTracker) record(md metadata.MD) {
+	limit, err := strconv.Atoi(first(md, rateLimitLimitKey))
+	if err != nil {
+		return
+	}
+	remaining, err := strconv.Atoi(first(md, rateLimitRemainingKey))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(first(md, rateLimitResetKey), 10, 64)
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.limit = RateLimit{Limit: limit, Remaining: remaining, Reset: time.Unix(reset, 0)}
+	t.known = true
+}
+
+// unaryInterceptor reads the quota from the trailer of every unary call.
+func (t *rateLimitTracker) unaryInterceptor(ctx context.Context, method string, req, reply any,
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	var trailer metadata.MD
+	err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Trailer(&trailer))...)
+	t.record(trailer)
+
+	return err
+}
+
+// streamInterceptor reads the quota from the trailer of every stream once
+// the stream is finished.
+func (t *rateLimitTracker) streamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+	method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	cs, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rateLimitStream{ClientStream: cs, tracker: t, serverStreams: desc.ServerStreams}, nil
+}
+
+// rateLimitStream records the trailer of the stream when it ends.
+type rateLimitStream struct {
+	grpc.ClientStream
+	tracker       *rateLimitTracker
+	serverStreams bool
+}
+
+func (s *rateLimitStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+
+	// A stream with a single response is finished after receiving it
+	if err != nil || !s.serverStreams {
+		s.tracker.record(s.Trailer())
+	}
+
+	//nolint:wrapcheck // This legal return
+	return err
+}
+
+// first returns the first value of the key in the metadata.
+func first(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+
+	return ""
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
+	interceptors "github.com/Renal37/goph-keeper/internal/server/adapters/middleware/grpc"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestRateLimitTrailers(t *testing.T) {
+	cert, certPath := testCertificate(t)
+
+	// Every call is made by the same user
+	authenticate := func(ctx context.Context) context.Context {
+		return middleware.SetTokenToContext(ctx, middleware.JWTclaims{ID: 1})
+	}
+	limiter := interceptors.NewRateLimiter(3, time.Hour)
+
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc.Creds(credentials.NewServerTLSFromCert(&cert)),
+		grpc.ChainUnaryInterceptor(
+			func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				return handler(authenticate(ctx), req)
+			},
+			limiter.UnaryInterceptor(),
+		),
+		grpc.ChainStreamInterceptor(
+			func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				return handler(srv, contextStream{ServerStream: ss, ctx: authenticate(ss.Context())})
+			},
+			limiter.StreamInterceptor(),
+		),
+	)
+	proto.RegisterStorageServer(server, &memoryStorage{records: make(map[int32][]byte)})
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	defer server.Stop()
+
+	cl, err := NewClient("localhost", certPath, "token", WithDialOptions(grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	})))
+	require.NoError(t, err)
+	defer cl.Close()
+
+	_, ok := cl.RateLimit()
+	assert.False(t, ok)
+
+	_, err = cl.ReadAllFile()
+	assert.NoError(t, err)
+
+	limit, ok := cl.RateLimit()
+	assert.True(t, ok)
+	assert.Equal(t, 3, limit.Limit)
+	assert.Equal(t, 2, limit.Remaining)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), limit.Reset, time.Minute)
+
+	// A stream counts as one call
+	_, err = cl.WriteFile("text", "note", "data")
+	assert.NoError(t, err)
+
+	limit, _ = cl.RateLimit()
+	assert.Equal(t, 1, limit.Remaining)
+
+	_, err = cl.ReadAllFile()
+	assert.NoError(t, err)
+
+	limit, _ = cl.RateLimit()
+	assert.Equal(t, 0, limit.Remaining)
+
+	// The call beyond the quota is rejected, the trailer is still sent
+	_, err = cl.ReadAllFile()
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	limit, ok = cl.RateLimit()
+	assert.True(t, ok)
+	assert.Equal(t, 0, limit.Remaining)
+}
+
+// contextStream is a server stream with the given context.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,150 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// tokenRefresher refreshes the token of the calls of a connection shortly
+// before it expires and sends the refreshed token instead. The calls keep
+// being made with the token of the client, the refresher replaces it. With
+// `retry` a unary call rejected as unauthenticated is retried once with a
+// refreshed token.
+type tokenRefresher struct {
+	before    time.Duration
+	retry     bool
+	onRefresh func(token string)
+
+	mu sync.Mutex
+	// from is the token of the calls and to is the refreshed token sent
+	// instead of it.
+	from string
+	to   string
+}
+
+// current returns the token sent instead of the token, the token itself if
+// it was not refreshed.
+func (t *tokenRefresher) current(token string) string {
+	if t == nil {
+		return token
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if token == t.from && t.to != "" {
+		return t.to
+	}
+
+	return token
+}
+
+// authorize replaces the token of the outgoing metadata with the current
+// token and refreshes it first if it expires within `before`, or always with
+// `force`. It reports whether the token was refreshed. A failed refresh is
+// not an error of the call: the token is still sent and the server decides
+// whether it is valid.
+func (t *tokenRefresher) authorize(ctx context.Context, method string, cc *grpc.ClientConn, force bool) (context.Context, bool) {
+	// The calls of the user service don't need a token, the refresh is one of them
+	if strings.HasPrefix(method, "/"+proto.User_ServiceDesc.ServiceName+"/") {
+		return ctx, false
+	}
+
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !ok {
+		return ctx, false
+	}
+
+	token, ok := strings.CutPrefix(first(md, "authorization"), "bearer ")
+	if !ok || token == "" {
+		return ctx, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	current := token
+	if token == t.from && t.to != "" {
+		current = t.to
+	}
+
+	refreshed := false
+	if force || expiresWithin(current, t.before) {
+		resp, err := proto.NewUserClient(cc).Refresh(ctx, &proto.RefreshRequest{Jwt: current})
+		if err == nil && resp.Error == "" {
+			t.from, t.to = token, resp.Jwt
+			current = resp.Jwt
+			refreshed = true
+
+			if t.onRefresh != nil {
+				t.onRefresh(resp.Jwt)
+			}
+		}
+	}
+
+	if current == token {
+		return ctx, refreshed
+	}
+
+	md = md.Copy()
+	md.Set("authorization", fmt.Sprintf("bearer %s", current))
+
+	return metadata.NewOutgoingContext(ctx, md), refreshed
+}
+
+// unaryInterceptor sends the current token with every unary call. With
+// `retry` a call rejected as unauthenticated, e.g. as the token expired
+// meanwhile, is retried once with a refreshed token. A call rejected for
+// an old password is not, the refresh keeps the time of the password.
+func (t *tokenRefresher) unaryInterceptor(ctx context.Context, method string, req, reply any,
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	authCtx, _ := t.authorize(ctx, method, cc, false)
+
+	err := invoker(authCtx, method, req, reply, cc, opts...)
+	if !t.retry || status.Code(err) != codes.Unauthenticated || IsReauthRequired(err) {
+		return err
+	}
+
+	authCtx, ok := t.authorize(ctx, method, cc, true)
+	if !ok {
+		return err
+	}
+
+	return invoker(authCtx, method, req, reply, cc, opts...)
+}
+
+// streamInterceptor sends the current token with every stream. A stream
+// can't be retried, as its messages are already sent, so with `retry` an
+// expired token is refreshed before the stream instead.
+func (t *tokenRefresher) streamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+	method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	authCtx, _ := t.authorize(ctx, method, cc, false)
+
+	return streamer(authCtx, desc, cc, method, opts...)
+}
+
+// expiresWithin reports whether the token expires within the duration. A
+// token that can't be parsed or has no expiration time is not refreshed.
+func expiresWithin(token string, d time.Duration) bool {
+	claims := &middleware.JWTclaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		return false
+	}
+
+	if claims.ExpiresAt == nil {
+		return false
+	}
+
+	return time.Until(claims.ExpiresAt.Time) < d
+}
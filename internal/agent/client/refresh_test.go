@@ -0,0 +1,267 @@
+package client
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const testJWTKey = "12345"
+
+// testToken signs a token of the user expiring after the duration.
+func testToken(t *testing.T, expiresIn time.Duration) string {
+	t.Helper()
+
+	now := time.Now()
+	claims := &middleware.JWTclaims{ID: 1, Login: "alice", Scope: middleware.ScopeRead, RegisteredClaims: jwt.RegisteredClaims{
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+	}}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testJWTKey))
+	require.NoError(t, err)
+
+	return token
+}
+
+// refreshUsers issues a token valid for 30 minutes for a valid token, or a
+// token expired within the grace.
+type refreshUsers struct {
+	proto.UnimplementedUserServer
+	t     *testing.T
+	grace time.Duration
+
+	mu        sync.Mutex
+	refreshed int
+}
+
+func (s *refreshUsers) Refresh(_ context.Context, in *proto.RefreshRequest) (*proto.RefreshResponse, error) {
+	claims := &middleware.JWTclaims{}
+	if _, err := jwt.ParseWithClaims(in.Jwt, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(testJWTKey), nil
+	}, jwt.WithLeeway(s.grace)); err != nil {
+		return &proto.RefreshResponse{Error: "invalid token"}, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refreshed++
+
+	return &proto.RefreshResponse{Jwt: testToken(s.t, 30*time.Minute)}, nil
+}
+
+func TestAutoRefresh(t *testing.T) {
+	cert, certPath := testCertificate(t)
+
+	// The tokens the storage calls are made with
+	var mu sync.Mutex
+	var sent []string
+	record := func(ctx context.Context) {
+		md, _ := metadata.FromIncomingContext(ctx)
+
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, first(md, "authorization"))
+	}
+
+	users := &refreshUsers{t: t}
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc.Creds(credentials.NewServerTLSFromCert(&cert)),
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if info.FullMethod != proto.User_Refresh_FullMethodName {
+				record(ctx)
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			record(ss.Context())
+			return handler(srv, ss)
+		}),
+	)
+	proto.RegisterStorageServer(server, &memoryStorage{records: make(map[int32][]byte)})
+	proto.RegisterUserServer(server, users)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	defer server.Stop()
+
+	dialer := WithDialOptions(grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+
+	// The token expires in a minute, it is refreshed 5 minutes before
+	short := testToken(t, time.Minute)
+	var saved []string
+	cl, err := NewClient("localhost", certPath, short, dialer, WithAutoRefresh(5*time.Minute, func(token string) {
+		saved = append(saved, token)
+	}))
+	require.NoError(t, err)
+	defer cl.Close()
+
+	_, err = cl.ReadAllFile()
+	require.NoError(t, err)
+	require.Len(t, saved, 1)
+	assert.Equal(t, 1, users.refreshed)
+	assert.Equal(t, []string{"bearer " + saved[0]}, sent)
+
+	// The refreshed token is used by the next calls and streams until it
+	// expires in its turn
+	_, err = cl.WriteFile("text", "note", "data")
+	require.NoError(t, err)
+	_, err = cl.ReadAllFile()
+	require.NoError(t, err)
+	assert.Equal(t, 1, users.refreshed)
+	assert.Equal(t, []string{"bearer " + saved[0], "bearer " + saved[0], "bearer " + saved[0]}, sent)
+
+	claims, err := cl.Claims()
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(30*time.Minute), claims.ExpiresAt.Time, time.Minute)
+	assert.Equal(t, middleware.ScopeRead, claims.Scope)
+
+	// A new token of the client, e.g. after logging in again, is sent as is
+	long := testToken(t, time.Hour)
+	cl.Token = long
+	_, err = cl.ReadAllFile()
+	require.NoError(t, err)
+	assert.Equal(t, "bearer "+long, sent[len(sent)-1])
+	assert.Equal(t, 1, users.refreshed)
+
+	// Without the option the token is never refreshed
+	plain, err := NewClient("localhost", certPath, short, dialer)
+	require.NoError(t, err)
+	defer plain.Close()
+
+	_, err = plain.ReadAllFile()
+	require.NoError(t, err)
+	assert.Equal(t, "bearer "+short, sent[len(sent)-1])
+	assert.Equal(t, 1, users.refreshed)
+
+	// The token can be refreshed explicitly as well
+	resp, err := plain.Refresh()
+	require.NoError(t, err)
+	assert.NotEqual(t, short, resp.Jwt)
+	assert.Equal(t, 2, users.refreshed)
+}
+
+func TestRefreshOnUnauthenticated(t *testing.T) {
+	cert, certPath := testCertificate(t)
+
+	// The server rejects the revoked tokens and the expired ones, as the
+	// tokens of the tests are not checked by an authenticator
+	var mu sync.Mutex
+	var sent []string
+	revoked := make(map[string]bool)
+	reauth := false
+	check := func(ctx context.Context) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		auth := first(md, "authorization")
+
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, auth)
+
+		token := strings.TrimPrefix(auth, "bearer ")
+		switch {
+		case reauth:
+			return status.Error(codes.Unauthenticated, reauthRequiredMessage)
+		case revoked[token] || expiresWithin(token, 0):
+			return status.Error(codes.Unauthenticated, "invalid token")
+		}
+
+		return nil
+	}
+
+	users := &refreshUsers{t: t, grace: 5 * time.Minute}
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc.Creds(credentials.NewServerTLSFromCert(&cert)),
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if info.FullMethod != proto.User_Refresh_FullMethodName {
+				if err := check(ctx); err != nil {
+					return nil, err
+				}
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := check(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	)
+	proto.RegisterStorageServer(server, &memoryStorage{records: make(map[int32][]byte)})
+	proto.RegisterUserServer(server, users)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	defer server.Stop()
+
+	dialer := WithDialOptions(grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+
+	// The token is valid for the client, but rejected by the server
+	token := testToken(t, time.Hour)
+	revoked[token] = true
+
+	var saved []string
+	cl, err := NewClient("localhost", certPath, token, dialer, WithRefreshOnUnauthenticated(func(token string) {
+		saved = append(saved, token)
+	}))
+	require.NoError(t, err)
+	defer cl.Close()
+
+	// The call is retried once with the refreshed token
+	_, err = cl.ReadAllFile()
+	require.NoError(t, err)
+	require.Len(t, saved, 1)
+	assert.Equal(t, []string{"bearer " + token, "bearer " + saved[0]}, sent)
+
+	// The next calls are made with the refreshed token
+	_, err = cl.ReadAllFile()
+	require.NoError(t, err)
+	assert.Equal(t, "bearer "+saved[0], sent[len(sent)-1])
+	assert.Equal(t, 1, users.refreshed)
+
+	// An expired token is refreshed before a stream, it can't be retried
+	expired := testToken(t, -time.Minute)
+	cl.Token = expired
+	_, err = cl.WriteFile("text", "note", "data")
+	require.NoError(t, err)
+	require.Len(t, saved, 2)
+	assert.Equal(t, "bearer "+saved[1], sent[len(sent)-1])
+
+	// A token expired after the grace is not refreshed, the call fails once
+	cl.Token = testToken(t, -time.Hour)
+	sent = nil
+	_, err = cl.ReadAllFile()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Len(t, sent, 1)
+
+	// Neither is a call rejected for an old password, a refresh keeps its time
+	cl.Token = testToken(t, time.Hour)
+	reauth = true
+	sent = nil
+	_, err = cl.ReadAllFile()
+	assert.True(t, IsReauthRequired(err))
+	assert.Len(t, sent, 1)
+	assert.Equal(t, 2, users.refreshed)
+}
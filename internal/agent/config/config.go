@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+	"time"
 
 	env "github.com/caarlos0/env/v6"
 	"github.com/joho/godotenv"
@@ -16,10 +17,58 @@ var defaultPermition fs.FileMode = 0600
 
 // ConfigENV contains app settings.
 type ConfigENV struct {
-	Command     string
-	JWT         string `env:"JWT"`
-	ServerAddr  string `json:"server_addr" env:"SERVER_ADDR"`
-	Certificate string `json:"certificate"`
+	Command      string
+	Category     string
+	Folder       string
+	Replace      bool
+	ExportEnv    bool
+	ExportFormat string
+	ReadOnly     bool
+	AssumeYes    bool
+	Raw          bool
+	Quiet        bool
+	Format       string
+	Stdout       bool
+	ID           int
+	Pretty       bool
+	JSONPath     string
+	Preview      int
+	Team         int
+	Out          string
+	In           string
+	OnConflict   string
+	JSONErrors   bool
+	DataFile     string
+	Deep         bool
+	BenchSizes   string
+	BenchCount   int
+	FIFO         string
+	Exec         bool
+	Paths        []string
+	Sort         string
+	Desc         bool
+	QR           bool
+	QRASCII      bool
+	ConfirmRead  bool
+	Local        string
+	Email        string
+	EnvFile      string
+	Force        bool
+	URL          string
+	URLTimeout   time.Duration
+	Ephemeral    bool
+	TTL          time.Duration
+	Type         string
+	Name         string
+	MimeType     string
+	JWT          string `env:"JWT"`
+	AutoRefresh  bool   `json:"auto_refresh" env:"AUTO_REFRESH"`
+	ServerAddr   string `json:"server_addr" env:"SERVER_ADDR"`
+	Certificate  string `json:"certificate"`
+	Fingerprint  string `json:"certificate_fingerprint" env:"CERTIFICATE_FINGERPRINT"`
+	Compression  bool   `json:"compression" env:"COMPRESSION"`
+	DownloadDir  string `json:"download_dir" env:"DOWNLOAD_DIR"`
+	SpoolDir     string `json:"spool_dir" env:"SPOOL_DIR"`
 }
 
 // GetConfig get app settings.
@@ -28,8 +77,54 @@ func GetConfig() (*ConfigENV, error) {
 	configPath := "config/agent.json"
 
 	flag.StringVar(&eCfg.Command, "c", "", "command for GophKeeper storage")
+	flag.StringVar(&eCfg.Category, "category", "", "show only records of the category")
+	flag.StringVar(&eCfg.Folder, "folder", "", "folder of the file written by write-file, e.g. work/aws, the lists show only the files of the folder and its nested folders")
+	flag.BoolVar(&eCfg.Replace, "replace", false, "replace all tags instead of merging them in update-meta")
+	flag.BoolVar(&eCfg.ExportEnv, "export-env", false, "print credentials read by read-file as environment variables")
+	flag.StringVar(&eCfg.ExportFormat, "export-format", "shell", "format of -export-env: shell or dotenv")
+	flag.BoolVar(&eCfg.ReadOnly, "readonly", false, "sign-in with a token that can only read files")
+	flag.BoolVar(&eCfg.AssumeYes, "yes", false, "accept the default answers without prompting")
+	flag.BoolVar(&eCfg.Raw, "raw", false, "read and write text files byte for byte, the text is read until EOF")
+	flag.BoolVar(&eCfg.Quiet, "quiet", false, "print only the result of the command, write-file prints the ID of the new record")
+	flag.StringVar(&eCfg.Format, "format", "simple", "format of the list of files: simple or table, format of export: keepass, keepass-xml or goph-json, format of import: goph-json")
+	flag.BoolVar(&eCfg.Stdout, "stdout", false, "write the data read by read-file to stdout instead of saving or showing it")
+	flag.IntVar(&eCfg.ID, "id", 0, "ID of the file for read-file, the files are not listed")
+	flag.BoolVar(&eCfg.Pretty, "pretty", false, "pretty-print json files read by read-file")
+	flag.StringVar(&eCfg.JSONPath, "jsonpath", "", "show only the field of a json file, e.g. servers[0].url")
+	flag.IntVar(&eCfg.Preview, "preview", 0, "show only the first characters of a text file read by read-file, the size of other files")
+	flag.IntVar(&eCfg.Team, "team", 0, "ID of the team to share the file written by write-file with")
+	flag.StringVar(&eCfg.Out, "out", "", "file of export, stdout by default, an interrupted csv export to the file is resumed")
+	flag.StringVar(&eCfg.In, "in", "", "file of import, stdin by default")
+	flag.StringVar(&eCfg.OnConflict, "on-conflict", "skip", "what import does with a file named as an existing one: skip or overwrite")
+	flag.BoolVar(&eCfg.JSONErrors, "json-errors", false, "print errors to stderr as json objects with the error and its gRPC status code")
+	flag.StringVar(&eCfg.DataFile, "data-file", "", "file with the data of a text or json record written by write-file, it must be UTF-8 text")
+	flag.StringVar(&eCfg.BenchSizes, "bench-sizes", "", "comma separated sizes of the records of benchmark in bytes, K or M, 1K,64K,1M by default")
+	flag.IntVar(&eCfg.BenchCount, "bench-count", 0, "number of records of every size benchmark uploads and downloads, 10 by default")
+	flag.BoolVar(&eCfg.Deep, "deep", false, "make healthcheck write, read back and delete a throwaway record to check the encryption of the server")
+	flag.BoolVar(&eCfg.Exec, "exec", false, "pipe the data read by read-file to the stdin of the command given after --")
+	flag.StringVar(&eCfg.FIFO, "fifo", "", "write the data read by read-file to the named pipe, it is created and removed when missing")
+	flag.StringVar(&eCfg.Sort, "sort", "", "sort the list of files by the comma separated keys: name, type, created_at or last_accessed")
+	flag.BoolVar(&eCfg.Desc, "desc", false, "sort the list of files in descending order")
+	flag.BoolVar(&eCfg.QR, "qr", false, "show the record read by read-file as a QR code, an otpauth URI or the password of credentials")
+	flag.BoolVar(&eCfg.QRASCII, "qr-ascii", false, "draw the QR code of -qr with ASCII instead of UTF-8 blocks")
+	flag.BoolVar(&eCfg.ConfirmRead, "confirm-read", false, "mark the file written by write-file as requiring confirmation before it is read")
+	flag.StringVar(&eCfg.Local, "local", "", "local file diff-file compares with the stored file of -id instead of comparing versions")
+	flag.StringVar(&eCfg.Email, "email", "", "email of the account created by sign-up, sign-in accepts it instead of the login")
+	flag.StringVar(&eCfg.EnvFile, "env-file", "", "write the credentials or json file read by read-file to the env file for docker compose --env-file")
+	flag.BoolVar(&eCfg.Force, "force", false, "overwrite the existing file of -env-file")
+	flag.StringVar(&eCfg.URL, "url", "", "http or https URL write-file fetches and stores as a file")
+	flag.DurationVar(&eCfg.URLTimeout, "url-timeout", 0, "timeout of fetching the URL of -url, 30s by default")
+	flag.BoolVar(&eCfg.Ephemeral, "ephemeral", false, "wipe the file saved by read-file after -ttl")
+	flag.DurationVar(&eCfg.TTL, "ttl", 0, "how long the file of -ephemeral is kept, 1m by default")
+	flag.StringVar(&eCfg.Type, "type", "", "show only records of the type, e.g. credentials")
+	flag.StringVar(&eCfg.Name, "name", "", "show only records with the name containing the text, ignoring the case")
+	flag.BoolVar(&eCfg.AutoRefresh, "auto-refresh", false, "refresh the token shortly before it expires and save it in place of the token saved by sign-in")
+	flag.StringVar(&eCfg.MimeType, "mime", "", "MIME type of the file written by write-file instead of the detected one")
 	flag.Parse()
 
+	// The files of write-file, or the command of -exec, are given as arguments
+	eCfg.Paths = flag.Args()
+
 	file, err := os.Open(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open config file: %w", err)
@@ -0,0 +1,165 @@
+package core
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// archiveMetaKey is the tag of a file record holding the format of the
+// archive, when the record bundles several files.
+const archiveMetaKey = "archive"
+
+// archiveFormatTarGz is the format of the archives written by the agent.
+const archiveFormatTarGz = "tar.gz"
+
+// archiveName returns the default name of the archive of the files.
+func archiveName(paths []string) string {
+	base := filepath.Base(paths[0])
+
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "." + archiveFormatTarGz
+}
+
+// writeArchive bundles the files into a tar.gz archive. The files are stored
+// by their base names, so the names must differ.
+func writeArchive(w io.Writer, paths []string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	names := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		name := filepath.Base(path)
+		if names[name] {
+			return fmt.Errorf("two files are named %s, the archive keeps only the names", name)
+		}
+		names[name] = true
+
+		if err := addArchiveFile(tw, path, name); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed close archive: %w", err)
+	}
+
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed close archive: %w", err)
+	}
+
+	return nil
+}
+
+// addArchiveFile adds the regular file at the path to the archive.
+func addArchiveFile(tw *tar.Writer, path string, name string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed open file: %w", err)
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed read stat file: %w", err)
+	}
+
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+
+	err = tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     fi.Size(),
+		Mode:     int64(defaultPermition),
+		ModTime:  fi.ModTime(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed write archive: %w", err)
+	}
+
+	if _, err := io.Copy(tw, file); err != nil {
+		return fmt.Errorf("failed write archive: %w", err)
+	}
+
+	return nil
+}
+
+// bundleFiles writes the archive of the files to a temporary file, which
+// is sent like a single file. The caller removes the file.
+func bundleFiles(paths []string) (string, error) {
+	file, err := os.CreateTemp("", "goph-keeper-*."+archiveFormatTarGz)
+	if err != nil {
+		return "", fmt.Errorf("failed create archive: %w", err)
+	}
+
+	err = writeArchive(file, paths)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed close archive: %w", closeErr)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+// extractArchive extracts the files of a tar.gz archive into the directory
+// and returns their names. Only regular files without a directory are
+// extracted, so an archive can't write outside the directory.
+func extractArchive(r io.Reader, dir string) ([]string, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed read archive: %w", err)
+	}
+	defer gz.Close()
+
+	var names []string
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return names, nil
+		}
+		if err != nil {
+			return names, fmt.Errorf("failed read archive: %w", err)
+		}
+
+		if hdr.Typeflag != tar.TypeReg || hdr.Name != filepath.Base(hdr.Name) || hdr.Name == ".." ||
+			strings.ContainsAny(hdr.Name, `/\`) {
+			return names, fmt.Errorf("unexpected entry %q in archive", hdr.Name)
+		}
+
+		if err := extractArchiveFile(tr, filepath.Join(dir, hdr.Name)); err != nil {
+			return names, err
+		}
+
+		names = append(names, hdr.Name)
+	}
+}
+
+// extractArchiveFile writes the current file of the archive to the path.
+func extractArchiveFile(tr *tar.Reader, path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, defaultPermition)
+	if err != nil {
+		return fmt.Errorf("failed create file: %w", err)
+	}
+
+	if _, err := io.Copy(file, tr); err != nil {
+		file.Close()
+		return fmt.Errorf("failed extract file: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed close file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testBundle writes files with the contents to a directory and returns their paths.
+func testBundle(t *testing.T, files map[string]string) []string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	var paths []string
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(data), defaultPermition))
+		paths = append(paths, path)
+	}
+
+	return paths
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	files := map[string]string{"cert.pem": "certificate", "key.pem": "private key", "empty": ""}
+	paths := testBundle(t, files)
+
+	archivePath, err := bundleFiles(paths)
+	require.NoError(t, err)
+	defer os.Remove(archivePath)
+
+	data, err := os.ReadFile(archivePath)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	names, err := extractArchive(bytes.NewReader(data), dir)
+	assert.NoError(t, err)
+	assert.Len(t, names, len(files))
+
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		assert.NoError(t, err)
+		assert.Equal(t, want, string(got))
+	}
+}
+
+func TestWriteArchiveSameNames(t *testing.T) {
+	first := testBundle(t, map[string]string{"cert.pem": "first"})
+	second := testBundle(t, map[string]string{"cert.pem": "second"})
+
+	err := writeArchive(io.Discard, append(first, second...))
+	assert.Error(t, err)
+}
+
+func TestExtractArchiveUnsafeEntries(t *testing.T) {
+	for _, name := range []string{"../escape", "dir/file", "/etc/passwd", ".."} {
+		t.Run(name, func(t *testing.T) {
+			var b bytes.Buffer
+			gz := gzip.NewWriter(&b)
+			tw := tar.NewWriter(gz)
+			require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Size: 4, Mode: 0600}))
+			_, err := tw.Write([]byte("data"))
+			require.NoError(t, err)
+			require.NoError(t, tw.Close())
+			require.NoError(t, gz.Close())
+
+			root := t.TempDir()
+			dir := filepath.Join(root, "out")
+			require.NoError(t, os.Mkdir(dir, defaultDirPermition))
+
+			_, err = extractArchive(&b, dir)
+			assert.Error(t, err)
+			assert.NoFileExists(t, filepath.Join(root, "escape"))
+		})
+	}
+}
+
+func TestSaveArchiveRecord(t *testing.T) {
+	output = io.Discard
+
+	archivePath, err := bundleFiles(testBundle(t, map[string]string{"a.txt": "a", "b.txt": "b"}))
+	require.NoError(t, err)
+	defer os.Remove(archivePath)
+
+	data, err := os.ReadFile(archivePath)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		answers string
+		files   []string
+	}{
+		{name: "Extracted by default", answers: "\n\n", files: []string{"a.txt", "b.txt"}},
+		{name: "Saved as the archive", answers: "\nn\n", files: []string{"bundle.tar.gz"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			input = strings.NewReader(tt.answers)
+
+			err := saveFileInDisk(&config.ConfigENV{DownloadDir: dir}, "bundle.tar.gz", data, archiveFormatTarGz)
+			assert.NoError(t, err)
+
+			entries, err := os.ReadDir(dir)
+			assert.NoError(t, err)
+
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			assert.Equal(t, tt.files, names)
+		})
+	}
+}
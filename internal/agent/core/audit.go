@@ -0,0 +1,193 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/Renal37/goph-keeper/internal/agent/client"
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+)
+
+// Passwords shorter than minPasswordLength are weak, passwords shorter than
+// strongPasswordLength are weak unless they have minPasswordClasses kinds of characters.
+var (
+	minPasswordLength    = 8
+	strongPasswordLength = 12
+	minPasswordClasses   = 3
+)
+
+// auditBatchSize is the number of records read by one request.
+var auditBatchSize = 100
+
+// auditRecord is a password of a credentials record to audit.
+type auditRecord struct {
+	Name     string
+	Password string
+}
+
+// credentialsRecord is a decrypted credentials record.
+type credentialsRecord struct {
+	Name     string
+	Category string
+	credentials
+}
+
+// auditReport holds the names of the records with problems, never the passwords.
+type auditReport struct {
+	// Reused are the groups of records sharing the same password.
+	Reused [][]string
+	// Weak are the records with a weak password.
+	Weak []string
+}
+
+// readCredentialsRecords reads and decrypts all credentials records.
+func readCredentialsRecords(cl *client.Client, cfg *config.ConfigENV) ([]credentialsRecord, error) {
+	all, err := cl.ReadAllFile(listOptions(cfg)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed get all file: %w", err)
+	}
+
+	return decryptCredentials(cl, credentialsIDs(all.Units))
+}
+
+// credentialsIDs returns the IDs of the credentials records of the list.
+func credentialsIDs(units []*proto.StorageUnit) []int32 {
+	var ids []int32
+	for _, u := range units {
+		if u.Type == "credentials" {
+			ids = append(ids, u.Id)
+		}
+	}
+
+	return ids
+}
+
+// decryptCredentials reads the credentials records with the IDs in batches.
+func decryptCredentials(cl *client.Client, ids []int32) ([]credentialsRecord, error) {
+	var records []credentialsRecord
+	for start := 0; start < len(ids); start += auditBatchSize {
+		end := min(start+auditBatchSize, len(ids))
+
+		batch, err := cl.ReadMany(ids[start:end])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range batch {
+			// The record may have been deleted in between
+			if r.Error != "" {
+				continue
+			}
+
+			c, err := parseCredentials(r.Data)
+			if err != nil {
+				return nil, err
+			}
+
+			records = append(records, credentialsRecord{Name: r.Name, Category: r.Category, credentials: c})
+		}
+	}
+
+	return records, nil
+}
+
+// auditRecords returns the passwords of the credentials records to audit.
+func auditRecords(records []credentialsRecord) []auditRecord {
+	res := make([]auditRecord, 0, len(records))
+	for _, r := range records {
+		res = append(res, auditRecord{Name: r.Name, Password: r.Password})
+	}
+
+	return res
+}
+
+// auditPasswords finds the reused and weak passwords.
+func auditPasswords(records []auditRecord) auditReport {
+	var report auditReport
+
+	byPassword := make(map[string][]string)
+	for _, r := range records {
+		byPassword[r.Password] = append(byPassword[r.Password], r.Name)
+
+		if isWeakPassword(r.Password) {
+			report.Weak = append(report.Weak, r.Name)
+		}
+	}
+
+	for _, names := range byPassword {
+		if len(names) > 1 {
+			sort.Strings(names)
+			report.Reused = append(report.Reused, names)
+		}
+	}
+
+	// The map order is random
+	sort.Slice(report.Reused, func(i, j int) bool {
+		return report.Reused[i][0] < report.Reused[j][0]
+	})
+	sort.Strings(report.Weak)
+
+	return report
+}
+
+// isWeakPassword reports whether the password is too short or too simple.
+func isWeakPassword(password string) bool {
+	length := len([]rune(password))
+	if length < minPasswordLength {
+		return true
+	}
+
+	if length >= strongPasswordLength {
+		return false
+	}
+
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, other} {
+		if present {
+			classes++
+		}
+	}
+
+	return classes < minPasswordClasses
+}
+
+// printAudit shows the names of the records with problems.
+func printAudit(report auditReport) {
+	if len(report.Reused) == 0 && len(report.Weak) == 0 {
+		fmt.Fprintln(output, "No reused or weak passwords found.")
+		return
+	}
+
+	if len(report.Reused) > 0 {
+		fmt.Fprintln(output, "Reused passwords:")
+		for _, names := range report.Reused {
+			fmt.Fprintf(output, "- %s \n", strings.Join(names, ", "))
+		}
+	}
+
+	if len(report.Weak) > 0 {
+		fmt.Fprintln(output, "Weak passwords:")
+		for _, name := range report.Weak {
+			fmt.Fprintf(output, "- %s \n", name)
+		}
+	}
+
+	fmt.Fprintln(output, "Use rotate-password to replace them.")
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditPasswords(t *testing.T) {
+	records := []auditRecord{
+		{Name: "mail", Password: "Shared#Secret2024"},
+		{Name: "bank", Password: "Unique&Strong9Pass"},
+		{Name: "forum", Password: "Shared#Secret2024"},
+		{Name: "shop", Password: "abc"},
+		{Name: "wiki", Password: "lowercaseonly"},
+		{Name: "chat", Password: "abc"},
+		{Name: "vpn", Password: "Short1!x"},
+		{Name: "git", Password: "Shared#Secret2024"},
+		{Name: "ftp", Password: "password12"},
+	}
+
+	report := auditPasswords(records)
+	assert.Equal(t, [][]string{{"chat", "shop"}, {"forum", "git", "mail"}}, report.Reused)
+	assert.Equal(t, []string{"chat", "ftp", "shop"}, report.Weak)
+}
+
+func TestIsWeakPassword(t *testing.T) {
+	tests := []struct {
+		password string
+		weak     bool
+	}{
+		{password: "", weak: true},
+		{password: "Ab1!", weak: true},
+		{password: "password12", weak: true},
+		{password: "Passw0rd12", weak: false},
+		{password: "lowercaseonly", weak: false},
+		{password: "пароль-Пароль", weak: false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.weak, isWeakPassword(tt.password), tt.password)
+	}
+}
+
+func TestPrintAuditHidesPasswords(t *testing.T) {
+	var out strings.Builder
+	output = &out
+	defer func() { output = os.Stdout }()
+
+	records := []auditRecord{
+		{Name: "mail", Password: "reused"},
+		{Name: "forum", Password: "reused"},
+	}
+
+	printAudit(auditPasswords(records))
+	assert.Contains(t, out.String(), "- forum, mail")
+	assert.Contains(t, out.String(), "Weak passwords:\n- forum \n- mail")
+	assert.NotContains(t, out.String(), "reused")
+}
@@ -0,0 +1,226 @@
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/agent/client"
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+)
+
+// benchmarkPrefix starts the names of the records written by the benchmark.
+const benchmarkPrefix = "goph-keeper-benchmark-"
+
+// Defaults of the benchmark without -bench-sizes and -bench-count.
+var (
+	defaultBenchSizes = "1K,64K,1M"
+	defaultBenchCount = 10
+)
+
+// benchmarkResult is the latencies of the uploads and downloads of records
+// of one size.
+type benchmarkResult struct {
+	size      int
+	uploads   []time.Duration
+	downloads []time.Duration
+}
+
+// benchmark uploads and downloads `-bench-count` records of random data of
+// every size of `-bench-sizes` and prints the throughput and the latency
+// percentiles. The records are files, so they are sent in chunks as any file.
+// The records are deleted at the end, also when the benchmark fails.
+func benchmark(cl *client.Client, cfg *config.ConfigENV) (err error) {
+	sizes, err := parseBenchSizes(cfg.BenchSizes)
+	if err != nil {
+		return err
+	}
+
+	count := cfg.BenchCount
+	if count == 0 {
+		count = defaultBenchCount
+	}
+	if count < 0 {
+		return fmt.Errorf("invalid benchmark count: %v", count)
+	}
+
+	dir, err := os.MkdirTemp("", "goph-keeper-benchmark-*")
+	if err != nil {
+		return fmt.Errorf("failed create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	random := make([]byte, 4)
+	if _, err := rand.Read(random); err != nil {
+		return fmt.Errorf("failed create benchmark name: %w", err)
+	}
+	prefix := benchmarkPrefix + hex.EncodeToString(random) + "-"
+
+	var ids []int32
+	defer func() {
+		err = errors.Join(err, deleteBenchRecords(cl, ids))
+	}()
+
+	for _, size := range sizes {
+		fmt.Fprintf(output, "-> Benchmark of %v records of %s \n", count, formatBenchSize(size))
+
+		res, written, err := benchmarkSize(cl, dir, prefix, size, count)
+		ids = append(ids, written...)
+		if err != nil {
+			return err
+		}
+
+		printBenchmark(result, res)
+	}
+
+	return nil
+}
+
+// benchmarkSize writes and reads back the records of the size one by one.
+// It returns the IDs of the written records, also on failure.
+func benchmarkSize(cl *client.Client, dir string, prefix string, size int, count int) (benchmarkResult, []int32, error) {
+	res := benchmarkResult{size: size}
+
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return res, nil, fmt.Errorf("failed create benchmark data: %w", err)
+	}
+
+	path := filepath.Join(dir, strconv.Itoa(size))
+	if err := os.WriteFile(path, data, defaultPermition); err != nil {
+		return res, nil, fmt.Errorf("failed write benchmark data: %w", err)
+	}
+
+	var ids []int32
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("%s%v-%v", prefix, size, i)
+
+		start := time.Now()
+		w, err := cl.WriteFile("file", name, path)
+		if err != nil {
+			return res, ids, fmt.Errorf("failed upload benchmark record: %w", err)
+		}
+		res.uploads = append(res.uploads, time.Since(start))
+		ids = append(ids, w.Id)
+
+		start = time.Now()
+		r, err := cl.ReadFile(w.Id)
+		if err != nil {
+			return res, ids, fmt.Errorf("failed download benchmark record: %w", err)
+		}
+		res.downloads = append(res.downloads, time.Since(start))
+
+		if !bytes.Equal(r.Data, data) {
+			return res, ids, fmt.Errorf("downloaded benchmark record %v differs from the uploaded", w.Id)
+		}
+	}
+
+	return res, ids, nil
+}
+
+// deleteBenchRecords deletes the records written by the benchmark, the
+// records that can't be deleted are reported by their IDs.
+func deleteBenchRecords(cl *client.Client, ids []int32) error {
+	var failed []string
+	for _, id := range ids {
+		if _, err := cl.DeleteFile(id); err != nil {
+			failed = append(failed, strconv.Itoa(int(id)))
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed delete benchmark records, delete them with delete-file: %s", strings.Join(failed, ", "))
+	}
+
+	fmt.Fprintf(output, "Deleted %v benchmark records \n", len(ids))
+
+	return nil
+}
+
+// printBenchmark prints the throughput and the latencies of the uploads and
+// the downloads of a size.
+func printBenchmark(w io.Writer, res benchmarkResult) {
+	fmt.Fprintf(w, "Size %s, %v records \n", formatBenchSize(res.size), len(res.uploads))
+	printBenchLatencies(w, "upload", res.size, res.uploads)
+	printBenchLatencies(w, "download", res.size, res.downloads)
+}
+
+// printBenchLatencies prints the throughput in MB/s, 10^6 bytes per second,
+// and the percentiles of the latencies.
+func printBenchLatencies(w io.Writer, op string, size int, latencies []time.Duration) {
+	if len(latencies) == 0 {
+		return
+	}
+
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+
+	sorted := slices.Clone(latencies)
+	slices.Sort(sorted)
+
+	mbps := float64(size) * float64(len(latencies)) / 1e6 / total.Seconds()
+	fmt.Fprintf(w, "  %-8s %10.2f MB/s  p50 %s  p90 %s  p99 %s  max %s \n", op+":", mbps,
+		percentile(sorted, 50), percentile(sorted, 90), percentile(sorted, 99), sorted[len(sorted)-1])
+}
+
+// percentile returns the nearest-rank percentile of the sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+
+	return sorted[max(rank, 1)-1].Round(time.Microsecond)
+}
+
+// benchSizeUnits are the suffixes of the sizes of -bench-sizes.
+var benchSizeUnits = map[string]int{"": 1, "K": 1 << 10, "M": 1 << 20}
+
+// parseBenchSizes parses the comma separated sizes of the benchmark records
+// in bytes, with the K or M suffix in KiB or MiB, e.g. "512,64K,1M".
+func parseBenchSizes(s string) ([]int, error) {
+	if s == "" {
+		s = defaultBenchSizes
+	}
+
+	var sizes []int
+	for _, field := range strings.Split(s, ",") {
+		field = strings.ToUpper(strings.TrimSpace(field))
+
+		num := strings.TrimRight(field, "KM")
+		unit, ok := benchSizeUnits[field[len(num):]]
+		if !ok {
+			return nil, fmt.Errorf("invalid benchmark size: %q", field)
+		}
+
+		n, err := strconv.Atoi(num)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid benchmark size: %q", field)
+		}
+
+		sizes = append(sizes, n*unit)
+	}
+
+	return sizes, nil
+}
+
+// formatBenchSize formats the size with the largest unit dividing it.
+func formatBenchSize(size int) string {
+	switch {
+	case size%(1<<20) == 0:
+		return fmt.Sprintf("%v MiB", size>>20)
+	case size%(1<<10) == 0:
+		return fmt.Sprintf("%v KiB", size>>10)
+	default:
+		return fmt.Sprintf("%v bytes", size)
+	}
+}
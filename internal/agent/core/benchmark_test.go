@@ -0,0 +1,109 @@
+package core
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// benchStorage is a vault that also reads the records one by one and counts
+// the written records.
+type benchStorage struct {
+	*vaultStorage
+	written int
+}
+
+func (s *benchStorage) ReadRecord(_ context.Context, in *proto.ReadRecordRequest) (*proto.ReadRecordResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[in.Id]
+	if !ok {
+		return &proto.ReadRecordResponse{Error: "record not found"}, nil
+	}
+
+	return r, nil
+}
+
+func (s *benchStorage) WriteRecord(stream proto.Storage_WriteRecordServer) error {
+	s.mu.Lock()
+	s.written++
+	s.mu.Unlock()
+
+	return s.vaultStorage.WriteRecord(stream)
+}
+
+func TestBenchmark(t *testing.T) {
+	var out strings.Builder
+	output = &out
+	result = &out
+	defer func() {
+		output = os.Stdout
+		result = os.Stdout
+	}()
+
+	storage := &benchStorage{vaultStorage: newVaultStorage()}
+	cl := testClient(t, storage)
+
+	require.NoError(t, benchmark(cl, &config.ConfigENV{BenchSizes: "100,2K", BenchCount: 3}))
+
+	// Every record is uploaded, checked and deleted
+	assert.Equal(t, 6, storage.written)
+	assert.Empty(t, storage.records)
+
+	report := out.String()
+	assert.Contains(t, report, "Size 100 bytes, 3 records \n")
+	assert.Contains(t, report, "Size 2 KiB, 3 records \n")
+	assert.Equal(t, 2, strings.Count(report, "  upload:"))
+	assert.Equal(t, 2, strings.Count(report, "  download:"))
+	assert.Contains(t, report, "MB/s  p50 ")
+	assert.Contains(t, report, "Deleted 6 benchmark records \n")
+}
+
+func TestBenchmarkCleanupOnFailure(t *testing.T) {
+	output = &strings.Builder{}
+	defer func() { output = os.Stdout }()
+
+	// The records can't be read back, the written one is deleted anyway
+	storage := newVaultStorage()
+	cl := testClient(t, storage)
+
+	err := benchmark(cl, &config.ConfigENV{BenchSizes: "10", BenchCount: 2})
+	assert.ErrorContains(t, err, "failed download benchmark record")
+	assert.Empty(t, storage.records)
+	assert.EqualValues(t, 1, storage.nextID)
+}
+
+func TestParseBenchSizes(t *testing.T) {
+	sizes, err := parseBenchSizes("512, 64k,1M")
+	require.NoError(t, err)
+	assert.Equal(t, []int{512, 64 << 10, 1 << 20}, sizes)
+
+	sizes, err = parseBenchSizes("")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1 << 10, 64 << 10, 1 << 20}, sizes)
+
+	for _, s := range []string{"0", "-1", "1G", "K", "1KM", "1,,2"} {
+		_, err := parseBenchSizes(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+
+	assert.Equal(t, 50*time.Millisecond, percentile(sorted, 50))
+	assert.Equal(t, 99*time.Millisecond, percentile(sorted, 99))
+	assert.Equal(t, 100*time.Millisecond, percentile(sorted, 100))
+	assert.Equal(t, time.Millisecond, percentile(sorted[:1], 50))
+}
@@ -2,24 +2,90 @@ package core
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
 
 	"github.com/Renal37/goph-keeper/internal/agent/client"
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
 )
 
 var defaultPermition fs.FileMode = 0600
+var defaultDirPermition fs.FileMode = 0700
 var errorFailedReadSTDIN = "failed read stdin: %w"
 
-func Run(client *client.Client, command string) error {
+// errDataFileCredentials is returned when -data-file is used for a credentials record.
+var errDataFileCredentials = errors.New("-data-file is not supported for credentials, enter the fields")
+
+// input is where the answers to the prompts are read from.
+var input io.Reader = os.Stdin
+
+// output receives the messages and prompts of the interactive commands.
+var output io.Writer = os.Stdout
+
+// Formats of the list of files.
+const (
+	FormatSimple = "simple"
+	FormatTable  = "table"
+)
+
+// maxTableNameLength is the width of the name column of the table format.
+const maxTableNameLength = 32
+
+const ellipsis = "..."
+
+// result receives the output of the commands that is meant for other programs.
+var result io.Writer = os.Stdout
+
+// MessageWriter returns where the messages of the agent are written. When
+// the result of a command is meant for other programs, the messages are
+// written to stderr, so that stdout only contains the result. In quiet mode
+// the messages are dropped.
+func MessageWriter(cfg *config.ConfigENV) io.Writer {
+	if cfg.Quiet {
+		return io.Discard
+	}
+
+	if cfg.ExportEnv || cfg.Raw || cfg.Stdout || cfg.Exec || cfg.Command == "export" || cfg.Command == "ids" {
+		return os.Stderr
+	}
+
+	return os.Stdout
+}
+
+func Run(client *client.Client, cfg *config.ConfigENV) error {
+	output = MessageWriter(cfg)
+
+	if cfg.Command == "export" {
+		if cfg.Format != FormatKeePass && cfg.Format != FormatKeePassXML && cfg.Format != FormatGophJSON {
+			return fmt.Errorf("unknown export format %s, use %s, %s or %s", cfg.Format, FormatKeePass, FormatKeePassXML, FormatGophJSON)
+		}
+	} else if cfg.Command == "import" {
+		if cfg.Format != FormatGophJSON {
+			return fmt.Errorf("unknown import format %s, use %s", cfg.Format, FormatGophJSON)
+		}
+	} else if cfg.Format != "" && cfg.Format != FormatSimple && cfg.Format != FormatTable {
+		return fmt.Errorf("unknown format %s, use %s or %s", cfg.Format, FormatSimple, FormatTable)
+	}
+
 	// Depending on the command, we choose the logic of behavior
-	switch command {
+	switch cfg.Command {
 	case "sign-up":
-		fmt.Println("-> Create new account")
+		fmt.Fprintln(output, "-> Create new account")
 
 		// Get user credentials from stdin tui
 		ss, err := getUserCredentials()
@@ -27,277 +93,1384 @@ func Run(client *client.Client, command string) error {
 			return fmt.Errorf("failed get user credentials: %w", err)
 		}
 
-		r, err := client.Register(ss.login, ss.password)
+		r, err := client.Register(ss.login, ss.password, registerOptions(cfg)...)
 		if err != nil {
 			return fmt.Errorf("failed register user: %w", err)
 		}
 
-		fmt.Printf("Token: %s \n", r.Jwt)
+		fmt.Fprintf(output, "Token: %s \n", r.Jwt)
+
+		// Do you want to save the token?
+		err = saveAuthToken(r.Jwt)
+		if err != nil {
+			return fmt.Errorf("client failed save token: %w", err)
+		}
+	case "sign-in":
+		fmt.Fprintln(output, "-> Sign in with your account")
+
+		ss, err := getUserCredentials()
+		if err != nil {
+			return fmt.Errorf("failed get user credentials: %w", err)
+		}
+
+		r, err := client.Login(ss.login, ss.password, loginOptions(cfg)...)
+		if err != nil {
+			return fmt.Errorf("failed login user: %w", err)
+		}
+
+		fmt.Fprintf(output, "Token: %s \n", r.Jwt)
+		err = saveAuthToken(r.Jwt)
+		if err != nil {
+			return fmt.Errorf("client failed save token: %w", err)
+		}
+	case "read-file":
+		fmt.Fprintln(output, "-> Read file")
+
+		// The file is selected by -id without listing the files
+		i := cfg.ID
+		if i == 0 {
+			// Request to read all file
+			rAllFile, err := client.ReadAllFile(listOptions(cfg)...)
+			if err != nil {
+				return fmt.Errorf("failed get all file: %w", err)
+			}
+
+			// If there are no files, exit
+			if len(rAllFile.Units) == 0 {
+				fmt.Fprintln(output, "Not found files. Bye!")
+				return nil
+			}
+
+			// Showing the available files
+			printFiles(rAllFile.Units, cfg.Format)
+
+			// Selecting a file to download
+			i, err = selectReadFile()
+			if err != nil {
+				return fmt.Errorf("wrong id file: %w", err)
+			}
+		}
+
+		// Request to read the file
+		var rFile *proto.ReadRecordResponse
+		err := withReauth(client, func() error {
+			var err error
+			if cfg.Preview > 0 {
+				rFile, err = client.ReadFilePreview(int32(i), previewLimit(cfg.Preview))
+			} else {
+				rFile, err = client.ReadFile(int32(i))
+			}
+			return err
+		})
+
+		// A record requiring confirmation is read again once the user confirms the read
+		if err != nil {
+			rFile, err = readConfirmed(client, cfg, err)
+		}
+		if err != nil {
+			return fmt.Errorf("failed get all file: %w", err)
+		}
+
+		if cfg.Preview > 0 {
+			printPreview(rFile, cfg.Preview)
+			break
+		}
+
+		err = printRecord(cfg, rFile)
+		if err != nil {
+			return err
+		}
+	case "write-file":
+		fmt.Fprintln(output, "-> Write file")
+
+		// The files given as arguments and the URL are written without selecting the type
+		var id int32
+		var err error
+		switch {
+		case cfg.URL != "":
+			id, err = writeURL(client, cfg)
+		case len(cfg.Paths) > 0:
+			id, err = writePaths(client, cfg)
+		default:
+			// Selecting the file type and the file we want to save
+			id, err = selectWriteData(client, cfg)
+		}
+		if err != nil {
+			return fmt.Errorf("select write data has error: %w", err)
+		}
+
+		printWriteResult(cfg, id)
+	case "delete-file":
+		fmt.Fprintln(output, "-> Delete file")
+
+		// Request to read all file
+		rAllFile, err := client.ReadAllFile(listOptions(cfg)...)
+		if err != nil {
+			return fmt.Errorf("failed get all file: %w", err)
+		}
+
+		// If there are no files, exit
+		if len(rAllFile.Units) == 0 {
+			fmt.Fprintln(output, "Not found files. Bye!")
+			return nil
+		}
+
+		// Showing the available files
+		printFiles(rAllFile.Units, cfg.Format)
+
+		// Select a file to delete
+		i, err := selectReadFile()
+		if err != nil {
+			return fmt.Errorf("wrong id file: %w", err)
+		}
+
+		// Request for delete
+		err = withReauth(client, func() error {
+			_, err := client.DeleteFile(int32(i))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed delete file: %w", err)
+		}
+
+		fmt.Fprintln(output, "File delete!")
+	case "transfer-file":
+		fmt.Fprintln(output, "-> Transfer file")
+
+		// Request to read all file
+		rAllFile, err := client.ReadAllFile(listOptions(cfg)...)
+		if err != nil {
+			return fmt.Errorf("failed get all file: %w", err)
+		}
+
+		// If there are no files, exit
+		if len(rAllFile.Units) == 0 {
+			fmt.Fprintln(output, "Not found files. Bye!")
+			return nil
+		}
+
+		// Showing the available files
+		printFiles(rAllFile.Units, cfg.Format)
+
+		// Select a file and the new owner
+		i, err := selectReadFile()
+		if err != nil {
+			return fmt.Errorf("wrong id file: %w", err)
+		}
+
+		login, err := selectTransferLogin(cfg, i)
+		if err != nil {
+			return err
+		}
+
+		// Request for transfer
+		err = withReauth(client, func() error {
+			_, err := client.TransferFile(int32(i), login)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed transfer file: %w", err)
+		}
+
+		fmt.Fprintf(output, "File transferred to %s! \n", login)
+	case "update-meta":
+		fmt.Fprintln(output, "-> Update tags")
+
+		// Request to read all file
+		rAllFile, err := client.ReadAllFile(listOptions(cfg)...)
+		if err != nil {
+			return fmt.Errorf("failed get all file: %w", err)
+		}
+
+		// If there are no files, exit
+		if len(rAllFile.Units) == 0 {
+			fmt.Fprintln(output, "Not found files. Bye!")
+			return nil
+		}
+
+		// Showing the available files
+		printFiles(rAllFile.Units, cfg.Format)
+
+		// Select a file to change
+		i, err := selectReadFile()
+		if err != nil {
+			return fmt.Errorf("wrong id file: %w", err)
+		}
+
+		set, remove, err := selectTags()
+		if err != nil {
+			return fmt.Errorf("select tags has error: %w", err)
+		}
+
+		r, err := client.UpdateMeta(int32(i), set, remove, cfg.Replace)
+		if err != nil {
+			return fmt.Errorf("failed update tags: %w", err)
+		}
+
+		fmt.Fprintf(output, "Tags: %s \n", formatTags(r.Meta))
+	case "diff-file":
+		// A stored file is compared with a local file given by -local
+		if cfg.Local != "" {
+			fmt.Fprintln(output, "-> Diff file with local file")
+
+			err := diffLocalFile(client, cfg)
+			if err != nil {
+				return fmt.Errorf("failed diff local file: %w", err)
+			}
+			break
+		}
+
+		fmt.Fprintln(output, "-> Diff file versions")
+
+		// Request to read all file
+		rAllFile, err := client.ReadAllFile(listOptions(cfg)...)
+		if err != nil {
+			return fmt.Errorf("failed get all file: %w", err)
+		}
+
+		// If there are no files, exit
+		if len(rAllFile.Units) == 0 {
+			fmt.Fprintln(output, "Not found files. Bye!")
+			return nil
+		}
+
+		// Showing the available files
+		printFiles(rAllFile.Units, cfg.Format)
+
+		// Select a file and two of its versions
+		i, err := selectReadFile()
+		if err != nil {
+			return fmt.Errorf("wrong id file: %w", err)
+		}
+
+		from, to, err := selectVersions()
+		if err != nil {
+			return fmt.Errorf("wrong version: %w", err)
+		}
+
+		var rFrom, rTo *proto.ReadRecordResponse
+		err = withReauth(client, func() error {
+			rFrom, err = client.ReadFileVersion(int32(i), int32(from))
+			if err != nil {
+				return err
+			}
+
+			rTo, err = client.ReadFileVersion(int32(i), int32(to))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed get file version: %w", err)
+		}
+
+		fmt.Fprint(output, diffRecords(
+			fmt.Sprintf("%s (version %v)", rFrom.Name, from), rFrom.Data,
+			fmt.Sprintf("%s (version %v)", rTo.Name, to), rTo.Data,
+			rFrom.Type == "file" || rTo.Type == "file",
+		))
+	case "rotate-password":
+		fmt.Fprintln(output, "-> Rotate password")
+
+		// Request to read all file
+		rAllFile, err := client.ReadAllFile(listOptions(cfg)...)
+		if err != nil {
+			return fmt.Errorf("failed get all file: %w", err)
+		}
+
+		// If there are no files, exit
+		if len(rAllFile.Units) == 0 {
+			fmt.Fprintln(output, "Not found files. Bye!")
+			return nil
+		}
+
+		// Showing the available files
+		printFiles(rAllFile.Units, cfg.Format)
+
+		// Select the credentials to rotate
+		i, err := selectReadFile()
+		if err != nil {
+			return fmt.Errorf("wrong id file: %w", err)
+		}
+
+		var password string
+		err = withReauth(client, func() error {
+			password, err = RotatePassword(client, int32(i))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed rotate password: %w", err)
+		}
+
+		// The password is shown only once
+		fmt.Fprintf(output, "New password: %s \n", password)
+		fmt.Fprintln(output, "The previous password is kept in the file history, see diff-file.")
+	case "ids":
+		fmt.Fprintln(output, "-> List IDs")
+
+		rAllFile, err := client.ReadAllFile(listOptions(cfg)...)
+		if err != nil {
+			return fmt.Errorf("failed get all file: %w", err)
+		}
+
+		printIDs(rAllFile.Units)
+	case "info-file":
+		fmt.Fprintln(output, "-> File info")
+
+		if err := infoFile(client, cfg); err != nil {
+			return err
+		}
+	case "update-file":
+		fmt.Fprintln(output, "-> Update file")
+
+		if err := updateFile(client, cfg); err != nil {
+			return err
+		}
+	case "list-folder":
+		fmt.Fprintln(output, "-> List folder")
+
+		if err := listFolder(client, cfg); err != nil {
+			return err
+		}
+	case "tag-files":
+		fmt.Fprintln(output, "-> Tag files")
+
+		if err := tagFiles(client, cfg); err != nil {
+			return err
+		}
+	case "shares-out":
+		fmt.Fprintln(output, "-> Files you share")
+
+		if err := sharesOut(client); err != nil {
+			return err
+		}
+	case "shares-in":
+		fmt.Fprintln(output, "-> Files shared with you")
+
+		if err := sharesIn(client); err != nil {
+			return err
+		}
+	case "categories":
+		fmt.Fprintln(output, "-> Categories")
+
+		// Request categories with counts
+		r, err := client.ReadCategories()
+		if err != nil {
+			return fmt.Errorf("failed get categories: %w", err)
+		}
+
+		// If there are no categories, exit
+		if len(r.Categories) == 0 {
+			fmt.Fprintln(output, "Not found categories. Bye!")
+			return nil
+		}
+
+		for _, v := range r.Categories {
+			fmt.Fprintf(output, "%s - %v \n", v.Name, v.Count)
+		}
+	case "audit-passwords":
+		fmt.Fprintln(output, "-> Audit passwords")
+
+		var records []credentialsRecord
+		err := withReauth(client, func() error {
+			var err error
+			records, err = readCredentialsRecords(client, cfg)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed read credentials: %w", err)
+		}
+
+		printAudit(auditPasswords(auditRecords(records)))
+	case "audit-expiry":
+		fmt.Fprintln(output, "-> Audit password expiry")
+
+		var records []credentialsRecord
+		err := withReauth(client, func() error {
+			var err error
+			records, err = readCredentialsRecords(client, cfg)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed read credentials: %w", err)
+		}
+
+		printExpiry(overduePasswords(records, time.Now()))
+	case "export":
+		if cfg.Format == FormatGophJSON {
+			fmt.Fprintln(output, "-> Export files")
+
+			var count int
+			err := withReauth(client, func() error {
+				var err error
+				if cfg.Out != "" {
+					count, err = exportGophJSONFile(client, cfg, cfg.Out)
+				} else {
+					count, err = exportGophJSON(client, cfg, result)
+				}
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("failed export files: %w", err)
+			}
+
+			fmt.Fprintf(output, "Exported %v files, the data is not encrypted! \n", count)
+			return nil
+		}
+
+		fmt.Fprintln(output, "-> Export credentials")
+
+		var count int
+		err := withReauth(client, func() error {
+			var err error
+			pages := readCredentialsPages(client, cfg)
+			if cfg.Out != "" {
+				count, err = exportKeePassFile(cfg.Out, cfg.Format, pages)
+			} else {
+				count, err = exportKeePass(result, cfg.Format, pages)
+			}
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed export credentials: %w", err)
+		}
+
+		fmt.Fprintf(output, "Exported %v credentials, the passwords are not encrypted! \n", count)
+	case "import":
+		fmt.Fprintln(output, "-> Import files")
+
+		if err := importFiles(client, cfg); err != nil {
+			return err
+		}
+	case "token-info":
+		fmt.Fprintln(output, "-> Token info")
+
+		if client.Token == "" {
+			return fmt.Errorf("token not found, sign in first")
+		}
+
+		// The token is only decoded, the server is not contacted
+		claims, err := client.Claims()
+		if err != nil {
+			return err
+		}
+
+		printTokenInfo(claims, time.Now())
+	case "offline-stash":
+		fmt.Fprintln(output, "-> Stash file offline")
+
+		path, err := stashData(cfg)
+		if err != nil {
+			return fmt.Errorf("failed stash file: %w", err)
+		}
+
+		fmt.Fprintf(output, "File stashed in %s, upload it with sync \n", path)
+	case "sync":
+		fmt.Fprintln(output, "-> Sync stashed files")
+
+		passphrase, err := readPassphrase(bufio.NewReader(input), false)
+		if err != nil {
+			return err
+		}
+
+		synced, err := syncSpool(spoolDir(cfg), passphrase, func(rec stashedRecord) error {
+			return uploadStashed(client, rec)
+		})
+		fmt.Fprintf(output, "Uploaded %v stashed files \n", synced)
+		if err != nil {
+			return fmt.Errorf("failed sync: %w", err)
+		}
+	case "rekey":
+		fmt.Fprintln(output, "-> Change passphrase of the stash")
+
+		rekeyed, err := rekeyStash(cfg)
+		if err != nil {
+			return fmt.Errorf("failed rekey: %w", err)
+		}
+
+		fmt.Fprintf(output, "Re-encrypted %v stashed files \n", rekeyed)
+	case "healthcheck":
+		fmt.Fprintln(output, "-> Health check")
+
+		err := withReauth(client, func() error {
+			return client.HealthCheck(cfg.Deep)
+		})
+		if err != nil {
+			return fmt.Errorf("server is not healthy: %w", err)
+		}
+
+		fmt.Fprintln(result, "OK")
+	case "benchmark":
+		err := benchmark(client, cfg)
+		if err != nil {
+			return fmt.Errorf("failed benchmark: %w", err)
+		}
+	default:
+		fmt.Fprintf(output, "Command:%s not found! \n", cfg.Command)
+	}
+
+	fmt.Fprintln(output, "Bye!")
+	return nil
+}
+
+// UTILS FOR WRITE FILE.
+
+// printRecord shows the read record. The credentials can be exported as
+// environment variables, credentials and json records written to an env file
+// with -env-file, with -qr the record is shown as a QR code, with -stdout the decrypted data of any record is
+// written to stdout as is, with -fifo to a named pipe, with -exec to the
+// stdin of a command, files are saved on disk otherwise.
+func printRecord(cfg *config.ConfigENV, rFile *proto.ReadRecordResponse) error {
+	if cfg.Exec {
+		return execWithData(cfg.Paths, rFile.Data)
+	}
+
+	if cfg.EnvFile != "" {
+		vars, err := envFileVars(rFile)
+		if err != nil {
+			return err
+		}
+
+		if err := writeEnvFile(cfg.EnvFile, formatEnvFile(vars), cfg.Force); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(output, "Written %v variables to %s \n", len(vars), cfg.EnvFile)
+		return nil
+	}
+
+	if cfg.ExportEnv {
+		if rFile.Type != "credentials" {
+			return fmt.Errorf("only credentials can be exported, the file type is %s", rFile.Type)
+		}
+
+		c, err := parseCredentials(rFile.Data)
+		if err != nil {
+			return err
+		}
+
+		exported, err := exportCredentials(c, cfg.ExportFormat)
+		if err != nil {
+			return err
+		}
+
+		// Only the variables go to stdout, so the output can be eval'd
+		fmt.Fprint(result, exported)
+		return nil
+	}
+
+	if cfg.QR || cfg.QRASCII {
+		payload, err := qrPayload(rFile)
+		if err != nil {
+			return err
+		}
+
+		return renderQR(result, payload, cfg.QRASCII)
+	}
+
+	if cfg.Stdout {
+		// Exactly the stored bytes, so the output can be piped to other tools
+		if _, err := result.Write(rFile.Data); err != nil {
+			return fmt.Errorf("failed write data: %w", err)
+		}
+
+		return nil
+	}
+
+	if cfg.FIFO != "" {
+		fmt.Fprintf(output, "Waiting for a reader of %s... \n", cfg.FIFO)
+
+		// Waiting for the reader is interrupted by Ctrl+C
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		return writeFIFO(ctx, cfg.FIFO, rFile.Data)
+	}
+
+	switch rFile.Type {
+	case "file":
+		if rFile.MimeType != "" {
+			fmt.Fprintf(output, "MIME type: %s \n", rFile.MimeType)
+		}
+
+		err := saveFileInDisk(cfg, rFile.Name, rFile.Data, rFile.Meta[archiveMetaKey])
+		if err != nil {
+			return fmt.Errorf("save file has error: %w", err)
+		}
+	case "credentials":
+		c, err := parseCredentials(rFile.Data)
+		if err != nil {
+			return err
+		}
+
+		printCredentials(c)
+	case "json":
+		return printJSON(cfg, rFile.Data)
+	default:
+		// Else type is text
+		if cfg.Raw {
+			// Exactly the stored bytes, without a trailing line break
+			if _, err := result.Write(rFile.Data); err != nil {
+				return fmt.Errorf("failed write data: %w", err)
+			}
+
+			return nil
+		}
+
+		fmt.Fprintln(output, string(rFile.Data))
+	}
+
+	return nil
+}
+
+// saveFileInDisk saving files to disk.
+// The configured download directory is offered as the default answer,
+// with `-yes` it is used without prompting. A missing directory is created
+// after confirmation. The files of an archive record can be extracted
+// instead of saving the archive. With -ephemeral the saved files are wiped
+// after the TTL.
+func saveFileInDisk(cfg *config.ConfigENV, fileName string, data []byte, archive string) error {
+	// Create a reader for input from standard input (console)
+	reader := bufio.NewReader(input)
+
+	dirPath := cfg.DownloadDir
+	if !cfg.AssumeYes || dirPath == "" {
+		fmt.Fprintln(output, "Where do you want to save the file?")
+		if dirPath != "" {
+			fmt.Fprintf(output, "Enter dir path [%s]: ", dirPath)
+		} else {
+			fmt.Fprint(output, "Enter dir path: ")
+		}
+
+		// Consider the user's response
+		r, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf(errorFailedReadSTDIN, err)
+		}
+
+		// Trim the spaces and newline characters from the response
+		if r = strings.TrimSpace(r); r != "" {
+			dirPath = r
+		}
+	}
+
+	err := ensureDir(cfg, reader, dirPath)
+	if err != nil {
+		return err
+	}
+
+	if archive == archiveFormatTarGz {
+		extract, err := confirmExtract(cfg, reader)
+		if err != nil {
+			return err
+		}
+
+		if extract {
+			names, err := extractArchive(bytes.NewReader(data), dirPath)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(output, "Extracted %v files in: %s \n", len(names), filepath.Join(dirPath, "."))
+			paths := make([]string, 0, len(names))
+			for _, name := range names {
+				fmt.Fprintf(output, "- %s \n", name)
+				paths = append(paths, filepath.Join(dirPath, name))
+			}
+
+			if cfg.Ephemeral {
+				return keepEphemeral(cfg, paths)
+			}
+
+			return nil
+		}
+	}
+
+	fullPath, err := safeFilePath(dirPath, fileName)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(fullPath, data, defaultPermition)
+	if err != nil {
+		return fmt.Errorf("failed write data: %w", err)
+	}
+
+	fmt.Fprintf(output, "File save in: %s \n", fullPath)
+
+	if cfg.Ephemeral {
+		return keepEphemeral(cfg, []string{fullPath})
+	}
+
+	return nil
+}
+
+// errUnsafeFileName is returned for a file name that leads out of the
+// download directory.
+var errUnsafeFileName = errors.New("unsafe file name")
+
+// safeFilePath returns the path of the file in the directory. The name comes
+// from the server, so only its base component is used, e.g. of a record
+// written before the server checked the names; absolute names and names with
+// ".." are rejected. Both separators are checked, as the record may have been
+// written on another system.
+func safeFilePath(dir string, name string) (string, error) {
+	slashed := strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(slashed, "/") || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("%w %q: absolute path", errUnsafeFileName, name)
+	}
+
+	for _, elem := range strings.Split(slashed, "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("%w %q: path traversal", errUnsafeFileName, name)
+		}
+	}
+
+	base := path.Base(slashed)
+	if base == "." || base == "/" {
+		return "", fmt.Errorf("%w %q: not a file name", errUnsafeFileName, name)
+	}
+
+	fullPath := filepath.Join(dir, base)
+
+	// The last line of defense, the file must stay in the directory
+	rel, err := filepath.Rel(dir, fullPath)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%w %q: the path escapes %s", errUnsafeFileName, name, dir)
+	}
+
+	return fullPath, nil
+}
+
+// diffLocalFile compares the local file of `-local` with the stored record of
+// `-id`, the record is selected from the list without `-id`.
+func diffLocalFile(cl *client.Client, cfg *config.ConfigENV) error {
+	local, err := os.ReadFile(cfg.Local)
+	if err != nil {
+		return fmt.Errorf("failed read local file: %w", err)
+	}
+
+	i := cfg.ID
+	if i == 0 {
+		rAllFile, err := cl.ReadAllFile(listOptions(cfg)...)
+		if err != nil {
+			return fmt.Errorf("failed get all file: %w", err)
+		}
+
+		if len(rAllFile.Units) == 0 {
+			return fmt.Errorf("not found files")
+		}
+
+		printFiles(rAllFile.Units, cfg.Format)
+
+		i, err = selectReadFile()
+		if err != nil {
+			return fmt.Errorf("wrong id file: %w", err)
+		}
+	}
+
+	var rec *proto.ReadRecordResponse
+	err = withReauth(cl, func() error {
+		rec, err = cl.ReadFile(int32(i))
+		return err
+	})
+	if err != nil {
+		rec, err = readConfirmed(cl, cfg, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed get file: %w", err)
+	}
+
+	fmt.Fprint(output, diffLocal(filepath.Base(cfg.Local), local, rec))
+
+	return nil
+}
+
+// readConfirmed reads the record requiring confirmation of the error once
+// the user confirms the read, other errors are returned as is. With `-yes`
+// the read is confirmed without prompting.
+func readConfirmed(cl *client.Client, cfg *config.ConfigENV, err error) (*proto.ReadRecordResponse, error) {
+	var confirm *client.ConfirmationRequiredError
+	if !errors.As(err, &confirm) {
+		return nil, err
+	}
+
+	if !cfg.AssumeYes {
+		fmt.Fprintf(output, "File %v requires confirmation, the read is logged by the server. Read it? [y/N]: ", confirm.ID)
+
+		r, err := bufio.NewReader(input).ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf(errorFailedReadSTDIN, err)
+		}
+
+		if strings.ToLower(strings.TrimSpace(r)) != "y" {
+			return nil, fmt.Errorf("read canceled")
+		}
+	}
+
+	rec, err := cl.ReadFileConfirmed(confirm.ID, confirm.Challenge)
+	if err != nil {
+		return nil, fmt.Errorf("failed read confirmed file: %w", err)
+	}
+
+	return rec, nil
+}
+
+// confirmExtract asks whether to extract an archive, with `-yes` it is extracted.
+func confirmExtract(cfg *config.ConfigENV, reader *bufio.Reader) (bool, error) {
+	if cfg.AssumeYes {
+		return true, nil
+	}
+
+	fmt.Fprint(output, "The file is an archive of several files. Extract them? [Y/n]: ")
+
+	r, err := reader.ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf(errorFailedReadSTDIN, err)
+	}
+
+	return strings.ToLower(strings.TrimSpace(r)) != "n", nil
+}
+
+// ensureDir creates the directory if it does not exist, asking for
+// confirmation unless `-yes` is set.
+func ensureDir(cfg *config.ConfigENV, reader *bufio.Reader, dirPath string) error {
+	if dirPath == "" {
+		return nil
+	}
+
+	_, err := os.Stat(dirPath)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed check dir: %w", err)
+	}
+
+	if !cfg.AssumeYes {
+		fmt.Fprintf(output, "Directory %s does not exist. Create it? [y/N]: ", dirPath)
+
+		r, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf(errorFailedReadSTDIN, err)
+		}
+
+		if strings.ToLower(strings.TrimSpace(r)) != "y" {
+			return fmt.Errorf("directory %s does not exist", dirPath)
+		}
+	}
+
+	err = os.MkdirAll(dirPath, defaultDirPermition)
+	if err != nil {
+		return fmt.Errorf("failed create dir: %w", err)
+	}
+
+	return nil
+}
+
+// selectWriteData selecting a file to download.
+func selectWriteData(client *client.Client, cfg *config.ConfigENV) (int32, error) {
+	// Create a reader for input from standard input (console)
+	reader := bufio.NewReader(input)
+
+	d, err := readWriteData(reader, cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	// Send the gRPC data
+	w, err := client.WriteFile(d.typ, d.name, d.data, writeOptions(cfg, d.category)...)
+	if err != nil {
+		return 0, fmt.Errorf("write file has error: %w", err)
+	}
+
+	return w.Id, nil
+}
+
+// writeData is a record entered by the user. The data of a file record is
+// the path of the file.
+type writeData struct {
+	typ      string
+	name     string
+	category string
+	data     string
+}
+
+// readWriteData asks the user for the type, the name, the category and the
+// data of a new record.
+func readWriteData(reader *bufio.Reader, cfg *config.ConfigENV) (writeData, error) {
+	fmt.Fprintln(output, "What you want send on server?")
+	fmt.Fprintln(output, "[1] - Text")
+	fmt.Fprintln(output, "[2] - File")
+	fmt.Fprint(output, "Enter a number: ")
+
+	// Consider the user's response
+	r, err := reader.ReadString('\n')
+	if err != nil {
+		return writeData{}, fmt.Errorf(errorFailedReadSTDIN, err)
+	}
+
+	// Trim the spaces and newline characters from the response
+	r = strings.TrimSpace(r)
+
+	i, err := strconv.Atoi(r)
+	if err != nil {
+		return writeData{}, fmt.Errorf("failed parse int: %w", err)
+	}
+
+	switch i {
+	case 1:
+		fmt.Fprintln(output, "What do you want to save?")
+		fmt.Fprintln(output, "[1] - Custom text")
+		fmt.Fprintln(output, "[2] - Login | Password")
+		fmt.Fprintln(output, "[3] - Credit card")
+		fmt.Fprintln(output, "[4] - JSON")
+		fmt.Fprint(output, "Enter a number: ")
+
+		r, err := reader.ReadString('\n')
+		if err != nil {
+			return writeData{}, fmt.Errorf(errorFailedReadSTDIN, err)
+		}
+
+		r = strings.TrimSpace(r)
 
-		// Do you want to save the token?
-		err = saveAuthToken(r.Jwt)
+		i, err := strconv.Atoi(r)
 		if err != nil {
-			return fmt.Errorf("client failed save token: %w", err)
+			return writeData{}, fmt.Errorf("failed parse int: %w", err)
 		}
-	case "sign-in":
-		fmt.Println("-> Sign in with your account")
 
-		ss, err := getUserCredentials()
-		if err != nil {
-			return fmt.Errorf("failed get user credentials: %w", err)
-		}
+		fmt.Fprint(output, "Enter name: ")
 
-		r, err := client.Login(ss.login, ss.password)
+		fileName, err := reader.ReadString('\n')
 		if err != nil {
-			return fmt.Errorf("failed login user: %w", err)
+			return writeData{}, fmt.Errorf(errorFailedReadSTDIN, err)
 		}
 
-		fmt.Printf("Token: %s \n", r.Jwt)
-		err = saveAuthToken(r.Jwt)
+		fileName = strings.TrimSpace(fileName)
+
+		category, err := readCategory(reader)
 		if err != nil {
-			return fmt.Errorf("client failed save token: %w", err)
+			return writeData{}, err
 		}
-	case "read-file":
-		fmt.Println("-> Read file")
 
-		// Request to read all file
-		rAllFile, err := client.ReadAllFile()
+		typ, data, err := readRecordData(reader, cfg, i)
 		if err != nil {
-			return fmt.Errorf("failed get all file: %w", err)
+			return writeData{}, err
 		}
 
-		// If there are no files, exit
-		if len(rAllFile.Units) == 0 {
-			fmt.Println("Not found files. Bye!")
-			return nil
-		}
+		return writeData{typ: typ, name: fileName, category: category, data: data}, nil
 
-		// Showing the available files
-		fmt.Println("Available files:")
-		for _, v := range rAllFile.Units {
-			// TODO: Откуда 0 ? Size slice ?
-			if v.Id > 0 {
-				fmt.Printf("[%v] - %s \n", v.Id, v.Name)
-			}
-		}
+	//nolint:gomnd // This legal number
+	case 2:
+		fmt.Fprint(output, "Enter the link to the file: ")
 
-		// Selecting a file to download
-		i, err := selectReadFile()
+		// Consider the user's response
+		filePath, err := reader.ReadString('\n')
 		if err != nil {
-			return fmt.Errorf("wrong id file: %w", err)
+			return writeData{}, fmt.Errorf(errorFailedReadSTDIN, err)
 		}
 
-		// Request to read the file
-		rFile, err := client.ReadFile(int32(i))
+		filePath = strings.TrimSpace(filePath)
+
+		category, err := readCategory(reader)
 		if err != nil {
-			return fmt.Errorf("failed get all file: %w", err)
+			return writeData{}, err
 		}
 
-		// If the file type is file
-		if rFile.Type == "file" {
-			err = saveFileInDisk(rFile.Name, rFile.Data)
+		return writeData{typ: "file", name: filepath.Base(filePath), category: category, data: filePath}, nil
+	}
+
+	return writeData{}, fmt.Errorf("unknown data type: %v", i)
+}
+
+// writePaths writes the files given as arguments as one file record. Several
+// files are bundled into a tar.gz archive, the format of the archive is kept
+// in the metadata of the record, so read-file can extract it.
+func writePaths(cl *client.Client, cfg *config.ConfigENV) (int32, error) {
+	reader := bufio.NewReader(input)
+
+	filePath := cfg.Paths[0]
+	name := filepath.Base(filePath)
+	var meta map[string]string
+
+	if len(cfg.Paths) > 1 {
+		name = archiveName(cfg.Paths)
+		if !cfg.AssumeYes {
+			fmt.Fprintf(output, "Enter name of the archive [%s]: ", name)
+
+			r, err := reader.ReadString('\n')
 			if err != nil {
-				return fmt.Errorf("save file has error: %w", err)
+				return 0, fmt.Errorf(errorFailedReadSTDIN, err)
 			}
-		} else {
-			// Else type is text
-			fmt.Println(string(rFile.Data))
-		}
-	case "write-file":
-		fmt.Println("-> Write file")
 
-		// Selecting the file type and the file we want to save
-		err := selectWriteData(client)
-		if err != nil {
-			return fmt.Errorf("select write data has error: %w", err)
+			if r = strings.TrimSpace(r); r != "" {
+				name = r
+			}
 		}
-	case "delete-file":
-		fmt.Println("-> Delete file")
 
-		// Request to read all file
-		rAllFile, err := client.ReadAllFile()
+		archivePath, err := bundleFiles(cfg.Paths)
 		if err != nil {
-			return fmt.Errorf("failed get all file: %w", err)
+			return 0, err
 		}
+		defer os.Remove(archivePath)
 
-		// If there are no files, exit
-		if len(rAllFile.Units) == 0 {
-			fmt.Println("Not found files. Bye!")
-			return nil
-		}
+		filePath = archivePath
+		meta = map[string]string{archiveMetaKey: archiveFormatTarGz}
+	}
 
-		// Showing the available files
-		fmt.Println("Available files:")
-		for _, v := range rAllFile.Units {
-			// TODO: Откуда 0 ? Size slice ?
-			if v.Id > 0 {
-				fmt.Printf("[%v] - %s \n", v.Id, v.Name)
-			}
-		}
+	category, err := readCategory(reader)
+	if err != nil {
+		return 0, err
+	}
 
-		// Select a file to delete
-		i, err := selectReadFile()
-		if err != nil {
-			return fmt.Errorf("wrong id file: %w", err)
-		}
+	opts := writeOptions(cfg, category)
+	if meta != nil {
+		opts = append(opts, client.WithMeta(meta))
+	}
 
-		// Request for delete
-		_, err = client.DeleteFile(int32(i))
+	w, err := cl.WriteFile("file", name, filePath, opts...)
+	if err != nil {
+		return 0, fmt.Errorf("write file has error: %w", err)
+	}
+
+	return w.Id, nil
+}
+
+// printWriteResult reports the written record. In quiet mode only the ID of
+// the record is printed, so a script can capture it.
+func printWriteResult(cfg *config.ConfigENV, id int32) {
+	if cfg.Quiet {
+		fmt.Fprintln(result, id)
+		return
+	}
+
+	fmt.Fprintf(output, "File write! ID: %v \n", id)
+}
+
+// readText reads the text of a record. Normally it is a single line without
+// the surrounding spaces, in raw mode everything up to EOF is kept byte for byte.
+func readText(reader *bufio.Reader, raw bool) (string, error) {
+	if raw {
+		data, err := io.ReadAll(reader)
 		if err != nil {
-			return fmt.Errorf("failed delete file: %w", err)
+			return "", fmt.Errorf(errorFailedReadSTDIN, err)
 		}
 
-		fmt.Println("File delete!")
-	default:
-		fmt.Printf("Command:%s not found! \n", command)
+		return string(data), nil
 	}
 
-	fmt.Println("Bye!")
-	return nil
+	data, err := reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf(errorFailedReadSTDIN, err)
+	}
+
+	return strings.TrimSpace(data), nil
 }
 
-// UTILS FOR WRITE FILE.
+// readRecordData reads the data of a text record of the selected kind and
+// returns the type of the record and the data. With -data-file the data is
+// read from the file instead of the input.
+func readRecordData(reader *bufio.Reader, cfg *config.ConfigENV, kind int) (string, string, error) {
+	typ := "text"
+	var prompt string
 
-// saveFileInDisk saving files to disk.
-func saveFileInDisk(fileName string, data []byte) error {
-	fmt.Println("Where do you want to save the file?")
-	fmt.Print("Enter dir path: ")
+	switch kind {
+	case 1:
+		prompt = "Enter text:"
+		if cfg.Raw {
+			prompt = "Enter text, finish with EOF (Ctrl+D):"
+		}
+	//nolint:gomnd // This legal number
+	case 2:
+		typ = "credentials"
+	//nolint:gomnd // This legal number
+	case 3:
+		prompt = "Enter number, name, date and CVV:"
+	//nolint:gomnd // This legal number
+	case 4:
+		typ = "json"
+		prompt = "Enter JSON:"
+		if cfg.Raw {
+			prompt = "Enter JSON, finish with EOF (Ctrl+D):"
+		}
+	}
 
-	// Create a reader for input from standard input (console)
-	reader := bufio.NewReader(os.Stdin)
+	var data string
+	var err error
 
-	// Consider the user's response
-	r, err := reader.ReadString('\n')
+	switch {
+	case typ == "credentials" && cfg.DataFile != "":
+		return "", "", errDataFileCredentials
+	case typ == "credentials":
+		data, err = readCredentials(reader, nil)
+	case cfg.DataFile != "":
+		data, err = readDataFile(cfg.DataFile)
+	default:
+		fmt.Fprintln(output, prompt)
+		data, err = readText(reader, cfg.Raw)
+	}
 	if err != nil {
-		return fmt.Errorf(errorFailedReadSTDIN, err)
+		return "", "", err
 	}
 
-	// Trim the spaces and newline characters from the response
-	dirPath := strings.TrimSpace(r)
-	fullPath := filepath.Join(dirPath, fileName)
+	return typ, data, nil
+}
 
-	err = os.WriteFile(fullPath, data, defaultPermition)
+// readDataFile reads the data of a text record from the file. The file is
+// stored byte for byte like with -raw, so it must be UTF-8 text, other
+// files are written with the file type.
+func readDataFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("failed write data: %w", err)
+		return "", fmt.Errorf("failed read data file: %w", err)
 	}
 
-	fmt.Printf("File save in: %s \n", fullPath)
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("data file %s is not UTF-8 text, write it as a file", path)
+	}
 
-	return nil
+	return string(data), nil
 }
 
-// selectWriteData selecting a file to download.
-func selectWriteData(client *client.Client) error {
-	fmt.Println("What you want send on server?")
-	fmt.Println("[1] - Text")
-	fmt.Println("[2] - File")
-	fmt.Print("Enter a number: ")
+// readCredentials reads the fields of a credentials record and returns
+// the record data. For an update the current credentials of the record are
+// given: the time of the password change is kept unless another password is
+// entered, and an empty rotation interval keeps the current one.
+func readCredentials(reader *bufio.Reader, current *credentials) (string, error) {
+	var c credentials
+
+	fields := []struct {
+		prompt string
+		value  *string
+	}{
+		{"Enter login: ", &c.Login},
+		{"Enter password: ", &c.Password},
+		{"Enter URL (optional): ", &c.URL},
+		{"Enter notes (optional): ", &c.Notes},
+	}
+	for _, f := range fields {
+		fmt.Fprint(output, f.prompt)
 
-	// Create a reader for input from standard input (console)
-	reader := bufio.NewReader(os.Stdin)
+		r, err := reader.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf(errorFailedReadSTDIN, err)
+		}
 
-	// Consider the user's response
+		*f.value = strings.TrimSpace(r)
+	}
+
+	fmt.Fprint(output, "Enter password rotation interval in days (optional): ")
 	r, err := reader.ReadString('\n')
 	if err != nil {
-		return fmt.Errorf(errorFailedReadSTDIN, err)
+		return "", fmt.Errorf(errorFailedReadSTDIN, err)
 	}
 
-	// Trim the spaces and newline characters from the response
-	r = strings.TrimSpace(r)
+	days := strings.TrimSpace(r)
+	switch {
+	case days != "":
+		c.RotationDays, err = strconv.Atoi(days)
+		if err != nil || c.RotationDays < 0 {
+			return "", fmt.Errorf("wrong rotation interval: %s", days)
+		}
+	case current != nil:
+		c.RotationDays = current.RotationDays
+	}
 
-	i, err := strconv.Atoi(r)
-	if err != nil {
-		return fmt.Errorf("failed parse int: %w", err)
+	if current != nil && c.Password == current.Password {
+		c.PasswordChangedAt = current.PasswordChangedAt
+	} else {
+		changed := time.Now().UTC().Truncate(time.Second)
+		c.PasswordChangedAt = &changed
 	}
 
-	switch i {
-	case 1:
-		fmt.Println("What do you want to save?")
-		fmt.Println("[1] - Custom text")
-		fmt.Println("[2] - Login | Password")
-		fmt.Println("[3] - Credit card")
-		fmt.Print("Enter a number: ")
+	return encodeCredentials(c)
+}
 
-		r, err := reader.ReadString('\n')
-		if err != nil {
-			return fmt.Errorf(errorFailedReadSTDIN, err)
-		}
+// readCategory reads an optional record category.
+func readCategory(reader *bufio.Reader) (string, error) {
+	fmt.Fprint(output, "Enter category (optional): ")
 
-		r = strings.TrimSpace(r)
+	category, err := reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf(errorFailedReadSTDIN, err)
+	}
 
-		i, err := strconv.Atoi(r)
-		if err != nil {
-			return fmt.Errorf("failed parse int: %w", err)
-		}
+	return strings.TrimSpace(category), nil
+}
 
-		fmt.Print("Enter name: ")
+// writeOptions returns options for writing a record with the given category
+// to the team from the agent settings. The MIME type of -mime applies only
+// to files.
+func writeOptions(cfg *config.ConfigENV, category string) []client.WriteOption {
+	opts := []client.WriteOption{client.WithCategory(category), client.WithFolder(cfg.Folder), client.WithTeam(cfg.Team)}
+	if cfg.ConfirmRead {
+		opts = append(opts, client.WithRequiresConfirmation())
+	}
+	if cfg.MimeType != "" {
+		opts = append(opts, client.WithMimeType(cfg.MimeType))
+	}
 
-		fileName, err := reader.ReadString('\n')
-		if err != nil {
-			return fmt.Errorf(errorFailedReadSTDIN, err)
-		}
+	return opts
+}
 
-		fileName = strings.TrimSpace(fileName)
+// UTILS FOR READ FILE.
+
+// listOptions returns options for listing records according to the agent settings.
+func listOptions(cfg *config.ConfigENV) []client.ListOption {
+	return []client.ListOption{
+		client.WithCategoryFilter(cfg.Category),
+		client.WithFolderFilter(cfg.Folder),
+		client.WithTypeFilter(cfg.Type),
+		client.WithNameFilter(cfg.Name),
+		client.WithSort(cfg.Sort, cfg.Desc),
+	}
+}
 
-		switch i {
-		case 1:
-			fmt.Println("Enter text:")
-		//nolint:gomnd // This legal number
-		case 2:
-			fmt.Println("Enter loggin and password:")
-		//nolint:gomnd // This legal number
-		case 3:
-			fmt.Println("Enter number, name, date and CVV:")
+// printFiles showing the available files.
+func printFiles(units []*proto.StorageUnit, format string) {
+	fmt.Fprintln(output, "Available files:")
+	if format == FormatTable {
+		printFilesTable(units)
+		return
+	}
+
+	for _, v := range units {
+		// TODO: Откуда 0 ? Size slice ?
+		if v.Id <= 0 {
+			continue
 		}
 
-		data, err := reader.ReadString('\n')
-		if err != nil {
-			return fmt.Errorf(errorFailedReadSTDIN, err)
+		line := fmt.Sprintf("[%v] - %s", v.Id, v.Name)
+		if v.Category != "" {
+			line += fmt.Sprintf(" (%s)", v.Category)
+		}
+		if len(v.Meta) > 0 {
+			line += fmt.Sprintf(" {%s}", formatTags(v.Meta))
+		}
+		if v.Team != 0 {
+			line += fmt.Sprintf(" [team %v]", v.Team)
 		}
 
-		data = strings.TrimSpace(data)
+		fmt.Fprintf(output, "%s \n", line)
+	}
+}
 
-		// Send the gRPC data
-		_, err = client.WriteFile("text", fileName, data)
-		if err != nil {
-			return fmt.Errorf("write file has error: %w", err)
+// printIDs prints only the IDs of the files, one per line, so they can be
+// used in shell loops.
+func printIDs(units []*proto.StorageUnit) {
+	for _, v := range units {
+		if v.Id <= 0 {
+			continue
 		}
 
-	//nolint:gomnd // This legal number
-	case 2:
-		fmt.Print("Enter the link to the file: ")
+		fmt.Fprintln(result, v.Id)
+	}
+}
 
-		// Consider the user's response
-		filePath, err := reader.ReadString('\n')
-		if err != nil {
-			return fmt.Errorf(errorFailedReadSTDIN, err)
+// printFilesTable showing the available files as a table with aligned columns.
+// Long names are truncated, so that one record stays on one line.
+func printFilesTable(units []*proto.StorageUnit) {
+	tw := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tTYPE\tCATEGORY\tVERSION\tTAGS")
+	for _, v := range units {
+		if v.Id <= 0 {
+			continue
 		}
 
-		filePath = strings.TrimSpace(filePath)
+		fmt.Fprintf(tw, "%v\t%s\t%s\t%s\t%v\t%s\n",
+			v.Id, truncate(v.Name, maxTableNameLength), v.Type, v.Category, v.Version, formatTags(v.Meta))
+	}
 
-		// Get file name
-		baseName := filepath.Base(filePath)
+	// The writer only fails if the output fails, the same as fmt.Fprint above
+	_ = tw.Flush()
+}
 
-		// Send the gRPC data
-		_, err = client.WriteFile("file", baseName, filePath)
-		if err != nil {
-			return fmt.Errorf("write file has error: %w", err)
-		}
+// truncate shortens s to at most n characters, marking the cut with "...".
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
 	}
 
-	fmt.Println("File write!")
+	return string(r[:n-len(ellipsis)]) + ellipsis
+}
 
-	return nil
+// printCredentials showing the fields of a credentials record.
+func printCredentials(c credentials) {
+	fmt.Fprintf(output, "Login: %s \n", c.Login)
+	fmt.Fprintf(output, "Password: %s \n", c.Password)
+	if c.URL != "" {
+		fmt.Fprintf(output, "URL: %s \n", c.URL)
+	}
+	if c.Notes != "" {
+		fmt.Fprintf(output, "Notes: %s \n", c.Notes)
+	}
 }
 
-// UTILS FOR READ FILE.
+// UTILS FOR TAGS.
+
+// selectTags reads the tags to set and the tags to remove.
+func selectTags() (map[string]string, []string, error) {
+	reader := bufio.NewReader(input)
+
+	fmt.Fprint(output, "Enter tags to set (key=value, comma separated): ")
+	setResp, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, nil, fmt.Errorf(errorFailedReadSTDIN, err)
+	}
+
+	fmt.Fprint(output, "Enter tags to remove (comma separated): ")
+	removeResp, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, nil, fmt.Errorf(errorFailedReadSTDIN, err)
+	}
+
+	return parseTags(setResp), splitList(removeResp), nil
+}
+
+// parseTags parses a comma separated list of `key=value` pairs.
+// A tag without a value gets an empty value.
+func parseTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, item := range splitList(s) {
+		k, v, _ := strings.Cut(item, "=")
+		tags[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+
+	return tags
+}
+
+// splitList splits a comma separated list and drops empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// formatTags formats tags as a sorted comma separated list.
+func formatTags(tags map[string]string) string {
+	items := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if v == "" {
+			items = append(items, k)
+		} else {
+			items = append(items, k+"="+v)
+		}
+	}
+	sort.Strings(items)
+
+	return strings.Join(items, ", ")
+}
 
 // selectReadFile select a file to read.
 func selectReadFile() (int, error) {
-	fmt.Print("Select ID file: ")
+	fmt.Fprint(output, "Select ID file: ")
 
 	// Create a reader for input from standard input (console)
-	reader := bufio.NewReader(os.Stdin)
+	reader := bufio.NewReader(input)
 
 	// Consider the user's response
 	response, err := reader.ReadString('\n')
@@ -317,14 +1490,90 @@ func selectReadFile() (int, error) {
 	return i, nil
 }
 
+// selectTransferLogin reads the login of the new owner of the file and asks
+// for confirmation unless `-yes` is set, as the file leaves the vault.
+func selectTransferLogin(cfg *config.ConfigENV, id int) (string, error) {
+	fmt.Fprint(output, "Enter login of the new owner: ")
+
+	// Create a reader for input from standard input (console)
+	reader := bufio.NewReader(input)
+
+	login, err := reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf(errorFailedReadSTDIN, err)
+	}
+
+	login = strings.TrimSpace(login)
+	if login == "" {
+		return "", fmt.Errorf("login of the new owner not found")
+	}
+
+	if !cfg.AssumeYes {
+		fmt.Fprintf(output, "File %v will be removed from your vault and owned by %s. Transfer it? [y/N]: ", id, login)
+
+		r, err := reader.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf(errorFailedReadSTDIN, err)
+		}
+
+		if strings.ToLower(strings.TrimSpace(r)) != "y" {
+			return "", fmt.Errorf("transfer canceled")
+		}
+	}
+
+	return login, nil
+}
+
+// selectVersions select two versions of a file to compare.
+func selectVersions() (int, int, error) {
+	reader := bufio.NewReader(input)
+
+	versions := make([]int, 0, 2)
+	for _, prompt := range []string{"Enter first version: ", "Enter second version: "} {
+		fmt.Fprint(output, prompt)
+
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			return 0, 0, fmt.Errorf(errorFailedReadSTDIN, err)
+		}
+
+		v, err := strconv.Atoi(strings.TrimSpace(response))
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed parse int: %w", err)
+		}
+
+		versions = append(versions, v)
+	}
+
+	return versions[0], versions[1], nil
+}
+
 // UTILS FOR REGISTER AND LOGIN.
 
+// registerOptions returns options for the registration according to the agent settings.
+func registerOptions(cfg *config.ConfigENV) []client.RegisterOption {
+	if cfg.Email != "" {
+		return []client.RegisterOption{client.WithEmail(cfg.Email)}
+	}
+
+	return nil
+}
+
+// loginOptions returns options for logging in according to the agent settings.
+func loginOptions(cfg *config.ConfigENV) []client.LoginOption {
+	if cfg.ReadOnly {
+		return []client.LoginOption{client.WithReadOnly()}
+	}
+
+	return nil
+}
+
 // saveAuthToken saving the token to the .env file.
 func saveAuthToken(token string) error {
-	fmt.Print("Do you want save token in .env? [y/N]: ")
+	fmt.Fprint(output, "Do you want save token in .env? [y/N]: ")
 
 	// Create a reader for input from standard input (console)
-	reader := bufio.NewReader(os.Stdin)
+	reader := bufio.NewReader(input)
 
 	// Consider the user's response
 	response, err := reader.ReadString('\n')
@@ -354,12 +1603,46 @@ func saveAuthToken(token string) error {
 			return fmt.Errorf("failed close file: %w", err)
 		}
 
-		fmt.Println("Token saved in .env file.")
+		fmt.Fprintln(output, "Token saved in .env file.")
 	}
 
 	return nil
 }
 
+// withReauth runs the call and, if the server asks for a recent
+// authentication, asks for the password again and repeats the call once.
+func withReauth(cl *client.Client, call func() error) error {
+	err := call()
+	if !client.IsReauthRequired(err) {
+		return err
+	}
+
+	info, err := cl.TokenInfo()
+	if err != nil {
+		return fmt.Errorf("failed get login: %w", err)
+	}
+
+	fmt.Fprintln(output, "This operation requires recent authentication.")
+	fmt.Fprint(output, "Enter your password: ")
+
+	reader := bufio.NewReader(input)
+
+	passwordResp, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed read password stdin: %w", err)
+	}
+
+	// The new token keeps the scope of the old one
+	r, err := cl.Login(info.Login, strings.TrimSpace(passwordResp), client.WithScope(info.Scope))
+	if err != nil {
+		return fmt.Errorf("failed login user: %w", err)
+	}
+
+	cl.Token = r.Jwt
+
+	return call()
+}
+
 type userCredentials struct {
 	login    string
 	password string
@@ -367,16 +1650,16 @@ type userCredentials struct {
 
 // getUserCredentials get a pair of username and password from the user.
 func getUserCredentials() (userCredentials, error) {
-	fmt.Print("Enter your login: ")
+	fmt.Fprint(output, "Enter your login: ")
 
-	reader := bufio.NewReader(os.Stdin)
+	reader := bufio.NewReader(input)
 
 	loginResp, err := reader.ReadString('\n')
 	if err != nil {
 		return userCredentials{}, fmt.Errorf("failed read login stdin: %w", err)
 	}
 
-	fmt.Print("Enter your password: ")
+	fmt.Fprint(output, "Enter your password: ")
 	passwordResp, err := reader.ReadString('\n')
 	if err != nil {
 		return userCredentials{}, fmt.Errorf("failed read password stdin: %w", err)
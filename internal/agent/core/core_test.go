@@ -0,0 +1,333 @@
+package core
+
+import (
+	"bufio"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveFileInDisk(t *testing.T) {
+	output = io.Discard
+
+	tests := []struct {
+		name        string
+		downloadDir string
+		assumeYes   bool
+		answers     string
+		// exp is the directory of the saved file, empty if saving fails
+		exp string
+	}{
+		{
+			name:        "Enter accepts the download directory",
+			downloadDir: "downloads",
+			answers:     "\n",
+			exp:         "downloads",
+		},
+		{
+			name:        "Typed directory overrides the download directory",
+			downloadDir: "downloads",
+			answers:     "other\ny\n",
+			exp:         "other",
+		},
+		{
+			name:        "Missing download directory is created after confirmation",
+			downloadDir: "new/dir",
+			answers:     "\ny\n",
+			exp:         "new/dir",
+		},
+		{
+			name:        "Declined directory is not created",
+			downloadDir: "declined",
+			answers:     "\nn\n",
+		},
+		{
+			name:        "Download directory is used without prompting",
+			downloadDir: "auto",
+			assumeYes:   true,
+			exp:         "auto",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			assert.NoError(t, os.Mkdir(filepath.Join(root, "downloads"), defaultDirPermition))
+
+			input = strings.NewReader(tt.answers)
+			cfg := &config.ConfigENV{DownloadDir: filepath.Join(root, tt.downloadDir), AssumeYes: tt.assumeYes}
+
+			// Relative answers are resolved in the temporary directory
+			wd, err := os.Getwd()
+			assert.NoError(t, err)
+			assert.NoError(t, os.Chdir(root))
+			defer func() { assert.NoError(t, os.Chdir(wd)) }()
+
+			err = saveFileInDisk(cfg, "secret.txt", []byte("data"), "")
+			if tt.exp == "" {
+				assert.Error(t, err)
+				assert.NoDirExists(t, cfg.DownloadDir)
+				return
+			}
+
+			assert.NoError(t, err)
+			data, err := os.ReadFile(filepath.Join(root, tt.exp, "secret.txt"))
+			assert.NoError(t, err)
+			assert.Equal(t, "data", string(data))
+		})
+	}
+}
+
+func TestSaveFileInDiskUnsafeName(t *testing.T) {
+	output = io.Discard
+
+	tests := []struct {
+		name string
+		// exp is the name of the saved file, empty if the name is rejected
+		exp string
+	}{
+		{name: "../../etc/passwd"},
+		{name: "../secret.txt"},
+		{name: "sub/../../secret.txt"},
+		{name: `..\..\secret.txt`},
+		{name: "/etc/passwd"},
+		{name: `\\server\share\secret.txt`},
+		{name: ".."},
+		{name: "."},
+		{name: ""},
+		{name: "sub/dir/secret.txt", exp: "secret.txt"},
+		{name: `sub\secret.txt`, exp: "secret.txt"},
+		{name: "..secret.txt", exp: "..secret.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			dir := filepath.Join(root, "downloads")
+			assert.NoError(t, os.Mkdir(dir, defaultDirPermition))
+
+			input = strings.NewReader("")
+			cfg := &config.ConfigENV{DownloadDir: dir, AssumeYes: true}
+
+			err := saveFileInDisk(cfg, tt.name, []byte("data"), "")
+
+			var files []string
+			assert.NoError(t, filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					files = append(files, path)
+				}
+				return err
+			}))
+
+			if tt.exp == "" {
+				assert.ErrorIs(t, err, errUnsafeFileName)
+				// Nothing is written anywhere under the root
+				assert.Empty(t, files)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, []string{filepath.Join(dir, tt.exp)}, files)
+		})
+	}
+}
+
+func TestSafeFilePath(t *testing.T) {
+	dir := t.TempDir()
+
+	p, err := safeFilePath(dir, "report.pdf")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "report.pdf"), p)
+
+	_, err = safeFilePath(dir, "../../etc/passwd")
+	assert.ErrorContains(t, err, "path traversal")
+
+	_, err = safeFilePath(dir, "/etc/passwd")
+	assert.ErrorContains(t, err, "absolute path")
+}
+
+func TestReadText(t *testing.T) {
+	text := "  first line\n\tsecond line  \n\n"
+
+	tests := []struct {
+		name string
+		raw  bool
+		exp  string
+	}{
+		{name: "Single line is trimmed", raw: false, exp: "first line"},
+		{name: "Raw text is kept byte for byte", raw: true, exp: text},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := readText(bufio.NewReader(strings.NewReader(text)), tt.raw)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.exp, out)
+		})
+	}
+}
+
+func TestReadRecordDataFromFile(t *testing.T) {
+	output = io.Discard
+	dir := t.TempDir()
+
+	text := filepath.Join(dir, "app.conf")
+	assert.NoError(t, os.WriteFile(text, []byte("  listen = 8080\n\tworkers = 4\n"), 0600))
+	card := filepath.Join(dir, "card.txt")
+	assert.NoError(t, os.WriteFile(card, []byte("4111 1111 1111 1111 IVAN 12/30 123"), 0600))
+	jsonFile := filepath.Join(dir, "config.json")
+	assert.NoError(t, os.WriteFile(jsonFile, []byte("{\n  \"port\": 8080\n}\n"), 0600))
+	binary := filepath.Join(dir, "image.bin")
+	assert.NoError(t, os.WriteFile(binary, []byte{0xff, 0xfe, 0x00}, 0600))
+
+	tests := []struct {
+		name    string
+		kind    int
+		file    string
+		expType string
+		expData string
+		wantErr bool
+	}{
+		{name: "Text is kept byte for byte", kind: 1, file: text, expType: "text", expData: "  listen = 8080\n\tworkers = 4\n"},
+		{name: "Credit card", kind: 3, file: card, expType: "text", expData: "4111 1111 1111 1111 IVAN 12/30 123"},
+		{name: "JSON", kind: 4, file: jsonFile, expType: "json", expData: "{\n  \"port\": 8080\n}\n"},
+		{name: "Not UTF-8", kind: 1, file: binary, wantErr: true},
+		{name: "Missing file", kind: 4, file: filepath.Join(dir, "missing"), wantErr: true},
+		{name: "Credentials", kind: 2, file: text, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The input is not read with a data file
+			reader := bufio.NewReader(strings.NewReader("typed\n"))
+
+			typ, data, err := readRecordData(reader, &config.ConfigENV{DataFile: tt.file}, tt.kind)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expType, typ)
+			assert.Equal(t, tt.expData, data)
+		})
+	}
+}
+
+func TestPrintWriteResult(t *testing.T) {
+	tests := []struct {
+		name      string
+		quiet     bool
+		expResult string
+		expOutput string
+	}{
+		{name: "Message with the ID", quiet: false, expResult: "", expOutput: "File write! ID: 42 \n"},
+		{name: "Quiet prints only the ID", quiet: true, expResult: "42\n", expOutput: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res, out strings.Builder
+			result, output = &res, &out
+			defer func() { result, output = os.Stdout, os.Stdout }()
+
+			cfg := &config.ConfigENV{Quiet: tt.quiet}
+			if tt.quiet {
+				// The messages are dropped, like in Run
+				output = MessageWriter(cfg)
+			}
+
+			printWriteResult(cfg, 42)
+			assert.Equal(t, tt.expResult, res.String())
+			assert.Equal(t, tt.expOutput, out.String())
+		})
+	}
+}
+
+func TestPrintIDs(t *testing.T) {
+	var res strings.Builder
+	result = &res
+	defer func() { result = os.Stdout }()
+
+	printIDs([]*proto.StorageUnit{
+		{Id: 7, Name: "mail", Type: "credentials", Category: "work", Meta: map[string]string{"env": "prod"}},
+		{Id: 0},
+		{Id: 12, Name: "notes", Type: "text"},
+	})
+	assert.Equal(t, "7\n12\n", res.String())
+
+	// The messages of the command don't go to stdout
+	assert.Equal(t, os.Stderr, MessageWriter(&config.ConfigENV{Command: "ids"}))
+}
+
+func TestPrintFilesTable(t *testing.T) {
+	var out strings.Builder
+	output = &out
+	defer func() { output = os.Stdout }()
+
+	units := []*proto.StorageUnit{
+		{Id: 1, Name: "a", Type: "text", Version: 1},
+		{Id: 22, Name: "medium name", Type: "file", Category: "work", Version: 3},
+		{Id: 333, Name: strings.Repeat("long", 20), Type: "credentials", Version: 12, Meta: map[string]string{"env": "prod"}},
+	}
+
+	printFiles(units, FormatTable)
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	assert.Equal(t, "Available files:", lines[0])
+	assert.Len(t, lines, 5)
+
+	// Every filled column starts at the same position as its header
+	header := lines[1]
+	for _, column := range []string{"NAME", "TYPE", "VERSION"} {
+		pos := strings.Index(header, column)
+		for i, u := range units {
+			row := lines[i+2]
+			if !assert.Greater(t, len(row), pos) {
+				continue
+			}
+			assert.NotEqual(t, ' ', rune(row[pos]), "column %s of record %v", column, u.Id)
+			assert.Equal(t, ' ', rune(row[pos-1]), "column %s of record %v", column, u.Id)
+		}
+	}
+
+	// The long name is truncated
+	assert.Contains(t, lines[4], strings.Repeat("long", 7)+"l"+ellipsis)
+	assert.NotContains(t, lines[4], strings.Repeat("long", 20))
+}
+
+func TestPrintRecordStdout(t *testing.T) {
+	tests := []struct {
+		name string
+		typ  string
+		data []byte
+	}{
+		{name: "Text", typ: "text", data: []byte("  secret text\n")},
+		{name: "File", typ: "file", data: []byte{0x00, 0xff, '\n', 0x10}},
+		{name: "Credentials", typ: "credentials", data: []byte(`{"login":"user","password":"pass"}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res, out strings.Builder
+			result, output = &res, &out
+			defer func() { result, output = os.Stdout, os.Stdout }()
+
+			// Nothing is prompted, the file is not saved on disk
+			input = strings.NewReader("")
+
+			cfg := &config.ConfigENV{Stdout: true}
+			err := printRecord(cfg, &proto.ReadRecordResponse{Name: "secret", Type: tt.typ, Data: tt.data})
+			assert.NoError(t, err)
+			assert.Equal(t, string(tt.data), res.String())
+			assert.Empty(t, out.String())
+		})
+	}
+}
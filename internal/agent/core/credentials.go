@@ -0,0 +1,135 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/agent/client"
+)
+
+// credentials is the data of a record of the `credentials` type.
+type credentials struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+	URL      string `json:"url,omitempty"`
+	Notes    string `json:"notes,omitempty"`
+	// PasswordChangedAt is set when the password is written or rotated.
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty"`
+	// RotationDays is the optional number of days the password should be
+	// rotated after, see audit-expiry.
+	RotationDays int `json:"rotation_days,omitempty"`
+}
+
+// Supported formats of exported credentials.
+const (
+	exportShell  = "shell"
+	exportDotenv = "dotenv"
+)
+
+// parseCredentials decodes the data of a credentials record.
+func parseCredentials(data []byte) (credentials, error) {
+	var c credentials
+	if err := json.Unmarshal(data, &c); err != nil {
+		return credentials{}, fmt.Errorf("failed decode credentials: %w", err)
+	}
+
+	return c, nil
+}
+
+// encodeCredentials encodes the data of a credentials record. It is indented,
+// so the versions of the record can be compared line by line.
+func encodeCredentials(c credentials) (string, error) {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed encode credentials: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// RotatePassword replaces the password of the credentials record with the
+// given ID by a generated one and returns the new password. The old password
+// stays in the version history of the record.
+func RotatePassword(cl *client.Client, id int32) (string, error) {
+	rec, err := cl.ReadFile(id)
+	if err != nil {
+		return "", fmt.Errorf("failed get file: %w", err)
+	}
+
+	if rec.Type != "credentials" {
+		return "", fmt.Errorf("only credentials have a password, the file type is %s", rec.Type)
+	}
+
+	c, err := parseCredentials(rec.Data)
+	if err != nil {
+		return "", err
+	}
+
+	c.Password, err = generatePassword(defaultPasswordLength)
+	if err != nil {
+		return "", err
+	}
+	changed := time.Now().UTC().Truncate(time.Second)
+	c.PasswordChangedAt = &changed
+
+	data, err := encodeCredentials(c)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = cl.UpdateFile(id, rec.Version, rec.Type, rec.Name, data)
+	if err != nil {
+		return "", fmt.Errorf("failed update file: %w", err)
+	}
+
+	return c.Password, nil
+}
+
+// vars returns the credentials as environment variables. Empty optional
+// fields are skipped.
+func (c credentials) vars() [][2]string {
+	vars := [][2]string{{"LOGIN", c.Login}, {"PASSWORD", c.Password}}
+	if c.URL != "" {
+		vars = append(vars, [2]string{"URL", c.URL})
+	}
+	if c.Notes != "" {
+		vars = append(vars, [2]string{"NOTES", c.Notes})
+	}
+
+	return vars
+}
+
+// exportCredentials formats the credentials as shell `export` assignments
+// that can be `eval`'d, or as a dotenv snippet.
+func exportCredentials(c credentials, format string) (string, error) {
+	var b strings.Builder
+
+	for _, v := range c.vars() {
+		switch format {
+		case exportShell:
+			fmt.Fprintf(&b, "export %s=%s\n", v[0], shellQuote(v[1]))
+		case exportDotenv:
+			fmt.Fprintf(&b, "%s=%s\n", v[0], dotenvQuote(v[1]))
+		default:
+			return "", fmt.Errorf("unsupported export format: %s", format)
+		}
+	}
+
+	return b.String(), nil
+}
+
+// shellQuote quotes a value for a POSIX shell. Inside single quotes nothing
+// is special except the single quote itself, which is closed, escaped and
+// opened again.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// dotenvQuote quotes a value for a dotenv file. Double quotes are used so
+// that line breaks can be escaped; `$` is escaped to prevent variable expansion.
+func dotenvQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`, "\r", `\r`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportCredentials(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		shell    string
+		dotenv   string
+	}{
+		{
+			name:     "Plain value",
+			password: "secret",
+			shell:    `'secret'`,
+			dotenv:   `"secret"`,
+		},
+		{
+			name:     "Empty value",
+			password: "",
+			shell:    `''`,
+			dotenv:   `""`,
+		},
+		{
+			name:     "Single quote",
+			password: "it's",
+			shell:    `'it'\''s'`,
+			dotenv:   `"it's"`,
+		},
+		{
+			name:     "Shell expansions",
+			password: "$HOME `id` $(id) \\ * ; &",
+			shell:    "'$HOME `id` $(id) \\ * ; &'",
+			dotenv:   "\"\\$HOME `id` \\$(id) \\\\ * ; &\"",
+		},
+		{
+			name:     "Double quote and line break",
+			password: "a\"b\nc",
+			shell:    "'a\"b\nc'",
+			dotenv:   `"a\"b\nc"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := credentials{Login: "user", Password: tt.password}
+
+			shell, err := exportCredentials(c, exportShell)
+			assert.NoError(t, err)
+			assert.Equal(t, "export LOGIN='user'\nexport PASSWORD="+tt.shell+"\n", shell)
+
+			dotenv, err := exportCredentials(c, exportDotenv)
+			assert.NoError(t, err)
+			assert.Equal(t, "LOGIN=\"user\"\nPASSWORD="+tt.dotenv+"\n", dotenv)
+
+			// The shell must get the original value back
+			out, err := exec.Command("sh", "-c", shell+`printf %s "$PASSWORD"`).Output()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.password, string(out))
+
+			// And so must a dotenv parser
+			env, err := godotenv.Unmarshal(dotenv)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.password, env["PASSWORD"])
+		})
+	}
+}
+
+func TestExportCredentialsOptionalFields(t *testing.T) {
+	c := credentials{Login: "user", Password: "secret", URL: "https://example.com"}
+
+	out, err := exportCredentials(c, exportShell)
+	assert.NoError(t, err)
+	assert.Equal(t, "export LOGIN='user'\nexport PASSWORD='secret'\nexport URL='https://example.com'\n", out)
+
+	_, err = exportCredentials(c, "yaml")
+	assert.Error(t, err)
+}
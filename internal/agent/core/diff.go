@@ -0,0 +1,191 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+)
+
+// diffContext is the number of unchanged lines shown around a change.
+var diffContext = 3
+
+// diffOp is a single line of a diff: kept (' '), removed ('-') or added ('+').
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// diffRecords describes the difference between two versions of a record.
+// Text records are compared line by line in the unified format, for files
+// only the sizes are reported.
+func diffRecords(fromName string, from []byte, toName string, to []byte, binary bool) string {
+	if binary {
+		if bytes.Equal(from, to) {
+			return "Files are identical\n"
+		}
+
+		return fmt.Sprintf("Binary files differ (%v bytes vs %v bytes)\n", len(from), len(to))
+	}
+
+	diff := unifiedDiff(fromName, string(from), toName, string(to))
+	if diff == "" {
+		return "Files are identical\n"
+	}
+
+	return diff
+}
+
+// diffLocal describes whether a local file matches the stored record. The
+// contents are compared by the SHA-256 hashes, the text records are compared
+// line by line as well, so the changes can be reviewed before overwriting.
+func diffLocal(localName string, local []byte, rec *proto.ReadRecordResponse) string {
+	localHash := sha256.Sum256(local)
+	storedHash := sha256.Sum256(rec.Data)
+
+	if localHash == storedHash {
+		return fmt.Sprintf("Files match (sha256 %s)\n", hex.EncodeToString(localHash[:]))
+	}
+
+	out := fmt.Sprintf("Files differ\nstored: %v bytes, sha256 %s\nlocal:  %v bytes, sha256 %s\n",
+		len(rec.Data), hex.EncodeToString(storedHash[:]), len(local), hex.EncodeToString(localHash[:]))
+	if rec.Type == "file" {
+		return out
+	}
+
+	return out + unifiedDiff(fmt.Sprintf("%s (stored, version %v)", rec.Name, rec.Version), string(rec.Data),
+		localName+" (local)", string(local))
+}
+
+// unifiedDiff returns the unified diff of two texts, or an empty string
+// if they are equal.
+func unifiedDiff(fromName string, from string, toName string, to string) string {
+	ops := diffLines(splitLines(from), splitLines(to))
+
+	// Line numbers before every operation
+	oldPos := make([]int, len(ops)+1)
+	newPos := make([]int, len(ops)+1)
+	for i, op := range ops {
+		oldPos[i+1], newPos[i+1] = oldPos[i], newPos[i]
+		if op.kind != '+' {
+			oldPos[i+1]++
+		}
+		if op.kind != '-' {
+			newPos[i+1]++
+		}
+	}
+
+	var b strings.Builder
+	for start := 0; start < len(ops); {
+		first := nextChange(ops, start)
+		if first < 0 {
+			break
+		}
+
+		// Join the changes that are close enough into one hunk
+		last := first
+		for i := nextChange(ops, last+1); i >= 0 && i-last-1 <= 2*diffContext; i = nextChange(ops, last+1) {
+			last = i
+		}
+
+		hunkStart := max(first-diffContext, start)
+		hunkEnd := min(last+diffContext+1, len(ops))
+
+		if b.Len() == 0 {
+			fmt.Fprintf(&b, "--- %s\n+++ %s\n", fromName, toName)
+		}
+
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n",
+			hunkRange(oldPos[hunkStart], oldPos[hunkEnd]), hunkRange(newPos[hunkStart], newPos[hunkEnd]))
+		for _, op := range ops[hunkStart:hunkEnd] {
+			fmt.Fprintf(&b, "%c%s\n", op.kind, op.line)
+		}
+
+		start = hunkEnd
+	}
+
+	return b.String()
+}
+
+// diffLines finds the shortest edit script between two lists of lines
+// using their longest common subsequence.
+func diffLines(a []string, b []string) []diffOp {
+	// lcs[i][j] is the length of the common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+
+	return ops
+}
+
+// nextChange returns the index of the first changed line starting from
+// `start`, or -1 if there are no more changes.
+func nextChange(ops []diffOp, start int) int {
+	for i := start; i < len(ops); i++ {
+		if ops[i].kind != ' ' {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// hunkRange formats the line range of a hunk side, where `from` is the
+// number of lines before the hunk and `to` the number of lines up to its end.
+func hunkRange(from int, to int) string {
+	count := to - from
+	if count == 0 {
+		return fmt.Sprintf("%v,0", from)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%v", from+1)
+	}
+
+	return fmt.Sprintf("%v,%v", from+1, count)
+}
+
+// splitLines splits a text into lines, a trailing newline does not start
+// a new line.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
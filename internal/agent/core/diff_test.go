@@ -0,0 +1,113 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffRecords(t *testing.T) {
+	tests := []struct {
+		name   string
+		from   string
+		to     string
+		binary bool
+		exp    string
+	}{
+		{
+			name: "Identical versions",
+			from: "login\npassword\n",
+			to:   "login\npassword\n",
+			exp:  "Files are identical\n",
+		},
+		{
+			name: "Changed line",
+			from: "login: alice\npassword: 123\nurl: example.com",
+			to:   "login: alice\npassword: 456\nurl: example.com",
+			exp: "--- secret (version 1)\n+++ secret (version 2)\n" +
+				"@@ -1,3 +1,3 @@\n login: alice\n-password: 123\n+password: 456\n url: example.com\n",
+		},
+		{
+			name: "Added line to empty record",
+			from: "",
+			to:   "note",
+			exp:  "--- secret (version 1)\n+++ secret (version 2)\n@@ -0,0 +1 @@\n+note\n",
+		},
+		{
+			name: "Distant changes are split into hunks",
+			from: "a\nb\nc\nd\ne\nf\ng\nh\ni\nj",
+			to:   "A\nb\nc\nd\ne\nf\ng\nh\ni\nJ",
+			exp: "--- secret (version 1)\n+++ secret (version 2)\n" +
+				"@@ -1,4 +1,4 @@\n-a\n+A\n b\n c\n d\n" +
+				"@@ -7,4 +7,4 @@\n g\n h\n i\n-j\n+J\n",
+		},
+		{
+			name:   "Binary files differ",
+			from:   "1234",
+			to:     "123456",
+			binary: true,
+			exp:    "Binary files differ (4 bytes vs 6 bytes)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := diffRecords("secret (version 1)", []byte(tt.from), "secret (version 2)", []byte(tt.to), tt.binary)
+			assert.Equal(t, tt.exp, out)
+		})
+	}
+}
+
+func TestDiffLocal(t *testing.T) {
+	text := &proto.ReadRecordResponse{Name: "config", Type: "text", Version: 2, Data: []byte("host: a\nport: 1\n")}
+	file := &proto.ReadRecordResponse{Name: "photo.jpg", Type: "file", Version: 1, Data: []byte{0xff, 0xd8}}
+
+	tests := []struct {
+		name  string
+		rec   *proto.ReadRecordResponse
+		local string
+		exp   []string
+		not   []string
+	}{
+		{
+			name:  "Matching text",
+			rec:   text,
+			local: "host: a\nport: 1\n",
+			exp:   []string{"Files match (sha256 "},
+			not:   []string{"differ"},
+		},
+		{
+			name:  "Differing text",
+			rec:   text,
+			local: "host: a\nport: 2\n",
+			exp: []string{"Files differ\n", "stored: 16 bytes", "local:  16 bytes",
+				"--- config (stored, version 2)\n+++ config.yaml (local)\n", "-port: 1\n+port: 2\n"},
+		},
+		{
+			name:  "Matching file",
+			rec:   file,
+			local: "\xff\xd8",
+			exp:   []string{"Files match"},
+		},
+		{
+			name:  "Differing file",
+			rec:   file,
+			local: "\xff\xd8\x00",
+			exp:   []string{"Files differ\n", "stored: 2 bytes", "local:  3 bytes"},
+			not:   []string{"---"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := diffLocal("config.yaml", []byte(tt.local), tt.rec)
+			for _, exp := range tt.exp {
+				assert.Contains(t, out, exp)
+			}
+			for _, not := range tt.not {
+				assert.NotContains(t, out, not)
+			}
+		})
+	}
+}
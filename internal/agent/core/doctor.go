@@ -0,0 +1,214 @@
+package core
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/agent/client"
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+)
+
+// doctorTimeout is the timeout of the network checks of doctor.
+var doctorTimeout = 5 * time.Second
+
+// errDoctorFailed is returned by doctor when a check failed.
+var errDoctorFailed = errors.New("some checks failed")
+
+// doctorCheck is a step of doctor. A passed check returns a detail shown
+// next to its result.
+type doctorCheck struct {
+	name  string
+	check func() (string, error)
+}
+
+// Doctor checks one by one what the agent needs to talk to the server: the
+// config, the certificate, the TCP connection, the TLS handshake and the
+// token, and prints the result of every check. It doesn't need a client, so
+// it runs even when the client can't be created.
+func Doctor(cfg *config.ConfigENV) error {
+	fmt.Fprintln(output, "-> Doctor")
+
+	return doctor(cfg, time.Now(), func() error {
+		var opts []client.Option
+		if cfg.Fingerprint != "" {
+			opts = append(opts, client.WithFingerprint(cfg.Fingerprint))
+		}
+
+		cl, err := client.NewClient(cfg.ServerAddr, cfg.Certificate, cfg.JWT, opts...)
+		if err != nil {
+			return err
+		}
+		defer cl.Close()
+
+		return cl.HealthCheck(false)
+	})
+}
+
+// doctor runs the checks in order. A check depends on the ones before it,
+// so the checks after a failed one are skipped. The token is verified by the
+// server with `verifyToken`.
+func doctor(cfg *config.ConfigENV, now time.Time, verifyToken func() error) error {
+	var roots *x509.CertPool
+
+	checks := []doctorCheck{
+		{name: "config", check: func() (string, error) {
+			return checkConfig(cfg)
+		}},
+		{name: "certificate", check: func() (string, error) {
+			var detail string
+			var err error
+			roots, detail, err = checkCertificate(cfg.Certificate, now)
+
+			return detail, err
+		}},
+		{name: "tcp", check: func() (string, error) {
+			return checkTCP(cfg.ServerAddr)
+		}},
+		{name: "tls", check: func() (string, error) {
+			return checkTLS(cfg.ServerAddr, roots)
+		}},
+		{name: "token", check: func() (string, error) {
+			return checkToken(cfg.JWT, now, verifyToken)
+		}},
+	}
+
+	failed := false
+	for _, c := range checks {
+		if failed {
+			fmt.Fprintf(output, "SKIP %s \n", c.name)
+			continue
+		}
+
+		detail, err := c.check()
+		if err != nil {
+			fmt.Fprintf(output, "FAIL %s: %v \n", c.name, err)
+			failed = true
+			continue
+		}
+
+		fmt.Fprintf(output, "PASS %s: %s \n", c.name, detail)
+	}
+
+	if failed {
+		return errDoctorFailed
+	}
+
+	return nil
+}
+
+// checkConfig checks the config has the address of the server and the certificate.
+func checkConfig(cfg *config.ConfigENV) (string, error) {
+	if cfg.ServerAddr == "" {
+		return "", fmt.Errorf("server address is not set, set server_addr or $SERVER_ADDR")
+	}
+
+	if cfg.Certificate == "" {
+		return "", fmt.Errorf("certificate is not set, set certificate in the config")
+	}
+
+	return fmt.Sprintf("server %s, certificate %s", cfg.ServerAddr, cfg.Certificate), nil
+}
+
+// checkCertificate checks the file has certificates in PEM that are valid
+// now, and returns them as the roots of the TLS check.
+func checkCertificate(path string, now time.Time) (*x509.CertPool, string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed read certificate: %w", err)
+	}
+
+	roots := x509.NewCertPool()
+	var detail string
+	for block, rest := pem.Decode(raw); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed parse certificate: %w", err)
+		}
+
+		if now.Before(cert.NotBefore) {
+			return nil, "", fmt.Errorf("certificate %q is not valid before %s", cert.Subject.CommonName, formatTime(cert.NotBefore))
+		}
+
+		if now.After(cert.NotAfter) {
+			return nil, "", fmt.Errorf("certificate %q expired at %s", cert.Subject.CommonName, formatTime(cert.NotAfter))
+		}
+
+		roots.AddCert(cert)
+		if detail == "" {
+			detail = fmt.Sprintf("%q valid until %s", cert.Subject.CommonName, formatTime(cert.NotAfter))
+		}
+	}
+
+	if detail == "" {
+		return nil, "", fmt.Errorf("no PEM certificate in %s", path)
+	}
+
+	return roots, detail, nil
+}
+
+// checkTCP checks the server accepts TCP connections.
+func checkTCP(addr string) (string, error) {
+	conn, err := net.DialTimeout("tcp", addr, doctorTimeout)
+	if err != nil {
+		return "", fmt.Errorf("failed connect: %w", err)
+	}
+	defer conn.Close()
+
+	return fmt.Sprintf("connected to %s", conn.RemoteAddr()), nil
+}
+
+// checkTLS checks the TLS handshake with the server, its certificate must be
+// signed by the roots.
+func checkTLS(addr string, roots *x509.CertPool) (string, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid server address: %w", err)
+	}
+
+	dialer := &net.Dialer{Timeout: doctorTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{
+		RootCAs:    roots,
+		ServerName: host,
+		MinVersion: tls.VersionTLS12,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed handshake: %w", err)
+	}
+	defer conn.Close()
+
+	return fmt.Sprintf("%s, server certificate %q", tls.VersionName(conn.ConnectionState().Version),
+		conn.ConnectionState().PeerCertificates[0].Subject.CommonName), nil
+}
+
+// checkToken checks the token is present and not expired, then lets the
+// server verify it.
+func checkToken(token string, now time.Time, verifyToken func() error) (string, error) {
+	if token == "" {
+		return "", fmt.Errorf("token not found, sign in first")
+	}
+
+	claims, err := client.Client{Token: token}.Claims()
+	if err != nil {
+		return "", err
+	}
+
+	if claims.ExpiresAt != nil && !now.Before(claims.ExpiresAt.Time) {
+		return "", fmt.Errorf("token expired at %s, sign in again", formatTime(claims.ExpiresAt.Time))
+	}
+
+	if err := verifyToken(); err != nil {
+		return "", fmt.Errorf("token not accepted by the server: %w", err)
+	}
+
+	return fmt.Sprintf("signed in as %s", claims.Login), nil
+}
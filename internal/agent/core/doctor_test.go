@@ -0,0 +1,148 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCertificate writes a self-signed certificate valid between the times
+// to a PEM file.
+func writeCertificate(t *testing.T, notBefore time.Time, notAfter time.Time) string {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "ca-cert.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), defaultPermition))
+
+	return path
+}
+
+// testToken returns a token of the user expiring at the time.
+func testToken(t *testing.T, expiresAt time.Time) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, middleware.JWTclaims{
+		Login:            "user",
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(expiresAt)},
+	}).SignedString([]byte("key"))
+	require.NoError(t, err)
+
+	return token
+}
+
+func TestDoctor(t *testing.T) {
+	now := time.Now()
+
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	addr := server.Listener.Addr().String()
+
+	cert := filepath.Join(t.TempDir(), "ca-cert.pem")
+	require.NoError(t, os.WriteFile(cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), defaultPermition))
+
+	// Certificates the server is not signed with
+	otherCert := writeCertificate(t, now.Add(-time.Hour), now.Add(time.Hour))
+	expiredCert := writeCertificate(t, now.Add(-48*time.Hour), now.Add(-24*time.Hour))
+
+	// An address nothing listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	notPEM := filepath.Join(t.TempDir(), "cert.txt")
+	require.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), defaultPermition))
+
+	valid := testToken(t, now.Add(time.Hour))
+	accepted := func() error { return nil }
+
+	tests := []struct {
+		name   string
+		cfg    config.ConfigENV
+		verify func() error
+		failed string
+	}{
+		{name: "All passed", cfg: config.ConfigENV{ServerAddr: addr, Certificate: cert, JWT: valid}},
+		{name: "No server address", cfg: config.ConfigENV{Certificate: cert, JWT: valid}, failed: "config"},
+		{name: "Missing certificate", cfg: config.ConfigENV{ServerAddr: addr, Certificate: "missing.pem", JWT: valid}, failed: "certificate"},
+		{name: "Not a certificate", cfg: config.ConfigENV{ServerAddr: addr, Certificate: notPEM, JWT: valid}, failed: "certificate"},
+		{name: "Expired certificate", cfg: config.ConfigENV{ServerAddr: addr, Certificate: expiredCert, JWT: valid}, failed: "certificate"},
+		{name: "Server down", cfg: config.ConfigENV{ServerAddr: closedAddr, Certificate: cert, JWT: valid}, failed: "tcp"},
+		{name: "Unknown server certificate", cfg: config.ConfigENV{ServerAddr: addr, Certificate: otherCert, JWT: valid}, failed: "tls"},
+		{name: "Not signed in", cfg: config.ConfigENV{ServerAddr: addr, Certificate: cert}, failed: "token"},
+		{name: "Expired token", cfg: config.ConfigENV{ServerAddr: addr, Certificate: cert, JWT: testToken(t, now.Add(-time.Minute))}, failed: "token"},
+		{
+			name:   "Token rejected",
+			cfg:    config.ConfigENV{ServerAddr: addr, Certificate: cert, JWT: valid},
+			verify: func() error { return errors.New("Unauthenticated") },
+			failed: "token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			output = &out
+			defer func() { output = os.Stdout }()
+
+			verify := tt.verify
+			if verify == nil {
+				verify = accepted
+			}
+
+			err := doctor(&tt.cfg, now, verify)
+
+			// The checks before the failed one pass, the ones after it are skipped
+			status := "PASS"
+			for _, name := range []string{"config", "certificate", "tcp", "tls", "token"} {
+				if name == tt.failed {
+					assert.Contains(t, out.String(), "FAIL "+name+":")
+					status = "SKIP"
+					continue
+				}
+				assert.Contains(t, out.String(), status+" "+name)
+			}
+
+			if tt.failed == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, errDoctorFailed)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+)
+
+// envFileVars returns the variables of a credentials or json record to write
+// to an env file. The fields of nested JSON objects and arrays are joined
+// with `_`, e.g. `{"db": {"hosts": ["a"]}}` becomes `DB_HOSTS_0=a`.
+func envFileVars(rec *proto.ReadRecordResponse) ([][2]string, error) {
+	switch rec.Type {
+	case "credentials":
+		c, err := parseCredentials(rec.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		return c.vars(), nil
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(rec.Data))
+		dec.UseNumber()
+
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			return nil, fmt.Errorf("failed decode json: %w", err)
+		}
+
+		if _, ok := v.(map[string]any); !ok {
+			return nil, errors.New("only a json object can be written to an env file")
+		}
+
+		vars := make(map[string]string)
+		if err := flattenEnv(vars, "", v); err != nil {
+			return nil, err
+		}
+
+		keys := make([]string, 0, len(vars))
+		for k := range vars {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		res := make([][2]string, 0, len(keys))
+		for _, k := range keys {
+			res = append(res, [2]string{k, vars[k]})
+		}
+
+		return res, nil
+	default:
+		return nil, fmt.Errorf("only credentials and json files can be written to an env file, the file type is %s", rec.Type)
+	}
+}
+
+// flattenEnv adds the variables of the JSON value with the key prefix.
+func flattenEnv(vars map[string]string, prefix string, v any) error {
+	var value string
+
+	switch v := v.(type) {
+	case map[string]any:
+		for k, field := range v {
+			if err := flattenEnv(vars, joinEnvKey(prefix, k), field); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case []any:
+		for i, item := range v {
+			if err := flattenEnv(vars, joinEnvKey(prefix, strconv.Itoa(i)), item); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case string:
+		value = v
+	case json.Number:
+		value = v.String()
+	case bool:
+		value = strconv.FormatBool(v)
+	case nil:
+		value = ""
+	}
+
+	key := normalizeEnvKey(prefix)
+	if key == "" {
+		return fmt.Errorf("json field %q has no letters or digits for a variable name", prefix)
+	}
+
+	if _, ok := vars[key]; ok {
+		return fmt.Errorf("json fields give the same variable %s", key)
+	}
+	vars[key] = value
+
+	return nil
+}
+
+// joinEnvKey joins the key of a nested field with its parent.
+func joinEnvKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+
+	return prefix + "_" + key
+}
+
+// normalizeEnvKey makes a variable name of a key: letters are uppercased,
+// other characters than letters and digits become `_`. A name can't start
+// with a digit, it gets a leading `_` then.
+func normalizeEnvKey(key string) string {
+	var b strings.Builder
+
+	underscore := false
+	for _, r := range strings.ToUpper(key) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			underscore = false
+			continue
+		}
+
+		// Runs of other characters give a single `_`
+		if !underscore && b.Len() > 0 {
+			b.WriteByte('_')
+			underscore = true
+		}
+	}
+
+	name := strings.TrimSuffix(b.String(), "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+
+	return name
+}
+
+// formatEnvFile formats the variables as an env file for `docker compose --env-file`.
+func formatEnvFile(vars [][2]string) string {
+	var b strings.Builder
+	for _, v := range vars {
+		fmt.Fprintf(&b, "%s=%s\n", v[0], dotenvQuote(v[1]))
+	}
+
+	return b.String()
+}
+
+// writeEnvFile writes the env file readable by the owner only. An existing
+// file is overwritten only with `force`.
+func writeEnvFile(path string, content string, force bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(path, flags, defaultPermition)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("env file %s exists, use -force to overwrite it", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed create env file: %w", err)
+	}
+
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return fmt.Errorf("failed write env file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed close env file: %w", err)
+	}
+
+	return nil
+}
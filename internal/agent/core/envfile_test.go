@@ -0,0 +1,90 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvFileVars(t *testing.T) {
+	tests := []struct {
+		name string
+		rec  *proto.ReadRecordResponse
+		env  string
+	}{
+		{
+			name: "Credentials",
+			rec:  &proto.ReadRecordResponse{Type: "credentials", Data: []byte(`{"login":"user","password":"p\"a$s\ns"}`)},
+			env:  "LOGIN=\"user\"\nPASSWORD=\"p\\\"a\\$s\\ns\"\n",
+		},
+		{
+			name: "Json",
+			rec: &proto.ReadRecordResponse{Type: "json", Data: []byte(
+				`{"db": {"host-name": "db.local", "port": 5432, "replicas": ["a", "b"]}, "debug": false, "api.key": null, "2fa": "on"}`)},
+			env: "API_KEY=\"\"\nDB_HOST_NAME=\"db.local\"\nDB_PORT=\"5432\"\nDB_REPLICAS_0=\"a\"\n" +
+				"DB_REPLICAS_1=\"b\"\nDEBUG=\"false\"\n_2FA=\"on\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars, err := envFileVars(tt.rec)
+			require.NoError(t, err)
+
+			env := formatEnvFile(vars)
+			assert.Equal(t, tt.env, env)
+
+			// A dotenv parser gets the original values back
+			parsed, err := godotenv.Unmarshal(env)
+			assert.NoError(t, err)
+			for _, v := range vars {
+				assert.Equal(t, v[1], parsed[v[0]])
+			}
+		})
+	}
+}
+
+func TestEnvFileVarsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rec  *proto.ReadRecordResponse
+	}{
+		{name: "Text", rec: &proto.ReadRecordResponse{Type: "text", Data: []byte("text")}},
+		{name: "Json array", rec: &proto.ReadRecordResponse{Type: "json", Data: []byte(`["a"]`)}},
+		{name: "Same variable", rec: &proto.ReadRecordResponse{Type: "json", Data: []byte(`{"a-b": "1", "a_b": "2"}`)}},
+		{name: "No name", rec: &proto.ReadRecordResponse{Type: "json", Data: []byte(`{"-": "1"}`)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := envFileVars(tt.rec)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestWriteEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+
+	require.NoError(t, writeEnvFile(path, "A=\"1\"\n", false))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// The existing file is kept without force
+	assert.ErrorContains(t, writeEnvFile(path, "B=\"2\"\n", false), "-force")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "A=\"1\"\n", string(data))
+
+	require.NoError(t, writeEnvFile(path, "B=\"2\"\n", true))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "B=\"2\"\n", string(data))
+}
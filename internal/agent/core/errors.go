@@ -0,0 +1,35 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+	"google.golang.org/grpc/status"
+)
+
+// errorJSON is an error of a command as printed with -json-errors.
+type errorJSON struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// WriteError writes the error of a command to w. With -json-errors it is
+// written as a JSON object on one line with the name of the gRPC status code
+// of the error, `Unknown` for errors not returned by the server.
+// Otherwise the message is written as text.
+func WriteError(w io.Writer, cfg *config.ConfigENV, err error) {
+	if !cfg.JSONErrors {
+		fmt.Fprintln(w, err)
+		return
+	}
+
+	b, jsonErr := json.Marshal(errorJSON{Error: err.Error(), Code: status.Code(err).String()})
+	if jsonErr != nil {
+		fmt.Fprintln(w, err)
+		return
+	}
+
+	fmt.Fprintln(w, string(b))
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWriteError(t *testing.T) {
+	// A command failed by the server
+	err := fmt.Errorf("failed command from client: %w", status.Error(codes.Unauthenticated, "token expired"))
+
+	var stderr strings.Builder
+	WriteError(&stderr, &config.ConfigENV{JSONErrors: true}, err)
+
+	var got map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(stderr.String()), &got))
+	assert.Equal(t, map[string]string{
+		"error": "failed command from client: rpc error: code = Unauthenticated desc = token expired",
+		"code":  "Unauthenticated",
+	}, got)
+
+	// A command failed by the agent itself
+	stderr.Reset()
+	err = Run(nil, &config.ConfigENV{Command: "read-file", Format: "xml", JSONErrors: true})
+	assert.Error(t, err)
+	WriteError(&stderr, &config.ConfigENV{JSONErrors: true}, err)
+
+	assert.NoError(t, json.Unmarshal([]byte(stderr.String()), &got))
+	assert.Equal(t, "Unknown", got["code"])
+	assert.Contains(t, got["error"], "unknown format xml")
+
+	// Without the flag the message is written as is
+	stderr.Reset()
+	WriteError(&stderr, &config.ConfigENV{}, err)
+	assert.Equal(t, err.Error()+"\n", stderr.String())
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// errExecCommand is returned by -exec without a command after "--".
+var errExecCommand = errors.New("-exec needs a command after --, e.g. -exec -- ssh-add -")
+
+// ExitError is returned when the command of -exec exits with a non-zero
+// code, the agent exits with the same code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command exited with code %d", e.Code)
+}
+
+// execWithData runs the command with the data on its stdin. The data is
+// passed through a pipe, it is never written to disk. The output of the
+// command goes to the output of the agent.
+func execWithData(args []string, data []byte) error {
+	if len(args) == 0 {
+		return errExecCommand
+	}
+
+	//nolint:gosec // The command is given by the user to receive the data
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = result
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code := exitErr.ExitCode()
+		// The command killed by a signal has no exit code
+		if code < 0 {
+			code = 1
+		}
+
+		return &ExitError{Code: code}
+	}
+	if err != nil {
+		return fmt.Errorf("failed start command: %w", err)
+	}
+
+	return nil
+}
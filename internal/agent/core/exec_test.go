@@ -0,0 +1,58 @@
+//go:build unix
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecRecord(t *testing.T) {
+	output = io.Discard
+	data := []byte("secret\x00data\nwithout a trailing line break")
+
+	tests := []struct {
+		name    string
+		args    []string
+		exp     string
+		code    int
+		wantErr bool
+	}{
+		{name: "Echo input", args: []string{"cat"}, exp: string(data)},
+		{name: "Arguments", args: []string{"sh", "-c", `printf "%s: " "$1"; cat`, "sh", "key"}, exp: "key: " + string(data)},
+		{name: "Exit code", args: []string{"sh", "-c", "cat >/dev/null; exit 3"}, code: 3},
+		{name: "Not started", args: []string{"goph-keeper-no-such-command"}, wantErr: true},
+		{name: "No command", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			result = &out
+
+			cfg := &config.ConfigENV{Exec: true, Paths: tt.args}
+			err := printRecord(cfg, &proto.ReadRecordResponse{Name: "key", Type: "file", Data: data})
+
+			switch {
+			case tt.code != 0:
+				var exitErr *ExitError
+				require.ErrorAs(t, err, &exitErr)
+				assert.Equal(t, tt.code, exitErr.Code)
+			case tt.wantErr:
+				var exitErr *ExitError
+				assert.Error(t, err)
+				assert.False(t, errors.As(err, &exitErr))
+			default:
+				require.NoError(t, err)
+				assert.Equal(t, tt.exp, out.String())
+			}
+		})
+	}
+}
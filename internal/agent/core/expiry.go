@@ -0,0 +1,67 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// day is the unit of the rotation interval of the passwords.
+const day = 24 * time.Hour
+
+// overduePassword is a credentials record whose password is older than its
+// rotation interval.
+type overduePassword struct {
+	Name      string
+	ChangedAt time.Time
+	// Overdue is the number of whole days passed since the rotation was due.
+	Overdue int
+}
+
+// overduePasswords returns the credentials records to rotate at the time,
+// the most overdue first. Records without a rotation interval or a time of
+// the password change never expire.
+func overduePasswords(records []credentialsRecord, now time.Time) []overduePassword {
+	var overdue []overduePassword
+	for _, r := range records {
+		if r.RotationDays <= 0 || r.PasswordChangedAt == nil {
+			continue
+		}
+
+		due := r.PasswordChangedAt.Add(time.Duration(r.RotationDays) * day)
+		if now.Before(due) {
+			continue
+		}
+
+		overdue = append(overdue, overduePassword{
+			Name:      r.Name,
+			ChangedAt: *r.PasswordChangedAt,
+			Overdue:   int(now.Sub(due) / day),
+		})
+	}
+
+	sort.SliceStable(overdue, func(i, j int) bool {
+		if overdue[i].Overdue != overdue[j].Overdue {
+			return overdue[i].Overdue > overdue[j].Overdue
+		}
+
+		return overdue[i].Name < overdue[j].Name
+	})
+
+	return overdue
+}
+
+// printExpiry shows the records with the passwords to rotate.
+func printExpiry(overdue []overduePassword) {
+	if len(overdue) == 0 {
+		fmt.Fprintln(output, "No passwords overdue for rotation.")
+		return
+	}
+
+	fmt.Fprintln(output, "Passwords overdue for rotation:")
+	for _, o := range overdue {
+		fmt.Fprintf(output, "- %s (changed %s, overdue %v days) \n", o.Name, o.ChangedAt.Format(time.DateOnly), o.Overdue)
+	}
+
+	fmt.Fprintln(output, "Use rotate-password to replace them.")
+}
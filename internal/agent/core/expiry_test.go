@@ -0,0 +1,50 @@
+package core
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverduePasswords(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	changed := func(daysAgo int) *time.Time {
+		at := now.Add(-time.Duration(daysAgo) * day)
+		return &at
+	}
+
+	records := []credentialsRecord{
+		{Name: "mail", credentials: credentials{PasswordChangedAt: changed(100), RotationDays: 90}},
+		{Name: "bank", credentials: credentials{PasswordChangedAt: changed(30), RotationDays: 90}},
+		{Name: "vpn", credentials: credentials{PasswordChangedAt: changed(45), RotationDays: 30}},
+		{Name: "wiki", credentials: credentials{PasswordChangedAt: changed(30), RotationDays: 30}},
+		{Name: "forum", credentials: credentials{PasswordChangedAt: changed(1000)}},
+		{Name: "legacy", credentials: credentials{RotationDays: 30}},
+	}
+
+	overdue := overduePasswords(records, now)
+	assert.Equal(t, []overduePassword{
+		{Name: "vpn", ChangedAt: *changed(45), Overdue: 15},
+		{Name: "mail", ChangedAt: *changed(100), Overdue: 10},
+		{Name: "wiki", ChangedAt: *changed(30), Overdue: 0},
+	}, overdue)
+
+	assert.Empty(t, overduePasswords(records, now.Add(-20*day)))
+}
+
+func TestPrintExpiry(t *testing.T) {
+	var out strings.Builder
+	output = &out
+	defer func() { output = os.Stdout }()
+
+	changed := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	printExpiry([]overduePassword{{Name: "mail", ChangedAt: changed, Overdue: 10}})
+	assert.Contains(t, out.String(), "- mail (changed 2024-01-02, overdue 10 days)")
+
+	out.Reset()
+	printExpiry(nil)
+	assert.Equal(t, "No passwords overdue for rotation.\n", out.String())
+}
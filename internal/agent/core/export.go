@@ -0,0 +1,259 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/Renal37/goph-keeper/internal/agent/client"
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+)
+
+// exportPageSize is the number of records listed by one request of export.
+var exportPageSize int32 = 100
+
+// exportResumeSuffix is appended to the output file to get the file of the export state.
+const exportResumeSuffix = ".resume"
+
+// credentialsPages reads the page of credentials records starting at the token
+// and returns the token of the next page, empty after the last page.
+type credentialsPages func(token string) ([]credentialsRecord, string, error)
+
+// readCredentialsPages returns a reader of the credentials records page by
+// page, so only one page of records is held in memory.
+func readCredentialsPages(cl *client.Client, cfg *config.ConfigENV) credentialsPages {
+	return func(token string) ([]credentialsRecord, string, error) {
+		opts := append(listOptions(cfg), client.WithPage(exportPageSize, token))
+
+		page, err := cl.ReadAllFile(opts...)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed get all file: %w", err)
+		}
+
+		records, err := decryptCredentials(cl, credentialsIDs(page.Units))
+		if err != nil {
+			return nil, "", err
+		}
+
+		return records, page.NextPageToken, nil
+	}
+}
+
+// exportState is the progress of an export to a file. It is saved next to
+// the file after every page, so an interrupted export continues with the
+// next page.
+type exportState struct {
+	Format    string `json:"format"`
+	PageToken string `json:"page_token"`
+	// Offset is the size of the file after the last saved page, a page
+	// written only partly is cut off on resume.
+	Offset int64 `json:"offset"`
+	Count  int   `json:"count"`
+}
+
+// exportKeePass writes the credentials to w and returns their number.
+// CSV is written page by page, XML is collected first, as its records are
+// grouped by category.
+func exportKeePass(w io.Writer, format string, pages credentialsPages) (int, error) {
+	if format == FormatKeePassXML {
+		records, err := readAllPages(pages)
+		if err != nil {
+			return 0, err
+		}
+
+		return len(records), writeKeePassXML(w, records)
+	}
+
+	if format != FormatKeePass {
+		return 0, fmt.Errorf("unknown export format %s, use %s or %s", format, FormatKeePass, FormatKeePassXML)
+	}
+
+	if err := writeCSVRows(w, [][]string{keePassColumns}); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	token := ""
+	for {
+		records, next, err := pages(token)
+		if err != nil {
+			return count, err
+		}
+
+		if err := writeKeePassCSVRows(w, records); err != nil {
+			return count, err
+		}
+
+		count += len(records)
+		if next == "" {
+			return count, nil
+		}
+
+		token = next
+	}
+}
+
+// exportKeePassFile writes the credentials to the file and returns their
+// number. A CSV export is resumable: if it is interrupted, running it again
+// continues after the last written page. XML is written at once.
+func exportKeePassFile(path string, format string, pages credentialsPages) (int, error) {
+	statePath := path + exportResumeSuffix
+
+	if format != FormatKeePass {
+		if _, err := os.Stat(statePath); err == nil {
+			return 0, fmt.Errorf("unfinished export to %s has format %s, remove %s to start again", path, FormatKeePass, statePath)
+		}
+
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, defaultPermition)
+		if err != nil {
+			return 0, fmt.Errorf("failed open export file: %w", err)
+		}
+		defer file.Close()
+
+		return exportKeePass(file, format, pages)
+	}
+
+	file, state, err := openExportFile(path, statePath, format)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	for {
+		records, next, err := pages(state.PageToken)
+		if err != nil {
+			return state.Count, err
+		}
+
+		if err := writeKeePassCSVRows(file, records); err != nil {
+			return state.Count, err
+		}
+
+		state.PageToken = next
+		state.Count += len(records)
+		if next == "" {
+			break
+		}
+
+		if err := saveExportState(file, statePath, state); err != nil {
+			return state.Count, err
+		}
+	}
+
+	if err := os.Remove(statePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return state.Count, fmt.Errorf("failed remove export state: %w", err)
+	}
+
+	return state.Count, nil
+}
+
+// openExportFile opens the file of a CSV export. An unfinished export is
+// continued from its saved state, otherwise the file is created with the header.
+func openExportFile(path string, statePath string, format string) (*os.File, *exportState, error) {
+	data, err := os.ReadFile(statePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, defaultPermition)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed open export file: %w", err)
+		}
+
+		state := &exportState{Format: format}
+		if err := writeCSVRows(file, [][]string{keePassColumns}); err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+
+		if err := saveExportState(file, statePath, state); err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+
+		return file, state, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed read export state: %w", err)
+	}
+
+	var state exportState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, nil, fmt.Errorf("failed decode export state: %w", err)
+	}
+
+	if state.Format != format {
+		return nil, nil, fmt.Errorf("unfinished export to %s has format %s, remove %s to start again", path, state.Format, statePath)
+	}
+
+	fmt.Fprintf(output, "Resuming export, %v credentials already exported \n", state.Count)
+
+	file, err := os.OpenFile(path, os.O_WRONLY, defaultPermition)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed open export file: %w", err)
+	}
+
+	// Cut off the rows written after the state was saved
+	if err := file.Truncate(state.Offset); err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed truncate export file: %w", err)
+	}
+
+	if _, err := file.Seek(state.Offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed seek export file: %w", err)
+	}
+
+	return file, &state, nil
+}
+
+// saveExportState flushes the written rows to disk and saves the state with
+// the current size of the file. The state file is replaced atomically.
+func saveExportState(file *os.File, statePath string, state *exportState) error {
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed sync export file: %w", err)
+	}
+
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed get export file offset: %w", err)
+	}
+
+	state.Offset = offset
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed encode export state: %w", err)
+	}
+
+	tmp := statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, defaultPermition); err != nil {
+		return fmt.Errorf("failed write export state: %w", err)
+	}
+
+	if err := os.Rename(tmp, statePath); err != nil {
+		return fmt.Errorf("failed write export state: %w", err)
+	}
+
+	return nil
+}
+
+// readAllPages reads the credentials records of all pages.
+func readAllPages(pages credentialsPages) ([]credentialsRecord, error) {
+	var records []credentialsRecord
+
+	token := ""
+	for {
+		page, next, err := pages(token)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, page...)
+		if next == "" {
+			return records, nil
+		}
+
+		token = next
+	}
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testPages serves the records by pages of one record and fails once on the
+// page failAt.
+func testPages(records []credentialsRecord, failAt int) credentialsPages {
+	failed := false
+
+	return func(token string) ([]credentialsRecord, string, error) {
+		i := 0
+		if token != "" {
+			i, _ = strconv.Atoi(token)
+		}
+
+		if i == failAt && !failed {
+			failed = true
+			return nil, "", errors.New("connection lost")
+		}
+
+		next := ""
+		if i+1 < len(records) {
+			next = strconv.Itoa(i + 1)
+		}
+
+		return records[i : i+1], next, nil
+	}
+}
+
+func TestExportKeePass(t *testing.T) {
+	var b strings.Builder
+	count, err := exportKeePass(&b, FormatKeePass, testPages(keePassRecords, -1))
+	assert.NoError(t, err)
+	assert.Equal(t, len(keePassRecords), count)
+
+	var want strings.Builder
+	assert.NoError(t, writeKeePassCSV(&want, keePassRecords))
+	assert.Equal(t, want.String(), b.String())
+
+	_, err = exportKeePass(io.Discard, FormatTable, testPages(keePassRecords, -1))
+	assert.Error(t, err)
+}
+
+func TestExportKeePassFileResume(t *testing.T) {
+	output = io.Discard
+	path := filepath.Join(t.TempDir(), "export.csv")
+	pages := testPages(keePassRecords, 2)
+
+	count, err := exportKeePassFile(path, FormatKeePass, pages)
+	assert.Error(t, err)
+	assert.Equal(t, 2, count)
+	assert.FileExists(t, path+exportResumeSuffix)
+
+	// A row written after the state was saved must not be duplicated
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, defaultPermition)
+	assert.NoError(t, err)
+	_, err = f.WriteString(`"goph-keeper","partial"`)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	_, err = exportKeePassFile(path, FormatKeePassXML, pages)
+	assert.Error(t, err, "export with other format must not resume")
+
+	count, err = exportKeePassFile(path, FormatKeePass, pages)
+	assert.NoError(t, err)
+	assert.Equal(t, len(keePassRecords), count)
+	assert.NoFileExists(t, path+exportResumeSuffix)
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	var want strings.Builder
+	assert.NoError(t, writeKeePassCSV(&want, keePassRecords))
+	assert.Equal(t, want.String(), string(data))
+}
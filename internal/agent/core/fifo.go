@@ -0,0 +1,76 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// errFIFOUnsupported is returned by -fifo on the platforms without named pipes.
+var errFIFOUnsupported = errors.New("named pipes are not supported on this platform")
+
+// errNotFIFO is returned when the -fifo path exists, but is not a named pipe.
+var errNotFIFO = errors.New("path exists and is not a named pipe")
+
+// writeFIFO writes the data to the named pipe at the path, so another
+// process reads the secret without it being stored on disk. A missing pipe
+// is created and removed when the data is written, an existing regular file
+// is never written. Opening a pipe blocks until a reader opens it as well,
+// so the open is abandoned when the context is done.
+func writeFIFO(ctx context.Context, path string, data []byte) error {
+	info, err := os.Lstat(path)
+	switch {
+	case err == nil:
+		if info.Mode()&os.ModeNamedPipe == 0 {
+			return fmt.Errorf("%s: %w", path, errNotFIFO)
+		}
+	case errors.Is(err, os.ErrNotExist):
+		if err := mkfifo(path); err != nil {
+			return fmt.Errorf("failed create fifo: %w", err)
+		}
+
+		defer os.Remove(path)
+	default:
+		return fmt.Errorf("failed stat fifo: %w", err)
+	}
+
+	type opened struct {
+		f   *os.File
+		err error
+	}
+	done := make(chan opened, 1)
+
+	go func() {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		done <- opened{f: f, err: err}
+	}()
+
+	var f *os.File
+	select {
+	case o := <-done:
+		if o.err != nil {
+			return fmt.Errorf("failed open fifo: %w", o.err)
+		}
+		f = o.f
+	case <-ctx.Done():
+		// Open the other end, so the blocked open returns and the file is closed
+		unblockFIFO(path)
+		if o := <-done; o.err == nil {
+			o.f.Close()
+		}
+
+		return fmt.Errorf("no reader opened the fifo: %w", ctx.Err())
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed write fifo: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed close fifo: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package core
+
+func mkfifo(string) error {
+	return errFIFOUnsupported
+}
+
+func unblockFIFO(string) {}
@@ -0,0 +1,59 @@
+//go:build unix
+
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFIFO(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret.fifo")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- writeFIFO(context.Background(), path, []byte("secret"))
+	}()
+
+	// The pipe is created by the writer, reading it waits for the data
+	require.Eventually(t, func() bool {
+		info, err := os.Lstat(path)
+		return err == nil && info.Mode()&os.ModeNamedPipe != 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", string(data))
+
+	assert.NoError(t, <-done)
+	assert.NoFileExists(t, path, "created pipe must be removed")
+}
+
+func TestWriteFIFOWithoutReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret.fifo")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := writeFIFO(ctx, path, []byte("secret"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NoFileExists(t, path)
+}
+
+func TestWriteFIFORegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret.txt")
+	require.NoError(t, os.WriteFile(path, []byte("keep"), defaultPermition))
+
+	err := writeFIFO(context.Background(), path, []byte("secret"))
+	assert.ErrorIs(t, err, errNotFIFO)
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "keep", string(data))
+}
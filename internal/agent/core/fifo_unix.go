@@ -0,0 +1,22 @@
+//go:build unix
+
+package core
+
+import (
+	"os"
+	"syscall"
+)
+
+// mkfifo creates a named pipe only the user can read and write.
+func mkfifo(path string) error {
+	//nolint:wrapcheck // This legal return
+	return syscall.Mkfifo(path, uint32(defaultPermition))
+}
+
+// unblockFIFO opens the read end of the pipe without blocking and closes it.
+func unblockFIFO(path string) {
+	f, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err == nil {
+		f.Close()
+	}
+}
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Renal37/goph-keeper/internal/agent/client"
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+)
+
+// noFolder is the heading of the files in no folder.
+const noFolder = "(no folder)"
+
+// listFolder lists the files of the `-folder` folder and its nested folders,
+// all files without the flag, grouped by their folders. The other filters
+// of the list apply as well.
+func listFolder(cl *client.Client, cfg *config.ConfigENV) error {
+	// A wrong path would be rejected by the server anyway
+	if err := domain.ValidateFolder(cfg.Folder); err != nil {
+		//nolint:wrapcheck // This legal return
+		return err
+	}
+
+	rAllFile, err := cl.ReadAllFile(listOptions(cfg)...)
+	if err != nil {
+		return fmt.Errorf("failed get all file: %w", err)
+	}
+
+	// If there are no files, exit
+	if len(rAllFile.Units) == 0 {
+		fmt.Fprintln(output, "Not found files. Bye!")
+		return nil
+	}
+
+	printFolders(output, rAllFile.Units)
+
+	return nil
+}
+
+// printFolders prints the files under the paths of their folders, a nested
+// folder right after its parent. The files of a folder keep the order of the
+// list.
+func printFolders(w io.Writer, units []*proto.StorageUnit) {
+	groups := make(map[string][]*proto.StorageUnit)
+	var folders []string
+	for _, u := range units {
+		if _, ok := groups[u.Folder]; !ok {
+			folders = append(folders, u.Folder)
+		}
+		groups[u.Folder] = append(groups[u.Folder], u)
+	}
+	// The paths are compared by the folder names, so "work/aws/prod" comes
+	// right after "work/aws" and before "work/aws-old"
+	sort.Slice(folders, func(i, j int) bool {
+		return slices.Compare(strings.Split(folders[i], domain.FolderSeparator), strings.Split(folders[j], domain.FolderSeparator)) < 0
+	})
+
+	for _, f := range folders {
+		heading := f + domain.FolderSeparator
+		if f == "" {
+			heading = noFolder
+		}
+		fmt.Fprintln(w, heading)
+
+		for _, u := range groups[f] {
+			fmt.Fprintf(w, "  [%v] - %s (%s) \n", u.Id, u.Name, u.Type)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// folderStorage answers ReadAllRecord with the units of the folder of the
+// request and its nested folders, as the server does.
+type folderStorage struct {
+	proto.UnimplementedStorageServer
+	units   []*proto.StorageUnit
+	folders []string
+}
+
+func (s *folderStorage) ReadAllRecord(_ context.Context, in *proto.ReadAllRecordRequest) (*proto.ReadAllRecordResponse, error) {
+	s.folders = append(s.folders, in.Folder)
+
+	var resp proto.ReadAllRecordResponse
+	for _, u := range s.units {
+		if in.Folder == "" || u.Folder == in.Folder || strings.HasPrefix(u.Folder, in.Folder+"/") {
+			resp.Units = append(resp.Units, u)
+		}
+	}
+
+	return &resp, nil
+}
+
+func TestListFolder(t *testing.T) {
+	var out strings.Builder
+	output = &out
+	defer func() { output = os.Stdout }()
+
+	storage := &folderStorage{units: []*proto.StorageUnit{
+		{Id: 1, Name: "notes", Type: "text"},
+		{Id: 2, Name: "prod", Type: "credentials", Folder: "work/aws/prod"},
+		{Id: 3, Name: "old", Type: "credentials", Folder: "work/aws-old"},
+		{Id: 4, Name: "root", Type: "credentials", Folder: "work/aws"},
+		{Id: 5, Name: "staging", Type: "credentials", Folder: "work/aws/prod"},
+	}}
+	cl := testClient(t, storage)
+
+	// The nested folders follow their parent, the files keep the list order
+	require.NoError(t, listFolder(cl, &config.ConfigENV{Folder: "work/aws"}))
+	assert.Equal(t, "work/aws/\n"+
+		"  [4] - root (credentials) \n"+
+		"work/aws/prod/\n"+
+		"  [2] - prod (credentials) \n"+
+		"  [5] - staging (credentials) \n", out.String())
+
+	out.Reset()
+	require.NoError(t, listFolder(cl, &config.ConfigENV{}))
+	assert.Equal(t, "(no folder)\n"+
+		"  [1] - notes (text) \n"+
+		"work/aws/\n"+
+		"  [4] - root (credentials) \n"+
+		"work/aws/prod/\n"+
+		"  [2] - prod (credentials) \n"+
+		"  [5] - staging (credentials) \n"+
+		"work/aws-old/\n"+
+		"  [3] - old (credentials) \n", out.String())
+
+	out.Reset()
+	require.NoError(t, listFolder(cl, &config.ConfigENV{Folder: "home"}))
+	assert.Equal(t, "Not found files. Bye!\n", out.String())
+
+	assert.Equal(t, []string{"work/aws", "", "home"}, storage.folders)
+
+	// A wrong path is rejected without a call
+	for _, folder := range []string{"/work", "work/", "work//aws", "work/../aws", " work"} {
+		assert.Error(t, listFolder(cl, &config.ConfigENV{Folder: folder}), folder)
+	}
+	assert.Len(t, storage.folders, 3)
+}
@@ -0,0 +1,325 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Renal37/goph-keeper/internal/agent/client"
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+)
+
+// FormatGophJSON is the format of the export of all records with their data
+// and attributes, the import reads it back, e.g. to move the records to
+// another server.
+const FormatGophJSON = "goph-json"
+
+// gophJSONVersion is the version of the goph-json export.
+const gophJSONVersion = 1
+
+// Policies of the import for a record with the name of an existing record.
+const (
+	ImportSkip      = "skip"
+	ImportOverwrite = "overwrite"
+)
+
+// Statuses of the imported records.
+const (
+	importStatusImported    = "imported"
+	importStatusOverwritten = "overwritten"
+	importStatusSkipped     = "skipped"
+	importStatusFailed      = "failed"
+)
+
+// gophJSONExport is the goph-json export. The data is not encrypted.
+type gophJSONExport struct {
+	Format  string           `json:"format"`
+	Version int              `json:"version"`
+	Records []gophJSONRecord `json:"records"`
+}
+
+// gophJSONRecord is an exported record. The data is encoded in base64, as
+// the files may be binary.
+type gophJSONRecord struct {
+	Name     string            `json:"name"`
+	Type     string            `json:"type"`
+	Category string            `json:"category,omitempty"`
+	Folder   string            `json:"folder,omitempty"`
+	Meta     map[string]string `json:"meta,omitempty"`
+	MimeType string            `json:"mime_type,omitempty"`
+	Data     []byte            `json:"data"`
+}
+
+// importResult is the outcome of the import of a record.
+type importResult struct {
+	Name   string
+	Status string
+	ID     int32
+	Err    error
+}
+
+// exportGophJSON writes the records matching the filters of the agent with
+// their data to w and returns their number. A record that can't be read,
+// e.g. one requiring the confirmation of the read, is reported and skipped.
+func exportGophJSON(cl *client.Client, cfg *config.ConfigENV, w io.Writer) (int, error) {
+	export := gophJSONExport{Format: FormatGophJSON, Version: gophJSONVersion, Records: []gophJSONRecord{}}
+
+	token := ""
+	for {
+		page, err := cl.ReadAllFile(append(listOptions(cfg), client.WithPage(exportPageSize, token))...)
+		if err != nil {
+			return 0, fmt.Errorf("failed get all file: %w", err)
+		}
+
+		ids := make([]int32, 0, len(page.Units))
+		for _, u := range page.Units {
+			ids = append(ids, u.Id)
+		}
+
+		if len(ids) > 0 {
+			recs, err := cl.ReadMany(ids)
+			if err != nil {
+				return 0, err
+			}
+
+			for _, r := range recs {
+				if r.Error != "" {
+					fmt.Fprintf(output, "Skipped file %v: %s \n", r.Id, r.Error)
+					continue
+				}
+
+				export.Records = append(export.Records, gophJSONRecord{
+					Name:     r.Name,
+					Type:     r.Type,
+					Category: r.Category,
+					Folder:   r.Folder,
+					Meta:     r.Meta,
+					MimeType: r.MimeType,
+					Data:     r.Data,
+				})
+			}
+		}
+
+		if page.NextPageToken == "" {
+			break
+		}
+		token = page.NextPageToken
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(export); err != nil {
+		return 0, fmt.Errorf("failed write export: %w", err)
+	}
+
+	return len(export.Records), nil
+}
+
+// exportGophJSONFile writes the goph-json export to the file, readable only
+// by the user, as the data is not encrypted.
+func exportGophJSONFile(cl *client.Client, cfg *config.ConfigENV, path string) (int, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, defaultPermition)
+	if err != nil {
+		return 0, fmt.Errorf("failed open export file: %w", err)
+	}
+	defer file.Close()
+
+	return exportGophJSON(cl, cfg, file)
+}
+
+// importGophJSON writes the records of the goph-json export read from r as
+// new records. A record with the name of an existing record is skipped, or
+// with ImportOverwrite written and the existing records deleted. The import
+// goes on after a failed record, the outcome of every record is returned.
+func importGophJSON(cl *client.Client, r io.Reader, policy string) ([]importResult, error) {
+	if policy != ImportSkip && policy != ImportOverwrite {
+		return nil, fmt.Errorf("unknown import policy %s, use %s or %s", policy, ImportSkip, ImportOverwrite)
+	}
+
+	var export gophJSONExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, fmt.Errorf("failed read import: %w", err)
+	}
+
+	if export.Format != FormatGophJSON {
+		return nil, fmt.Errorf("unknown import format %q, expected %s", export.Format, FormatGophJSON)
+	}
+
+	if export.Version > gophJSONVersion {
+		return nil, fmt.Errorf("unsupported %s version %v, the maximum is %v", FormatGophJSON, export.Version, gophJSONVersion)
+	}
+
+	existing, err := recordNames(cl)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]importResult, 0, len(export.Records))
+	for _, rec := range export.Records {
+		res := importResult{Name: rec.Name, Status: importStatusImported}
+
+		previous := existing[rec.Name]
+		if len(previous) > 0 {
+			if policy == ImportSkip {
+				res.Status = importStatusSkipped
+				results = append(results, res)
+				continue
+			}
+
+			res.Status = importStatusOverwritten
+		}
+
+		// The record is written before the previous ones are deleted, so a
+		// failed write loses nothing
+		res.ID, res.Err = writeGophRecord(cl, rec)
+		if res.Err == nil {
+			existing[rec.Name] = []int32{res.ID}
+
+			for _, id := range previous {
+				err := withReauth(cl, func() error {
+					_, err := cl.DeleteFile(id)
+					return err
+				})
+				if err != nil {
+					res.Err = fmt.Errorf("failed delete the previous file %v: %w", id, err)
+					existing[rec.Name] = append(existing[rec.Name], id)
+				}
+			}
+		}
+
+		if res.Err != nil {
+			res.Status = importStatusFailed
+		}
+
+		results = append(results, res)
+	}
+
+	return results, nil
+}
+
+// recordNames returns the IDs of all records of the user by their names.
+func recordNames(cl *client.Client) (map[string][]int32, error) {
+	names := make(map[string][]int32)
+
+	token := ""
+	for {
+		page, err := cl.ReadAllFile(client.WithPage(exportPageSize, token))
+		if err != nil {
+			return nil, fmt.Errorf("failed get all file: %w", err)
+		}
+
+		for _, u := range page.Units {
+			names[u.Name] = append(names[u.Name], u.Id)
+		}
+
+		if page.NextPageToken == "" {
+			return names, nil
+		}
+		token = page.NextPageToken
+	}
+}
+
+// writeGophRecord writes an imported record and returns its ID. The data of
+// a file is written from a temporary file, as files are uploaded by path.
+func writeGophRecord(cl *client.Client, rec gophJSONRecord) (int32, error) {
+	opts := []client.WriteOption{client.WithCategory(rec.Category), client.WithFolder(rec.Folder), client.WithMeta(rec.Meta)}
+	if rec.MimeType != "" {
+		opts = append(opts, client.WithMimeType(rec.MimeType))
+	}
+
+	data := string(rec.Data)
+	if rec.Type == "file" {
+		tmp, err := os.CreateTemp("", "goph-keeper-import-*")
+		if err != nil {
+			return 0, fmt.Errorf("failed create temporary file: %w", err)
+		}
+		defer os.Remove(tmp.Name())
+
+		_, err = tmp.Write(rec.Data)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed write temporary file: %w", err)
+		}
+
+		data = tmp.Name()
+	}
+
+	w, err := cl.WriteFile(rec.Type, rec.Name, data, opts...)
+	if err != nil {
+		return 0, fmt.Errorf("write file has error: %w", err)
+	}
+
+	return w.Id, nil
+}
+
+// printImport prints the outcome of every imported record.
+func printImport(w io.Writer, results []importResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tID\tNAME\tERROR")
+	for _, r := range results {
+		id := "-"
+		if r.ID != 0 {
+			id = fmt.Sprint(r.ID)
+		}
+
+		errText := ""
+		if r.Err != nil {
+			errText = r.Err.Error()
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Status, id, truncate(r.Name, maxTableNameLength), errText)
+	}
+
+	// The writer only fails if the output fails, the same as fmt.Fprint above
+	_ = tw.Flush()
+}
+
+// importFiles imports the goph-json export from -in or stdin and prints the
+// outcome of every record.
+func importFiles(cl *client.Client, cfg *config.ConfigENV) error {
+	r := input
+	if cfg.In != "" {
+		file, err := os.Open(cfg.In)
+		if err != nil {
+			return fmt.Errorf("failed open import file: %w", err)
+		}
+		defer file.Close()
+
+		r = file
+	}
+
+	results, err := importGophJSON(cl, r, cfg.OnConflict)
+	if err != nil {
+		return fmt.Errorf("failed import files: %w", err)
+	}
+
+	printImport(result, results)
+
+	counts := importSummary(results)
+	fmt.Fprintf(output, "Imported %v, overwritten %v, skipped %v, failed %v \n", counts[importStatusImported],
+		counts[importStatusOverwritten], counts[importStatusSkipped], counts[importStatusFailed])
+
+	if counts[importStatusFailed] > 0 {
+		return errImportIncomplete
+	}
+
+	return nil
+}
+
+// importSummary counts the imported records by their statuses.
+func importSummary(results []importResult) map[string]int {
+	counts := make(map[string]int)
+	for _, r := range results {
+		counts[r.Status]++
+	}
+
+	return counts
+}
+
+// errImportIncomplete means some records of the import failed.
+var errImportIncomplete = errors.New("some files were not imported")
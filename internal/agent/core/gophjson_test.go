@@ -0,0 +1,214 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// vaultStorage keeps the records of a user in memory, as a server does.
+type vaultStorage struct {
+	proto.UnimplementedStorageServer
+
+	mu      sync.Mutex
+	records map[int32]*proto.ReadRecordResponse
+	nextID  int32
+}
+
+func newVaultStorage() *vaultStorage {
+	return &vaultStorage{records: make(map[int32]*proto.ReadRecordResponse)}
+}
+
+func (s *vaultStorage) ReadAllRecord(_ context.Context, in *proto.ReadAllRecordRequest) (*proto.ReadAllRecordResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]int32, 0, len(s.records))
+	for id := range s.records {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	start, _ := strconv.Atoi(in.PageToken)
+	end := len(ids)
+	if in.PageSize > 0 {
+		end = min(start+int(in.PageSize), len(ids))
+	}
+
+	var resp proto.ReadAllRecordResponse
+	for _, id := range ids[start:end] {
+		r := s.records[id]
+		resp.Units = append(resp.Units, &proto.StorageUnit{Id: id, Name: r.Name, Type: r.Type, Category: r.Category, Folder: r.Folder, Meta: r.Meta})
+	}
+	if end < len(ids) {
+		resp.NextPageToken = strconv.Itoa(end)
+	}
+
+	return &resp, nil
+}
+
+func (s *vaultStorage) ReadRecords(_ context.Context, in *proto.ReadRecordsRequest) (*proto.ReadRecordsResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var resp proto.ReadRecordsResponse
+	for _, id := range in.Ids {
+		r, ok := s.records[id]
+		if !ok {
+			resp.Records = append(resp.Records, &proto.ReadRecordResponse{Id: id, Error: "record not found"})
+			continue
+		}
+
+		resp.Records = append(resp.Records, r)
+	}
+
+	return &resp, nil
+}
+
+func (s *vaultStorage) WriteRecord(stream proto.Storage_WriteRecordServer) error {
+	var rec proto.ReadRecordResponse
+	for {
+		in, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		rec.Name, rec.Type, rec.Category, rec.Meta, rec.MimeType = in.Name, in.Type, in.Category, in.Meta, in.MimeType
+		rec.Folder = in.Folder
+		rec.Data = append(rec.Data, in.Data...)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	rec.Id = s.nextID
+	s.records[rec.Id] = &rec
+
+	return stream.SendAndClose(&proto.WriteRecordResponse{Id: rec.Id})
+}
+
+func (s *vaultStorage) DeleteRecord(_ context.Context, in *proto.DeleteRecordRequest) (*proto.DeleteRecordResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, in.Id)
+
+	return &proto.DeleteRecordResponse{}, nil
+}
+
+// byName returns the records of the storage by their names.
+func (s *vaultStorage) byName() map[string]*proto.ReadRecordResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make(map[string]*proto.ReadRecordResponse, len(s.records))
+	for _, r := range s.records {
+		names[r.Name] = r
+	}
+
+	return names
+}
+
+func TestGophJSONRoundTrip(t *testing.T) {
+	output = io.Discard
+
+	from := newVaultStorage()
+	written := []*proto.ReadRecordResponse{
+		{Name: "mail", Type: "credentials", Category: "work", Folder: "work/mail", Meta: map[string]string{"site": "mail.example.com"},
+			Data: []byte(`{"login":"bob","password":"secret"}`)},
+		{Name: "notes", Type: "text", Data: []byte("first line\nsecond line")},
+		{Name: "config", Type: "json", Category: "ops", Data: []byte(`{"port":8080}`)},
+		{Name: "key.bin", Type: "file", MimeType: "application/octet-stream", Meta: map[string]string{"archive": ""},
+			Data: []byte{0x00, 0xff, 0x10, '\n'}},
+	}
+	for i, r := range written {
+		r.Id = int32(i + 1)
+		from.records[r.Id] = r
+	}
+	from.nextID = int32(len(written))
+
+	// Pages smaller than the records are read one after another
+	defer func(size int32) { exportPageSize = size }(exportPageSize)
+	exportPageSize = 3
+
+	var export bytes.Buffer
+	count, err := exportGophJSON(testClient(t, from), &config.ConfigENV{}, &export)
+	require.NoError(t, err)
+	assert.Equal(t, len(written), count)
+	assert.Contains(t, export.String(), `"format": "goph-json"`)
+
+	// Another server has a record with the name of an exported one
+	to := newVaultStorage()
+	to.records[1] = &proto.ReadRecordResponse{Id: 1, Name: "notes", Type: "text", Data: []byte("other notes")}
+	to.nextID = 1
+	cl := testClient(t, to)
+
+	results, err := importGophJSON(cl, bytes.NewReader(export.Bytes()), ImportSkip)
+	require.NoError(t, err)
+	require.Len(t, results, len(written))
+	assert.Equal(t, map[string]int{importStatusImported: 3, importStatusSkipped: 1}, importSummary(results))
+	assert.Equal(t, importResult{Name: "notes", Status: importStatusSkipped}, results[1])
+
+	imported := to.byName()
+	assert.Equal(t, []byte("other notes"), imported["notes"].Data)
+	for _, r := range written {
+		if r.Name == "notes" {
+			continue
+		}
+
+		got := imported[r.Name]
+		require.NotNil(t, got, r.Name)
+		assert.Equal(t, r.Type, got.Type)
+		assert.Equal(t, r.Category, got.Category)
+		assert.Equal(t, r.Folder, got.Folder)
+		assert.Equal(t, r.Meta, got.Meta)
+		assert.Equal(t, r.MimeType, got.MimeType)
+		assert.Equal(t, r.Data, got.Data)
+	}
+
+	// Overwriting replaces the existing record and keeps one per name
+	results, err = importGophJSON(cl, bytes.NewReader(export.Bytes()), ImportOverwrite)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{importStatusOverwritten: len(written)}, importSummary(results))
+
+	imported = to.byName()
+	assert.Len(t, to.records, len(written))
+	assert.Equal(t, []byte("first line\nsecond line"), imported["notes"].Data)
+
+	var summary bytes.Buffer
+	printImport(&summary, results)
+	lines := strings.Split(strings.TrimSpace(summary.String()), "\n")
+	assert.Len(t, lines, len(written)+1)
+	assert.Regexp(t, `^overwritten\s+\d+\s+mail\s*$`, lines[1])
+}
+
+func TestImportGophJSONErrors(t *testing.T) {
+	cl := testClient(t, newVaultStorage())
+
+	_, err := importGophJSON(cl, strings.NewReader(`{"format":"goph-json","version":1}`), "merge")
+	assert.ErrorContains(t, err, "unknown import policy")
+
+	_, err = importGophJSON(cl, strings.NewReader(`{"format":"keepass","version":1}`), ImportSkip)
+	assert.ErrorContains(t, err, "unknown import format")
+
+	_, err = importGophJSON(cl, strings.NewReader(`{"format":"goph-json","version":2}`), ImportSkip)
+	assert.ErrorContains(t, err, "unsupported goph-json version")
+
+	_, err = importGophJSON(cl, strings.NewReader(`[`), ImportSkip)
+	assert.Error(t, err)
+}
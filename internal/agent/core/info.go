@@ -0,0 +1,84 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/agent/client"
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+)
+
+// infoFile shows the attributes of the file with `-id`, or of the file
+// selected from the list. Only the metadata is requested, the server doesn't
+// decrypt and send the data.
+func infoFile(cl *client.Client, cfg *config.ConfigENV) error {
+	id := cfg.ID
+	if id == 0 {
+		rAllFile, err := cl.ReadAllFile(listOptions(cfg)...)
+		if err != nil {
+			return fmt.Errorf("failed get all file: %w", err)
+		}
+
+		// If there are no files, exit
+		if len(rAllFile.Units) == 0 {
+			fmt.Fprintln(output, "Not found files. Bye!")
+			return nil
+		}
+
+		printFiles(rAllFile.Units, cfg.Format)
+
+		i, err := selectReadFile()
+		if err != nil {
+			return fmt.Errorf("wrong id file: %w", err)
+		}
+		id = i
+	}
+
+	var meta *proto.ReadRecordMetaResponse
+	err := withReauth(cl, func() error {
+		var err error
+		meta, err = cl.GetMeta(int32(id))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed get file info: %w", err)
+	}
+
+	printMeta(result, meta)
+
+	return nil
+}
+
+// printMeta prints the attributes of a file one per line. The timestamps the
+// server doesn't know are shown as "-".
+func printMeta(w io.Writer, m *proto.ReadRecordMetaResponse) {
+	mime := m.MimeType
+	if mime == "" {
+		mime = "-"
+	}
+
+	fmt.Fprintf(w, "ID: %d \n", m.Id)
+	fmt.Fprintf(w, "Name: %s \n", m.Name)
+	fmt.Fprintf(w, "Type: %s \n", m.Type)
+	fmt.Fprintf(w, "Size: %d bytes \n", m.Size)
+	fmt.Fprintf(w, "MIME: %s \n", mime)
+	fmt.Fprintf(w, "Category: %s \n", m.Category)
+	if m.Folder != "" {
+		fmt.Fprintf(w, "Folder: %s \n", m.Folder)
+	}
+	fmt.Fprintf(w, "Version: %d \n", m.Version)
+	fmt.Fprintf(w, "Created: %s \n", formatUnix(m.CreatedAt))
+	fmt.Fprintf(w, "Last accessed: %s \n", formatUnix(m.LastAccessedAt))
+	fmt.Fprintf(w, "Tags: %s \n", formatTags(m.Meta))
+}
+
+// formatUnix formats the unix time in seconds, zero is unknown time.
+func formatUnix(sec int64) string {
+	if sec == 0 {
+		return "-"
+	}
+
+	return formatTime(time.Unix(sec, 0))
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/agent/client"
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// metaStorage answers only ReadRecordMeta, any other call fails as
+// unimplemented.
+type metaStorage struct {
+	proto.UnimplementedStorageServer
+	meta *proto.ReadRecordMetaResponse
+}
+
+func (s metaStorage) ReadRecordMeta(_ context.Context, in *proto.ReadRecordMetaRequest) (*proto.ReadRecordMetaResponse, error) {
+	if in.Id != s.meta.Id {
+		return &proto.ReadRecordMetaResponse{Error: "record not found"}, nil
+	}
+
+	return s.meta, nil
+}
+
+// testClient serves the storage on an in-memory listener and returns a
+// client connected to it.
+func testClient(t *testing.T, storage proto.StorageServer, opts ...grpc.ServerOption) *client.Client {
+	t.Helper()
+
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(opts...)
+	proto.RegisterStorageServer(server, storage)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return &client.Client{Conn: conn, Token: "token"}
+}
+
+func TestInfoFile(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	meta := &proto.ReadRecordMetaResponse{
+		Id:        7,
+		Name:      "passport.pdf",
+		Type:      "file",
+		Category:  "docs",
+		Version:   2,
+		Meta:      map[string]string{"scan": "", "owner": "bob"},
+		Size:      2048,
+		MimeType:  "application/pdf",
+		CreatedAt: created.Unix(),
+	}
+
+	var calls []string
+	cl := testClient(t, metaStorage{meta: meta}, grpc.ChainUnaryInterceptor(
+		func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			calls = append(calls, info.FullMethod)
+			return handler(ctx, req)
+		},
+	))
+
+	var out bytes.Buffer
+	output = io.Discard
+	result = &out
+
+	err := infoFile(cl, &config.ConfigENV{ID: 7})
+	require.NoError(t, err)
+
+	// The data is never requested
+	assert.Equal(t, []string{proto.Storage_ReadRecordMeta_FullMethodName}, calls)
+
+	info := out.String()
+	assert.Contains(t, info, "Name: passport.pdf \n")
+	assert.Contains(t, info, "Type: file \n")
+	assert.Contains(t, info, "Size: 2048 bytes \n")
+	assert.Contains(t, info, "MIME: application/pdf \n")
+	assert.Contains(t, info, "Category: docs \n")
+	assert.Contains(t, info, "Version: 2 \n")
+	assert.Contains(t, info, "Created: "+formatTime(created)+" \n")
+	assert.Contains(t, info, "Last accessed: - \n")
+	assert.Contains(t, info, "Tags: owner=bob, scan \n")
+
+	err = infoFile(cl, &config.ConfigENV{ID: 8})
+	assert.ErrorContains(t, err, "record not found")
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+)
+
+// printJSON shows a json record. With -jsonpath only the selected field is
+// shown, a string field is shown without quotes. With -pretty the JSON is indented.
+func printJSON(cfg *config.ConfigENV, data []byte) error {
+	if cfg.JSONPath != "" {
+		v, err := extractJSONPath(data, cfg.JSONPath)
+		if err != nil {
+			return err
+		}
+
+		if s, ok := v.(string); ok {
+			fmt.Fprintln(output, s)
+			return nil
+		}
+
+		data, err = json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed encode json: %w", err)
+		}
+	}
+
+	if cfg.Pretty {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, data, "", "  "); err != nil {
+			return fmt.Errorf("failed indent json: %w", err)
+		}
+
+		data = buf.Bytes()
+	}
+
+	fmt.Fprintln(output, string(data))
+
+	return nil
+}
+
+// extractJSONPath returns the value at the path in the JSON. The path is a
+// list of object keys and array indexes separated by dots, indexes can also
+// be written in brackets, e.g. "servers[0].url" or "$.servers.0.url".
+func extractJSONPath(data []byte, path string) (any, error) {
+	var v any
+
+	// Numbers are kept as they are written
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("failed decode json: %w", err)
+	}
+
+	for _, key := range splitJSONPath(path) {
+		switch node := v.(type) {
+		case map[string]any:
+			field, ok := node[key]
+			if !ok {
+				return nil, fmt.Errorf("field %s not found", key)
+			}
+
+			v = field
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("index %s out of range of array of %v elements", key, len(node))
+			}
+
+			v = node[i]
+		default:
+			return nil, fmt.Errorf("field %s not found, the value is not an object or array", key)
+		}
+	}
+
+	return v, nil
+}
+
+// splitJSONPath splits the path into object keys and array indexes.
+func splitJSONPath(path string) []string {
+	path = strings.TrimPrefix(path, "$")
+	path = strings.ReplaceAll(path, "[", ".")
+	path = strings.ReplaceAll(path, "]", "")
+
+	var keys []string
+	for _, key := range strings.Split(path, ".") {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
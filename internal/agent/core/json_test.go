@@ -0,0 +1,50 @@
+package core
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintJSON(t *testing.T) {
+	data := []byte(`{"name":"api","retries":3,"servers":[{"url":"https://a"},{"url":"https://b","weight":0.5}]}`)
+
+	tests := []struct {
+		name    string
+		pretty  bool
+		path    string
+		exp     string
+		wantErr bool
+	}{
+		{name: "As stored", exp: string(data) + "\n"},
+		{name: "Pretty", pretty: true, exp: "{\n  \"name\": \"api\",\n  \"retries\": 3,\n  \"servers\": ["},
+		{name: "String field without quotes", path: "servers[1].url", exp: "https://b\n"},
+		{name: "Dot index and root", path: "$.servers.0.url", exp: "https://a\n"},
+		{name: "Number field", path: "servers[1].weight", exp: "0.5\n"},
+		{name: "Object field", path: "servers[0]", exp: "{\"url\":\"https://a\"}\n"},
+		{name: "Pretty object field", path: "servers[0]", pretty: true, exp: "{\n  \"url\": \"https://a\"\n}\n"},
+		{name: "Missing field", path: "servers[0].port", wantErr: true},
+		{name: "Index out of range", path: "servers[2]", wantErr: true},
+		{name: "Field of a number", path: "retries.count", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			output = &out
+			defer func() { output = os.Stdout }()
+
+			err := printJSON(&config.ConfigENV{Pretty: tt.pretty, JSONPath: tt.path}, data)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(out.String(), tt.exp), out.String())
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Formats of the export command.
+const (
+	FormatKeePass    = "keepass"
+	FormatKeePassXML = "keepass-xml"
+)
+
+// keePassRootGroup is the name of the group holding the exported records.
+// The categories of the records become its subgroups.
+const keePassRootGroup = "goph-keeper"
+
+// keePassColumns are the columns of the CSV export in the order of KeePassXC.
+var keePassColumns = []string{"Group", "Title", "Username", "Password", "URL", "Notes"}
+
+// keePassUUIDLength is the length of the entry and group UUIDs in bytes.
+var keePassUUIDLength = 16
+
+// writeKeePassCSV writes the credentials as CSV in the layout of KeePassXC.
+// Every field is quoted, so the values may contain commas, quotes and new lines.
+func writeKeePassCSV(w io.Writer, records []credentialsRecord) error {
+	if err := writeCSVRows(w, [][]string{keePassColumns}); err != nil {
+		return err
+	}
+
+	return writeKeePassCSVRows(w, records)
+}
+
+// writeKeePassCSVRows writes the credentials as CSV rows without the header.
+func writeKeePassCSVRows(w io.Writer, records []credentialsRecord) error {
+	rows := make([][]string, 0, len(records))
+	for _, r := range records {
+		rows = append(rows, []string{keePassGroup(r.Category), r.Name, r.Login, r.Password, r.URL, r.Notes})
+	}
+
+	return writeCSVRows(w, rows)
+}
+
+// writeCSVRows writes the rows with every field quoted.
+func writeCSVRows(w io.Writer, rows [][]string) error {
+	for _, row := range rows {
+		quoted := make([]string, 0, len(row))
+		for _, v := range row {
+			quoted = append(quoted, `"`+strings.ReplaceAll(v, `"`, `""`)+`"`)
+		}
+
+		if _, err := fmt.Fprintf(w, "%s\r\n", strings.Join(quoted, ",")); err != nil {
+			return fmt.Errorf("failed write csv: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// keePassGroup returns the path of the group of a record with the category.
+func keePassGroup(category string) string {
+	if category == "" {
+		return keePassRootGroup
+	}
+
+	return keePassRootGroup + "/" + category
+}
+
+// keePassFile is the unencrypted XML database of KeePass 2.
+type keePassFile struct {
+	XMLName   xml.Name `xml:"KeePassFile"`
+	Generator string   `xml:"Meta>Generator"`
+	Root      struct {
+		Group keePassGroupXML `xml:"Group"`
+	} `xml:"Root"`
+}
+
+// keePassGroupXML is a group of entries, the groups can be nested.
+type keePassGroupXML struct {
+	UUID    string            `xml:"UUID"`
+	Name    string            `xml:"Name"`
+	Entries []keePassEntry    `xml:"Entry"`
+	Groups  []keePassGroupXML `xml:"Group"`
+}
+
+// keePassEntry is a record, its fields are stored as key-value strings.
+type keePassEntry struct {
+	UUID    string          `xml:"UUID"`
+	Strings []keePassString `xml:"String"`
+}
+
+// keePassString is a field of an entry.
+type keePassString struct {
+	Key   string       `xml:"Key"`
+	Value keePassValue `xml:"Value"`
+}
+
+// keePassValue is the value of a field, protected values are hidden by KeePass.
+type keePassValue struct {
+	Value   string `xml:",chardata"`
+	Protect string `xml:"ProtectInMemory,attr,omitempty"`
+}
+
+// writeKeePassXML writes the credentials as a KeePass 2 XML database.
+// The records without a category are put in the root group, the others
+// in a subgroup per category.
+func writeKeePassXML(w io.Writer, records []credentialsRecord) error {
+	root, err := newKeePassGroup(keePassRootGroup)
+	if err != nil {
+		return err
+	}
+
+	byCategory := make(map[string][]keePassEntry)
+	var categories []string
+
+	for _, r := range records {
+		entry, err := newKeePassEntry(r)
+		if err != nil {
+			return err
+		}
+
+		if r.Category == "" {
+			root.Entries = append(root.Entries, entry)
+			continue
+		}
+
+		if _, ok := byCategory[r.Category]; !ok {
+			categories = append(categories, r.Category)
+		}
+		byCategory[r.Category] = append(byCategory[r.Category], entry)
+	}
+
+	sort.Strings(categories)
+	for _, c := range categories {
+		group, err := newKeePassGroup(c)
+		if err != nil {
+			return err
+		}
+
+		group.Entries = byCategory[c]
+		root.Groups = append(root.Groups, group)
+	}
+
+	file := keePassFile{Generator: keePassRootGroup}
+	file.Root.Group = root
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("failed write xml: %w", err)
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(file); err != nil {
+		return fmt.Errorf("failed write xml: %w", err)
+	}
+
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return fmt.Errorf("failed write xml: %w", err)
+	}
+
+	return nil
+}
+
+// newKeePassGroup creates a group with a new UUID.
+func newKeePassGroup(name string) (keePassGroupXML, error) {
+	uuid, err := newKeePassUUID()
+	if err != nil {
+		return keePassGroupXML{}, err
+	}
+
+	return keePassGroupXML{UUID: uuid, Name: name}, nil
+}
+
+// newKeePassEntry creates an entry with a new UUID for the record.
+// The password is marked to be protected in memory like in KeePass itself.
+func newKeePassEntry(r credentialsRecord) (keePassEntry, error) {
+	uuid, err := newKeePassUUID()
+	if err != nil {
+		return keePassEntry{}, err
+	}
+
+	return keePassEntry{
+		UUID: uuid,
+		Strings: []keePassString{
+			{Key: "Title", Value: keePassValue{Value: r.Name}},
+			{Key: "UserName", Value: keePassValue{Value: r.Login}},
+			{Key: "Password", Value: keePassValue{Value: r.Password, Protect: "True"}},
+			{Key: "URL", Value: keePassValue{Value: r.URL}},
+			{Key: "Notes", Value: keePassValue{Value: r.Notes}},
+		},
+	}, nil
+}
+
+// newKeePassUUID returns a random UUID encoded in base64 as KeePass stores it.
+func newKeePassUUID() (string, error) {
+	b := make([]byte, keePassUUIDLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed generate uuid: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(b), nil
+}
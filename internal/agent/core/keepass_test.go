@@ -0,0 +1,67 @@
+package core
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var keePassRecords = []credentialsRecord{
+	{Name: "mail", Category: "work", credentials: credentials{Login: "alice", Password: `p"a,ss`, URL: "https://mail.example"}},
+	{Name: "bank", credentials: credentials{Login: "alice", Password: "secret", Notes: "line 1\nline 2"}},
+	{Name: "<wiki> & co", Category: "work", credentials: credentials{Login: "bob", Password: "</Value>"}},
+}
+
+func TestWriteKeePassCSV(t *testing.T) {
+	var b strings.Builder
+	assert.NoError(t, writeKeePassCSV(&b, keePassRecords))
+
+	rows, err := csv.NewReader(strings.NewReader(b.String())).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"Group", "Title", "Username", "Password", "URL", "Notes"},
+		{"goph-keeper/work", "mail", "alice", `p"a,ss`, "https://mail.example", ""},
+		{"goph-keeper", "bank", "alice", "secret", "", "line 1\nline 2"},
+		{"goph-keeper/work", "<wiki> & co", "bob", "</Value>", "", ""},
+	}, rows)
+}
+
+func TestWriteKeePassXML(t *testing.T) {
+	var b strings.Builder
+	assert.NoError(t, writeKeePassXML(&b, keePassRecords))
+
+	var file keePassFile
+	assert.NoError(t, xml.Unmarshal([]byte(b.String()), &file))
+
+	entry := func(e keePassEntry) map[string]string {
+		assert.NotEmpty(t, e.UUID)
+
+		fields := make(map[string]string)
+		for _, s := range e.Strings {
+			fields[s.Key] = s.Value.Value
+		}
+
+		return fields
+	}
+
+	root := file.Root.Group
+	assert.Equal(t, "goph-keeper", root.Name)
+	if assert.Len(t, root.Entries, 1) {
+		assert.Equal(t, map[string]string{
+			"Title": "bank", "UserName": "alice", "Password": "secret", "URL": "", "Notes": "line 1\nline 2",
+		}, entry(root.Entries[0]))
+	}
+
+	if assert.Len(t, root.Groups, 1) {
+		work := root.Groups[0]
+		assert.Equal(t, "work", work.Name)
+		if assert.Len(t, work.Entries, 2) {
+			assert.Equal(t, `p"a,ss`, entry(work.Entries[0])["Password"])
+			assert.Equal(t, "<wiki> & co", entry(work.Entries[1])["Title"])
+			assert.Equal(t, "</Value>", entry(work.Entries[1])["Password"])
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// defaultPasswordLength is the length of generated passwords.
+var defaultPasswordLength = 20
+
+// Character classes of generated passwords, each one is always present.
+var passwordClasses = []string{
+	"abcdefghijklmnopqrstuvwxyz",
+	"ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"0123456789",
+	"!@#$%^&*()-_=+[]{}<>?",
+}
+
+// generatePassword generates a random password of the given length with
+// lowercase and uppercase letters, digits and symbols.
+func generatePassword(length int) (string, error) {
+	if length < len(passwordClasses) {
+		return "", fmt.Errorf("password length should be at least %v", len(passwordClasses))
+	}
+
+	alphabet := strings.Join(passwordClasses, "")
+
+	for {
+		b := make([]byte, length)
+		for i := range b {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+			if err != nil {
+				return "", fmt.Errorf("failed generate password: %w", err)
+			}
+
+			b[i] = alphabet[n.Int64()]
+		}
+
+		// Draw again until every class is present, so the choice stays uniform
+		if hasAllClasses(string(b)) {
+			return string(b), nil
+		}
+	}
+}
+
+// hasAllClasses reports whether the password has a character of every class.
+func hasAllClasses(password string) bool {
+	for _, class := range passwordClasses {
+		if !strings.ContainsAny(password, class) {
+			return false
+		}
+	}
+
+	return true
+}
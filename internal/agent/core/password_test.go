@@ -0,0 +1,24 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeneratePassword(t *testing.T) {
+	seen := make(map[string]bool)
+
+	for i := 0; i < 100; i++ {
+		p, err := generatePassword(defaultPasswordLength)
+		assert.NoError(t, err)
+		assert.Len(t, p, defaultPasswordLength)
+		assert.True(t, hasAllClasses(p), p)
+		assert.False(t, seen[p])
+
+		seen[p] = true
+	}
+
+	_, err := generatePassword(3)
+	assert.Error(t, err)
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"unicode/utf8"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+)
+
+// previewLimit returns how many bytes to read for a preview of n characters.
+func previewLimit(n int) int32 {
+	if n > math.MaxInt32/utf8.UTFMax {
+		return math.MaxInt32
+	}
+
+	return int32(n * utf8.UTFMax)
+}
+
+// printPreview shows the first n characters of a record followed by an
+// ellipsis when the data is longer. For files only the size is shown.
+func printPreview(rFile *proto.ReadRecordResponse, n int) {
+	if rFile.Type == "file" {
+		fmt.Fprintf(output, "File %s, size: %v bytes \n", rFile.Name, rFile.Size)
+		return
+	}
+
+	fmt.Fprintln(output, preview(rFile.Data, n, rFile.Size))
+}
+
+// preview returns the first n characters of the data. The data may be cut in
+// the middle of a character, the cut character is dropped. The size is the
+// size of the whole data, which may be longer than the read data.
+func preview(data []byte, n int, size int64) string {
+	count := 0
+	end := 0
+	for end < len(data) && count < n {
+		r, w := utf8.DecodeRune(data[end:])
+		if r == utf8.RuneError && w == 1 && !utf8.FullRune(data[end:]) {
+			break
+		}
+
+		end += w
+		count++
+	}
+
+	if int64(end) < size {
+		return string(data[:end]) + ellipsis
+	}
+
+	return string(data[:end])
+}
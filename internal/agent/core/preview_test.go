@@ -0,0 +1,43 @@
+package core
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreview(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		n    int
+		// size is the size of the whole data, the data is the read beginning
+		size int
+		exp  string
+	}{
+		{name: "Short text is shown whole", data: "short", n: 10, size: 5, exp: "short"},
+		{name: "Exact length", data: "exact", n: 5, size: 5, exp: "exact"},
+		{name: "Long text is truncated", data: "long secret text", n: 4, size: 16, exp: "long..."},
+		{name: "Not transferred rest is marked", data: "abcd", n: 4, size: 100, exp: "abcd..."},
+		{name: "Characters are counted", data: "привет мир", n: 6, size: len("привет мир"), exp: "привет..."},
+		{name: "Character cut by the limit is dropped", data: "при"[:5], n: 3, size: 100, exp: "пр..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.exp, preview([]byte(tt.data), tt.n, int64(tt.size)))
+		})
+	}
+}
+
+func TestPrintPreviewFile(t *testing.T) {
+	var out strings.Builder
+	output = &out
+	defer func() { output = os.Stdout }()
+
+	printPreview(&proto.ReadRecordResponse{Name: "photo.png", Type: "file", Data: []byte("\x89PNG"), Size: 2048}, 4)
+	assert.Equal(t, "File photo.png, size: 2048 bytes \n", out.String())
+}
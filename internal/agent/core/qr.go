@@ -0,0 +1,124 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"rsc.io/qr"
+)
+
+// otpauthScheme is the scheme of the URIs authenticator apps set up the
+// one-time passwords from.
+const otpauthScheme = "otpauth://"
+
+// qrQuietZone is the width in modules of the light border around a QR code,
+// scanners need it to find the code.
+const qrQuietZone = 4
+
+// Characters of the QR codes. Light modules are drawn, so the code reads
+// dark on light in a terminal with a dark background.
+const (
+	qrBlockFull  = "█"
+	qrBlockUpper = "▀"
+	qrBlockLower = "▄"
+	qrASCIILight = "##"
+)
+
+// qrPayload returns the text of the record shown as a QR code. A text record
+// is encoded as is, e.g. an otpauth URI. A credentials record is encoded by
+// its otpauth URI if a field has one, by the password otherwise.
+func qrPayload(rec *proto.ReadRecordResponse) (string, error) {
+	switch rec.Type {
+	case "credentials":
+		c, err := parseCredentials(rec.Data)
+		if err != nil {
+			return "", err
+		}
+
+		for _, field := range []string{c.URL, c.Notes, c.Password} {
+			if strings.HasPrefix(field, otpauthScheme) {
+				return field, nil
+			}
+		}
+
+		return c.Password, nil
+	case "file":
+		return "", fmt.Errorf("files can't be shown as a QR code")
+	default:
+		return strings.TrimSpace(string(rec.Data)), nil
+	}
+}
+
+// qrModules encodes the text as a QR code and returns its modules with the
+// quiet zone, true is a dark module.
+func qrModules(text string) ([][]bool, error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return nil, fmt.Errorf("failed encode QR code: %w", err)
+	}
+
+	size := code.Size + 2*qrQuietZone
+	modules := make([][]bool, size)
+	for y := range modules {
+		modules[y] = make([]bool, size)
+		for x := range modules[y] {
+			modules[y][x] = code.Black(x-qrQuietZone, y-qrQuietZone)
+		}
+	}
+
+	return modules, nil
+}
+
+// renderQR writes the text as a QR code. The code is drawn with the UTF-8
+// half blocks, two rows of modules per line, or with ASCII for the terminals
+// without them, one row per line and two characters per module.
+func renderQR(w io.Writer, text string, ascii bool) error {
+	modules, err := qrModules(text)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+
+	if ascii {
+		for _, row := range modules {
+			for _, dark := range row {
+				if dark {
+					bw.WriteString("  ")
+				} else {
+					bw.WriteString(qrASCIILight)
+				}
+			}
+			bw.WriteString("\n")
+		}
+	} else {
+		for y := 0; y < len(modules); y += 2 {
+			for x := range modules[y] {
+				upper := !modules[y][x]
+				// The last line of an odd number of rows has no lower half
+				lower := y+1 < len(modules) && !modules[y+1][x]
+
+				switch {
+				case upper && lower:
+					bw.WriteString(qrBlockFull)
+				case upper:
+					bw.WriteString(qrBlockUpper)
+				case lower:
+					bw.WriteString(qrBlockLower)
+				default:
+					bw.WriteString(" ")
+				}
+			}
+			bw.WriteString("\n")
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed write QR code: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/stretchr/testify/assert"
+	"rsc.io/qr/coding"
+)
+
+// parseQR reads the modules of a QR code rendered by renderQR back,
+// true is a dark module.
+func parseQR(t *testing.T, text string, ascii bool) [][]bool {
+	t.Helper()
+
+	var modules [][]bool
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if ascii {
+			var row []bool
+			for i := 0; i+1 < len(line); i += 2 {
+				row = append(row, line[i:i+2] != qrASCIILight)
+			}
+			modules = append(modules, row)
+			continue
+		}
+
+		var upper, lower []bool
+		for _, r := range line {
+			switch string(r) {
+			case qrBlockFull:
+				upper, lower = append(upper, false), append(lower, false)
+			case qrBlockUpper:
+				upper, lower = append(upper, false), append(lower, true)
+			case qrBlockLower:
+				upper, lower = append(upper, true), append(lower, false)
+			default:
+				upper, lower = append(upper, true), append(lower, true)
+			}
+		}
+		modules = append(modules, upper, lower)
+	}
+
+	// The odd last row of the blocks was padded with a dark lower half
+	if !ascii && len(modules)%2 == 0 && len(modules) > len(modules[0]) {
+		modules = modules[:len(modules)-1]
+	}
+
+	return modules
+}
+
+// decodeQR decodes a QR code in byte mode. The level and the mask are found
+// by matching the fixed patterns of the code, then the data bits are read
+// at their positions in the plan of the code.
+func decodeQR(t *testing.T, modules [][]bool) string {
+	t.Helper()
+
+	// Strip the quiet zone
+	size := len(modules) - 2*qrQuietZone
+	grid := make([][]bool, size)
+	for y := range grid {
+		grid[y] = modules[y+qrQuietZone][qrQuietZone : qrQuietZone+size]
+	}
+
+	version := coding.Version((size - 17) / 4)
+	for level := coding.L; level <= coding.H; level++ {
+		for mask := coding.Mask(0); mask < 8; mask++ {
+			plan, err := coding.NewPlan(version, level, mask)
+			if !assert.NoError(t, err) {
+				return ""
+			}
+
+			if text, ok := readPlan(plan, grid); ok {
+				return text
+			}
+		}
+	}
+
+	t.Fatal("QR code does not match any plan")
+	return ""
+}
+
+// readPlan reads the data of the grid encoded by the plan. It fails if the
+// fixed patterns of the grid are not the ones of the plan.
+func readPlan(plan *coding.Plan, grid [][]bool) (string, bool) {
+	data := make([]byte, plan.DataBytes+plan.CheckBytes)
+	for y, row := range plan.Pixel {
+		for x, pix := range row {
+			dark := pix&coding.Black != 0
+
+			switch pix.Role() {
+			case coding.Data, coding.Check:
+				if grid[y][x] != dark {
+					o := pix.Offset()
+					data[o/8] |= 1 << (7 - o%8)
+				}
+			case coding.Extra:
+			default:
+				if grid[y][x] != dark {
+					return "", false
+				}
+			}
+		}
+	}
+
+	// Byte mode with the length of the small versions
+	if data[0]>>4 != 4 || plan.Version > 9 {
+		return "", false
+	}
+
+	n := int(data[0]&0x0f)<<4 | int(data[1]>>4)
+	text := make([]byte, n)
+	for i := range text {
+		text[i] = data[1+i]<<4 | data[2+i]>>4
+	}
+
+	return string(text), true
+}
+
+func TestRenderQR(t *testing.T) {
+	payloads := []string{
+		"otpauth://totp/GophKeeper:alice?secret=JBSWY3DPEHPK3PXP&issuer=GophKeeper",
+		"p@ssw0rd",
+	}
+
+	for _, payload := range payloads {
+		for _, ascii := range []bool{false, true} {
+			var buf bytes.Buffer
+			assert.NoError(t, renderQR(&buf, payload, ascii))
+
+			modules := parseQR(t, buf.String(), ascii)
+			assert.Equal(t, payload, decodeQR(t, modules))
+		}
+	}
+}
+
+func TestQRPayload(t *testing.T) {
+	uri := "otpauth://totp/Bank:alice?secret=JBSWY3DPEHPK3PXP"
+
+	tests := []struct {
+		name string
+		rec  *proto.ReadRecordResponse
+		exp  string
+		err  bool
+	}{
+		{name: "Text", rec: &proto.ReadRecordResponse{Type: "text", Data: []byte(uri + "\n")}, exp: uri},
+		{name: "Credentials with otpauth", rec: &proto.ReadRecordResponse{Type: "credentials",
+			Data: []byte(`{"login":"alice","password":"secret","notes":"` + uri + `"}`)}, exp: uri},
+		{name: "Credentials", rec: &proto.ReadRecordResponse{Type: "credentials",
+			Data: []byte(`{"login":"alice","password":"secret"}`)}, exp: "secret"},
+		{name: "File", rec: &proto.ReadRecordResponse{Type: "file", Data: []byte{0xff}}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := qrPayload(tt.rec)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.exp, payload)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+)
+
+// rekeySuffix is the extension of a stashed record encrypted under the new
+// passphrase until it replaces the old file. Sync doesn't pick such files up.
+const rekeySuffix = ".rekey"
+
+// errRekeyIncomplete is returned when only some of the stashed records were
+// replaced, the others keep the old passphrase.
+var errRekeyIncomplete = errors.New("not all stashed records were re-encrypted")
+
+// rekeyStash asks for the current and a new passphrase of the stash and
+// encrypts all stashed records under the new one. The operation is confirmed
+// unless -yes is set, a stashed record can't be read without its passphrase.
+func rekeyStash(cfg *config.ConfigENV) (int, error) {
+	reader := bufio.NewReader(input)
+
+	fmt.Fprintln(output, "All stashed files are re-encrypted under a new passphrase.")
+	fmt.Fprintln(output, "A stashed file can't be read without its passphrase, keep the current one until sync.")
+
+	if !cfg.AssumeYes {
+		fmt.Fprint(output, "Continue? [y/N]: ")
+
+		r, err := reader.ReadString('\n')
+		if err != nil {
+			return 0, fmt.Errorf(errorFailedReadSTDIN, err)
+		}
+
+		if strings.ToLower(strings.TrimSpace(r)) != "y" {
+			return 0, fmt.Errorf("rekey canceled")
+		}
+	}
+
+	fmt.Fprintln(output, "Current passphrase")
+	oldPassphrase, err := readPassphrase(reader, false)
+	if err != nil {
+		return 0, err
+	}
+
+	fmt.Fprintln(output, "New passphrase")
+	newPassphrase, err := readPassphrase(reader, true)
+	if err != nil {
+		return 0, err
+	}
+
+	return rekeySpool(spoolDir(cfg), oldPassphrase, newPassphrase)
+}
+
+// rekeySpool encrypts the stashed records of the directory under the new
+// passphrase. All records are decrypted and encrypted again in files next to
+// them first, so a wrong passphrase or a failed write leaves the stash as it
+// was. Only then the new files replace the old ones. It returns the number of
+// the replaced records.
+func rekeySpool(dir string, oldPassphrase string, newPassphrase string) (int, error) {
+	paths, err := spoolFiles(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var rekeyed []string
+	clean := func() {
+		for _, path := range rekeyed {
+			os.Remove(path + rekeySuffix)
+		}
+	}
+
+	for _, path := range paths {
+		rec, err := readStash(path, oldPassphrase)
+		if err != nil {
+			clean()
+			return 0, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+
+		data, err := sealStash(newPassphrase, rec)
+		if err == nil {
+			err = os.WriteFile(path+rekeySuffix, data, defaultPermition)
+		}
+		if err != nil {
+			clean()
+			return 0, fmt.Errorf("%s: failed write stashed record: %w", filepath.Base(path), err)
+		}
+
+		rekeyed = append(rekeyed, path)
+	}
+
+	for i, path := range rekeyed {
+		if err := os.Rename(path+rekeySuffix, path); err != nil {
+			return i, fmt.Errorf("%w, %v of %v keep the old passphrase and their new files end with %s: %w",
+				errRekeyIncomplete, len(paths)-i, len(paths), rekeySuffix, err)
+		}
+	}
+
+	return len(rekeyed), nil
+}
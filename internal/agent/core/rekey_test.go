@@ -0,0 +1,74 @@
+package core
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRekeySpool(t *testing.T) {
+	output = io.Discard
+	dir := t.TempDir()
+
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, name := range []string{"first", "second"} {
+		_, err := stashRecord(dir, "old", stashedRecord{
+			Type:           "text",
+			Name:           name,
+			Data:           []byte(name + " secret"),
+			IdempotencyKey: strings.Repeat(name[:1], 16),
+			Created:        created.Add(time.Duration(i) * time.Second),
+		})
+		require.NoError(t, err)
+	}
+
+	paths, err := spoolFiles(dir)
+	require.NoError(t, err)
+	before, err := os.ReadFile(paths[0])
+	require.NoError(t, err)
+
+	// A wrong passphrase changes nothing
+	_, err = rekeySpool(dir, "wrong", "new")
+	assert.ErrorIs(t, err, errSpoolPassphrase)
+
+	after, err := os.ReadFile(paths[0])
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	// The records are readable with the new passphrase only
+	cfg := &config.ConfigENV{SpoolDir: dir, AssumeYes: true}
+	input = strings.NewReader("old\nnew\nnew\n")
+	rekeyed, err := rekeyStash(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, 2, rekeyed)
+
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	for i, name := range []string{"first", "second"} {
+		_, err := readStash(paths[i], "old")
+		assert.ErrorIs(t, err, errSpoolPassphrase)
+
+		rec, err := readStash(paths[i], "new")
+		require.NoError(t, err)
+		assert.Equal(t, name, rec.Name)
+		assert.Equal(t, []byte(name+" secret"), rec.Data)
+		assert.Equal(t, strings.Repeat(name[:1], 16), rec.IdempotencyKey)
+	}
+
+	// The rekey is confirmed without -yes
+	input = strings.NewReader("n\n")
+	_, err = rekeyStash(&config.ConfigENV{SpoolDir: dir})
+	assert.Error(t, err)
+}
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Renal37/goph-keeper/internal/agent/client"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+)
+
+// sharesOut shows the files the user shared with the teams and who can read
+// them, then revokes the sharing of the file selected from the list.
+func sharesOut(cl *client.Client) error {
+	r, err := cl.ReadShares(false)
+	if err != nil {
+		return fmt.Errorf("failed get shares: %w", err)
+	}
+
+	if len(r.Shares) == 0 {
+		fmt.Fprintln(output, "You don't share files. Bye!")
+		return nil
+	}
+
+	printShares(output, r.Shares, false)
+
+	id, err := selectRevokeShare(r.Shares)
+	if err != nil {
+		return err
+	}
+
+	// Nothing selected, all files stay shared
+	if id == 0 {
+		return nil
+	}
+
+	if _, err := cl.RevokeShare(id); err != nil {
+		return fmt.Errorf("failed revoke share: %w", err)
+	}
+
+	fmt.Fprintf(output, "File %v is not shared anymore! \n", id)
+
+	return nil
+}
+
+// sharesIn shows the files other users shared with the teams of the user.
+func sharesIn(cl *client.Client) error {
+	r, err := cl.ReadShares(true)
+	if err != nil {
+		return fmt.Errorf("failed get shares: %w", err)
+	}
+
+	if len(r.Shares) == 0 {
+		fmt.Fprintln(output, "No files are shared with you. Bye!")
+		return nil
+	}
+
+	printShares(output, r.Shares, true)
+
+	return nil
+}
+
+// printShares writes the number of the shared files and a table of them. The
+// last column is the owner of a file shared with the user, the other members
+// of the team for a file the user shared.
+func printShares(w io.Writer, shares []*proto.ShareUnit, incoming bool) {
+	fmt.Fprintf(w, "Shared files: %v\n", len(shares))
+
+	with := "SHARED WITH"
+	if incoming {
+		with = "OWNER"
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID\tNAME\tTYPE\tTEAM\t%s\n", with)
+	for _, v := range shares {
+		team := v.TeamName
+		if team == "" {
+			team = strconv.Itoa(int(v.Team))
+		}
+
+		fmt.Fprintf(tw, "%v\t%s\t%s\t%s\t%s\n",
+			v.Id, truncate(v.Name, maxTableNameLength), v.Type, team, strings.Join(v.Logins, ", "))
+	}
+
+	// The writer only fails if the output fails, the same as fmt.Fprint above
+	_ = tw.Flush()
+}
+
+// selectRevokeShare reads the ID of the shared file to revoke the sharing of.
+// An empty answer keeps all files shared and returns zero.
+func selectRevokeShare(shares []*proto.ShareUnit) (int32, error) {
+	fmt.Fprint(output, "Enter ID file to stop sharing (empty to keep all): ")
+
+	reader := bufio.NewReader(input)
+
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return 0, fmt.Errorf(errorFailedReadSTDIN, err)
+	}
+
+	response = strings.TrimSpace(response)
+	if response == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.Atoi(response)
+	if err != nil {
+		return 0, fmt.Errorf("failed parse int: %w", err)
+	}
+
+	for _, v := range shares {
+		if int(v.Id) == id {
+			return v.Id, nil
+		}
+	}
+
+	return 0, fmt.Errorf("file %v is not in the list of shared files", id)
+}
@@ -0,0 +1,66 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintShares(t *testing.T) {
+	shares := []*proto.ShareUnit{
+		{Id: 3, Name: "mail", Type: "credentials", Team: 1, TeamName: "ops", Logins: []string{"bob", "eve"}},
+		{Id: 7, Name: "deploy key", Type: "file", Team: 2},
+	}
+
+	var out bytes.Buffer
+	printShares(&out, shares, false)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 4)
+	assert.Equal(t, "Shared files: 2", lines[0])
+	assert.Contains(t, lines[1], "SHARED WITH")
+	assert.Regexp(t, `^3\s+mail\s+credentials\s+ops\s+bob, eve$`, lines[2])
+	// A team without a name is shown by its ID
+	assert.Regexp(t, `^7\s+deploy key\s+file\s+2\s*$`, lines[3])
+
+	out.Reset()
+	printShares(&out, shares[:1], true)
+	assert.Contains(t, out.String(), "OWNER")
+}
+
+func TestSelectRevokeShare(t *testing.T) {
+	output = io.Discard
+
+	shares := []*proto.ShareUnit{{Id: 3}, {Id: 7}}
+
+	tests := []struct {
+		name    string
+		answer  string
+		exp     int32
+		wantErr bool
+	}{
+		{name: "Shared file", answer: " 7 \n", exp: 7},
+		{name: "Empty answer keeps the shares", answer: "\n"},
+		{name: "File not in the list", answer: "5\n", wantErr: true},
+		{name: "Not a number", answer: "mail\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input = strings.NewReader(tt.answer)
+
+			id, err := selectRevokeShare(shares)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.exp, id)
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package core
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/agent/client"
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+	"golang.org/x/crypto/argon2"
+)
+
+// defaultSpoolDir is the directory of the stashed records when the settings
+// don't have one.
+const defaultSpoolDir = "spool"
+
+// spoolSuffix is the extension of the files of the stashed records.
+const spoolSuffix = ".stash"
+
+// Parameters of the argon2id derivation of the key of a stashed record from
+// the passphrase.
+var (
+	spoolKeySize      uint32 = 32
+	spoolSaltSize            = 16
+	spoolArgonTime    uint32 = 1
+	spoolArgonMemory  uint32 = 64 * 1024
+	spoolArgonThreads uint8  = 4
+)
+
+// Attempts of the upload of a stashed record by one sync and the delay
+// before the first retry, it doubles with every next retry.
+var (
+	spoolSyncAttempts = 3
+	spoolSyncBackoff  = time.Second
+)
+
+// errSpoolPassphrase is returned when a stashed record can't be decrypted
+// with the entered passphrase.
+var errSpoolPassphrase = errors.New("wrong passphrase of the stashed record")
+
+// errSyncIncomplete is returned when some stashed records were not uploaded,
+// they stay in the spool for the next sync.
+var errSyncIncomplete = errors.New("not all stashed records were uploaded")
+
+// stashedRecord is a record written while offline. The idempotency key is
+// chosen when the record is stashed, so a record uploaded by an interrupted
+// sync is not duplicated by the next one.
+type stashedRecord struct {
+	Type           string    `json:"type"`
+	Name           string    `json:"name"`
+	Category       string    `json:"category"`
+	Data           []byte    `json:"data"`
+	IdempotencyKey string    `json:"idempotency_key"`
+	Created        time.Time `json:"created"`
+}
+
+// spoolFile is the content of a file in the spool: the stashed record
+// encrypted by AES-GCM under a key derived from the passphrase.
+type spoolFile struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+// spoolDir returns the directory of the stashed records.
+func spoolDir(cfg *config.ConfigENV) string {
+	if cfg.SpoolDir == "" {
+		return defaultSpoolDir
+	}
+
+	return cfg.SpoolDir
+}
+
+// stashData asks for a new record and its passphrase and stashes it in the
+// spool. The file of a file record is read now, so it can change or go away
+// before the sync.
+func stashData(cfg *config.ConfigENV) (string, error) {
+	reader := bufio.NewReader(input)
+
+	d, err := readWriteData(reader, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	data := []byte(d.data)
+	if d.typ == "file" {
+		data, err = os.ReadFile(d.data)
+		if err != nil {
+			return "", fmt.Errorf("failed read file: %w", err)
+		}
+	}
+
+	passphrase, err := readPassphrase(reader, true)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := newSpoolKey()
+	if err != nil {
+		return "", err
+	}
+
+	return stashRecord(spoolDir(cfg), passphrase, stashedRecord{
+		Type:           d.typ,
+		Name:           d.name,
+		Category:       d.category,
+		Data:           data,
+		IdempotencyKey: key,
+		Created:        time.Now().UTC(),
+	})
+}
+
+// readPassphrase asks for the passphrase of the spool, a new passphrase is
+// entered twice.
+func readPassphrase(reader *bufio.Reader, confirm bool) (string, error) {
+	fmt.Fprint(output, "Enter passphrase of the stash: ")
+
+	passphrase, err := reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf(errorFailedReadSTDIN, err)
+	}
+
+	passphrase = strings.TrimSpace(passphrase)
+	if passphrase == "" {
+		return "", errors.New("passphrase of the stash is empty")
+	}
+
+	if confirm {
+		fmt.Fprint(output, "Repeat passphrase: ")
+
+		repeated, err := reader.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf(errorFailedReadSTDIN, err)
+		}
+
+		if strings.TrimSpace(repeated) != passphrase {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+
+	return passphrase, nil
+}
+
+// stashRecord encrypts the record under the passphrase and saves it in the
+// spool directory. It returns the path of the saved file.
+func stashRecord(dir string, passphrase string, rec stashedRecord) (string, error) {
+	if err := os.MkdirAll(dir, defaultDirPermition); err != nil {
+		return "", fmt.Errorf("failed create spool directory: %w", err)
+	}
+
+	data, err := sealStash(passphrase, rec)
+	if err != nil {
+		return "", err
+	}
+
+	// The files are named by the time, so the records are synced in the
+	// order they were stashed
+	name := rec.Created.Format("20060102T150405.000000000") + "-" + rec.IdempotencyKey[:8] + spoolSuffix
+	path := filepath.Join(dir, name)
+
+	// A half written file is never picked up by sync
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, defaultPermition); err != nil {
+		return "", fmt.Errorf("failed write stashed record: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return "", fmt.Errorf("failed write stashed record: %w", err)
+	}
+
+	return path, nil
+}
+
+// sealStash encrypts the record under the passphrase with a new salt and
+// returns the content of its file.
+func sealStash(passphrase string, rec stashedRecord) ([]byte, error) {
+	plain, err := json.Marshal(rec)
+	if err != nil {
+		return nil, fmt.Errorf("failed encode stashed record: %w", err)
+	}
+
+	salt := make([]byte, spoolSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed generate salt: %w", err)
+	}
+
+	aead, err := spoolCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed generate nonce: %w", err)
+	}
+
+	data, err := json.Marshal(spoolFile{Salt: salt, Nonce: nonce, Data: aead.Seal(nil, nonce, plain, nil)})
+	if err != nil {
+		return nil, fmt.Errorf("failed encode stashed record: %w", err)
+	}
+
+	return data, nil
+}
+
+// readStash decrypts the stashed record of the file.
+func readStash(path string, passphrase string) (stashedRecord, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return stashedRecord{}, fmt.Errorf("failed read stashed record: %w", err)
+	}
+
+	var f spoolFile
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return stashedRecord{}, fmt.Errorf("failed decode stashed record: %w", err)
+	}
+
+	aead, err := spoolCipher(passphrase, f.Salt)
+	if err != nil {
+		return stashedRecord{}, err
+	}
+
+	if len(f.Nonce) != aead.NonceSize() {
+		return stashedRecord{}, fmt.Errorf("failed decode stashed record: nonce has %v bytes", len(f.Nonce))
+	}
+
+	plain, err := aead.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return stashedRecord{}, errSpoolPassphrase
+	}
+
+	var rec stashedRecord
+	if err := json.Unmarshal(plain, &rec); err != nil {
+		return stashedRecord{}, fmt.Errorf("failed decode stashed record: %w", err)
+	}
+
+	return rec, nil
+}
+
+// spoolCipher returns AES-GCM with the key derived from the passphrase.
+func spoolCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key := argon2.IDKey([]byte(passphrase), salt, spoolArgonTime, spoolArgonMemory, spoolArgonThreads, spoolKeySize)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed create cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed create cipher: %w", err)
+	}
+
+	return aead, nil
+}
+
+// spoolFiles returns the stashed records in the order they were stashed.
+// A missing spool directory has no records.
+func spoolFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed read spool directory: %w", err)
+	}
+
+	var paths []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasSuffix(e.Name(), spoolSuffix) {
+			paths = append(paths, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// syncSpool uploads the stashed records one by one and removes the uploaded
+// ones from the spool. A failed upload is retried a few times, then the sync
+// goes on with the next record; the records not uploaded stay in the spool,
+// so the next sync retries them. It returns the number of uploaded records.
+func syncSpool(dir string, passphrase string, upload func(stashedRecord) error) (int, error) {
+	paths, err := spoolFiles(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var errs []error
+	synced := 0
+	for _, path := range paths {
+		rec, err := readStash(path, passphrase)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", filepath.Base(path), err))
+			continue
+		}
+
+		backoff := spoolSyncBackoff
+		for attempt := 1; ; attempt++ {
+			err = upload(rec)
+			if err == nil || attempt >= spoolSyncAttempts {
+				break
+			}
+
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", filepath.Base(path), err))
+			continue
+		}
+
+		if err := os.Remove(path); err != nil {
+			errs = append(errs, fmt.Errorf("failed remove stashed record: %w", err))
+			continue
+		}
+
+		synced++
+	}
+
+	if len(errs) > 0 {
+		return synced, fmt.Errorf("%w, %v of %v remain in %s: %w",
+			errSyncIncomplete, len(paths)-synced, len(paths), dir, errors.Join(errs...))
+	}
+
+	return synced, nil
+}
+
+// uploadStashed writes the stashed record to the server. The data of a file
+// record is written to a temporary file, as files are sent from disk.
+func uploadStashed(cl *client.Client, rec stashedRecord) error {
+	opts := []client.WriteOption{client.WithCategory(rec.Category), client.WithIdempotencyKey(rec.IdempotencyKey)}
+
+	data := string(rec.Data)
+	if rec.Type == "file" {
+		tmp, err := os.CreateTemp("", "goph-keeper-stash-*")
+		if err != nil {
+			return fmt.Errorf("failed create temporary file: %w", err)
+		}
+		defer os.Remove(tmp.Name())
+
+		_, err = tmp.Write(rec.Data)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed write temporary file: %w", err)
+		}
+
+		data = tmp.Name()
+	}
+
+	if _, err := cl.WriteFile(rec.Type, rec.Name, data, opts...); err != nil {
+		return fmt.Errorf("write file has error: %w", err)
+	}
+
+	return nil
+}
+
+// newSpoolKey returns a random idempotency key of a stashed record.
+func newSpoolKey() (string, error) {
+	//nolint:gomnd // This legal number
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed generate byte: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStashData(t *testing.T) {
+	output = io.Discard
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "photo.jpg")
+	assert.NoError(t, os.WriteFile(file, []byte{0xff, 0xd8, 0x00}, defaultPermition))
+
+	spool := filepath.Join(dir, "spool")
+	cfg := &config.ConfigENV{SpoolDir: spool}
+
+	// A text record and a file record
+	input = strings.NewReader("1\n1\nnote\nwork\nhello\nsecret\nsecret\n")
+	_, err := stashData(cfg)
+	assert.NoError(t, err)
+
+	input = strings.NewReader("2\n" + file + "\n\nsecret\nsecret\n")
+	_, err = stashData(cfg)
+	assert.NoError(t, err)
+
+	// The passphrase must be repeated
+	input = strings.NewReader("1\n1\nnote\n\nhello\nsecret\nother\n")
+	_, err = stashData(cfg)
+	assert.Error(t, err)
+
+	paths, err := spoolFiles(spool)
+	if !assert.NoError(t, err) || !assert.Len(t, paths, 2) {
+		return
+	}
+
+	// The data is not stored in plaintext
+	raw, err := os.ReadFile(paths[0])
+	assert.NoError(t, err)
+	assert.NotContains(t, string(raw), "hello")
+
+	rec, err := readStash(paths[0], "secret")
+	assert.NoError(t, err)
+	assert.Equal(t, "text", rec.Type)
+	assert.Equal(t, "note", rec.Name)
+	assert.Equal(t, "work", rec.Category)
+	assert.Equal(t, []byte("hello"), rec.Data)
+	assert.NotEmpty(t, rec.IdempotencyKey)
+
+	rec, err = readStash(paths[1], "secret")
+	assert.NoError(t, err)
+	assert.Equal(t, "file", rec.Type)
+	assert.Equal(t, "photo.jpg", rec.Name)
+	assert.Equal(t, []byte{0xff, 0xd8, 0x00}, rec.Data)
+
+	_, err = readStash(paths[0], "wrong")
+	assert.ErrorIs(t, err, errSpoolPassphrase)
+}
+
+func TestSyncSpool(t *testing.T) {
+	spoolSyncBackoff = time.Millisecond
+	dir := t.TempDir()
+
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, name := range []string{"first", "second", "third"} {
+		_, err := stashRecord(dir, "secret", stashedRecord{
+			Type:           "text",
+			Name:           name,
+			Data:           []byte(name),
+			IdempotencyKey: strings.Repeat(name[:1], 16),
+			Created:        created.Add(time.Duration(i) * time.Second),
+		})
+		assert.NoError(t, err)
+	}
+
+	// The second record can't be uploaded, even after the retries
+	var uploaded []string
+	attempts := 0
+	upload := func(rec stashedRecord) error {
+		if rec.Name == "second" {
+			attempts++
+			return errors.New("connection refused")
+		}
+
+		uploaded = append(uploaded, rec.Name)
+		return nil
+	}
+
+	synced, err := syncSpool(dir, "secret", upload)
+	assert.ErrorIs(t, err, errSyncIncomplete)
+	assert.Equal(t, 2, synced)
+	assert.Equal(t, []string{"first", "third"}, uploaded)
+	assert.Equal(t, spoolSyncAttempts, attempts)
+
+	paths, err := spoolFiles(dir)
+	assert.NoError(t, err)
+	assert.Len(t, paths, 1)
+
+	// The next sync uploads the remaining record and clears the spool
+	uploaded = nil
+	synced, err = syncSpool(dir, "secret", func(rec stashedRecord) error {
+		uploaded = append(uploaded, rec.Name)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, synced)
+	assert.Equal(t, []string{"second"}, uploaded)
+
+	paths, err = spoolFiles(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, paths)
+
+	// A wrong passphrase keeps the records
+	_, err = stashRecord(dir, "secret", stashedRecord{Type: "text", Name: "kept", IdempotencyKey: strings.Repeat("k", 16), Created: created})
+	assert.NoError(t, err)
+
+	synced, err = syncSpool(dir, "wrong", upload)
+	assert.ErrorIs(t, err, errSpoolPassphrase)
+	assert.Zero(t, synced)
+
+	paths, err = spoolFiles(dir)
+	assert.NoError(t, err)
+	assert.Len(t, paths, 1)
+
+	// A missing spool has nothing to sync
+	synced, err = syncSpool(filepath.Join(dir, "missing"), "secret", upload)
+	assert.NoError(t, err)
+	assert.Zero(t, synced)
+}
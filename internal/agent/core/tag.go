@@ -0,0 +1,73 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/Renal37/goph-keeper/internal/agent/client"
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+)
+
+// tagFiles sets the tags and the category of all files matching the filter
+// of -category, -type and -name at once. The matching files are shown and
+// the change is confirmed unless -yes is set.
+func tagFiles(cl *client.Client, cfg *config.ConfigENV) error {
+	if cfg.Category == "" && cfg.Type == "" && cfg.Name == "" {
+		return fmt.Errorf("select the files with -category, -type or -name")
+	}
+
+	rAllFile, err := cl.ReadAllFile(listOptions(cfg)...)
+	if err != nil {
+		return fmt.Errorf("failed get all file: %w", err)
+	}
+
+	if len(rAllFile.Units) == 0 {
+		fmt.Fprintln(output, "Not found files. Bye!")
+		return nil
+	}
+
+	printFiles(rAllFile.Units, cfg.Format)
+
+	reader := bufio.NewReader(input)
+
+	fmt.Fprint(output, "Enter tags to set (key=value, comma separated): ")
+	setResp, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf(errorFailedReadSTDIN, err)
+	}
+
+	fmt.Fprint(output, "Enter category to set (optional): ")
+	category, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf(errorFailedReadSTDIN, err)
+	}
+
+	set, category := parseTags(setResp), strings.TrimSpace(category)
+	if len(set) == 0 && category == "" {
+		return fmt.Errorf("no tags or category to set")
+	}
+
+	if !cfg.AssumeYes {
+		fmt.Fprintf(output, "Change %v files? [y/N]: ", len(rAllFile.Units))
+
+		r, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf(errorFailedReadSTDIN, err)
+		}
+
+		if strings.ToLower(strings.TrimSpace(r)) != "y" {
+			return fmt.Errorf("tagging canceled")
+		}
+	}
+
+	updated, err := cl.TagFiles(set, category, listOptions(cfg)...)
+	if err != nil {
+		return fmt.Errorf("failed tag files: %w", err)
+	}
+
+	// The files of the teams owned by other users are not changed
+	fmt.Fprintf(output, "Updated %v files \n", updated)
+
+	return nil
+}
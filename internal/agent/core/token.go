@@ -0,0 +1,101 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/agent/client"
+	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
+	"github.com/joho/godotenv"
+)
+
+// tokenExpiryWarning is how long before the expiry of the token the user is warned.
+var tokenExpiryWarning = 5 * time.Minute
+
+// tokenRefreshBefore is how long before the expiry the token is refreshed
+// with -auto-refresh.
+var tokenRefreshBefore = 5 * time.Minute
+
+// tokenEnvFile is the file the token is saved in by sign-in.
+var tokenEnvFile = ".env"
+
+// AutoRefresh returns the option of the client refreshing the token shortly
+// before it expires. The refreshed token replaces the token saved by sign-in.
+func AutoRefresh() client.Option {
+	return client.WithAutoRefresh(tokenRefreshBefore, saveRefreshedToken)
+}
+
+// RefreshOnUnauthenticated returns the option of the client refreshing the
+// token once when the server rejects a call as unauthenticated and retrying
+// the call. The refreshed token replaces the token saved by sign-in.
+func RefreshOnUnauthenticated() client.Option {
+	return client.WithRefreshOnUnauthenticated(saveRefreshedToken)
+}
+
+// saveRefreshedToken replaces the token in the .env file, the other variables
+// are kept. A token that was not saved by sign-in is not saved either, it is
+// used only by the running agent.
+func saveRefreshedToken(token string) {
+	env, err := godotenv.Read(tokenEnvFile)
+	if err != nil {
+		fmt.Fprintf(output, "Failed save refreshed token: %s \n", err)
+		return
+	}
+
+	if _, ok := env["JWT"]; !ok {
+		return
+	}
+	env["JWT"] = token
+
+	content, err := godotenv.Marshal(env)
+	if err == nil {
+		err = os.WriteFile(tokenEnvFile, []byte(content+"\n"), defaultPermition)
+	}
+	if err != nil {
+		fmt.Fprintf(output, "Failed save refreshed token: %s \n", err)
+	}
+}
+
+// printTokenInfo shows the login, scope, issue and expiry time of the token
+// and warns when the token has expired or is about to expire.
+func printTokenInfo(claims *middleware.JWTclaims, now time.Time) {
+	fmt.Fprintf(output, "Login: %s \n", claims.Login)
+
+	scope := claims.Scope
+	if scope == "" {
+		scope = middleware.ScopeFull
+	}
+	fmt.Fprintf(output, "Scope: %s \n", scope)
+
+	// Tokens issued before the issue time was added have the time of the login
+	switch {
+	case claims.IssuedAt != nil:
+		fmt.Fprintf(output, "Issued at: %s \n", formatTime(claims.IssuedAt.Time))
+	case claims.AuthTime != 0:
+		fmt.Fprintf(output, "Issued at: %s \n", formatTime(time.Unix(claims.AuthTime, 0)))
+	}
+
+	if claims.ExpiresAt == nil {
+		fmt.Fprintln(output, "Expires at: never")
+		return
+	}
+
+	expiresAt := claims.ExpiresAt.Time
+	fmt.Fprintf(output, "Expires at: %s \n", formatTime(expiresAt))
+
+	left := expiresAt.Sub(now)
+	switch {
+	case left <= 0:
+		fmt.Fprintf(output, "Warning: the token expired %s ago, sign in again! \n", -left.Round(time.Second))
+	case left <= tokenExpiryWarning:
+		fmt.Fprintf(output, "Warning: the token expires in %s, sign in again soon! \n", left.Round(time.Second))
+	default:
+		fmt.Fprintf(output, "Expires in: %s \n", left.Round(time.Second))
+	}
+}
+
+// formatTime formats the time in the local time zone.
+func formatTime(t time.Time) string {
+	return t.Local().Format(time.DateTime)
+}
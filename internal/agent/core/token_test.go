@@ -0,0 +1,86 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintTokenInfo(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		exp       string
+	}{
+		{name: "Valid token", expiresAt: now.Add(30 * time.Minute), exp: "Expires in: 30m0s"},
+		{name: "Token close to expiry", expiresAt: now.Add(2 * time.Minute), exp: "Warning: the token expires in 2m0s"},
+		{name: "Expired token", expiresAt: now.Add(-time.Minute), exp: "Warning: the token expired 1m0s ago"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			output = &out
+			defer func() { output = os.Stdout }()
+
+			claims := &middleware.JWTclaims{
+				Login: "user",
+				Scope: middleware.ScopeRead,
+				RegisteredClaims: jwt.RegisteredClaims{
+					IssuedAt:  jwt.NewNumericDate(now.Add(-time.Hour)),
+					ExpiresAt: jwt.NewNumericDate(tt.expiresAt),
+				},
+			}
+
+			printTokenInfo(claims, now)
+			assert.Contains(t, out.String(), "Login: user")
+			assert.Contains(t, out.String(), "Scope: read")
+			assert.Contains(t, out.String(), "Issued at: "+formatTime(now.Add(-time.Hour)))
+			assert.Contains(t, out.String(), "Expires at: "+formatTime(tt.expiresAt))
+			assert.Contains(t, out.String(), tt.exp)
+		})
+	}
+}
+
+func TestSaveRefreshedToken(t *testing.T) {
+	var out strings.Builder
+	output = &out
+
+	defer func(path string) { tokenEnvFile = path }(tokenEnvFile)
+	tokenEnvFile = filepath.Join(t.TempDir(), ".env")
+
+	// A token that was not saved by sign-in stays in memory
+	require.NoError(t, os.WriteFile(tokenEnvFile, []byte("SERVER_ADDR=localhost:8080\n"), 0o600))
+	saveRefreshedToken("new")
+
+	env, err := godotenv.Read(tokenEnvFile)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"SERVER_ADDR": "localhost:8080"}, env)
+
+	// The saved token is replaced, the other variables are kept
+	require.NoError(t, os.WriteFile(tokenEnvFile, []byte("JWT=old\nSERVER_ADDR=localhost:8080\n"), 0o600))
+	saveRefreshedToken("new")
+
+	env, err = godotenv.Read(tokenEnvFile)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"JWT": "new", "SERVER_ADDR": "localhost:8080"}, env)
+
+	info, err := os.Stat(tokenEnvFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	assert.Empty(t, out.String())
+
+	tokenEnvFile = filepath.Join(t.TempDir(), "missing", ".env")
+	saveRefreshedToken("new")
+	assert.Contains(t, out.String(), "Failed save refreshed token")
+}
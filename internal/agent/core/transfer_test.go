@@ -0,0 +1,43 @@
+package core
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectTransferLogin(t *testing.T) {
+	output = io.Discard
+
+	tests := []struct {
+		name      string
+		assumeYes bool
+		answers   string
+		// exp is the login of the new owner, empty if the transfer is canceled
+		exp string
+	}{
+		{name: "Confirmed transfer", answers: " bob \ny\n", exp: "bob"},
+		{name: "Declined transfer", answers: "bob\nn\n"},
+		{name: "Empty answer declines", answers: "bob\n\n"},
+		{name: "Empty login", answers: "\ny\n"},
+		{name: "Transfer without prompting", assumeYes: true, answers: "bob\n", exp: "bob"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input = strings.NewReader(tt.answers)
+
+			login, err := selectTransferLogin(&config.ConfigENV{AssumeYes: tt.assumeYes}, 5)
+			if tt.exp == "" {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.exp, login)
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/Renal37/goph-keeper/internal/agent/client"
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// updateFile replaces the data of the file with `-id`, or of the file
+// selected from the list, with the entered data. The file keeps its ID and
+// type, the previous data stays in the version history. The name is kept
+// unless a new one is entered. Credentials keep the time of the password
+// change unless the password is changed.
+func updateFile(cl *client.Client, cfg *config.ConfigENV) error {
+	id := cfg.ID
+	if id == 0 {
+		rAllFile, err := cl.ReadAllFile(listOptions(cfg)...)
+		if err != nil {
+			return fmt.Errorf("failed get all file: %w", err)
+		}
+
+		// If there are no files, exit
+		if len(rAllFile.Units) == 0 {
+			fmt.Fprintln(output, "Not found files. Bye!")
+			return nil
+		}
+
+		printFiles(rAllFile.Units, cfg.Format)
+
+		i, err := selectReadFile()
+		if err != nil {
+			return fmt.Errorf("wrong id file: %w", err)
+		}
+		id = i
+	}
+
+	// Only the attributes are needed, the current data is read only for credentials
+	meta, err := cl.GetMeta(int32(id))
+	if err != nil {
+		return fmt.Errorf("failed get file: %w", err)
+	}
+
+	// The current credentials keep the rotation clock of an unchanged password
+	var current *credentials
+	if meta.Type == "credentials" {
+		current, err = readCurrentCredentials(cl, cfg, meta.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	reader := bufio.NewReader(input)
+
+	name, err := readUpdateName(reader, meta.Name)
+	if err != nil {
+		return err
+	}
+
+	data, err := readUpdateData(reader, cfg, meta.Type, current)
+	if err != nil {
+		return err
+	}
+
+	resp, err := cl.UpdateFile(meta.Id, meta.Version, meta.Type, name, data)
+	if status.Code(err) == codes.Aborted {
+		return fmt.Errorf("the file was changed meanwhile, run update-file again: %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed update file: %w", err)
+	}
+
+	fmt.Fprintf(output, "File update! ID: %v, version: %v \n", meta.Id, resp.Version)
+
+	return nil
+}
+
+// readUpdateName reads the new name of the file, an empty answer keeps the
+// current name.
+func readUpdateName(reader *bufio.Reader, current string) (string, error) {
+	fmt.Fprintf(output, "Enter new name (empty keeps %s): ", current)
+
+	name, err := reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf(errorFailedReadSTDIN, err)
+	}
+
+	if name = strings.TrimSpace(name); name == "" {
+		return current, nil
+	}
+
+	return name, nil
+}
+
+// readCurrentCredentials reads the current credentials of the record. A
+// record requiring confirmation is read once the user confirms the read.
+func readCurrentCredentials(cl *client.Client, cfg *config.ConfigENV, id int32) (*credentials, error) {
+	var rec *proto.ReadRecordResponse
+	err := withReauth(cl, func() error {
+		var err error
+		rec, err = cl.ReadFile(id)
+		return err
+	})
+	if err != nil {
+		rec, err = readConfirmed(cl, cfg, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed get file: %w", err)
+	}
+
+	c, err := parseCredentials(rec.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// readUpdateData reads the new data of a file of the type, the same way as
+// for a new file. The data of a file record is the path of the file, the
+// credentials are read with the current credentials of the record.
+func readUpdateData(reader *bufio.Reader, cfg *config.ConfigENV, typ string, current *credentials) (string, error) {
+	var kind int
+	switch typ {
+	case "text":
+		kind = 1
+	case "credentials":
+		if cfg.DataFile != "" {
+			return "", errDataFileCredentials
+		}
+
+		return readCredentials(reader, current)
+	//nolint:gomnd // This legal number
+	case "json":
+		kind = 4
+	case "file":
+		fmt.Fprint(output, "Enter the link to the file: ")
+
+		path, err := reader.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf(errorFailedReadSTDIN, err)
+		}
+
+		return strings.TrimSpace(path), nil
+	default:
+		return "", fmt.Errorf("unsupported record type: %s", typ)
+	}
+
+	_, data, err := readRecordData(reader, cfg, kind)
+
+	return data, err
+}
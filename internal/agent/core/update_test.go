@@ -0,0 +1,212 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// updateStorage updates the records of the vault in place and rejects an
+// update of a stale version, as a server does. With a challenge the reads
+// require confirmation.
+type updateStorage struct {
+	*vaultStorage
+	challenge string
+}
+
+func (s updateStorage) ReadRecordMeta(_ context.Context, in *proto.ReadRecordMetaRequest) (*proto.ReadRecordMetaResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[in.Id]
+	if !ok {
+		return &proto.ReadRecordMetaResponse{Error: "record not found"}, nil
+	}
+
+	return &proto.ReadRecordMetaResponse{Id: r.Id, Name: r.Name, Type: r.Type, Version: r.Version}, nil
+}
+
+func (s updateStorage) ReadRecord(_ context.Context, in *proto.ReadRecordRequest) (*proto.ReadRecordResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[in.Id]
+	if !ok {
+		return &proto.ReadRecordResponse{Error: "record not found"}, nil
+	}
+
+	if s.challenge != "" && in.Confirmation != s.challenge {
+		return &proto.ReadRecordResponse{Id: r.Id, ConfirmationRequired: true, Challenge: s.challenge}, nil
+	}
+
+	return r, nil
+}
+
+func (s updateStorage) UpdateRecord(stream proto.Storage_UpdateRecordServer) error {
+	var upd proto.UpdateRecordRequest
+	for {
+		in, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		upd.Id, upd.Version, upd.Name, upd.Type = in.Id, in.Version, in.Name, in.Type
+		upd.Data = append(upd.Data, in.Data...)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[upd.Id]
+	if !ok {
+		return stream.SendAndClose(&proto.UpdateRecordResponse{Error: "record not found"})
+	}
+	if r.Version != upd.Version {
+		return status.Error(codes.Aborted, "record was changed")
+	}
+
+	r.Version++
+	r.Name, r.Data = upd.Name, upd.Data
+
+	return stream.SendAndClose(&proto.UpdateRecordResponse{Version: r.Version})
+}
+
+func TestUpdateFile(t *testing.T) {
+	output = io.Discard
+	defer func(r io.Reader) { input = r }(input)
+
+	storage := updateStorage{vaultStorage: newVaultStorage()}
+	storage.records[7] = &proto.ReadRecordResponse{Id: 7, Name: "notes", Type: "text", Version: 2, Data: []byte("old")}
+	cl := testClient(t, storage)
+
+	// An empty name keeps the name, the ID and the type stay the same
+	input = strings.NewReader("\nnew notes\n")
+	require.NoError(t, updateFile(cl, &config.ConfigENV{ID: 7}))
+
+	rec := storage.records[7]
+	assert.Equal(t, "notes", rec.Name)
+	assert.Equal(t, "text", rec.Type)
+	assert.Equal(t, []byte("new notes"), rec.Data)
+	assert.Equal(t, int32(3), rec.Version)
+	assert.Len(t, storage.records, 1)
+
+	input = strings.NewReader("renamed\nnewer notes\n")
+	require.NoError(t, updateFile(cl, &config.ConfigENV{ID: 7}))
+	assert.Equal(t, "renamed", rec.Name)
+	assert.Equal(t, int32(4), rec.Version)
+
+	// The stored JSON is validated before the update
+	storage.records[8] = &proto.ReadRecordResponse{Id: 8, Name: "config", Type: "json", Version: 1, Data: []byte("{}")}
+	input = strings.NewReader("\n{\"port\":\n")
+	assert.Error(t, updateFile(cl, &config.ConfigENV{ID: 8}))
+	assert.Equal(t, int32(1), storage.records[8].Version)
+}
+
+func TestUpdateFileCredentials(t *testing.T) {
+	output = io.Discard
+	defer func(r io.Reader) { input = r }(input)
+
+	changed := time.Now().UTC().Truncate(time.Second).AddDate(0, 0, -100)
+	data, err := encodeCredentials(credentials{Login: "alice", Password: "secret", URL: "https://old.example.com",
+		PasswordChangedAt: &changed, RotationDays: 90})
+	require.NoError(t, err)
+
+	storage := updateStorage{vaultStorage: newVaultStorage()}
+	storage.records[7] = &proto.ReadRecordResponse{Id: 7, Name: "mail", Type: "credentials", Version: 1, Data: []byte(data)}
+	cl := testClient(t, storage)
+
+	// Only the URL is changed, the password stays as old as it was
+	input = strings.NewReader("\nalice\nsecret\nhttps://new.example.com\n\n\n")
+	require.NoError(t, updateFile(cl, &config.ConfigENV{ID: 7}))
+
+	c, err := parseCredentials(storage.records[7].Data)
+	require.NoError(t, err)
+	assert.Equal(t, "https://new.example.com", c.URL)
+	require.NotNil(t, c.PasswordChangedAt)
+	assert.True(t, changed.Equal(*c.PasswordChangedAt))
+	assert.Equal(t, 90, c.RotationDays)
+
+	// A new password restarts the rotation clock, the interval is kept
+	input = strings.NewReader("\nalice\nnew-secret\nhttps://new.example.com\n\n\n")
+	require.NoError(t, updateFile(cl, &config.ConfigENV{ID: 7}))
+
+	c, err = parseCredentials(storage.records[7].Data)
+	require.NoError(t, err)
+	assert.Equal(t, "new-secret", c.Password)
+	assert.WithinDuration(t, time.Now(), *c.PasswordChangedAt, time.Minute)
+	assert.Equal(t, 90, c.RotationDays)
+
+	// An entered interval replaces the current one
+	input = strings.NewReader("\nalice\nnew-secret\n\n\n30\n")
+	require.NoError(t, updateFile(cl, &config.ConfigENV{ID: 7}))
+
+	c, err = parseCredentials(storage.records[7].Data)
+	require.NoError(t, err)
+	assert.Equal(t, 30, c.RotationDays)
+	assert.Empty(t, c.URL)
+}
+
+func TestUpdateFileCredentialsConfirmRead(t *testing.T) {
+	output = io.Discard
+	defer func(r io.Reader) { input = r }(input)
+
+	changed := time.Now().UTC().Truncate(time.Second).AddDate(0, 0, -100)
+	data, err := encodeCredentials(credentials{Login: "alice", Password: "secret", PasswordChangedAt: &changed})
+	require.NoError(t, err)
+
+	// The record was written with -confirm-read
+	storage := updateStorage{vaultStorage: newVaultStorage(), challenge: "challenge"}
+	storage.records[7] = &proto.ReadRecordResponse{Id: 7, Name: "mail", Type: "credentials", Version: 1, Data: []byte(data)}
+	cl := testClient(t, storage)
+
+	input = strings.NewReader("\nalice\nsecret\nhttps://new.example.com\n\n\n")
+	require.NoError(t, updateFile(cl, &config.ConfigENV{ID: 7, AssumeYes: true}))
+
+	c, err := parseCredentials(storage.records[7].Data)
+	require.NoError(t, err)
+	assert.Equal(t, "https://new.example.com", c.URL)
+	assert.True(t, changed.Equal(*c.PasswordChangedAt))
+	assert.Equal(t, int32(2), storage.records[7].Version)
+
+	// A declined confirmation cancels the update
+	input = strings.NewReader("n\n")
+	assert.ErrorContains(t, updateFile(cl, &config.ConfigENV{ID: 7}), "read canceled")
+	assert.Equal(t, int32(2), storage.records[7].Version)
+}
+
+func TestUpdateFileConflict(t *testing.T) {
+	output = io.Discard
+	defer func(r io.Reader) { input = r }(input)
+
+	storage := updateStorage{vaultStorage: newVaultStorage()}
+	storage.records[7] = &proto.ReadRecordResponse{Id: 7, Name: "notes", Type: "text", Version: 2, Data: []byte("old")}
+	cl := testClient(t, storage)
+
+	meta, err := cl.GetMeta(7)
+	require.NoError(t, err)
+
+	// Another device updates the record after its version was read
+	_, err = cl.UpdateFile(7, meta.Version, meta.Type, meta.Name, "from another device")
+	require.NoError(t, err)
+
+	_, err = cl.UpdateFile(7, meta.Version, meta.Type, meta.Name, "stale")
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	assert.Equal(t, []byte("from another device"), storage.records[7].Data)
+
+	input = strings.NewReader("\nnewest\n")
+	require.NoError(t, updateFile(cl, &config.ConfigENV{ID: 7}))
+	assert.Equal(t, []byte("newest"), storage.records[7].Data)
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/agent/client"
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
+)
+
+// defaultURLTimeout is how long fetching the URL of write-file -url may take.
+var defaultURLTimeout = 30 * time.Second
+
+// maxURLRedirects is the number of redirects followed when fetching a URL.
+var maxURLRedirects = 10
+
+// maxURLSize is the maximum size of a fetched body, the default limit of the
+// size of a record on the server.
+var maxURLSize int64 = domain.DefaultMaxRecordSize
+
+// errURLTooLarge is returned when the body of the URL exceeds maxURLSize.
+var errURLTooLarge = errors.New("response body is larger than the record size limit")
+
+// writeURL fetches the URL of -url on the client and stores the response
+// body as a file record named after the last element of the URL path.
+func writeURL(cl *client.Client, cfg *config.ConfigENV) (int32, error) {
+	timeout := cfg.URLTimeout
+	if timeout <= 0 {
+		timeout = defaultURLTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	fmt.Fprintf(output, "Fetching %s... \n", cfg.URL)
+
+	filePath, name, err := fetchURL(ctx, cfg.URL)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(filePath)
+
+	category, err := readCategory(bufio.NewReader(input))
+	if err != nil {
+		return 0, err
+	}
+
+	w, err := cl.WriteFile("file", name, filePath, writeOptions(cfg, category)...)
+	if err != nil {
+		return 0, fmt.Errorf("write file has error: %w", err)
+	}
+
+	return w.Id, nil
+}
+
+// fetchURL downloads the body of an http or https URL to a temporary file
+// and returns the path of the file and the name of the record. A declared
+// length over the limit is rejected before reading the body, a body growing
+// over the limit while it is read too.
+func fetchURL(ctx context.Context, rawURL string) (string, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", fmt.Errorf("failed parse url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", "", fmt.Errorf("unsupported url scheme %q, use http or https", u.Scheme)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", "", fmt.Errorf("failed create request: %w", err)
+	}
+
+	httpClient := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxURLRedirects {
+				return fmt.Errorf("stopped after %v redirects", maxURLRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported url scheme %q", req.URL.Scheme)
+			}
+
+			return nil
+		},
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("failed fetch url: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("failed fetch url: server returned %s", resp.Status)
+	}
+
+	if resp.ContentLength > maxURLSize {
+		return "", "", fmt.Errorf("%w: %v bytes, the limit is %v", errURLTooLarge, resp.ContentLength, maxURLSize)
+	}
+
+	file, err := os.CreateTemp("", "goph-keeper-url-*")
+	if err != nil {
+		return "", "", fmt.Errorf("failed create temp file: %w", err)
+	}
+
+	// One byte over the limit tells a body that is too large
+	n, err := io.Copy(file, io.LimitReader(resp.Body, maxURLSize+1))
+	if err == nil && n > maxURLSize {
+		err = fmt.Errorf("%w: the limit is %v bytes", errURLTooLarge, maxURLSize)
+	} else if err != nil {
+		err = fmt.Errorf("failed read response body: %w", err)
+	}
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed close temp file: %w", closeErr)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", "", err
+	}
+
+	return file.Name(), urlName(u), nil
+}
+
+// urlName returns the name of a record fetched from the URL: the last
+// element of the path, the host if the path is empty.
+func urlName(u *url.URL) string {
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		return u.Hostname()
+	}
+
+	return name
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchURL(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/files/report.pdf", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, "report data")
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/files/report.pdf", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/ftp", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "ftp://example.com/file", http.StatusFound)
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Length", "1000")
+		fmt.Fprint(w, strings.Repeat("a", 1000))
+	})
+	mux.HandleFunc("/chunked", func(w http.ResponseWriter, _ *http.Request) {
+		// No length is declared, the body is cut while it is read
+		for i := 0; i < 10; i++ {
+			fmt.Fprint(w, strings.Repeat("a", 100))
+			w.(http.Flusher).Flush()
+		}
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	defer func(size int64) { maxURLSize = size }(maxURLSize)
+	maxURLSize = 500
+
+	t.Run("Body stored", func(t *testing.T) {
+		for _, p := range []string{"/files/report.pdf", "/moved"} {
+			filePath, name, err := fetchURL(context.Background(), srv.URL+p)
+			require.NoError(t, err)
+
+			data, err := os.ReadFile(filePath)
+			require.NoError(t, err)
+			assert.Equal(t, "report data", string(data))
+			assert.NoError(t, os.Remove(filePath))
+
+			if p == "/moved" {
+				assert.Equal(t, "moved", name)
+			} else {
+				assert.Equal(t, "report.pdf", name)
+			}
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		url  string
+		err  string
+	}{
+		{name: "Not found", ctx: context.Background(), url: srv.URL + "/missing", err: "404 Not Found"},
+		{name: "Declared length over the limit", ctx: context.Background(), url: srv.URL + "/large", err: "1000 bytes"},
+		{name: "Body over the limit", ctx: context.Background(), url: srv.URL + "/chunked", err: "larger than the record size limit"},
+		{name: "Redirect loop", ctx: context.Background(), url: srv.URL + "/loop", err: "redirects"},
+		{name: "Redirect to other scheme", ctx: context.Background(), url: srv.URL + "/ftp", err: "unsupported url scheme"},
+		{name: "Timeout", ctx: ctx, url: srv.URL + "/slow", err: "deadline exceeded"},
+		{name: "Not http", ctx: context.Background(), url: "file:///etc/passwd", err: "unsupported url scheme"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := fetchURL(tt.ctx, tt.url)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestURLName(t *testing.T) {
+	tests := []struct {
+		url  string
+		name string
+	}{
+		{url: "https://example.com/files/report%20v2.pdf?download=1", name: "report v2.pdf"},
+		{url: "https://example.com/files/", name: "files"},
+		{url: "https://example.com/", name: "example.com"},
+		{url: "https://example.com:8443", name: "example.com"},
+	}
+
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		require.NoError(t, err)
+		assert.Equal(t, tt.name, urlName(u), tt.url)
+	}
+}
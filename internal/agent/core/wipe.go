@@ -0,0 +1,111 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/agent/config"
+)
+
+// defaultEphemeralTTL is how long a file saved by read-file -ephemeral is kept.
+var defaultEphemeralTTL = time.Minute
+
+// wipeBlockSize is the size of the blocks of zeros a file is overwritten with.
+var wipeBlockSize = 32 << 10
+
+// keepEphemeral keeps the saved files for the TTL of -ephemeral and wipes
+// them. Ctrl+C wipes them right away.
+func keepEphemeral(cfg *config.ConfigENV, paths []string) error {
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = defaultEphemeralTTL
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	return wipeAfter(ctx, paths, ttl)
+}
+
+// wipeAfter waits for the TTL or the end of the context and wipes the files.
+func wipeAfter(ctx context.Context, paths []string, ttl time.Duration) error {
+	fmt.Fprintf(output, "Warning: the saved file will be wiped in %v, press Ctrl+C to wipe it now \n", ttl)
+
+	timer := time.NewTimer(ttl)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	var errs []error
+	for _, path := range paths {
+		if err := wipeFile(path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		fmt.Fprintf(output, "File wiped: %s \n", path)
+	}
+
+	return errors.Join(errs...)
+}
+
+// wipeFile overwrites the file with zeros and removes it. A file the user
+// already removed is not an error. The overwrite is best effort: journaling
+// and copy-on-write file systems or SSDs may keep copies of the old data.
+func wipeFile(path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(output, "File already removed: %s \n", path)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed read stat file: %w", err)
+	}
+
+	// Something else may have been put in place of the file, it is not touched
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file any more, it is left as is", path)
+	}
+
+	if err := overwriteFile(path, fi.Size()); err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed remove file: %w", err)
+	}
+
+	return nil
+}
+
+// overwriteFile overwrites the first `size` bytes of the file with zeros
+// and flushes them to the disk.
+func overwriteFile(path string, size int64) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed open file: %w", err)
+	}
+	defer file.Close()
+
+	zeros := make([]byte, wipeBlockSize)
+	for written := int64(0); written < size; {
+		n := min(int64(len(zeros)), size-written)
+		if _, err := file.Write(zeros[:n]); err != nil {
+			return fmt.Errorf("failed overwrite file: %w", err)
+		}
+		written += n
+	}
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed sync file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWipeAfterTTL(t *testing.T) {
+	var out strings.Builder
+	output = &out
+	defer func() { output = os.Stdout }()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret.txt")
+	require.NoError(t, os.WriteFile(path, []byte("secret data"), 0600))
+
+	// A hard link shows the data was overwritten before the removal
+	link := filepath.Join(dir, "link")
+	require.NoError(t, os.Link(path, link))
+
+	start := time.Now()
+	require.NoError(t, wipeAfter(context.Background(), []string{path}, 50*time.Millisecond))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	_, err := os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	data, err := os.ReadFile(link)
+	require.NoError(t, err)
+	assert.Equal(t, make([]byte, len("secret data")), data)
+	assert.Contains(t, out.String(), "will be wiped in 50ms")
+}
+
+func TestWipeAfterRemovedEarlier(t *testing.T) {
+	var out strings.Builder
+	output = &out
+	defer func() { output = os.Stdout }()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret.txt")
+	require.NoError(t, os.WriteFile(path, []byte("secret"), 0600))
+	require.NoError(t, os.Remove(path))
+
+	// The canceled context wipes right away
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.NoError(t, wipeAfter(ctx, []string{path}, time.Hour))
+	assert.Contains(t, out.String(), "File already removed")
+
+	// A symlink put in place of the file is not followed
+	target := filepath.Join(dir, "target")
+	require.NoError(t, os.WriteFile(target, []byte("other"), 0600))
+	require.NoError(t, os.Symlink(target, path))
+
+	assert.Error(t, wipeAfter(ctx, []string{path}, time.Hour))
+	data, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "other", string(data))
+}
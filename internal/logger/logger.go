@@ -3,24 +3,167 @@ package logger
 
 import (
 	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+// Supported encodings of log entries.
+const (
+	// EncodingJSON writes entries as JSON, it is the default.
+	EncodingJSON = "json"
+	// EncodingConsole writes human-readable colored entries for local development.
+	EncodingConsole = "console"
+)
+
+// Permissions of the log file and its directory. Logs may contain sensitive
+// metadata, so only the owner of the process can read them.
+var (
+	filePermission fs.FileMode = 0600
+	dirPermission  fs.FileMode = 0700
+)
+
+// File contains settings of a log file with rotation.
+type File struct {
+	// Path of the log file, logging to a file is disabled when it is empty.
+	Path string `json:"path" env:"PATH"`
+	// MaxSize is the size in megabytes at which the file is rotated, 100 by default.
+	MaxSize int `json:"max_size" env:"MAX_SIZE"`
+	// MaxAge is the number of days to keep rotated files, 0 keeps them forever.
+	MaxAge int `json:"max_age" env:"MAX_AGE"`
+	// MaxBackups is the number of rotated files to keep, 0 keeps all of them.
+	MaxBackups int `json:"max_backups" env:"MAX_BACKUPS"`
+	// Stderr keeps writing entries to stderr in addition to the file.
+	Stderr bool `json:"stderr" env:"STDERR"`
+}
+
+// Option configures the logger built by `Init`.
+type Option func(*options)
+
+// options holds the settings of the logger.
+type options struct {
+	encoding string
+	file     File
+}
+
+// WithEncoding sets the encoding of log entries, `EncodingJSON` or
+// `EncodingConsole`. An empty encoding keeps the default JSON.
+func WithEncoding(encoding string) Option {
+	return func(o *options) {
+		if encoding != "" {
+			o.encoding = encoding
+		}
+	}
+}
+
+// WithFile writes entries to a file rotated by size and age, instead of or
+// in addition to stderr. A file with an empty path is ignored.
+func WithFile(file File) Option {
+	return func(o *options) {
+		o.file = file
+	}
+}
+
 // Init initializes the logger.
-func Init(level string) (*zap.Logger, error) {
+// If the logger cannot be built with the requested settings, Init returns
+// a minimal fallback logger writing to stderr together with the error, so
+// the caller can emit a warning and keep working instead of crashing.
+func Init(level string, opts ...Option) (*zap.Logger, error) {
+	o := options{encoding: EncodingJSON}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	lvl, err := zap.ParseAtomicLevel(level)
 	if err != nil {
-		return nil, fmt.Errorf("failed parse error level %w", err)
+		return Fallback(), fmt.Errorf("failed parse error level %w", err)
 	}
 
 	cfg := zap.NewProductionConfig()
 	cfg.Level = lvl
 
-	zl, err := cfg.Build()
+	switch o.encoding {
+	case EncodingJSON:
+	case EncodingConsole:
+		cfg.Encoding = EncodingConsole
+		cfg.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+		cfg.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	default:
+		return Fallback(), fmt.Errorf("unsupported log encoding: %s", o.encoding)
+	}
+
+	var buildOpts []zap.Option
+	if o.file.Path != "" {
+		fileCore, err := newFileCore(o.file, cfg)
+		if err != nil {
+			return Fallback(), err
+		}
+
+		buildOpts = append(buildOpts, zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+			if o.file.Stderr {
+				return zapcore.NewTee(c, fileCore)
+			}
+
+			return fileCore
+		}))
+	}
+
+	zl, err := cfg.Build(buildOpts...)
 	if err != nil {
-		return nil, fmt.Errorf("failed build zap config %w", err)
+		return Fallback(), fmt.Errorf("failed build zap config %w", err)
 	}
 
 	return zl, nil
 }
+
+// newFileCore creates a core writing entries with the encoding of the config
+// to a rotated log file. The file and its directory are created with
+// restrictive permissions, an existing file gets them as well.
+func newFileCore(file File, cfg zap.Config) (zapcore.Core, error) {
+	if err := os.MkdirAll(filepath.Dir(file.Path), dirPermission); err != nil {
+		return nil, fmt.Errorf("failed create log dir: %w", err)
+	}
+
+	f, err := os.OpenFile(file.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, filePermission)
+	if err != nil {
+		return nil, fmt.Errorf("failed open log file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed close log file: %w", err)
+	}
+
+	if err := os.Chmod(file.Path, filePermission); err != nil {
+		return nil, fmt.Errorf("failed change log file permission: %w", err)
+	}
+
+	encoder := zapcore.NewJSONEncoder(cfg.EncoderConfig)
+	if cfg.Encoding == EncodingConsole {
+		encoder = zapcore.NewConsoleEncoder(cfg.EncoderConfig)
+	}
+
+	w := &lumberjack.Logger{
+		Filename:   file.Path,
+		MaxSize:    file.MaxSize,
+		MaxAge:     file.MaxAge,
+		MaxBackups: file.MaxBackups,
+		LocalTime:  true,
+	}
+
+	return zapcore.NewCore(encoder, zapcore.AddSync(w), cfg.Level), nil
+}
+
+// Fallback returns a minimal logger writing JSON entries of the info level
+// and above to stderr. It does not depend on any configuration and cannot fail.
+func Fallback() *zap.Logger {
+	core := zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.Lock(os.Stderr),
+		zapcore.InfoLevel,
+	)
+
+	return zap.New(core)
+}
@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInit(t *testing.T) {
+	tests := []struct {
+		name  string
+		level string
+		err   bool
+	}{
+		{name: "Valid level", level: "info", err: false},
+		{name: "Invalid level returns fallback logger", level: "loud", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lg, err := Init(tt.level)
+			if tt.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			// The logger is usable in both cases
+			assert.NotNil(t, lg)
+			assert.NotPanics(t, func() { lg.Info("test message") })
+		})
+	}
+}
+
+func TestInitEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		err      bool
+	}{
+		{name: "Default encoding", encoding: "", err: false},
+		{name: "JSON encoding", encoding: EncodingJSON, err: false},
+		{name: "Console encoding", encoding: EncodingConsole, err: false},
+		{name: "Unknown encoding returns fallback logger", encoding: "xml", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lg, err := Init("info", WithEncoding(tt.encoding))
+			if tt.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.NotNil(t, lg)
+			assert.NotPanics(t, func() { lg.Info("test message") })
+		})
+	}
+}
+
+func TestInitFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "server.log")
+
+	lg, err := Init("info", WithFile(File{Path: path}))
+	assert.NoError(t, err)
+
+	lg.Info("first message")
+	lg.Debug("hidden message")
+	lg.Info("second message")
+	assert.NoError(t, lg.Sync())
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"msg":"first message"`)
+	assert.Contains(t, lines[1], `"msg":"second message"`)
+
+	// Only the owner can read the logs
+	fi, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, filePermission, fi.Mode().Perm())
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Levels of the access events logged for the read records.
+const (
+	AccessLogInfo = "info"
+	AccessLogWarn = "warn"
+)
+
+// ValidateAccessLog checks the level of the access events, empty disables them.
+func ValidateAccessLog(level string) error {
+	switch level {
+	case "", AccessLogInfo, AccessLogWarn:
+		return nil
+	default:
+		return fmt.Errorf("unknown access log level %s, use %s or %s", level, AccessLogInfo, AccessLogWarn)
+	}
+}
+
+// logAccess logs the event of a successful read of a record at the level of
+// the access log. Only the IDs and the time are logged, never the data or
+// the name of the record.
+func (s StorageHandler) logAccess(userID int, recordID int, version int) {
+	level := zapcore.InfoLevel
+	switch s.AccessLog {
+	case "":
+		return
+	case AccessLogWarn:
+		level = zapcore.WarnLevel
+	}
+
+	if ce := s.Logger.Check(level, "record accessed"); ce != nil {
+		ce.Write(
+			zap.Int("record_id", recordID),
+			zap.Int("version", version),
+			zap.Int("user_id", userID),
+			zap.Time("accessed_at", time.Now().UTC()),
+		)
+	}
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/Renal37/goph-keeper/internal/server/core/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestAccessLog(t *testing.T) {
+	secret := "correct horse battery staple"
+
+	rec := domain.Storage{ID: 7, Owner: 1, Name: "bank", Type: "text", Version: 3}
+	require.NoError(t, StorageHandler{MasterKey: "1234567812345678"}.encrypt(&rec, []byte(secret)))
+
+	tests := []struct {
+		name  string
+		level string
+		exp   zapcore.Level
+	}{
+		{name: "Info", level: AccessLogInfo, exp: zapcore.InfoLevel},
+		{name: "Warn", level: AccessLogWarn, exp: zapcore.WarnLevel},
+		{name: "Disabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+			s := StorageHandler{
+				Svc:       *services.NewStorageService(&recordRepo{rec: rec}),
+				Logger:    zap.New(core),
+				MasterKey: "1234567812345678",
+				AccessLog: tt.level,
+			}
+			ctx := middleware.SetTokenToContext(context.Background(), middleware.JWTclaims{ID: 1, Login: "bob"})
+
+			before := time.Now().UTC()
+			resp, err := s.ReadRecord(ctx, &proto.ReadRecordRequest{Id: 7})
+			require.NoError(t, err)
+			require.Equal(t, secret, string(resp.Data))
+
+			// A failed read is not an access
+			_, err = s.ReadRecord(ctx, &proto.ReadRecordRequest{Id: 8})
+			require.NoError(t, err)
+
+			events := logs.FilterMessage("record accessed").All()
+			if tt.level == "" {
+				assert.Empty(t, events)
+				return
+			}
+
+			require.Len(t, events, 1)
+			assert.Equal(t, tt.exp, events[0].Level)
+
+			fields := events[0].ContextMap()
+			assert.Equal(t, int64(7), fields["record_id"])
+			assert.Equal(t, int64(3), fields["version"])
+			assert.Equal(t, int64(1), fields["user_id"])
+			assert.WithinDuration(t, before, fields["accessed_at"].(time.Time), time.Minute)
+			assert.Len(t, fields, 4)
+
+			// Neither the data nor the name is logged
+			for _, entry := range logs.All() {
+				text := fmt.Sprint(entry.Message, entry.ContextMap())
+				assert.NotContains(t, text, secret)
+				assert.NotContains(t, text, "bank")
+			}
+		})
+	}
+}
+
+func TestValidateAccessLog(t *testing.T) {
+	assert.NoError(t, ValidateAccessLog(""))
+	assert.NoError(t, ValidateAccessLog(AccessLogWarn))
+	assert.Error(t, ValidateAccessLog("debug"))
+}
@@ -0,0 +1,358 @@
+package handler
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/Renal37/goph-keeper/internal/server/core/services"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultDeleteBatch is the number of records deleted in one transaction by
+// `DeleteOlderThan` when the request has no batch size.
+const defaultDeleteBatch = 1000
+
+// defaultScanBatch is the number of records read at once by `ReencryptAll`
+// and `RepairRecordTypes` when the request has no batch size.
+const defaultScanBatch = 100
+
+// ReadOnlyMode is the maintenance mode of the server. While it is enabled
+// records can be read, but not written, updated or deleted. It is shared by
+// the servers of all listeners and can be switched at runtime.
+type ReadOnlyMode struct {
+	enabled atomic.Bool
+	logger  *zap.Logger
+}
+
+// NewReadOnlyMode creates the mode in the given state.
+func NewReadOnlyMode(lg *zap.Logger, enabled bool) *ReadOnlyMode {
+	m := &ReadOnlyMode{logger: lg}
+	m.enabled.Store(enabled)
+
+	if enabled {
+		lg.Info("Server in read-only mode")
+	}
+
+	return m
+}
+
+// Enabled reports whether the changes of records are blocked.
+func (m *ReadOnlyMode) Enabled() bool {
+	return m != nil && m.enabled.Load()
+}
+
+// Set switches the mode and logs the change.
+func (m *ReadOnlyMode) Set(enabled bool) {
+	if m.enabled.Swap(enabled) == enabled {
+		return
+	}
+
+	m.logger.Info("Read-only mode changed", zap.Bool("enabled", enabled))
+}
+
+// AdminHandler serves the administration calls. It is only served on the
+// listeners marked as admin, the calls need a token of the admin scope.
+type AdminHandler struct {
+	proto.UnimplementedAdminServer
+	ReadOnlyMode *ReadOnlyMode
+	Storage      *services.StorageService
+	Users        *services.UserService
+	Logger       *zap.Logger
+	// MasterKey, MasterKeyID and MasterKeys are the master keys of the
+	// records, as for the storage.
+	MasterKey   string
+	MasterKeyID string
+	MasterKeys  map[string]string
+	// Algorithm is the algorithm `ReencryptAll` re-encrypts the records
+	// with. Empty means DefaultAlgorithm.
+	Algorithm string
+}
+
+// keys returns a storage handler with the master keys of the admin handler
+// to decrypt and encrypt the records.
+func (h AdminHandler) keys() StorageHandler {
+	return StorageHandler{MasterKey: h.MasterKey, MasterKeyID: h.MasterKeyID, MasterKeys: h.MasterKeys}
+}
+
+// SetReadOnly enables or disables the read-only mode of the server.
+func (h AdminHandler) SetReadOnly(ctx context.Context, in *proto.SetReadOnlyRequest) (*proto.SetReadOnlyResponse, error) {
+	h.ReadOnlyMode.Set(in.Enabled)
+
+	return &proto.SetReadOnlyResponse{Enabled: h.ReadOnlyMode.Enabled()}, nil
+}
+
+// DeleteOlderThan deletes the records created, or last accessed, before the
+// cutoff for the retention policy and returns the number of deleted records.
+// The records are deleted in batches, each batch in its own transaction.
+func (h AdminHandler) DeleteOlderThan(ctx context.Context, in *proto.DeleteOlderThanRequest) (*proto.DeleteOlderThanResponse, error) {
+	if in.Cutoff <= 0 {
+		//nolint:wrapcheck // This legal return
+		return nil, status.Error(codes.InvalidArgument, "cutoff is required")
+	}
+
+	if in.BatchSize < 0 {
+		//nolint:wrapcheck // This legal return
+		return nil, status.Error(codes.InvalidArgument, "negative batch size")
+	}
+
+	if h.ReadOnlyMode.Enabled() {
+		return nil, ErrServerReadOnly
+	}
+
+	cutoff := domain.RetentionCutoff{Before: time.Unix(in.Cutoff, 0), LastAccessed: in.LastAccessed}
+	if in.Login != "" {
+		user, err := h.Users.FindUserByLogin(in.Login)
+		if err != nil {
+			h.Logger.With(zap.Error(err)).Error("failed find user")
+			//nolint:wrapcheck // This legal return
+			return nil, status.Error(codes.Internal, "failed find user")
+		}
+
+		if user == nil {
+			//nolint:wrapcheck // This legal return
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+
+		cutoff.Owner = user.ID
+	}
+
+	batch := int(in.BatchSize)
+	if batch == 0 {
+		batch = defaultDeleteBatch
+	}
+
+	deleted, err := h.Storage.DeleteOlderThan(cutoff, batch)
+	if err != nil {
+		h.Logger.With(zap.Error(err), zap.Int("deleted", deleted)).Error("failed delete old records")
+		//nolint:wrapcheck // This legal return
+		return nil, status.Errorf(codes.Internal, "failed delete old records, %v deleted", deleted)
+	}
+
+	h.Logger.Info("Old records deleted", zap.Time("cutoff", cutoff.Before),
+		zap.Bool("last_accessed", cutoff.LastAccessed), zap.Int("owner", cutoff.Owner), zap.Int("deleted", deleted))
+
+	return &proto.DeleteOlderThanResponse{Deleted: int64(deleted)}, nil
+}
+
+// ReencryptAll re-encrypts the records written with an algorithm other than
+// the configured one, e.g. after the algorithm of the server was changed, and
+// the records whose data keys are encrypted with a previous master key.
+// The records are read in batches in the order of the IDs, so an interrupted
+// call is resumed from the last ID it returned. A record that can't be
+// re-encrypted is logged and skipped, it is returned in the failed IDs.
+// Then the versions of the history are re-encrypted the same way, from the
+// last version ID.
+func (h AdminHandler) ReencryptAll(ctx context.Context, in *proto.ReencryptAllRequest) (*proto.ReencryptAllResponse, error) {
+	if in.BatchSize < 0 {
+		//nolint:wrapcheck // This legal return
+		return nil, status.Error(codes.InvalidArgument, "negative batch size")
+	}
+
+	if h.ReadOnlyMode.Enabled() {
+		return nil, ErrServerReadOnly
+	}
+
+	algorithm := h.Algorithm
+	if algorithm == "" {
+		algorithm = DefaultAlgorithm
+	}
+
+	if _, err := GetCipher(algorithm); err != nil {
+		//nolint:wrapcheck // This legal return
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	batch := int(in.BatchSize)
+	if batch == 0 {
+		batch = defaultScanBatch
+	}
+
+	resp := proto.ReencryptAllResponse{LastId: in.AfterId, LastVersionId: in.AfterVersionId}
+	for {
+		if err := ctx.Err(); err != nil {
+			h.Logger.Info("Re-encryption interrupted", zap.Int64("reencrypted", resp.Reencrypted), zap.Int32("last_id", resp.LastId))
+			//nolint:wrapcheck // This legal return
+			return nil, status.FromContextError(err).Err()
+		}
+
+		recs, err := h.Storage.ReadRecordsToReencrypt(algorithm, h.MasterKeyID, int(resp.LastId), batch)
+		if err != nil {
+			h.Logger.With(zap.Error(err), zap.Int32("last_id", resp.LastId)).Error("failed read records to re-encrypt")
+			//nolint:wrapcheck // This legal return
+			return nil, status.Errorf(codes.Internal, "failed read records, %v re-encrypted, resume after %v",
+				resp.Reencrypted, resp.LastId)
+		}
+
+		for i := range recs {
+			rec := recs[i]
+			resp.LastId = int32(rec.ID)
+
+			err := reencrypt(&rec, h.keys(), algorithm)
+			if err == nil {
+				err = h.Storage.ReencryptRecord(rec, rec.Version)
+			}
+			if err != nil {
+				h.Logger.With(zap.Error(err), zap.Int("record_id", rec.ID)).Error("failed re-encrypt record")
+				resp.FailedIds = append(resp.FailedIds, int32(rec.ID))
+				continue
+			}
+
+			resp.Reencrypted++
+		}
+
+		h.Logger.Info("Records re-encrypted", zap.String("algorithm", algorithm), zap.Int64("reencrypted", resp.Reencrypted),
+			zap.Int("failed", len(resp.FailedIds)), zap.Int32("last_id", resp.LastId))
+
+		if len(recs) < batch {
+			break
+		}
+	}
+
+	if err := h.reencryptVersions(ctx, algorithm, batch, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// reencryptVersions re-encrypts the versions of the history of the records
+// by the same rules as the records, so a previous master key or algorithm is
+// not needed to read the history. The versions are read in batches in the
+// order of their IDs after the last version ID of the response. A version
+// that can't be re-encrypted is logged and skipped, it is returned in the
+// failed versions.
+func (h AdminHandler) reencryptVersions(ctx context.Context, algorithm string, batch int, resp *proto.ReencryptAllResponse) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			h.Logger.Info("Re-encryption of versions interrupted", zap.Int64("reencrypted", resp.ReencryptedVersions),
+				zap.Int32("last_version_id", resp.LastVersionId))
+			//nolint:wrapcheck // This legal return
+			return status.FromContextError(err).Err()
+		}
+
+		versions, err := h.Storage.ReadVersionsToReencrypt(algorithm, h.MasterKeyID, int(resp.LastVersionId), batch)
+		if err != nil {
+			h.Logger.With(zap.Error(err), zap.Int32("last_version_id", resp.LastVersionId)).Error("failed read versions to re-encrypt")
+			//nolint:wrapcheck // This legal return
+			return status.Errorf(codes.Internal, "failed read versions, %v re-encrypted, resume after %v and after version %v",
+				resp.ReencryptedVersions, resp.LastId, resp.LastVersionId)
+		}
+
+		for _, v := range versions {
+			resp.LastVersionId = int32(v.ID)
+			rec := v.Record()
+
+			err := reencrypt(&rec, h.keys(), algorithm)
+			if err == nil {
+				err = h.Storage.ReencryptVersion(v.ID, rec)
+			}
+			if err != nil {
+				h.Logger.With(zap.Error(err), zap.Int("record_id", v.RecordID), zap.Int("version", v.Version)).
+					Error("failed re-encrypt version")
+				resp.FailedVersions = append(resp.FailedVersions,
+					&proto.RecordVersion{Id: int32(v.RecordID), Version: int32(v.Version)})
+				continue
+			}
+
+			resp.ReencryptedVersions++
+		}
+
+		h.Logger.Info("Versions re-encrypted", zap.String("algorithm", algorithm), zap.Int64("reencrypted", resp.ReencryptedVersions),
+			zap.Int("failed", len(resp.FailedVersions)), zap.Int32("last_version_id", resp.LastVersionId))
+
+		if len(versions) < batch {
+			return nil
+		}
+	}
+}
+
+// RepairRecordTypes finds the records with an empty or unknown type, e.g.
+// written by old clients. The type of a record is inferred from its data,
+// with repair it is saved. A record that can't be decrypted is only reported
+// for a manual review. Without repair the call works in the read-only mode.
+func (h AdminHandler) RepairRecordTypes(ctx context.Context, in *proto.RepairRecordTypesRequest) (*proto.RepairRecordTypesResponse, error) {
+	if in.BatchSize < 0 {
+		//nolint:wrapcheck // This legal return
+		return nil, status.Error(codes.InvalidArgument, "negative batch size")
+	}
+
+	if in.Repair && h.ReadOnlyMode.Enabled() {
+		return nil, ErrServerReadOnly
+	}
+
+	batch := int(in.BatchSize)
+	if batch == 0 {
+		batch = defaultScanBatch
+	}
+
+	var resp proto.RepairRecordTypesResponse
+	after := int(in.AfterId)
+	repaired := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			//nolint:wrapcheck // This legal return
+			return nil, status.FromContextError(err).Err()
+		}
+
+		recs, err := h.Storage.ReadRecordsWithInvalidType(domain.RecordTypes, after, batch)
+		if err != nil {
+			h.Logger.With(zap.Error(err)).Error("failed read records with invalid type")
+			//nolint:wrapcheck // This legal return
+			return nil, status.Error(codes.Internal, "failed read records")
+		}
+
+		for i := range recs {
+			issue := h.inspectRecordType(&recs[i], in.Repair)
+			if issue.Repaired {
+				repaired++
+			}
+
+			resp.Issues = append(resp.Issues, issue)
+			after = recs[i].ID
+		}
+
+		if len(recs) < batch {
+			break
+		}
+	}
+
+	h.Logger.Info("Records with invalid type checked", zap.Int("found", len(resp.Issues)),
+		zap.Int("repaired", repaired), zap.Bool("repair", in.Repair))
+
+	return &resp, nil
+}
+
+// inspectRecordType infers the type of a record with an invalid type and
+// saves it with repair.
+func (h AdminHandler) inspectRecordType(rec *domain.Storage, repair bool) *proto.RecordTypeIssue {
+	issue := &proto.RecordTypeIssue{Id: int32(rec.ID), Owner: int32(rec.Owner), Type: rec.Type}
+	log := h.Logger.With(zap.Int("record_id", rec.ID), zap.String("type", rec.Type))
+
+	data, err := h.keys().decrypt(rec)
+	if err != nil {
+		log.With(zap.Error(err)).Warn("record with invalid type needs review")
+		issue.Error = "failed decrypt data"
+		return issue
+	}
+
+	issue.InferredType = domain.InferRecordType(data)
+	if !repair {
+		return issue
+	}
+
+	if err := h.Storage.UpdateRecordType(rec.ID, rec.Type, issue.InferredType); err != nil {
+		log.With(zap.Error(err)).Error("failed repair record type")
+		issue.Error = "failed update type"
+		return issue
+	}
+
+	log.Info("record type repaired", zap.String("inferred_type", issue.InferredType))
+	issue.Repaired = true
+
+	return issue
+}
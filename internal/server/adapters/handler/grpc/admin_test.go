@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/Renal37/goph-keeper/internal/server/core/ports"
+	"github.com/Renal37/goph-keeper/internal/server/core/services"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDeleteOlderThanValidation(t *testing.T) {
+	h := AdminHandler{ReadOnlyMode: NewReadOnlyMode(zap.NewNop(), false), Logger: zap.NewNop()}
+
+	_, err := h.DeleteOlderThan(context.Background(), &proto.DeleteOlderThanRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = h.DeleteOlderThan(context.Background(), &proto.DeleteOlderThanRequest{Cutoff: 1, BatchSize: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	h.ReadOnlyMode.Set(true)
+	_, err = h.DeleteOlderThan(context.Background(), &proto.DeleteOlderThanRequest{Cutoff: 1})
+	assert.ErrorIs(t, err, ErrServerReadOnly)
+}
+
+func TestReencryptAllValidation(t *testing.T) {
+	h := AdminHandler{ReadOnlyMode: NewReadOnlyMode(zap.NewNop(), false), Logger: zap.NewNop(), Algorithm: "des"}
+
+	_, err := h.ReencryptAll(context.Background(), &proto.ReencryptAllRequest{BatchSize: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = h.ReencryptAll(context.Background(), &proto.ReencryptAllRequest{})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	h.ReadOnlyMode.Set(true)
+	_, err = h.ReencryptAll(context.Background(), &proto.ReencryptAllRequest{})
+	assert.ErrorIs(t, err, ErrServerReadOnly)
+}
+
+// versionRepo is a storage repository with the versions of the history of
+// the records only, the other methods are not implemented.
+type versionRepo struct {
+	ports.StorageRepository
+	versions []domain.StorageVersion
+}
+
+func (r *versionRepo) ReadRecordsToReencrypt(algorithm string, keyID string, after int, limit int) ([]domain.Storage, error) {
+	return nil, nil
+}
+
+func (r *versionRepo) ReadVersionsToReencrypt(algorithm string, keyID string, after int, limit int) ([]domain.StorageVersion, error) {
+	var versions []domain.StorageVersion
+	for _, v := range r.versions {
+		if v.ID > after && (v.Algorithm != algorithm || v.KeyID != keyID) && len(versions) < limit {
+			versions = append(versions, v)
+		}
+	}
+
+	return versions, nil
+}
+
+func (r *versionRepo) ReencryptVersion(id int, doc domain.Storage) error {
+	for i := range r.versions {
+		if r.versions[i].ID == id {
+			r.versions[i].Value, r.versions[i].Key, r.versions[i].Algorithm = doc.Value, doc.Key, doc.Algorithm
+			return nil
+		}
+	}
+
+	return domain.ErrNotFound
+}
+
+func TestReencryptAllVersions(t *testing.T) {
+	keys := StorageHandler{MasterKey: "1234567812345678", Algorithm: AlgorithmAESGCM}
+
+	repo := &versionRepo{}
+	for i, data := range []string{"v1", "v2", "v3"} {
+		rec := domain.Storage{ID: 7, Owner: 1, Version: i + 1}
+		assert.NoError(t, keys.encrypt(&rec, []byte(data)))
+		repo.versions = append(repo.versions, domain.StorageVersion{ID: 10 + i, RecordID: rec.ID, Version: rec.Version,
+			Owner: rec.Owner, Value: rec.Value, Key: rec.Key, Algorithm: rec.Algorithm, Bound: rec.Bound})
+	}
+	repo.versions[1].Value = "broken"
+
+	h := AdminHandler{
+		ReadOnlyMode: NewReadOnlyMode(zap.NewNop(), false),
+		Storage:      services.NewStorageService(repo),
+		Logger:       zap.NewNop(),
+		MasterKey:    keys.MasterKey,
+		Algorithm:    AlgorithmChaCha20Poly1305,
+	}
+
+	out, err := h.ReencryptAll(context.Background(), &proto.ReencryptAllRequest{BatchSize: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), out.ReencryptedVersions)
+	assert.Equal(t, int32(12), out.LastVersionId)
+	if assert.Len(t, out.FailedVersions, 1) {
+		assert.Equal(t, int32(7), out.FailedVersions[0].Id)
+		assert.Equal(t, int32(2), out.FailedVersions[0].Version)
+	}
+
+	for i, data := range map[int]string{0: "v1", 2: "v3"} {
+		rec := repo.versions[i].Record()
+		assert.Equal(t, AlgorithmChaCha20Poly1305, rec.Algorithm)
+		read, err := keys.decrypt(&rec)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(data), read)
+	}
+
+	// A resumed call skips the failed version
+	out, err = h.ReencryptAll(context.Background(), &proto.ReencryptAllRequest{AfterVersionId: out.LastVersionId})
+	assert.NoError(t, err)
+	assert.Zero(t, out.ReencryptedVersions)
+	assert.Empty(t, out.FailedVersions)
+	assert.Equal(t, int32(12), out.LastVersionId)
+}
+
+func TestRepairRecordTypesValidation(t *testing.T) {
+	h := AdminHandler{ReadOnlyMode: NewReadOnlyMode(zap.NewNop(), true), Logger: zap.NewNop()}
+
+	_, err := h.RepairRecordTypes(context.Background(), &proto.RepairRecordTypesRequest{BatchSize: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = h.RepairRecordTypes(context.Background(), &proto.RepairRecordTypesRequest{Repair: true})
+	assert.ErrorIs(t, err, ErrServerReadOnly)
+}
@@ -0,0 +1,412 @@
+package handler
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Algorithms of the record encryption. The algorithm is stored with every
+// record, so records written with different algorithms stay readable.
+const (
+	AlgorithmAESGCM           = "aes-gcm"
+	AlgorithmChaCha20Poly1305 = "chacha20-poly1305"
+)
+
+// DefaultAlgorithm is used when no algorithm is configured and for records
+// written before the algorithm was stored.
+const DefaultAlgorithm = AlgorithmAESGCM
+
+// ErrMasterKeyMismatch means the authentication of an encrypted record
+// failed: most likely the master key is not the one the record was written
+// with, or the record was tampered with.
+var ErrMasterKeyMismatch = errors.New("record could not be decrypted — master key may be incorrect")
+
+// errUnknownMasterKey means a record is written with a master key the server
+// doesn't have.
+var errUnknownMasterKey = errors.New("unknown master key")
+
+// errAuthentication means the ciphertext was not sealed with the key.
+var errAuthentication = errors.New("message authentication failed")
+
+// errMalformedCiphertext means the stored ciphertext is not in the format of
+// seal, e.g. it is empty or corrupted in BD.
+var errMalformedCiphertext = errors.New("malformed encrypted data")
+
+// Cipher encrypts the data of a record with a random data key and the data
+// key with the master key.
+type Cipher interface {
+	// KeySize is the size of a random data key in bytes.
+	KeySize() int
+	// Encrypt encrypts the plaintext and returns it encoded as a string.
+	// The additional data is authenticated, but not encrypted.
+	Encrypt(key []byte, plaintext []byte, aad []byte) (string, error)
+	// Decrypt decrypts a string returned by Encrypt with the same additional data.
+	Decrypt(key []byte, ciphertext string, aad []byte) ([]byte, error)
+}
+
+var ciphers = map[string]Cipher{
+	AlgorithmAESGCM:           aesGCM{},
+	AlgorithmChaCha20Poly1305: chaCha20Poly1305{},
+}
+
+// GetCipher returns the cipher of the algorithm. An empty algorithm means DefaultAlgorithm.
+func GetCipher(algorithm string) (Cipher, error) {
+	if algorithm == "" {
+		algorithm = DefaultAlgorithm
+	}
+
+	c, ok := ciphers[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption algorithm: %s", algorithm)
+	}
+
+	return c, nil
+}
+
+// aesGCM is AES-256 in GCM mode. The 256-bit key is the SHA-256 of the
+// given key, so all bytes of a long master key are used. The ciphertext is
+// prefixed with aesVersionMarker. The records written before the marker were
+// encrypted with AES-128 and the key cut to 16 bytes, they are still read
+// this way.
+type aesGCM struct{}
+
+// aesVersionMarker prefixes the AES-256 ciphertexts. The legacy ciphertexts
+// are base64 separated by "*", so they never contain ":".
+const aesVersionMarker = "v2:"
+
+// aesMinimumKeySize is the minimum size of a key, a shorter key is rejected
+// instead of being padded.
+const aesMinimumKeySize = 16
+
+// aesLegacyKeySize is the size of the legacy AES-128 key.
+const aesLegacyKeySize = 16
+
+func (aesGCM) KeySize() int {
+	return sha256.Size
+}
+
+func (aesGCM) aead(key []byte) (cipher.AEAD, error) {
+	if len(key) < aesMinimumKeySize {
+		return nil, fmt.Errorf("AES key is too short: %v bytes, the minimum is %v", len(key), aesMinimumKeySize)
+	}
+
+	sum := sha256.Sum256(key)
+
+	return newGCM(sum[:])
+}
+
+// legacyAEAD returns AES-128 with the key cut to 16 bytes, as the records
+// written before aesVersionMarker were encrypted.
+func (aesGCM) legacyAEAD(key []byte) (cipher.AEAD, error) {
+	return newGCM(adjustKeySize(key, aesLegacyKeySize))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	// Создайте новый блок AES с использованием ключа
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create chiper: %w", err)
+	}
+
+	return aesgcm, nil
+}
+
+func (c aesGCM) Encrypt(key []byte, plaintext []byte, aad []byte) (string, error) {
+	aead, err := c.aead(key)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := seal(aead, plaintext, aad)
+	if err != nil {
+		return "", err
+	}
+
+	return aesVersionMarker + sealed, nil
+}
+
+func (c aesGCM) Decrypt(key []byte, ciphertext string, aad []byte) ([]byte, error) {
+	sealed, ok := strings.CutPrefix(ciphertext, aesVersionMarker)
+
+	aeadFunc := c.aead
+	if !ok {
+		aeadFunc = c.legacyAEAD
+	}
+
+	aead, err := aeadFunc(key)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	return open(aead, sealed, aad)
+}
+
+// chaCha20Poly1305 is ChaCha20-Poly1305. The 256-bit key is the SHA-256 of
+// the given key, so the master key of any length can be used.
+type chaCha20Poly1305 struct{}
+
+func (chaCha20Poly1305) KeySize() int {
+	return chacha20poly1305.KeySize
+}
+
+func (chaCha20Poly1305) aead(key []byte) (cipher.AEAD, error) {
+	sum := sha256.Sum256(key)
+
+	aead, err := chacha20poly1305.New(sum[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ChaCha20-Poly1305 cipher: %w", err)
+	}
+
+	return aead, nil
+}
+
+func (c chaCha20Poly1305) Encrypt(key []byte, plaintext []byte, aad []byte) (string, error) {
+	aead, err := c.aead(key)
+	if err != nil {
+		return "", err
+	}
+
+	return seal(aead, plaintext, aad)
+}
+
+func (c chaCha20Poly1305) Decrypt(key []byte, ciphertext string, aad []byte) ([]byte, error) {
+	aead, err := c.aead(key)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	return open(aead, ciphertext, aad)
+}
+
+// recordAAD returns the additional data the encryption of a record is bound
+// to: its owner and ID. A ciphertext copied into another record, or a record
+// given to another owner in BD, fails the authentication. The records
+// written before the binding have no additional data.
+func recordAAD(rec *domain.Storage) []byte {
+	if !rec.Bound {
+		return nil
+	}
+
+	return []byte(fmt.Sprintf("goph-keeper:record:%d:%d", rec.Owner, rec.ID))
+}
+
+// MasterKey is a master key with its ID. The ID is stored with the records,
+// so several master keys can be used at once: the new records are written
+// with the primary key, the others are read with the key they were written
+// with. The empty ID is the key of the records written before the IDs.
+type MasterKey struct {
+	ID  string
+	Key string
+}
+
+// keyAAD returns the additional data the data key of a record is encrypted
+// with: the additional data of the record and the ID of the master key, so
+// the key ID stored with the record can't be changed. The key without an ID
+// adds nothing, as the records written before the IDs.
+func keyAAD(aad []byte, keyID string) []byte {
+	if keyID == "" {
+		return aad
+	}
+
+	return append(append([]byte{}, aad...), ":key:"+keyID...)
+}
+
+// encryptionData encrypts the data with a random data key and the data key
+// with the master key.
+func encryptionData(c Cipher, mk MasterKey, data []byte, aad []byte) (string, string, error) {
+	key, err := generateRandom(c.KeySize())
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+
+	encKey, err := c.Encrypt([]byte(mk.Key), key, keyAAD(aad, mk.ID))
+	if err != nil {
+		return "", "", fmt.Errorf("failed encript key: %w", err)
+	}
+
+	encData, err := c.Encrypt(key, data, aad)
+	if err != nil {
+		return "", "", fmt.Errorf("failed encript data: %w", err)
+	}
+
+	return encData, encKey, nil
+}
+
+// decryptionData decrypts the data key with the master key and the data with
+// the data key.
+func decryptionData(c Cipher, mk MasterKey, key string, data string, aad []byte) ([]byte, error) {
+	decKey, err := c.Decrypt([]byte(mk.Key), key, keyAAD(aad, mk.ID))
+	if err != nil {
+		return []byte{}, fmt.Errorf("failed decrypt key: %w", authenticationError(err))
+	}
+
+	decData, err := c.Decrypt(decKey, data, aad)
+	if err != nil {
+		return []byte{}, fmt.Errorf("failed decrypt data: %w", authenticationError(err))
+	}
+
+	return decData, nil
+}
+
+// authenticationError marks an authentication failure of a record with
+// ErrMasterKeyMismatch, other errors are returned as is.
+func authenticationError(err error) error {
+	if errors.Is(err, errAuthentication) {
+		return fmt.Errorf("%w: %w", ErrMasterKeyMismatch, err)
+	}
+
+	return err
+}
+
+// reencrypt decrypts the data of a record, and its name if it is encrypted,
+// with the algorithm and the master key of the record and encrypts them with
+// a new data key of the given algorithm under the primary master key of
+// `keys`.
+func reencrypt(rec *domain.Storage, keys StorageHandler, algorithm string) error {
+	return reseal(rec, keys, algorithm, rec.Owner)
+}
+
+// rebind encrypts a record given to another owner again, so its encryption
+// is bound to the new owner. The algorithm of the record is kept.
+func rebind(rec *domain.Storage, keys StorageHandler, owner int) error {
+	return reseal(rec, keys, rec.Algorithm, owner)
+}
+
+// reseal decrypts a record with the master keys of `keys` and encrypts it
+// with a new data key of the algorithm under the primary master key, bound
+// to the owner.
+func reseal(rec *domain.Storage, keys StorageHandler, algorithm string, owner int) error {
+	from := StorageHandler{MasterKey: keys.MasterKey, MasterKeyID: keys.MasterKeyID, MasterKeys: keys.MasterKeys}
+	to := from
+	to.Algorithm = algorithm
+	to.EncryptNames = rec.NameEncrypted
+
+	data, err := from.decrypt(rec)
+	if err != nil {
+		return err
+	}
+
+	if err := from.openName(rec); err != nil {
+		return err
+	}
+
+	sealed := *rec
+	sealed.Owner = owner
+	if err := to.encrypt(&sealed, data); err != nil {
+		return err
+	}
+
+	if err := to.sealName(&sealed); err != nil {
+		return err
+	}
+
+	*rec = sealed
+
+	return nil
+}
+
+// seal encrypts the plaintext with a random nonce and encodes both as
+// "nonce*ciphertext" in base64.
+func seal(aead cipher.AEAD, plaintext []byte, aad []byte) (string, error) {
+	// Создаём вектор инициализации
+	nonce, err := generateRandom(aead.NonceSize())
+	if err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+
+	dst := aead.Seal(nil, nonce, plaintext, aad)
+
+	// Кодируем зашифрованные данные в строку (base64)
+	encString := base64.StdEncoding.EncodeToString(nonce) + "*" + base64.StdEncoding.EncodeToString(dst)
+
+	return encString, nil
+}
+
+// open decrypts a string encoded by seal.
+func open(aead cipher.AEAD, ciphertext string, aad []byte) ([]byte, error) {
+	nonce, data, err := splitSealed(ciphertext)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	// Получаем вектор
+	decNonce, err := base64.StdEncoding.DecodeString(nonce)
+	if err != nil {
+		return []byte{}, fmt.Errorf("%w: failed decode base64: %w", errMalformedCiphertext, err)
+	}
+
+	// Зашифровваные данные
+	decString, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return []byte{}, fmt.Errorf("%w: failed decode base64: %w", errMalformedCiphertext, err)
+	}
+
+	if len(decNonce) != aead.NonceSize() {
+		return []byte{}, fmt.Errorf("%w: invalid nonce size: %v", errMalformedCiphertext, len(decNonce))
+	}
+
+	// Расшифровываем
+	dst, err := aead.Open(nil, decNonce, decString, aad)
+	if err != nil {
+		// Open fails only if the authentication fails
+		return []byte{}, fmt.Errorf("failed open decrypts: %w: %w", errAuthentication, err)
+	}
+
+	return dst, nil
+}
+
+// splitSealed splits a string encoded by seal into the nonce and the
+// ciphertext, both in base64. Anything but two non-empty parts is malformed.
+func splitSealed(sealed string) (string, string, error) {
+	parts := strings.Split(sealed, "*")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("%w: expected nonce*data", errMalformedCiphertext)
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// sealOverhead is the size of the authentication tag added by seal, the same
+// for AES-GCM and ChaCha20-Poly1305.
+const sealOverhead = 16
+
+// sealedSize returns the size of the plaintext of a string encoded by seal
+// without decrypting it.
+func sealedSize(ciphertext string) (int64, error) {
+	_, data, err := splitSealed(strings.TrimPrefix(ciphertext, aesVersionMarker))
+	if err != nil {
+		return 0, err
+	}
+
+	padding := strings.Count(data[max(len(data)-2, 0):], "=")
+	size := int64(base64.StdEncoding.DecodedLen(len(data)) - padding - sealOverhead)
+	if size < 0 {
+		return 0, fmt.Errorf("invalid encrypted data size: %v", size)
+	}
+
+	return size, nil
+}
+
+// adjustKeySize cuts the key to the size. It is used only to read the
+// legacy AES-128 records.
+func adjustKeySize(originalKey []byte, desiredSize int) []byte {
+	// Если исходный ключ больше желаемого размера, обрезаем его
+	if len(originalKey) > desiredSize {
+		return originalKey[:desiredSize]
+	}
+
+	return originalKey
+}
@@ -0,0 +1,340 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestCipherRoundTrip(t *testing.T) {
+	mk := MasterKey{Key: "1234567812345678"}
+	data := []byte("secret data \x00\xff")
+
+	for _, algorithm := range []string{AlgorithmAESGCM, AlgorithmChaCha20Poly1305} {
+		t.Run(algorithm, func(t *testing.T) {
+			c, err := GetCipher(algorithm)
+			assert.NoError(t, err)
+
+			encData, encKey, err := encryptionData(c, mk, data, nil)
+			assert.NoError(t, err)
+			assert.NotContains(t, encData, string(data))
+
+			decData, err := decryptionData(c, mk, encKey, encData, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, data, decData)
+
+			// The data can't be read with another master key
+			_, err = decryptionData(c, MasterKey{Key: "8765432187654321"}, encKey, encData, nil)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCipherMixedRecords(t *testing.T) {
+	mk := MasterKey{Key: "1234567812345678"}
+
+	aes, err := GetCipher(AlgorithmAESGCM)
+	assert.NoError(t, err)
+	chacha, err := GetCipher(AlgorithmChaCha20Poly1305)
+	assert.NoError(t, err)
+
+	encData, encKey, err := encryptionData(chacha, mk, []byte("data"), nil)
+	assert.NoError(t, err)
+
+	// A record is only readable with the algorithm it was written with
+	_, err = decryptionData(aes, mk, encKey, encData, nil)
+	assert.Error(t, err)
+
+	h := StorageHandler{MasterKey: mk.Key, Algorithm: AlgorithmAESGCM}
+	data, err := h.decrypt(&domain.Storage{Value: encData, Key: encKey, Algorithm: AlgorithmChaCha20Poly1305})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("data"), data)
+}
+
+func TestDecryptWrongMasterKey(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmAESGCM, AlgorithmChaCha20Poly1305} {
+		t.Run(algorithm, func(t *testing.T) {
+			written := StorageHandler{MasterKey: "1234567812345678", Algorithm: algorithm, EncryptNames: true}
+
+			rec := &domain.Storage{ID: 7, Owner: 1, Name: "bank"}
+			assert.NoError(t, written.encrypt(rec, []byte("data")))
+			assert.NoError(t, written.sealName(rec))
+
+			// The record is read by a server with another master key
+			s := StorageHandler{MasterKey: "8765432187654321", Logger: zap.NewNop()}
+
+			_, err := s.decrypt(rec)
+			assert.ErrorIs(t, err, ErrMasterKeyMismatch)
+			assert.Equal(t, "record could not be decrypted — master key may be incorrect", s.decryptError(rec.ID, err))
+
+			assert.ErrorIs(t, s.openName(rec), ErrMasterKeyMismatch)
+
+			// Tampered data fails the authentication too
+			tampered := *rec
+			tampered.Value = rec.Value[:len(rec.Value)-4] + "AAA="
+			_, err = written.decrypt(&tampered)
+			assert.ErrorIs(t, err, ErrMasterKeyMismatch)
+		})
+	}
+
+	// Malformed data is not an authentication failure
+	s := StorageHandler{MasterKey: "1234567812345678", Logger: zap.NewNop()}
+	_, err := s.decrypt(&domain.Storage{Value: "broken", Key: "broken"})
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrMasterKeyMismatch)
+	assert.Equal(t, "failed decrypt data", s.decryptError(1, err))
+}
+
+func TestDecryptMalformed(t *testing.T) {
+	mk := MasterKey{Key: "1234567812345678"}
+	malformed := []string{"", "abc", "*", "abc*", "*abc", "a*b*c", "!!!*abc", "abc*!!!", "AAAA*AAAA"}
+
+	for _, algorithm := range []string{AlgorithmAESGCM, AlgorithmChaCha20Poly1305} {
+		t.Run(algorithm, func(t *testing.T) {
+			c, err := GetCipher(algorithm)
+			require.NoError(t, err)
+
+			// A valid data key, so the data itself is opened
+			_, encKey, err := encryptionData(c, mk, []byte("data"), nil)
+			require.NoError(t, err)
+
+			s := StorageHandler{MasterKey: mk.Key, Logger: zap.NewNop()}
+			for _, value := range malformed {
+				_, err := s.decrypt(&domain.Storage{Value: value, Key: encKey, Algorithm: algorithm})
+				assert.ErrorIs(t, err, errMalformedCiphertext, value)
+				assert.NotErrorIs(t, err, ErrMasterKeyMismatch, value)
+				assert.Equal(t, "failed decrypt data", s.decryptError(1, err))
+
+				_, err = s.decrypt(&domain.Storage{Value: value, Key: value, Algorithm: algorithm})
+				assert.ErrorIs(t, err, errMalformedCiphertext, value)
+			}
+		})
+	}
+}
+
+func TestGetCipher(t *testing.T) {
+	c, err := GetCipher("")
+	assert.NoError(t, err)
+	assert.Equal(t, aesGCM{}, c)
+
+	_, err = GetCipher("des")
+	assert.Error(t, err)
+}
+
+func TestAES256FullKey(t *testing.T) {
+	c, err := GetCipher(AlgorithmAESGCM)
+	require.NoError(t, err)
+
+	mk := MasterKey{Key: "1234567812345678abcdefghabcdefgh"}
+	data := []byte("secret data")
+
+	encData, encKey, err := encryptionData(c, mk, data, nil)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encData, aesVersionMarker))
+	assert.True(t, strings.HasPrefix(encKey, aesVersionMarker))
+
+	decData, err := decryptionData(c, mk, encKey, encData, nil)
+	require.NoError(t, err)
+	assert.Equal(t, data, decData)
+
+	// A key differing only in its last 16 bytes is another key
+	_, err = decryptionData(c, MasterKey{Key: "1234567812345678abcdefghabcdefgX"}, encKey, encData, nil)
+	assert.ErrorIs(t, err, ErrMasterKeyMismatch)
+	_, err = decryptionData(c, MasterKey{Key: "1234567812345678"}, encKey, encData, nil)
+	assert.ErrorIs(t, err, ErrMasterKeyMismatch)
+
+	// The data key has 256 bits
+	key, err := c.Decrypt([]byte(mk.Key), encKey, nil)
+	require.NoError(t, err)
+	assert.Len(t, key, 32)
+
+	// A short key is rejected, not padded
+	_, err = c.Encrypt([]byte("short"), data, nil)
+	assert.ErrorContains(t, err, "AES key is too short")
+}
+
+func TestAESLegacyRecords(t *testing.T) {
+	// A record written before the version marker: AES-128 with the
+	// master key cut to 16 bytes and a 16-byte data key
+	mk := MasterKey{Key: "1234567812345678abcdefghabcdefgh"}
+	legacy, err := aesGCM{}.legacyAEAD([]byte(mk.Key))
+	require.NoError(t, err)
+
+	key := []byte("8765432187654321")
+	encKey, err := seal(legacy, key, nil)
+	require.NoError(t, err)
+
+	dataAEAD, err := aesGCM{}.legacyAEAD(key)
+	require.NoError(t, err)
+	encData, err := seal(dataAEAD, []byte("old data"), nil)
+	require.NoError(t, err)
+
+	h := StorageHandler{MasterKey: mk.Key, Algorithm: AlgorithmAESGCM}
+	rec := &domain.Storage{ID: 7, Owner: 1, Value: encData, Key: encKey, Algorithm: AlgorithmAESGCM}
+
+	data, err := h.decrypt(rec)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("old data"), data)
+
+	// Re-encryption moves the record to AES-256
+	require.NoError(t, reencrypt(rec, h, AlgorithmAESGCM))
+	assert.True(t, strings.HasPrefix(rec.Value, aesVersionMarker))
+	assert.True(t, strings.HasPrefix(rec.Key, aesVersionMarker))
+
+	data, err = h.decrypt(rec)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("old data"), data)
+}
+
+func TestReencrypt(t *testing.T) {
+	mk := "1234567812345678"
+
+	for _, encryptNames := range []bool{false, true} {
+		from := StorageHandler{MasterKey: mk, Algorithm: AlgorithmAESGCM, EncryptNames: encryptNames}
+
+		rec := &domain.Storage{ID: 7, Owner: 1, Name: "bank"}
+		assert.NoError(t, from.encrypt(rec, []byte("data")))
+		key := rec.Key
+		assert.NoError(t, from.sealName(rec))
+
+		assert.NoError(t, reencrypt(rec, from, AlgorithmChaCha20Poly1305))
+		assert.Equal(t, AlgorithmChaCha20Poly1305, rec.Algorithm)
+		assert.Equal(t, encryptNames, rec.NameEncrypted)
+		assert.NotEqual(t, key, rec.Key)
+
+		// The record is readable with the new algorithm only
+		chacha, err := GetCipher(AlgorithmChaCha20Poly1305)
+		assert.NoError(t, err)
+		data, err := decryptionData(chacha, MasterKey{Key: mk}, rec.Key, rec.Value, recordAAD(rec))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("data"), data)
+
+		aes, err := GetCipher(AlgorithmAESGCM)
+		assert.NoError(t, err)
+		_, err = decryptionData(aes, MasterKey{Key: mk}, rec.Key, rec.Value, recordAAD(rec))
+		assert.Error(t, err)
+
+		assert.NoError(t, from.openName(rec))
+		assert.Equal(t, "bank", rec.Name)
+	}
+
+	// A record that can't be decrypted is left as it is
+	rec := &domain.Storage{Name: "bank", Value: "broken", Key: "broken", Algorithm: AlgorithmAESGCM}
+	assert.Error(t, reencrypt(rec, StorageHandler{MasterKey: mk}, AlgorithmChaCha20Poly1305))
+	assert.Equal(t, AlgorithmAESGCM, rec.Algorithm)
+}
+
+func TestRecordBinding(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmAESGCM, AlgorithmChaCha20Poly1305} {
+		t.Run(algorithm, func(t *testing.T) {
+			s := StorageHandler{MasterKey: "1234567812345678", Algorithm: algorithm, EncryptNames: true, Logger: zap.NewNop()}
+
+			rec := &domain.Storage{ID: 7, Owner: 1, Name: "bank"}
+			assert.NoError(t, s.encrypt(rec, []byte("data")))
+			assert.NoError(t, s.sealName(rec))
+			assert.True(t, rec.Bound)
+
+			data, err := s.decrypt(rec)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("data"), data)
+
+			// The ciphertext copied into another record fails the authentication
+			moved := *rec
+			moved.ID = 8
+			_, err = s.decrypt(&moved)
+			assert.ErrorIs(t, err, ErrMasterKeyMismatch)
+			assert.ErrorIs(t, s.openName(&moved), ErrMasterKeyMismatch)
+
+			// The record given to another owner fails it too
+			stolen := *rec
+			stolen.Owner = 2
+			_, err = s.decrypt(&stolen)
+			assert.ErrorIs(t, err, ErrMasterKeyMismatch)
+
+			// The records written before the binding stay readable
+			c, err := GetCipher(algorithm)
+			assert.NoError(t, err)
+			value, key, err := encryptionData(c, s.primaryKey(), []byte("old"), nil)
+			assert.NoError(t, err)
+			data, err = s.decrypt(&domain.Storage{ID: 9, Owner: 1, Value: value, Key: key, Algorithm: algorithm})
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("old"), data)
+
+			// A transfer binds the record to the new owner
+			transferred := *rec
+			assert.NoError(t, rebind(&transferred, s, 2))
+			assert.Equal(t, 2, transferred.Owner)
+			assert.Equal(t, algorithm, transferred.Algorithm)
+			data, err = s.decrypt(&transferred)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("data"), data)
+			assert.NoError(t, s.openName(&transferred))
+			assert.Equal(t, "bank", transferred.Name)
+		})
+	}
+}
+
+func TestMasterKeyRotation(t *testing.T) {
+	before := StorageHandler{MasterKey: "1234567812345678", EncryptNames: true, Logger: zap.NewNop()}
+	rotated := StorageHandler{
+		MasterKey:    "8765432187654321",
+		MasterKeyID:  "2024",
+		MasterKeys:   map[string]string{"": before.MasterKey},
+		EncryptNames: true,
+		Logger:       zap.NewNop(),
+	}
+
+	old := &domain.Storage{ID: 7, Owner: 1, Name: "bank"}
+	assert.NoError(t, before.encrypt(old, []byte("old")))
+	assert.NoError(t, before.sealName(old))
+	assert.Empty(t, old.KeyID)
+
+	// The new records are written with the primary key
+	rec := &domain.Storage{ID: 8, Owner: 1, Name: "mail"}
+	assert.NoError(t, rotated.encrypt(rec, []byte("new")))
+	assert.NoError(t, rotated.sealName(rec))
+	assert.Equal(t, "2024", rec.KeyID)
+
+	// Both are read with the keys they were written with
+	for _, r := range []struct {
+		rec  *domain.Storage
+		data string
+		name string
+	}{{old, "old", "bank"}, {rec, "new", "mail"}} {
+		read := *r.rec
+		data, err := rotated.decrypt(&read)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(r.data), data)
+		assert.NoError(t, rotated.openName(&read))
+		assert.Equal(t, r.name, read.Name)
+	}
+
+	// A server without the key of the record can't read it
+	_, err := before.decrypt(rec)
+	assert.ErrorIs(t, err, ErrMasterKeyMismatch)
+	assert.ErrorIs(t, err, errUnknownMasterKey)
+	assert.ErrorIs(t, before.openName(rec), errUnknownMasterKey)
+
+	// The key ID of a record can't be changed in BD
+	relabeled := *rec
+	relabeled.KeyID = "copy"
+	copied := rotated
+	copied.MasterKeys = map[string]string{"copy": rotated.MasterKey}
+	_, err = copied.decrypt(&relabeled)
+	assert.ErrorIs(t, err, ErrMasterKeyMismatch)
+
+	// The old record is migrated to the primary key
+	assert.NoError(t, reencrypt(old, rotated, DefaultAlgorithm))
+	assert.Equal(t, "2024", old.KeyID)
+
+	migrated := StorageHandler{MasterKey: rotated.MasterKey, MasterKeyID: rotated.MasterKeyID}
+	data, err := migrated.decrypt(old)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("old"), data)
+	assert.NoError(t, migrated.openName(old))
+	assert.Equal(t, "bank", old.Name)
+}
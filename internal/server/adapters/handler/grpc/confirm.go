@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultConfirmationTTL is the time a challenge to confirm the read of a
+// record is accepted for.
+var defaultConfirmationTTL = 2 * time.Minute
+
+// confirmationChallenge returns the challenge the client re-sends to confirm
+// the read of a record. It is bound to the user and the record and expires
+// after the TTL, so it can't confirm the read of another record.
+func (s StorageHandler) confirmationChallenge(user int, record int, now time.Time) string {
+	expiry := strconv.FormatInt(now.Add(s.confirmationTTL()).Unix(), 10)
+
+	return expiry + "." + s.signChallenge(user, record, expiry)
+}
+
+// checkConfirmation checks the confirmation of the read of a record is a
+// challenge issued for the user and the record, that has not expired.
+func (s StorageHandler) checkConfirmation(confirmation string, user int, record int, now time.Time) error {
+	expiry, sign, ok := strings.Cut(confirmation, ".")
+	if !ok {
+		return fmt.Errorf("malformed confirmation")
+	}
+
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return fmt.Errorf("malformed confirmation expiry: %w", err)
+	}
+
+	if !hmac.Equal([]byte(sign), []byte(s.signChallenge(user, record, expiry))) {
+		return fmt.Errorf("confirmation not issued for the record")
+	}
+
+	if now.After(time.Unix(unix, 0)) {
+		return fmt.Errorf("confirmation expired")
+	}
+
+	return nil
+}
+
+// signChallenge returns the HMAC of the challenge keyed by the master key.
+func (s StorageHandler) signChallenge(user int, record int, expiry string) string {
+	mac := hmac.New(sha256.New, []byte(s.MasterKey))
+	fmt.Fprintf(mac, "confirm:%d:%d:%s", user, record, expiry)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// confirmationTTL returns the time a challenge is accepted for.
+func (s StorageHandler) confirmationTTL() time.Duration {
+	if s.ConfirmationTTL == 0 {
+		return defaultConfirmationTTL
+	}
+
+	return s.ConfirmationTTL
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfirmationChallenge(t *testing.T) {
+	s := StorageHandler{MasterKey: "master", ConfirmationTTL: time.Minute}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	challenge := s.confirmationChallenge(1, 7, now)
+	assert.NoError(t, s.checkConfirmation(challenge, 1, 7, now.Add(30*time.Second)))
+
+	tests := []struct {
+		name         string
+		confirmation string
+		user         int
+		record       int
+		now          time.Time
+	}{
+		{name: "Expired", confirmation: challenge, user: 1, record: 7, now: now.Add(2 * time.Minute)},
+		{name: "Other record", confirmation: challenge, user: 1, record: 8, now: now},
+		{name: "Other user", confirmation: challenge, user: 2, record: 7, now: now},
+		{name: "Other key", confirmation: StorageHandler{MasterKey: "other"}.confirmationChallenge(1, 7, now), user: 1, record: 7, now: now},
+		{name: "Empty", confirmation: "", user: 1, record: 7, now: now},
+		{name: "Malformed", confirmation: "abc.def", user: 1, record: 7, now: now},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, s.checkConfirmation(tt.confirmation, tt.user, tt.record, tt.now))
+		})
+	}
+}
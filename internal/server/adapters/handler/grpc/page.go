@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxPageSize is the maximum number of records of a ReadAllRecord page,
+// larger page sizes are reduced to it.
+var maxPageSize = 1000
+
+// ErrInvalidPageToken is returned when the page token was not issued by the server.
+var ErrInvalidPageToken = status.Error(codes.InvalidArgument, "invalid page token")
+
+// sortedPageToken is the token of a page of records with a sort other than by
+// ascending ID. It is bound to the sort it was issued for.
+type sortedPageToken struct {
+	Sort   string   `json:"s"`
+	ID     int      `json:"id"`
+	Values []string `json:"v,omitempty"`
+}
+
+// encodePageToken returns the opaque token of the page following the cursor.
+// The token of the records ordered by ID is the ID of the last record.
+func encodePageToken(sort domain.RecordSort, after domain.PageCursor) string {
+	data := []byte(strconv.Itoa(after.ID))
+	if len(sort.Keys) > 0 || sort.Desc {
+		// Marshaling the strings and ints can't fail
+		data, _ = json.Marshal(sortedPageToken{Sort: sort.String(), ID: after.ID, Values: after.Values})
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodePageToken returns the cursor the page starts after. An empty token
+// is the first page. The token must be issued for the same sort.
+func decodePageToken(token string, sort domain.RecordSort) (domain.PageCursor, error) {
+	if token == "" {
+		return domain.PageCursor{}, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return domain.PageCursor{}, fmt.Errorf("failed decode page token: %w", err)
+	}
+
+	if len(sort.Keys) == 0 && !sort.Desc {
+		id, err := strconv.Atoi(string(b))
+		if err != nil || id < 0 {
+			return domain.PageCursor{}, fmt.Errorf("failed parse page token: %s", b)
+		}
+
+		return domain.PageCursor{ID: id}, nil
+	}
+
+	var t sortedPageToken
+	if err := json.Unmarshal(b, &t); err != nil {
+		return domain.PageCursor{}, fmt.Errorf("failed parse page token: %w", err)
+	}
+
+	if t.Sort != sort.String() || t.ID <= 0 {
+		return domain.PageCursor{}, fmt.Errorf("page token of other sort: %s", t.Sort)
+	}
+
+	after := domain.PageCursor{ID: t.ID, Values: t.Values}
+	if _, err := sort.CursorValues(after); err != nil {
+		return domain.PageCursor{}, fmt.Errorf("failed parse page token: %w", err)
+	}
+
+	return after, nil
+}
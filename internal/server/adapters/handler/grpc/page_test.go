@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageToken(t *testing.T) {
+	byID := domain.RecordSort{}
+
+	after, err := decodePageToken(encodePageToken(byID, domain.PageCursor{ID: 42}), byID)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.PageCursor{ID: 42}, after)
+
+	after, err = decodePageToken("", byID)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.PageCursor{}, after)
+
+	for _, token := range []string{"!!!", base64.RawURLEncoding.EncodeToString([]byte("abc")), encodePageToken(byID, domain.PageCursor{ID: -1})} {
+		_, err := decodePageToken(token, byID)
+		assert.Error(t, err, token)
+	}
+}
+
+func TestSortedPageToken(t *testing.T) {
+	sort, err := domain.ParseRecordSort("type,created_at", true)
+	assert.NoError(t, err)
+
+	rec := &domain.Storage{ID: 7, Type: "text", CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC)}
+	token := encodePageToken(sort, sort.Cursor(rec))
+
+	after, err := decodePageToken(token, sort)
+	assert.NoError(t, err)
+	assert.Equal(t, sort.Cursor(rec), after)
+
+	values, err := sort.CursorValues(after)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"text", rec.CreatedAt, 7}, values)
+
+	// The token is bound to the sort it was issued for
+	for _, other := range []domain.RecordSort{{}, {Keys: sort.Keys}, {Keys: []string{domain.SortType}, Desc: true}} {
+		_, err := decodePageToken(token, other)
+		assert.Error(t, err, other.String())
+	}
+
+	_, err = decodePageToken(encodePageToken(sort, domain.PageCursor{ID: 7, Values: []string{"text", "yesterday"}}), sort)
+	assert.Error(t, err)
+}
+
+func TestParseRecordSort(t *testing.T) {
+	sort, err := domain.ParseRecordSort(" last_accessed , name", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{domain.SortLastAccessed, domain.SortName}, sort.Keys)
+
+	for _, keys := range []string{"id", "name; DROP TABLE storages", "name,name", "owner", ","} {
+		_, err := domain.ParseRecordSort(keys, false)
+		assert.ErrorIs(t, err, domain.ErrInvalidSort, keys)
+	}
+}
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported algorithms of the password hashes.
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+)
+
+// argon2idPrefix starts the argon2id hashes, bcrypt hashes start with `$2`.
+const argon2idPrefix = "$" + HashArgon2id + "$"
+
+// Default parameters of the argon2id password hashes.
+var (
+	defaultArgonTime    uint32 = 1
+	defaultArgonMemory  uint32 = 64 * 1024
+	defaultArgonThreads uint8  = 4
+)
+
+// Sizes of the salt and the key of the argon2id password hashes in bytes.
+var (
+	passwordSaltSize = 16
+	passwordKeySize  = 32
+)
+
+// errPasswordMismatch means the password is not the one of the hash.
+var errPasswordMismatch = errors.New("password does not match the hash")
+
+// PasswordHasher hashes the passwords of the users with the configured
+// algorithm, bcrypt by default. The hashes of both algorithms are verified,
+// so the existing bcrypt hashes keep working after switching to argon2id.
+// Argon2id hashes are stored in the PHC format with their parameters:
+// `$argon2id$v=19$m=65536,t=1,p=4$<salt>$<key>`.
+type PasswordHasher struct {
+	Algorithm string
+	// Parameters of argon2id, the memory is in KiB. Zero means the default.
+	ArgonTime    uint32
+	ArgonMemory  uint32
+	ArgonThreads uint8
+}
+
+// Validate checks the algorithm is supported.
+func (p PasswordHasher) Validate() error {
+	switch p.Algorithm {
+	case "", HashBcrypt, HashArgon2id:
+		return nil
+	default:
+		return fmt.Errorf("unknown password hash algorithm: %s", p.Algorithm)
+	}
+}
+
+// Hash returns the hash of the password with the configured algorithm.
+func (p PasswordHasher) Hash(password string) (string, error) {
+	if p.Algorithm != HashArgon2id {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return "", fmt.Errorf("failed get bcrypt hash: %w", err)
+		}
+
+		return string(hash), nil
+	}
+
+	salt, err := generateRandom(passwordSaltSize)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+
+	t, m, threads := p.argonParams()
+	key := argon2.IDKey([]byte(password), salt, t, m, threads, uint32(passwordKeySize))
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, m, t, threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify checks the password matches the hash of any supported algorithm.
+func (p PasswordHasher) Verify(hash string, password string) error {
+	if !strings.HasPrefix(hash, argon2idPrefix) {
+		//nolint:wrapcheck // This legal return
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	}
+
+	h, err := parseArgon2idHash(hash)
+	if err != nil {
+		return err
+	}
+
+	key := argon2.IDKey([]byte(password), h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+	if subtle.ConstantTimeCompare(key, h.key) != 1 {
+		return errPasswordMismatch
+	}
+
+	return nil
+}
+
+// NeedsRehash reports whether the hash should be replaced by a hash with the
+// configured algorithm, i.e. it is a bcrypt hash or an argon2id hash with
+// other parameters when argon2id is configured. Argon2id hashes are never
+// downgraded to bcrypt.
+func (p PasswordHasher) NeedsRehash(hash string) bool {
+	if p.Algorithm != HashArgon2id {
+		return false
+	}
+
+	h, err := parseArgon2idHash(hash)
+	if err != nil {
+		return true
+	}
+
+	t, m, threads := p.argonParams()
+
+	return h.time != t || h.memory != m || h.threads != threads
+}
+
+// argonParams returns the argon2id parameters with the defaults.
+func (p PasswordHasher) argonParams() (uint32, uint32, uint8) {
+	t, m, threads := p.ArgonTime, p.ArgonMemory, p.ArgonThreads
+	if t == 0 {
+		t = defaultArgonTime
+	}
+	if m == 0 {
+		m = defaultArgonMemory
+	}
+	if threads == 0 {
+		threads = defaultArgonThreads
+	}
+
+	return t, m, threads
+}
+
+// argon2idHash is a decoded argon2id hash.
+type argon2idHash struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// parseArgon2idHash decodes an argon2id hash in the PHC format.
+func parseArgon2idHash(hash string) (argon2idHash, error) {
+	var h argon2idHash
+
+	parts := strings.Split(hash, "$")
+	//nolint:gomnd // This legal number
+	if len(parts) != 6 || parts[1] != HashArgon2id {
+		return h, errors.New("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return h, fmt.Errorf("unsupported argon2id version: %s", parts[2])
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads); err != nil {
+		return h, fmt.Errorf("malformed argon2id parameters: %w", err)
+	}
+
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return h, fmt.Errorf("failed decode base64: %w", err)
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return h, fmt.Errorf("failed decode base64: %w", err)
+	}
+	if len(h.key) == 0 || h.threads == 0 {
+		return h, errors.New("malformed argon2id hash")
+	}
+
+	return h, nil
+}
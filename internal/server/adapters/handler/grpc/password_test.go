@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/Renal37/goph-keeper/internal/server/core/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// testArgon keeps the argon2id hashes of the tests cheap.
+var testArgon = PasswordHasher{Algorithm: HashArgon2id, ArgonTime: 1, ArgonMemory: 1024, ArgonThreads: 1}
+
+func TestPasswordHasher(t *testing.T) {
+	bcryptHash, err := PasswordHasher{}.Hash("secret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(bcryptHash, "$2"))
+
+	argonHash, err := testArgon.Hash("secret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(argonHash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+	// Both hashes verify with any configured algorithm
+	for _, p := range []PasswordHasher{{}, testArgon} {
+		for _, hash := range []string{bcryptHash, argonHash} {
+			assert.NoError(t, p.Verify(hash, "secret"))
+			assert.Error(t, p.Verify(hash, "wrong"))
+		}
+	}
+
+	// Argon2id has no 72 bytes limit of bcrypt
+	long := strings.Repeat("a", 72)
+	longHash, err := testArgon.Hash(long + "1")
+	require.NoError(t, err)
+	assert.Error(t, testArgon.Verify(longHash, long+"2"))
+
+	assert.Error(t, testArgon.Verify("$argon2id$v=19$m=1024$salt$key", "secret"))
+	assert.Error(t, testArgon.Verify("$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$a2V5", "secret"))
+
+	assert.False(t, PasswordHasher{}.NeedsRehash(bcryptHash))
+	assert.False(t, PasswordHasher{}.NeedsRehash(argonHash))
+	assert.True(t, testArgon.NeedsRehash(bcryptHash))
+	assert.False(t, testArgon.NeedsRehash(argonHash))
+
+	stronger := testArgon
+	stronger.ArgonTime = 2
+	assert.True(t, stronger.NeedsRehash(argonHash))
+
+	assert.NoError(t, testArgon.Validate())
+	assert.Error(t, PasswordHasher{Algorithm: "md5"}.Validate())
+}
+
+func TestLoginUpgradesPasswordHash(t *testing.T) {
+	ctx := context.Background()
+
+	bcryptHash, err := PasswordHasher{}.Hash("secret")
+	require.NoError(t, err)
+
+	repo := &userRepo{}
+	_, err = repo.CreateUser("alice", bcryptHash)
+	require.NoError(t, err)
+
+	h := UserHandler{
+		Svc:       *services.NewUserService(repo),
+		Logger:    zap.NewNop(),
+		JWTkey:    "12345",
+		Passwords: testArgon,
+	}
+
+	// A wrong password keeps the hash
+	r, err := h.Login(ctx, &proto.LoginRequest{Login: "alice", Password: "wrong"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, r.Error)
+	assert.Equal(t, bcryptHash, repo.users[0].Hash)
+
+	r, err = h.Login(ctx, &proto.LoginRequest{Login: "alice", Password: "secret"})
+	require.NoError(t, err)
+	assert.Empty(t, r.Error)
+	assert.True(t, strings.HasPrefix(repo.users[0].Hash, "$argon2id$"))
+
+	// The upgraded hash verifies, it is not replaced again
+	upgraded := repo.users[0].Hash
+	r, err = h.Login(ctx, &proto.LoginRequest{Login: "alice", Password: "secret"})
+	require.NoError(t, err)
+	assert.Empty(t, r.Error)
+	assert.Equal(t, upgraded, repo.users[0].Hash)
+}
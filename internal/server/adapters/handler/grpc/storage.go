@@ -4,33 +4,109 @@ package handler
 import (
 	"bytes"
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
+	"github.com/Renal37/goph-keeper/internal/server/adapters/webhook"
 	"github.com/Renal37/goph-keeper/internal/server/core/domain"
 	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
 	"github.com/Renal37/goph-keeper/internal/server/core/services"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type StorageHandler struct {
 	proto.UnimplementedStorageServer
-	Svc       services.StorageService
-	Logger    *zap.Logger
-	MasterKey string
+	Svc    services.StorageService
+	Logger *zap.Logger
+	// MasterKey encrypts the data keys of the written records. Its ID is
+	// stored with every record, empty for the key used before the IDs.
+	MasterKey   string
+	MasterKeyID string
+	// MasterKeys are the previous master keys by their IDs, kept to read the
+	// records written with them until they are re-encrypted.
+	MasterKeys map[string]string
+	// IdempotencyTTL is the window during which a repeated idempotency key
+	// returns the already written record. Zero means defaultIdempotencyTTL.
+	IdempotencyTTL time.Duration
+	// ReauthWindow is how recently the user must have entered the password
+	// to read or delete a record. Zero disables the check.
+	ReauthWindow time.Duration
+	// ConfirmationTTL is the time a challenge to confirm the read of a
+	// record is accepted for. Zero means defaultConfirmationTTL.
+	ConfirmationTTL time.Duration
+	// MaxNameLength is the maximum length of a record name in characters.
+	// Zero means domain.DefaultMaxNameLength.
+	MaxNameLength int
+	// MaxRecordSize is the maximum size of the data of a record in bytes.
+	// Zero means domain.DefaultMaxRecordSize.
+	MaxRecordSize int64
+	// Notifier posts the events of reading and writing records to the
+	// webhooks of the users. Nil disables the events.
+	Notifier *webhook.Notifier
+	// Algorithm encrypts the written records. Empty means DefaultAlgorithm.
+	Algorithm string
+	// EncryptNames encrypts the names of the written records with their
+	// data keys, so the names are not stored in plaintext.
+	EncryptNames bool
+	// ReadOnlyMode blocks changes of records during maintenance. Nil means
+	// the changes are always allowed.
+	ReadOnlyMode *ReadOnlyMode
+	// AccessLog logs an event for every successfully read record at the
+	// level: AccessLogInfo or AccessLogWarn. Empty disables the events.
+	AccessLog string
+	// RecordIDs is the scheme of the record IDs shown to the clients, empty
+	// means domain.RecordIDsInt. With domain.RecordIDsUUID the records are
+	// addressed only by their UUIDs.
+	RecordIDs string
 }
 
 var errorInvalidToken = "invalid token"
+
+// ErrReauthRequired is returned by sensitive calls when the user entered
+// the password too long ago. The client should ask for the password again.
+var ErrReauthRequired = status.Error(codes.Unauthenticated, "reauthentication required")
+
+// ErrRecordUIDRequired is returned for a record addressed by its sequential
+// ID when the server uses UUID record IDs.
+var ErrRecordUIDRequired = status.Error(codes.InvalidArgument, "records are addressed by UUID, set the uid")
+
+// ErrInvalidRecordUID is returned for a record addressed by a malformed UUID.
+var ErrInvalidRecordUID = status.Error(codes.InvalidArgument, "invalid record UUID")
+
+// ErrNotTeamMember is returned when a record is written to a team the user is not a member of.
+var ErrNotTeamMember = status.Error(codes.PermissionDenied, domain.ErrNotTeamMember.Error())
+
+// ErrServerReadOnly is returned by calls changing records when the server is in the read-only mode.
+var ErrServerReadOnly = status.Error(codes.FailedPrecondition, "server in read-only mode")
+
 var errorCloseStream = "failed close stream: %w"
+var defaultIdempotencyTTL = 24 * time.Hour
+
+// ErrNameFilterEncrypted is returned when the records are filtered by the name, but the names are encrypted.
+var ErrNameFilterEncrypted = status.Error(codes.InvalidArgument, "names are encrypted and can't be filtered")
+
+// ErrNameSortEncrypted is returned when the records are sorted by the name, but the names are encrypted.
+var ErrNameSortEncrypted = status.Error(codes.InvalidArgument, "names are encrypted and can't be sorted")
 
-// ReadAllRecord read all record from BD.
+// maxReadRecords is the maximum number of records read by one ReadRecords call.
+var maxReadRecords = 100
+
+// ReadAllRecord read all record from BD. With a page size the records are
+// returned in pages ordered by ID, the response of a page that may be
+// followed by more records has the token of the next page. The records can
+// be filtered by the category, type, tags, a part of the name and a folder
+// with its nested folders, and sorted by the allowed keys, otherwise they are
+// ordered by ID.
 func (s StorageHandler) ReadAllRecord(ctx context.Context, in *proto.ReadAllRecordRequest) (*proto.ReadAllRecordResponse, error) {
 	var resp proto.ReadAllRecordResponse
 
@@ -42,8 +118,49 @@ func (s StorageHandler) ReadAllRecord(ctx context.Context, in *proto.ReadAllReco
 		return &resp, nil
 	}
 
+	if in.PageSize < 0 {
+		//nolint:wrapcheck // This legal return
+		return nil, status.Error(codes.InvalidArgument, "negative page size")
+	}
+
+	if in.Name != "" && s.EncryptNames {
+		return nil, ErrNameFilterEncrypted
+	}
+
+	if err := domain.ValidateFolder(in.Folder); err != nil {
+		//nolint:wrapcheck // This legal return
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	filter := domain.RecordFilter{Category: in.Category, Type: in.Type, Tags: in.Tags, Name: in.Name, Folder: in.Folder}
+
+	sort, err := domain.ParseRecordSort(in.Sort, in.Desc)
+	if err != nil {
+		//nolint:wrapcheck // This legal return
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if sort.Has(domain.SortName) && s.EncryptNames {
+		return nil, ErrNameSortEncrypted
+	}
+
 	// Get data from BD
-	rec, err := s.Svc.ReadAllRecord(token.ID)
+	var rec []*domain.Storage
+	if in.PageSize > 0 {
+		after, tokenErr := decodePageToken(in.PageToken, sort)
+		if tokenErr != nil {
+			return nil, ErrInvalidPageToken
+		}
+
+		limit := min(int(in.PageSize), maxPageSize)
+
+		rec, err = s.Svc.ReadRecordPage(token.ID, filter, sort, after, limit)
+		if err == nil && len(rec) == limit {
+			resp.NextPageToken = encodePageToken(sort, sort.Cursor(rec[len(rec)-1]))
+		}
+	} else {
+		rec, err = s.Svc.ReadAllRecord(token.ID, filter, sort)
+	}
 	if err != nil {
 		s.Logger.With(zap.Error(err)).Error("failed get all records")
 		resp.Error = "failed get all records"
@@ -53,11 +170,26 @@ func (s StorageHandler) ReadAllRecord(ctx context.Context, in *proto.ReadAllReco
 	// Preparing response
 	respSlice := make([]*proto.StorageUnit, 0, len(rec))
 	for _, v := range rec {
+		if err := s.openName(v); err != nil {
+			s.Logger.With(zap.Error(err)).Error("failed decrypt name")
+			resp.Error = "failed decrypt name"
+			return &resp, nil
+		}
+
+		id, uid := s.publicID(v)
 		respSlice = append(respSlice, &proto.StorageUnit{
-			Id:    int32(v.ID),
-			Name:  v.Name,
-			Type:  v.Type,
-			Owner: int32(v.Owner),
+			Id:                   id,
+			Uid:                  uid,
+			Name:                 v.Name,
+			Type:                 v.Type,
+			Owner:                int32(v.Owner),
+			Category:             v.Category,
+			Folder:               v.Folder,
+			Version:              int32(v.Version),
+			Meta:                 v.Meta,
+			Team:                 int32(v.Team),
+			RequiresConfirmation: v.RequiresConfirmation,
+			MimeType:             v.MimeType,
 		})
 	}
 
@@ -65,7 +197,41 @@ func (s StorageHandler) ReadAllRecord(ctx context.Context, in *proto.ReadAllReco
 	return &resp, nil
 }
 
-// ReadRecord read single record from BD.
+// ReadCategories read record categories with counts from BD.
+func (s StorageHandler) ReadCategories(ctx context.Context, in *proto.ReadCategoriesRequest) (*proto.ReadCategoriesResponse, error) {
+	var resp proto.ReadCategoriesResponse
+
+	// Get token from context
+	token, ok := middleware.GetTokenFromContext(ctx)
+	if !ok {
+		s.Logger.Error(errorInvalidToken)
+		resp.Error = errorInvalidToken
+		return &resp, nil
+	}
+
+	// Get categories from BD
+	categories, err := s.Svc.ReadCategories(token.ID)
+	if err != nil {
+		s.Logger.With(zap.Error(err)).Error("failed get categories")
+		resp.Error = "failed get categories"
+		return &resp, nil
+	}
+
+	// Preparing response
+	resp.Categories = make([]*proto.CategoryCount, 0, len(categories))
+	for _, v := range categories {
+		resp.Categories = append(resp.Categories, &proto.CategoryCount{
+			Name:  v.Name,
+			Count: int32(v.Count),
+		})
+	}
+
+	return &resp, nil
+}
+
+// ReadRecord read single record from BD, or one of its previous versions.
+// A non-zero limit returns only the first bytes of the data, the size is
+// always the size of the whole data.
 func (s StorageHandler) ReadRecord(ctx context.Context, in *proto.ReadRecordRequest) (*proto.ReadRecordResponse, error) {
 	var resp proto.ReadRecordResponse
 
@@ -77,8 +243,22 @@ func (s StorageHandler) ReadRecord(ctx context.Context, in *proto.ReadRecordRequ
 		return &resp, nil
 	}
 
-	// Get record from BD
-	rec, err := s.Svc.ReadRecord(int(in.Id), token.ID)
+	if !s.recentlyAuthenticated(token) {
+		return nil, ErrReauthRequired
+	}
+
+	id, err := s.recordID(in.Id, in.Uid, token.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get record from BD, a non-zero version selects a previous version
+	var rec *domain.Storage
+	if in.Version != 0 {
+		rec, err = s.Svc.ReadRecordVersion(id, token.ID, int(in.Version))
+	} else {
+		rec, err = s.Svc.ReadRecord(id, token.ID)
+	}
 	if err != nil {
 		s.Logger.With(zap.Error(err)).Error("failed read record")
 		resp.Error = "failed read record"
@@ -90,26 +270,251 @@ func (s StorageHandler) ReadRecord(ctx context.Context, in *proto.ReadRecordRequ
 		return &resp, nil
 	}
 
+	// A record requiring confirmation is read in two steps, the first read
+	// only gets the challenge the client re-sends to confirm the read
+	if rec.RequiresConfirmation {
+		log := s.Logger.With(zap.Int("record_id", rec.ID), zap.Int("user_id", token.ID), zap.String("login", token.Login))
+
+		now := time.Now()
+		if err := s.checkConfirmation(in.Confirmation, token.ID, rec.ID, now); err != nil {
+			if in.Confirmation != "" {
+				log.With(zap.Error(err)).Warn("rejected confirmation of a read")
+			}
+			log.Info("read of a record requiring confirmation challenged")
+
+			resp.Id, resp.Uid = s.publicID(rec)
+			resp.ConfirmationRequired = true
+			resp.Challenge = s.confirmationChallenge(token.ID, rec.ID, now)
+			return &resp, nil
+		}
+
+		log.Warn("confirmed read of a record requiring confirmation")
+	}
+
 	// Dectyption data
-	data, err := decryptionData(s.MasterKey, rec.Key, rec.Value)
+	data, err := s.decrypt(rec)
+	if err == nil {
+		err = s.openName(rec)
+	}
 	if err != nil {
-		s.Logger.With(zap.Error(err)).Error("failed decrypt data")
-		resp.Error = "failed decrypt data"
+		resp.Error = s.decryptError(rec.ID, err)
 		return &resp, nil
 	}
 
+	s.markAccessed(rec.ID)
+	s.notify(token, webhook.EventRead, rec.ID)
+	s.logAccess(token.ID, rec.ID, rec.Version)
+
+	resp.Id, resp.Uid = s.publicID(rec)
 	resp.Name = rec.Name
 	resp.Type = rec.Type
+	resp.Category = rec.Category
+	resp.Folder = rec.Folder
+	resp.Version = int32(rec.Version)
+	resp.Meta = rec.Meta
+	resp.Size = int64(len(data))
+	resp.MimeType = rec.MimeType
+
+	// A preview gets only the beginning of the data
+	if in.Limit > 0 && len(data) > int(in.Limit) {
+		data = data[:in.Limit]
+	}
 	resp.Data = data
 
 	return &resp, nil
 }
 
+// ReadRecordMeta read the attributes of a single record from BD without its
+// data. The data is not decrypted, its size is taken from the ciphertext,
+// so the call is cheap and doesn't need a recent authentication.
+func (s StorageHandler) ReadRecordMeta(ctx context.Context, in *proto.ReadRecordMetaRequest) (*proto.ReadRecordMetaResponse, error) {
+	var resp proto.ReadRecordMetaResponse
+
+	// Get token from context
+	token, ok := middleware.GetTokenFromContext(ctx)
+	if !ok {
+		s.Logger.Error(errorInvalidToken)
+		resp.Error = errorInvalidToken
+		return &resp, nil
+	}
+
+	id, err := s.recordID(in.Id, in.Uid, token.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get record from BD
+	rec, err := s.Svc.ReadRecord(id, token.ID)
+	if err != nil {
+		s.Logger.With(zap.Error(err)).Error("failed read record")
+		resp.Error = "failed read record"
+		return &resp, nil
+	}
+
+	if rec == nil {
+		resp.Error = "record not found"
+		return &resp, nil
+	}
+
+	size, err := sealedSize(rec.Value)
+	if err == nil {
+		err = s.openName(rec)
+	}
+	if err != nil {
+		resp.Error = s.decryptError(rec.ID, err)
+		return &resp, nil
+	}
+
+	resp.Id, resp.Uid = s.publicID(rec)
+	resp.Name = rec.Name
+	resp.Type = rec.Type
+	resp.Category = rec.Category
+	resp.Folder = rec.Folder
+	resp.Version = int32(rec.Version)
+	resp.Meta = rec.Meta
+	resp.Size = size
+	resp.CreatedAt = rec.CreatedAt.Unix()
+	resp.LastAccessedAt = rec.AccessedAt.Unix()
+	resp.RequiresConfirmation = rec.RequiresConfirmation
+	resp.Team = int32(rec.Team)
+	resp.MimeType = rec.MimeType
+
+	return &resp, nil
+}
+
+// ReadRecords read several records from BD in one call. The records are
+// returned in the order of the IDs, then of the UUIDs; an ID or a UUID that
+// is not found or belongs to another user gets a record with only the ID or
+// the UUID and the error.
+func (s StorageHandler) ReadRecords(ctx context.Context, in *proto.ReadRecordsRequest) (*proto.ReadRecordsResponse, error) {
+	var resp proto.ReadRecordsResponse
+
+	// Get token from context
+	token, ok := middleware.GetTokenFromContext(ctx)
+	if !ok {
+		s.Logger.Error(errorInvalidToken)
+		resp.Error = errorInvalidToken
+		return &resp, nil
+	}
+
+	if !s.recentlyAuthenticated(token) {
+		return nil, ErrReauthRequired
+	}
+
+	if len(in.Ids)+len(in.Uids) > maxReadRecords {
+		//nolint:wrapcheck // This legal return
+		return nil, status.Errorf(codes.InvalidArgument, "too many records, the maximum is %v", maxReadRecords)
+	}
+
+	if len(in.Ids) > 0 && s.uuidIDs() {
+		return nil, ErrRecordUIDRequired
+	}
+
+	// The requested records by ID, then by UUID. An unknown UUID gets the zero ID
+	requested := make([]*proto.ReadRecordResponse, 0, len(in.Ids)+len(in.Uids))
+	ids := make([]int, 0, len(in.Ids)+len(in.Uids))
+	for _, id := range in.Ids {
+		requested = append(requested, &proto.ReadRecordResponse{Id: id})
+		ids = append(ids, int(id))
+	}
+
+	if len(in.Uids) > 0 {
+		for _, uid := range in.Uids {
+			if err := uuid.Validate(uid); err != nil {
+				return nil, ErrInvalidRecordUID
+			}
+		}
+
+		resolved, err := s.Svc.ResolveRecordUIDs(in.Uids, token.ID)
+		if err != nil {
+			s.Logger.With(zap.Error(err)).Error("failed resolve record UUIDs")
+			resp.Error = "failed read records"
+			return &resp, nil
+		}
+
+		for _, uid := range in.Uids {
+			requested = append(requested, &proto.ReadRecordResponse{Uid: uid})
+			ids = append(ids, resolved[uid])
+		}
+	}
+
+	// Get records from BD
+	recs, err := s.Svc.ReadRecords(ids, token.ID)
+	if err != nil {
+		s.Logger.With(zap.Error(err)).Error("failed read records")
+		resp.Error = "failed read records"
+		return &resp, nil
+	}
+
+	found := make(map[int]*domain.Storage, len(recs))
+	read := make([]int, 0, len(recs))
+	for i := range recs {
+		found[recs[i].ID] = &recs[i]
+		// The records requiring confirmation are only read with ReadRecord
+		if !recs[i].RequiresConfirmation {
+			read = append(read, recs[i].ID)
+		}
+	}
+
+	if len(read) > 0 {
+		s.markAccessed(read...)
+		s.notify(token, webhook.EventRead, read...)
+	}
+
+	for i, out := range requested {
+		rec, ok := found[ids[i]]
+		if !ok {
+			out.Error = "record not found"
+			resp.Records = append(resp.Records, out)
+			continue
+		}
+
+		if rec.RequiresConfirmation {
+			out.Error = "confirmation required"
+			out.ConfirmationRequired = true
+			resp.Records = append(resp.Records, out)
+			continue
+		}
+
+		// Dectyption data
+		data, err := s.decrypt(rec)
+		if err == nil {
+			err = s.openName(rec)
+		}
+		if err != nil {
+			out.Error = s.decryptError(rec.ID, err)
+			resp.Records = append(resp.Records, out)
+			continue
+		}
+
+		s.logAccess(token.ID, rec.ID, rec.Version)
+
+		out.Name = rec.Name
+		out.Type = rec.Type
+		out.Category = rec.Category
+		out.Folder = rec.Folder
+		out.Version = int32(rec.Version)
+		out.Meta = rec.Meta
+		out.Size = int64(len(data))
+		out.Data = data
+		resp.Records = append(resp.Records, out)
+	}
+
+	return &resp, nil
+}
+
 // WriteRecord write record in BD.
 func (s StorageHandler) WriteRecord(stream proto.Storage_WriteRecordServer) error {
 	var resp proto.WriteRecordResponse
 	var fileName string
 	var fileType string
+	var idempotencyKey string
+	var category string
+	var folder string
+	var meta domain.Meta
+	var team int32
+	var requiresConfirmation bool
+	var mimeType string
 
 	// For chunk
 	buffer := &bytes.Buffer{}
@@ -126,6 +531,10 @@ func (s StorageHandler) WriteRecord(stream proto.Storage_WriteRecordServer) erro
 		}
 	}
 
+	if s.ReadOnlyMode.Enabled() {
+		return ErrServerReadOnly
+	}
+
 	for {
 		chunk, err := stream.Recv()
 		if errors.Is(err, io.EOF) {
@@ -150,6 +559,34 @@ func (s StorageHandler) WriteRecord(stream proto.Storage_WriteRecordServer) erro
 			fileType = chunk.GetType()
 		}
 
+		if idempotencyKey == "" {
+			idempotencyKey = chunk.GetIdempotencyKey()
+		}
+
+		if category == "" {
+			category = chunk.GetCategory()
+		}
+
+		if folder == "" {
+			folder = chunk.GetFolder()
+		}
+
+		if meta == nil {
+			meta = chunk.GetMeta()
+		}
+
+		if team == 0 {
+			team = chunk.GetTeam()
+		}
+
+		if chunk.GetRequiresConfirmation() {
+			requiresConfirmation = true
+		}
+
+		if mimeType == "" {
+			mimeType = chunk.GetMimeType()
+		}
+
 		// Write the data to the buffer
 		if _, err := buffer.Write(chunk.GetData()); err != nil {
 			s.Logger.With(zap.Error(err)).Error("failed write chunk to buffer")
@@ -160,31 +597,97 @@ func (s StorageHandler) WriteRecord(stream proto.Storage_WriteRecordServer) erro
 				return fmt.Errorf(errorCloseStream, err)
 			}
 		}
+
+		// A too large record is rejected without receiving the rest
+		if err := domain.ValidateRecordSize(int64(buffer.Len()), s.maxRecordSize()); err != nil {
+			//nolint:wrapcheck // This legal return
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
 	}
 
-	// Encription data
-	data, key, err := encryptionData(s.MasterKey, buffer.Bytes())
+	if problems := s.validateRecord(fileName, fileType, int64(buffer.Len()), buffer.Bytes()); len(problems) > 0 {
+		//nolint:wrapcheck // This legal return
+		return status.Error(codes.InvalidArgument, strings.Join(problems, "; "))
+	}
+
+	mimeType, err := detectMimeType(fileType, mimeType, buffer.Bytes())
 	if err != nil {
-		s.Logger.With(zap.Error(err)).Error("failed encrypt data")
-		resp.Error = "failed encrypt data"
+		//nolint:wrapcheck // This legal return
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := domain.ValidateFolder(folder); err != nil {
+		//nolint:wrapcheck // This legal return
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// The ID of the record is reserved before the encryption, which is bound to it
+	id, err := s.Svc.NextRecordID()
+	if err != nil {
+		s.Logger.With(zap.Error(err)).Error("failed reserve record ID")
+		resp.Error = "failed write record"
 
 		err := stream.SendAndClose(&resp)
 		if err != nil {
 			return fmt.Errorf(errorCloseStream, err)
 		}
+
+		return nil
 	}
 
 	// Prepare record for save
 	var unit = domain.Storage{
-		Name:  fileName,
-		Type:  fileType,
-		Value: data,
-		Key:   key,
-		Owner: token.ID,
+		ID:                   id,
+		Name:                 fileName,
+		Type:                 fileType,
+		Owner:                token.ID,
+		Category:             category,
+		Folder:               folder,
+		Version:              1,
+		Meta:                 meta,
+		Team:                 int(team),
+		RequiresConfirmation: requiresConfirmation,
+		MimeType:             mimeType,
+	}
+	if s.uuidIDs() {
+		unit.UID = uuid.NewString()
+	}
+
+	// Encription data
+	if err := s.encrypt(&unit, buffer.Bytes()); err != nil {
+		s.Logger.With(zap.Error(err)).Error("failed encrypt data")
+		resp.Error = "failed encrypt data"
+
+		err := stream.SendAndClose(&resp)
+		if err != nil {
+			return fmt.Errorf(errorCloseStream, err)
+		}
+
+		return nil
+	}
+
+	if err := s.sealName(&unit); err != nil {
+		s.Logger.With(zap.Error(err)).Error("failed encrypt name")
+		resp.Error = "failed encrypt name"
+
+		err := stream.SendAndClose(&resp)
+		if err != nil {
+			return fmt.Errorf(errorCloseStream, err)
+		}
+
+		return nil
+	}
+
+	ttl := s.IdempotencyTTL
+	if ttl == 0 {
+		ttl = defaultIdempotencyTTL
 	}
 
 	// Write recorn in BD
-	err = s.Svc.WriteRecord(unit)
+	id, err = s.Svc.WriteRecord(unit, idempotencyKey, ttl)
+	if errors.Is(err, domain.ErrNotTeamMember) {
+		return ErrNotTeamMember
+	}
 	if err != nil {
 		s.Logger.With(zap.Error(err)).Error("failed write record")
 		resp.Error = "failed write record"
@@ -195,6 +698,11 @@ func (s StorageHandler) WriteRecord(stream proto.Storage_WriteRecordServer) erro
 		}
 	}
 
+	if id != 0 {
+		resp.Id, resp.Uid = s.writtenID(unit, id, token.ID)
+		s.notify(token, webhook.EventWrite, id)
+	}
+
 	// Close stream
 	err = stream.SendAndClose(&resp)
 	if err != nil {
@@ -204,6 +712,219 @@ func (s StorageHandler) WriteRecord(stream proto.Storage_WriteRecordServer) erro
 	return nil
 }
 
+// UpdateRecord replaces the data of an existing record in BD.
+// The record keeps its ID. The update is applied only if the client sent the
+// current version of the record, otherwise an `Aborted` error is returned and
+// the client should read the record again and retry.
+func (s StorageHandler) UpdateRecord(stream proto.Storage_UpdateRecordServer) error {
+	var resp proto.UpdateRecordResponse
+	var id int32
+	var uid string
+	var version int32
+	var fileName string
+	var fileType string
+
+	// For chunk
+	buffer := &bytes.Buffer{}
+
+	// Get token from context
+	token, ok := middleware.GetTokenFromContext(stream.Context())
+	if !ok {
+		s.Logger.Error(errorInvalidToken)
+		resp.Error = errorInvalidToken
+
+		return closeUpdateStream(stream, &resp)
+	}
+
+	if s.ReadOnlyMode.Enabled() {
+		return ErrServerReadOnly
+	}
+
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			s.Logger.With(zap.Error(err)).Error("failed recive chunk")
+			resp.Error = "failed recive chunk"
+
+			return closeUpdateStream(stream, &resp)
+		}
+
+		// Saving the record attributes from the first chunk
+		if id == 0 && uid == "" {
+			id = chunk.GetId()
+			uid = chunk.GetUid()
+			version = chunk.GetVersion()
+			fileName = chunk.GetName()
+			fileType = chunk.GetType()
+		}
+
+		// Write the data to the buffer
+		if _, err := buffer.Write(chunk.GetData()); err != nil {
+			s.Logger.With(zap.Error(err)).Error("failed write chunk to buffer")
+			resp.Error = "failed write chunk to buffer"
+
+			return closeUpdateStream(stream, &resp)
+		}
+	}
+
+	if problems := s.validateRecord(fileName, fileType, int64(buffer.Len()), buffer.Bytes()); len(problems) > 0 {
+		//nolint:wrapcheck // This legal return
+		return status.Error(codes.InvalidArgument, strings.Join(problems, "; "))
+	}
+
+	// The MIME type of the new data is detected again
+	mimeType, err := detectMimeType(fileType, "", buffer.Bytes())
+	if err != nil {
+		//nolint:wrapcheck // This legal return
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	recordID, err := s.recordID(id, uid, token.ID)
+	if err != nil {
+		return err
+	}
+
+	unit := domain.Storage{
+		ID:       recordID,
+		Name:     fileName,
+		Type:     fileType,
+		Owner:    token.ID,
+		MimeType: mimeType,
+	}
+
+	// Encription data
+	if err := s.encrypt(&unit, buffer.Bytes()); err != nil {
+		s.Logger.With(zap.Error(err)).Error("failed encrypt data")
+		resp.Error = "failed encrypt data"
+
+		return closeUpdateStream(stream, &resp)
+	}
+
+	if err := s.sealName(&unit); err != nil {
+		s.Logger.With(zap.Error(err)).Error("failed encrypt name")
+		resp.Error = "failed encrypt name"
+
+		return closeUpdateStream(stream, &resp)
+	}
+
+	// Update record in BD
+	newVersion, err := s.Svc.UpdateRecord(unit, int(version))
+	switch {
+	case errors.Is(err, domain.ErrVersionConflict):
+		//nolint:wrapcheck // This legal return
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, domain.ErrNotFound):
+		resp.Error = "record not found"
+
+		return closeUpdateStream(stream, &resp)
+	case err != nil:
+		s.Logger.With(zap.Error(err)).Error("failed update record")
+		resp.Error = "failed update record"
+
+		return closeUpdateStream(stream, &resp)
+	}
+
+	resp.Version = int32(newVersion)
+	s.notify(token, webhook.EventWrite, recordID)
+
+	return closeUpdateStream(stream, &resp)
+}
+
+// closeUpdateStream sends the response and closes the update stream.
+func closeUpdateStream(stream proto.Storage_UpdateRecordServer, resp *proto.UpdateRecordResponse) error {
+	if err := stream.SendAndClose(resp); err != nil {
+		return fmt.Errorf(errorCloseStream, err)
+	}
+
+	return nil
+}
+
+// UpdateMeta changes the metadata of a record in BD without touching its data.
+func (s StorageHandler) UpdateMeta(ctx context.Context, in *proto.UpdateMetaRequest) (*proto.UpdateMetaResponse, error) {
+	var resp proto.UpdateMetaResponse
+
+	// Get token from context
+	token, ok := middleware.GetTokenFromContext(ctx)
+	if !ok {
+		s.Logger.Error(errorInvalidToken)
+		resp.Error = errorInvalidToken
+		return &resp, nil
+	}
+
+	if s.ReadOnlyMode.Enabled() {
+		return nil, ErrServerReadOnly
+	}
+
+	// Update metadata
+	id, err := s.recordID(in.Id, in.Uid, token.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := s.Svc.UpdateMeta(id, token.ID, in.Meta, in.Remove, in.Replace)
+	if errors.Is(err, domain.ErrNotFound) {
+		resp.Error = "record not found"
+		return &resp, nil
+	}
+	if err != nil {
+		s.Logger.With(zap.Error(err)).Error("failed update meta")
+		resp.Error = "failed update meta"
+		return &resp, nil
+	}
+
+	resp.Meta = meta
+
+	return &resp, nil
+}
+
+// TagRecords merges the tags into the metadata of all records of the caller
+// matching the filter and sets their category in a single update, so a
+// large vault is organized without changing each record. A filter is
+// required, so a mistyped call can't change the whole vault.
+func (s StorageHandler) TagRecords(ctx context.Context, in *proto.TagRecordsRequest) (*proto.TagRecordsResponse, error) {
+	var resp proto.TagRecordsResponse
+
+	// Get token from context
+	token, ok := middleware.GetTokenFromContext(ctx)
+	if !ok {
+		s.Logger.Error(errorInvalidToken)
+		resp.Error = errorInvalidToken
+		return &resp, nil
+	}
+
+	if s.ReadOnlyMode.Enabled() {
+		return nil, ErrServerReadOnly
+	}
+
+	filter := domain.RecordFilter{Category: in.Category, Type: in.Type, Tags: in.Tags, Name: in.Name}
+	if filter.IsEmpty() {
+		//nolint:wrapcheck // This legal return
+		return nil, status.Error(codes.InvalidArgument, "filter of the records is empty")
+	}
+	if len(in.SetMeta) == 0 && in.SetCategory == "" {
+		//nolint:wrapcheck // This legal return
+		return nil, status.Error(codes.InvalidArgument, "no tags or category to set")
+	}
+	if in.Name != "" && s.EncryptNames {
+		return nil, ErrNameFilterEncrypted
+	}
+
+	updated, err := s.Svc.TagRecords(token.ID, filter, in.SetMeta, in.SetCategory)
+	if err != nil {
+		s.Logger.With(zap.Error(err)).Error("failed tag records")
+		resp.Error = "failed tag records"
+		return &resp, nil
+	}
+
+	s.Logger.Info("records tagged", zap.Int("owner", token.ID), zap.Int("updated", updated))
+	resp.Updated = int32(updated)
+
+	return &resp, nil
+}
+
 // DeleteRecord delete record from BD.
 func (s StorageHandler) DeleteRecord(ctx context.Context, in *proto.DeleteRecordRequest) (*proto.DeleteRecordResponse, error) {
 	var resp proto.DeleteRecordResponse
@@ -216,8 +937,21 @@ func (s StorageHandler) DeleteRecord(ctx context.Context, in *proto.DeleteRecord
 		return &resp, nil
 	}
 
+	if s.ReadOnlyMode.Enabled() {
+		return nil, ErrServerReadOnly
+	}
+
+	if !s.recentlyAuthenticated(token) {
+		return nil, ErrReauthRequired
+	}
+
+	id, err := s.recordID(in.Id, in.Uid, token.ID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Delete record
-	err := s.Svc.DeleteRecord(int(in.Id), token.ID)
+	err = s.Svc.DeleteRecord(id, token.ID)
 	if err != nil {
 		s.Logger.With(zap.Error(err)).Error("failed delete record")
 		resp.Error = "failed delete record"
@@ -227,116 +961,434 @@ func (s StorageHandler) DeleteRecord(ctx context.Context, in *proto.DeleteRecord
 	return &resp, nil
 }
 
-/* UTILS. */
+// TransferRecord hands a record over to another user. The record is removed
+// from the vault of the caller. The encryption of a record is bound to its
+// owner, so the record and its versions are encrypted again for the new owner.
+func (s StorageHandler) TransferRecord(ctx context.Context, in *proto.TransferRecordRequest) (*proto.TransferRecordResponse, error) {
+	var resp proto.TransferRecordResponse
 
-var sizeRandomKey = 16
+	// Get token from context
+	token, ok := middleware.GetTokenFromContext(ctx)
+	if !ok {
+		s.Logger.Error(errorInvalidToken)
+		resp.Error = errorInvalidToken
+		return &resp, nil
+	}
 
-func encryptionData(mk string, data []byte) (string, string, error) {
-	key, err := generateRandom(sizeRandomKey)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to generate random bytes: %w", err)
+	if s.ReadOnlyMode.Enabled() {
+		return nil, ErrServerReadOnly
 	}
 
-	encKey, err := encrypt([]byte(mk), key)
+	if !s.recentlyAuthenticated(token) {
+		return nil, ErrReauthRequired
+	}
+
+	id, err := s.recordID(in.Id, in.Uid, token.ID)
 	if err != nil {
-		return "", "", fmt.Errorf("failed encript key: %w", err)
+		return nil, err
+	}
+
+	// Transfer record, its encryption is bound to the new owner
+	err = s.Svc.TransferRecord(id, token.ID, in.Login, func(doc *domain.Storage, owner int) error {
+		return rebind(doc, s, owner)
+	})
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		resp.Error = "record not found"
+	case errors.Is(err, domain.ErrUserNotFound):
+		resp.Error = "user not found"
+	case err != nil:
+		s.Logger.With(zap.Error(err)).Error("failed transfer record")
+		resp.Error = "failed transfer record"
+	}
+
+	return &resp, nil
+}
+
+// ReadShares lists the records the user shared with the teams together with
+// the other members of the teams, or the records shared with the user
+// together with their owners.
+func (s StorageHandler) ReadShares(ctx context.Context, in *proto.ReadSharesRequest) (*proto.ReadSharesResponse, error) {
+	var resp proto.ReadSharesResponse
+
+	// Get token from context
+	token, ok := middleware.GetTokenFromContext(ctx)
+	if !ok {
+		s.Logger.Error(errorInvalidToken)
+		resp.Error = errorInvalidToken
+		return &resp, nil
 	}
 
-	encData, err := encrypt(key, data)
+	shares, err := s.Svc.ReadShares(token.ID, in.Incoming)
 	if err != nil {
-		return "", "", fmt.Errorf("failed encript data: %w", err)
+		s.Logger.With(zap.Error(err)).Error("failed get shares")
+		resp.Error = "failed get shares"
+		return &resp, nil
+	}
+
+	resp.Shares = make([]*proto.ShareUnit, 0, len(shares))
+	for _, v := range shares {
+		if err := s.openName(&v.Record); err != nil {
+			s.Logger.With(zap.Error(err)).Error("failed decrypt name")
+			resp.Error = "failed decrypt name"
+			return &resp, nil
+		}
+
+		id, uid := s.publicID(&v.Record)
+		resp.Shares = append(resp.Shares, &proto.ShareUnit{
+			Id:       id,
+			Uid:      uid,
+			Name:     v.Record.Name,
+			Type:     v.Record.Type,
+			Team:     int32(v.Record.Team),
+			TeamName: v.TeamName,
+			Logins:   v.Logins,
+		})
 	}
 
-	return encData, encKey, nil
+	return &resp, nil
 }
 
-func decryptionData(mk string, key string, data string) ([]byte, error) {
-	decKey, err := decrypt([]byte(mk), key)
+// RevokeShare stops sharing a record of the user, the record becomes private.
+func (s StorageHandler) RevokeShare(ctx context.Context, in *proto.RevokeShareRequest) (*proto.RevokeShareResponse, error) {
+	var resp proto.RevokeShareResponse
+
+	// Get token from context
+	token, ok := middleware.GetTokenFromContext(ctx)
+	if !ok {
+		s.Logger.Error(errorInvalidToken)
+		resp.Error = errorInvalidToken
+		return &resp, nil
+	}
+
+	if s.ReadOnlyMode.Enabled() {
+		return nil, ErrServerReadOnly
+	}
+
+	id, err := s.recordID(in.Id, in.Uid, token.ID)
 	if err != nil {
-		return []byte{}, fmt.Errorf("failed decrypt key: %w", err)
+		return nil, err
 	}
 
-	decData, err := decrypt(decKey, data)
+	err = s.Svc.RevokeShare(id, token.ID)
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		resp.Error = "shared record not found"
+	case err != nil:
+		s.Logger.With(zap.Error(err)).Error("failed revoke share")
+		resp.Error = "failed revoke share"
+	}
+
+	return &resp, nil
+}
+
+/* UTILS. */
+
+// uuidIDs reports whether the clients address the records by their UUIDs.
+func (s StorageHandler) uuidIDs() bool {
+	return s.RecordIDs == domain.RecordIDsUUID
+}
+
+// recordID returns the ID of the record a request addresses by its ID or
+// UUID. The UUID of a record the user can't read gives zero, which no record
+// has, so the call fails as for an unknown ID. With UUID record IDs the
+// sequential ID is not accepted.
+func (s StorageHandler) recordID(id int32, uid string, user int) (int, error) {
+	if uid == "" {
+		if s.uuidIDs() {
+			return 0, ErrRecordUIDRequired
+		}
+
+		return int(id), nil
+	}
+
+	if err := uuid.Validate(uid); err != nil {
+		return 0, ErrInvalidRecordUID
+	}
+
+	ids, err := s.Svc.ResolveRecordUIDs([]string{uid}, user)
 	if err != nil {
-		return []byte{}, fmt.Errorf("failed decrypt data: %w", err)
+		s.Logger.With(zap.Error(err)).Error("failed resolve record UUID")
+		//nolint:wrapcheck // This legal return
+		return 0, status.Error(codes.Internal, "failed resolve record UUID")
+	}
+
+	return ids[uid], nil
+}
+
+// publicID returns the ID or the UUID of the record shown to the client,
+// depending on the scheme of the record IDs.
+func (s StorageHandler) publicID(rec *domain.Storage) (int32, string) {
+	if s.uuidIDs() {
+		return 0, rec.UID
+	}
+
+	return int32(rec.ID), ""
+}
+
+// writtenID returns the public ID of a written record. A retried write
+// returns the record of the first write, which has its own UUID.
+func (s StorageHandler) writtenID(unit domain.Storage, id int, user int) (int32, string) {
+	if id == unit.ID || !s.uuidIDs() {
+		unit.ID = id
+		return s.publicID(&unit)
+	}
+
+	rec, err := s.Svc.ReadRecord(id, user)
+	if err != nil || rec == nil {
+		s.Logger.With(zap.Error(err)).Error("failed read written record")
+		return 0, ""
+	}
+
+	return s.publicID(rec)
+}
+
+// validateName checks the record name and returns an `InvalidArgument`
+// error if it is too long or has forbidden characters.
+func (s StorageHandler) validateName(name string) error {
+	maxLength := s.MaxNameLength
+	if maxLength == 0 {
+		maxLength = domain.DefaultMaxNameLength
+	}
+
+	if err := domain.ValidateName(name, maxLength); err != nil {
+		//nolint:wrapcheck // This legal return
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return nil
+}
+
+// ValidateRecord runs the checks of WriteRecord on a record without storing
+// it, so a client can fail fast before a large upload. The data of a large
+// record can be left out, then only its size is checked with the name.
+func (s StorageHandler) ValidateRecord(ctx context.Context, in *proto.ValidateRecordRequest) (*proto.ValidateRecordResponse, error) {
+	size := int64(len(in.Data))
+	data := in.Data
+	if size == 0 && in.Size > 0 {
+		size = in.Size
+		data = nil
+	}
+
+	problems := s.validateRecord(in.Name, in.Type, size, data)
+
+	return &proto.ValidateRecordResponse{Valid: len(problems) == 0, Errors: problems}, nil
+}
+
+// validateRecord checks the name, the size and the structure of the data of
+// a written record and returns the messages of the failed checks. Nil data
+// is not checked, only its size.
+func (s StorageHandler) validateRecord(name string, typ string, size int64, data []byte) []string {
+	var problems []string
+
+	if err := s.validateName(name); err != nil {
+		problems = append(problems, status.Convert(err).Message())
+	}
+
+	if typ == "file" {
+		if err := domain.ValidateFileName(name); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if err := domain.ValidateRecordSize(size, s.maxRecordSize()); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if data != nil || size == 0 {
+		if err := domain.ValidateRecordData(typ, data); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	return problems
+}
+
+// detectMimeType returns the MIME type of the data of a file record: the
+// explicit type if it is set, otherwise the type detected from the beginning
+// of the data. The other records have no MIME type.
+func detectMimeType(typ string, explicit string, data []byte) (string, error) {
+	if typ != "file" {
+		return "", nil
+	}
+
+	if explicit != "" {
+		if _, _, err := mime.ParseMediaType(explicit); err != nil {
+			return "", fmt.Errorf("invalid MIME type %q: %w", explicit, err)
+		}
+
+		return explicit, nil
+	}
+
+	return http.DetectContentType(data), nil
+}
+
+// maxRecordSize returns the maximum size of the data of a record.
+func (s StorageHandler) maxRecordSize() int64 {
+	if s.MaxRecordSize == 0 {
+		return domain.DefaultMaxRecordSize
 	}
 
-	return decData, nil
+	return s.MaxRecordSize
+}
+
+// recentlyAuthenticated checks the token against the reauthentication window.
+func (s StorageHandler) recentlyAuthenticated(token middleware.JWTclaims) bool {
+	return s.ReauthWindow <= 0 || token.AuthenticatedWithin(s.ReauthWindow)
 }
 
-func encrypt(key []byte, plaintext []byte) (string, error) {
-	// Преобразуйте ключ в байты нужной длины
-	keyBytes := adjustKeySize(key, sizeRandomKey)
-	// Создайте новый блок AES с использованием ключа
-	block, err := aes.NewCipher(keyBytes)
+// algorithm returns the algorithm of the written records.
+func (s StorageHandler) algorithm() string {
+	if s.Algorithm == "" {
+		return DefaultAlgorithm
+	}
+
+	return s.Algorithm
+}
+
+// primaryKey returns the master key the data keys of the written records are
+// encrypted with.
+func (s StorageHandler) primaryKey() MasterKey {
+	return MasterKey{ID: s.MasterKeyID, Key: s.MasterKey}
+}
+
+// masterKey returns the master key with the ID a record was written with.
+func (s StorageHandler) masterKey(id string) (MasterKey, error) {
+	if id == s.MasterKeyID {
+		return s.primaryKey(), nil
+	}
+
+	key, ok := s.MasterKeys[id]
+	if !ok {
+		return MasterKey{}, fmt.Errorf("%w: %w %q", ErrMasterKeyMismatch, errUnknownMasterKey, id)
+	}
+
+	return MasterKey{ID: id, Key: key}, nil
+}
+
+// encrypt encrypts the data of a written record with the configured
+// algorithm and the primary master key, and binds the encryption to the owner and ID of the record.
+func (s StorageHandler) encrypt(rec *domain.Storage, data []byte) error {
+	c, err := GetCipher(s.algorithm())
 	if err != nil {
-		return "", fmt.Errorf("failed to create AES cipher: %w", err)
+		return err
 	}
 
-	// NewGCM возвращает заданный 128-битный блочный шифр
-	aesgcm, err := cipher.NewGCM(block)
+	rec.Bound = true
+
+	mk := s.primaryKey()
+
+	rec.Value, rec.Key, err = encryptionData(c, mk, data, recordAAD(rec))
 	if err != nil {
-		return "", fmt.Errorf("failed to create chiper: %w", err)
+		return err
 	}
+	rec.Algorithm = s.algorithm()
+	rec.KeyID = mk.ID
 
-	// Создаём вектор инициализации
-	nonce, err := generateRandom(aesgcm.NonceSize())
+	return nil
+}
+
+// decrypt decrypts the data of a record with the algorithm and the master key
+// it was written with.
+func (s StorageHandler) decrypt(rec *domain.Storage) ([]byte, error) {
+	c, err := GetCipher(rec.Algorithm)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	mk, err := s.masterKey(rec.KeyID)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+		return []byte{}, err
 	}
 
-	dst := aesgcm.Seal(nil, nonce, plaintext, nil)
+	return decryptionData(c, mk, rec.Key, rec.Value, recordAAD(rec))
+}
+
+// decryptError logs a failed decryption of the record with its ID and
+// returns the error for the client. A failed authentication gets a message
+// pointing to the master key, so the operators know what to check.
+func (s StorageHandler) decryptError(id int, err error) string {
+	log := s.Logger.With(zap.Error(err), zap.Int("record_id", id))
+	if errors.Is(err, ErrMasterKeyMismatch) {
+		log.Error("failed authenticate record, the master key may be incorrect")
+		return ErrMasterKeyMismatch.Error()
+	}
 
-	// Кодируем зашифрованные данные в строку (base64)
-	encString := base64.StdEncoding.EncodeToString(nonce) + "*" + base64.StdEncoding.EncodeToString(dst)
+	log.Error("failed decrypt data")
 
-	return encString, nil
+	return "failed decrypt data"
 }
 
-func decrypt(key []byte, plaintext string) ([]byte, error) {
-	splStr := strings.Split(plaintext, "*")
+// sealName encrypts the name of a record prepared for saving with the data
+// key of the record, if the names are encrypted.
+func (s StorageHandler) sealName(rec *domain.Storage) error {
+	if !s.EncryptNames {
+		return nil
+	}
+
+	c, err := GetCipher(rec.Algorithm)
+	if err != nil {
+		return err
+	}
 
-	// Получаем вектор
-	decNonce, err := base64.StdEncoding.DecodeString(splStr[0])
+	key, err := s.dataKey(c, rec)
 	if err != nil {
-		return []byte{}, fmt.Errorf("failed decode base64: %w", err)
+		return err
 	}
 
-	// Зашифровваные данные
-	decString, err := base64.StdEncoding.DecodeString(splStr[1])
+	name, err := c.Encrypt(key, []byte(rec.Name), recordAAD(rec))
 	if err != nil {
-		return []byte{}, fmt.Errorf("failed decode base64: %w", err)
+		return fmt.Errorf("failed encrypt name: %w", err)
+	}
+
+	rec.Name = name
+	rec.NameEncrypted = true
+
+	return nil
+}
+
+// openName decrypts the name of a read record if it is encrypted.
+// Records written without name encryption are left as is.
+func (s StorageHandler) openName(rec *domain.Storage) error {
+	if !rec.NameEncrypted {
+		return nil
 	}
 
-	// Преобразуйте ключ в байты нужной длины
-	keyBytes := adjustKeySize(key, sizeRandomKey)
-	block, err := aes.NewCipher(keyBytes)
+	c, err := GetCipher(rec.Algorithm)
 	if err != nil {
-		return []byte{}, fmt.Errorf("failed to create AES cipher: %w", err)
+		return err
 	}
 
-	// NewGCM возвращает заданный 128-битный блочный шифр
-	aesgcm, err := cipher.NewGCM(block)
+	key, err := s.dataKey(c, rec)
 	if err != nil {
-		return []byte{}, fmt.Errorf("failed to create chiper: %w", err)
+		return err
 	}
 
-	// Расшифровываем
-	dst, err := aesgcm.Open(nil, decNonce, decString, nil)
+	name, err := c.Decrypt(key, rec.Name, recordAAD(rec))
 	if err != nil {
-		return []byte{}, fmt.Errorf("failed open decrypts: %w", err)
+		return fmt.Errorf("failed decrypt name: %w", authenticationError(err))
 	}
 
-	return dst, nil
+	rec.Name = string(name)
+	rec.NameEncrypted = false
+
+	return nil
 }
 
-func adjustKeySize(originalKey []byte, desiredSize int) []byte {
-	// Если исходный ключ больше желаемого размера, обрезаем его
-	if len(originalKey) > desiredSize {
-		return originalKey[:desiredSize]
+// dataKey decrypts the data key of a record with the master key it was
+// written with.
+func (s StorageHandler) dataKey(c Cipher, rec *domain.Storage) ([]byte, error) {
+	mk, err := s.masterKey(rec.KeyID)
+	if err != nil {
+		return nil, err
 	}
 
-	return originalKey
+	key, err := c.Decrypt([]byte(mk.Key), rec.Key, keyAAD(recordAAD(rec), mk.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed decrypt key: %w", authenticationError(err))
+	}
+
+	return key, nil
 }
 
 func generateRandom(size int) ([]byte, error) {
@@ -348,3 +1400,20 @@ func generateRandom(size int) ([]byte, error) {
 
 	return b, nil
 }
+
+// markAccessed sets the time of the last access of the read records, it is
+// used by the retention cleanup. A failure is only logged, as the records
+// are read anyway.
+func (s StorageHandler) markAccessed(ids ...int) {
+	if err := s.Svc.TouchRecords(ids); err != nil {
+		s.Logger.With(zap.Error(err)).Error("failed mark records accessed")
+	}
+}
+
+// notify queues the event of the records for the webhook of the user.
+func (s StorageHandler) notify(token middleware.JWTclaims, event string, ids ...int) {
+	now := time.Now().UTC()
+	for _, id := range ids {
+		s.Notifier.Notify(token.Login, webhook.Event{Event: event, RecordID: int32(id), UserID: token.ID, Time: now})
+	}
+}
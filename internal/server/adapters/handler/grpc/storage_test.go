@@ -0,0 +1,339 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/Renal37/goph-keeper/internal/server/core/ports"
+	"github.com/Renal37/goph-keeper/internal/server/core/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestRecordNameEncryption(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmAESGCM, AlgorithmChaCha20Poly1305} {
+		t.Run(algorithm, func(t *testing.T) {
+			s := StorageHandler{MasterKey: "1234567812345678", Algorithm: algorithm, EncryptNames: true}
+
+			rec := domain.Storage{ID: 7, Owner: 1, Name: "My Bank Password"}
+			assert.NoError(t, s.encrypt(&rec, []byte("data")))
+			value, key := rec.Value, rec.Key
+			assert.NoError(t, s.sealName(&rec))
+			assert.True(t, rec.NameEncrypted)
+			assert.NotContains(t, rec.Name, "Bank")
+
+			assert.NoError(t, s.openName(&rec))
+			assert.False(t, rec.NameEncrypted)
+			assert.Equal(t, "My Bank Password", rec.Name)
+
+			// Records written without name encryption stay readable
+			plain := StorageHandler{MasterKey: s.MasterKey, Algorithm: algorithm}
+			rec = domain.Storage{ID: 7, Owner: 1, Name: "plain", Value: value, Key: key, Algorithm: algorithm, Bound: true}
+			assert.NoError(t, plain.sealName(&rec))
+			assert.False(t, rec.NameEncrypted)
+			assert.NoError(t, s.openName(&rec))
+			assert.Equal(t, "plain", rec.Name)
+		})
+	}
+}
+
+func TestValidateRecord(t *testing.T) {
+	s := StorageHandler{MaxNameLength: 16, MaxRecordSize: 32}
+
+	tests := []struct {
+		name    string
+		in      *proto.ValidateRecordRequest
+		valid   bool
+		problem string
+	}{
+		{
+			name:  "valid text",
+			in:    &proto.ValidateRecordRequest{Name: "note", Type: "text", Data: []byte("hello")},
+			valid: true,
+		},
+		{
+			name:  "valid credentials",
+			in:    &proto.ValidateRecordRequest{Name: "bank", Type: "credentials", Data: []byte(`{"login":"a","password":"b"}`)},
+			valid: true,
+		},
+		{
+			name:  "valid size only",
+			in:    &proto.ValidateRecordRequest{Name: "movie", Type: "file", Size: 32},
+			valid: true,
+		},
+		{
+			name:    "name too long",
+			in:      &proto.ValidateRecordRequest{Name: "a very long record name", Type: "text", Data: []byte("hello")},
+			problem: "maximum is 16",
+		},
+		{
+			name:    "control character in name",
+			in:      &proto.ValidateRecordRequest{Name: "bad\nname", Type: "text", Data: []byte("hello")},
+			problem: "control",
+		},
+		{
+			name:    "too large",
+			in:      &proto.ValidateRecordRequest{Name: "movie", Type: "file", Size: 33},
+			problem: "maximum is 32",
+		},
+		{
+			name:    "path traversal in file name",
+			in:      &proto.ValidateRecordRequest{Name: "../../etc/passwd", Type: "file", Size: 4},
+			problem: "path separator",
+		},
+		{
+			name:    "windows path in file name",
+			in:      &proto.ValidateRecordRequest{Name: `..\boot.ini`, Type: "file", Size: 4},
+			problem: "path separator",
+		},
+		{
+			name:    "dot dot file name",
+			in:      &proto.ValidateRecordRequest{Name: "..", Type: "file", Size: 4},
+			problem: "not a file name",
+		},
+		{
+			name:  "path in text name",
+			in:    &proto.ValidateRecordRequest{Name: "work/mail", Type: "text", Data: []byte("hello")},
+			valid: true,
+		},
+		{
+			name:  "unusual characters in file name",
+			in:    &proto.ValidateRecordRequest{Name: "отчёт \"q1\" ✓.pdf", Type: "file", Size: 4},
+			valid: true,
+		},
+		{
+			name:    "invalid json",
+			in:      &proto.ValidateRecordRequest{Name: "config", Type: "json", Data: []byte(`{"a":`)},
+			problem: "not well-formed JSON",
+		},
+		{
+			name:    "invalid credentials",
+			in:      &proto.ValidateRecordRequest{Name: "bank", Type: "credentials", Data: []byte("login:password")},
+			problem: "credentials must be",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := s.ValidateRecord(context.Background(), tt.in)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.valid, resp.Valid)
+			if tt.problem != "" && assert.Len(t, resp.Errors, 1) {
+				assert.Contains(t, resp.Errors[0], tt.problem)
+			}
+		})
+	}
+}
+
+// recordRepo is a storage repository with a single record, the other methods
+// are not implemented.
+type recordRepo struct {
+	ports.StorageRepository
+	rec domain.Storage
+}
+
+func (r *recordRepo) ReadRecord(id int, owner int) (*domain.Storage, error) {
+	if id != r.rec.ID || owner != r.rec.Owner {
+		return nil, nil
+	}
+
+	rec := r.rec
+	return &rec, nil
+}
+
+func (r *recordRepo) ReadRecords(ids []int, owner int) ([]domain.Storage, error) {
+	var recs []domain.Storage
+	for _, id := range ids {
+		if rec, _ := r.ReadRecord(id, owner); rec != nil {
+			recs = append(recs, *rec)
+		}
+	}
+
+	return recs, nil
+}
+
+func (r *recordRepo) TouchRecords(ids []int, at time.Time) error {
+	return nil
+}
+
+func (r *recordRepo) ResolveRecordUIDs(uids []string, user int) (map[string]int, error) {
+	ids := make(map[string]int)
+	for _, uid := range uids {
+		if uid == r.rec.UID && user == r.rec.Owner {
+			ids[uid] = r.rec.ID
+		}
+	}
+
+	return ids, nil
+}
+
+func TestReadRecordMeta(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	data := []byte("a secret of 21 bytes.")
+
+	for _, algorithm := range []string{AlgorithmAESGCM, AlgorithmChaCha20Poly1305} {
+		t.Run(algorithm, func(t *testing.T) {
+			// The record is encrypted with another master key, so any
+			// attempt to decrypt its data fails
+			rec := domain.Storage{
+				ID: 7, Owner: 1, Name: "bank", Type: "text", Category: "home", Version: 2,
+				Meta: domain.Meta{"env": "prod"}, CreatedAt: created, AccessedAt: created.Add(time.Hour),
+			}
+			require.NoError(t, StorageHandler{MasterKey: "other-master-key", Algorithm: algorithm}.encrypt(&rec, data))
+
+			repo := &recordRepo{rec: rec}
+			s := StorageHandler{Svc: *services.NewStorageService(repo), Logger: zap.NewNop(), MasterKey: "1234567812345678"}
+			ctx := middleware.SetTokenToContext(context.Background(), middleware.JWTclaims{ID: 1})
+
+			read, err := s.ReadRecord(ctx, &proto.ReadRecordRequest{Id: 7})
+			require.NoError(t, err)
+			assert.Equal(t, ErrMasterKeyMismatch.Error(), read.Error)
+
+			// A corrupted value is reported, not a panic
+			repo.rec.Key, repo.rec.Value = "*", "*"
+			read, err = s.ReadRecord(ctx, &proto.ReadRecordRequest{Id: 7})
+			require.NoError(t, err)
+			assert.Equal(t, "failed decrypt data", read.Error)
+			assert.Empty(t, read.Data)
+			repo.rec = rec
+
+			resp, err := s.ReadRecordMeta(ctx, &proto.ReadRecordMetaRequest{Id: 7})
+			require.NoError(t, err)
+			assert.Empty(t, resp.Error)
+			assert.Equal(t, &proto.ReadRecordMetaResponse{
+				Id: 7, Name: "bank", Type: "text", Category: "home", Version: 2,
+				Meta: map[string]string{"env": "prod"}, Size: int64(len(data)),
+				CreatedAt: created.Unix(), LastAccessedAt: created.Add(time.Hour).Unix(),
+			}, resp)
+
+			resp, err = s.ReadRecordMeta(middleware.SetTokenToContext(context.Background(), middleware.JWTclaims{ID: 2}),
+				&proto.ReadRecordMetaRequest{Id: 7})
+			require.NoError(t, err)
+			assert.Equal(t, "record not found", resp.Error)
+		})
+	}
+}
+
+func TestSealedSize(t *testing.T) {
+	aead, err := aesGCM{}.aead([]byte("1234567812345678"))
+	require.NoError(t, err)
+
+	for _, size := range []int{0, 1, 2, 3, 100} {
+		sealed, err := seal(aead, make([]byte, size), nil)
+		require.NoError(t, err)
+
+		got, err := sealedSize(sealed)
+		require.NoError(t, err)
+		assert.Equal(t, int64(size), got)
+	}
+
+	// The version marker of AES-256 is not counted
+	sealed, err := aesGCM{}.Encrypt([]byte("1234567812345678"), make([]byte, 10), nil)
+	require.NoError(t, err)
+	got, err := sealedSize(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), got)
+
+	for _, sealed := range []string{"", "abc", "*", "abc*"} {
+		_, err = sealedSize(sealed)
+		assert.ErrorIs(t, err, errMalformedCiphertext, sealed)
+	}
+}
+
+func TestDetectMimeType(t *testing.T) {
+	tests := []struct {
+		name     string
+		typ      string
+		explicit string
+		data     []byte
+		want     string
+		wantErr  bool
+	}{
+		{name: "png", typ: "file", data: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), want: "image/png"},
+		{name: "jpeg", typ: "file", data: []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x10}, want: "image/jpeg"},
+		{name: "pdf", typ: "file", data: []byte("%PDF-1.7\n"), want: "application/pdf"},
+		{name: "zip", typ: "file", data: []byte("PK\x03\x04\x14\x00"), want: "application/zip"},
+		{name: "gzip", typ: "file", data: []byte{0x1f, 0x8b, 0x08, 0x00}, want: "application/x-gzip"},
+		{name: "text", typ: "file", data: []byte("server {\n listen 80;\n}\n"), want: "text/plain; charset=utf-8"},
+		{name: "binary", typ: "file", data: []byte{0x00, 0x01, 0x02, 0x03}, want: "application/octet-stream"},
+		{name: "explicit", typ: "file", explicit: "application/x-yaml", data: []byte("a: 1\n"), want: "application/x-yaml"},
+		{name: "invalid explicit", typ: "file", explicit: "not a type/", data: []byte("a"), wantErr: true},
+		{name: "not a file", typ: "text", explicit: "text/html", data: []byte("<html>"), want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := detectMimeType(tt.typ, tt.explicit, tt.data)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRecordIDs(t *testing.T) {
+	uid := "3f1c2a4e-8b7d-4c6e-9a51-2d7f0e6b8c90"
+	rec := domain.Storage{ID: 7, UID: uid, Name: "bank", Type: "text", Owner: 1, Version: 1}
+	require.NoError(t, StorageHandler{MasterKey: "1234567812345678"}.encrypt(&rec, []byte("secret")))
+
+	handler := func(scheme string) StorageHandler {
+		repo := &recordRepo{rec: rec}
+		return StorageHandler{Svc: *services.NewStorageService(repo), Logger: zap.NewNop(), MasterKey: "1234567812345678", RecordIDs: scheme}
+	}
+	owner := middleware.SetTokenToContext(context.Background(), middleware.JWTclaims{ID: 1})
+	other := middleware.SetTokenToContext(context.Background(), middleware.JWTclaims{ID: 2})
+
+	t.Run("int", func(t *testing.T) {
+		s := handler(domain.RecordIDsInt)
+
+		resp, err := s.ReadRecordMeta(owner, &proto.ReadRecordMetaRequest{Id: 7})
+		require.NoError(t, err)
+		assert.Empty(t, resp.Error)
+		assert.Equal(t, int32(7), resp.Id)
+
+		// A record with a UUID can be addressed by it as well
+		resp, err = s.ReadRecordMeta(owner, &proto.ReadRecordMetaRequest{Uid: uid})
+		require.NoError(t, err)
+		assert.Equal(t, int32(7), resp.Id)
+		assert.Empty(t, resp.Uid)
+	})
+
+	t.Run("uuid", func(t *testing.T) {
+		s := handler(domain.RecordIDsUUID)
+
+		// The sequential ID is hidden and not accepted
+		resp, err := s.ReadRecordMeta(owner, &proto.ReadRecordMetaRequest{Uid: uid})
+		require.NoError(t, err)
+		assert.Empty(t, resp.Error)
+		assert.Zero(t, resp.Id)
+		assert.Equal(t, uid, resp.Uid)
+
+		_, err = s.ReadRecordMeta(owner, &proto.ReadRecordMetaRequest{Id: 7})
+		assert.ErrorIs(t, err, ErrRecordUIDRequired)
+
+		_, err = s.ReadRecordMeta(owner, &proto.ReadRecordMetaRequest{Uid: "7"})
+		assert.ErrorIs(t, err, ErrInvalidRecordUID)
+
+		// The UUID of another user's record is not found
+		resp, err = s.ReadRecordMeta(other, &proto.ReadRecordMetaRequest{Uid: uid})
+		require.NoError(t, err)
+		assert.Equal(t, "record not found", resp.Error)
+
+		records, err := s.ReadRecords(owner, &proto.ReadRecordsRequest{Uids: []string{uid, "00000000-0000-4000-8000-000000000000"}})
+		require.NoError(t, err)
+		require.Len(t, records.Records, 2)
+		assert.Equal(t, uid, records.Records[0].Uid)
+		assert.Zero(t, records.Records[0].Id)
+		assert.Equal(t, "secret", string(records.Records[0].Data))
+		assert.Equal(t, "record not found", records.Records[1].Error)
+	})
+}
@@ -8,13 +8,14 @@ import (
 	"time"
 
 	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
 	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
 	"github.com/Renal37/goph-keeper/internal/server/core/services"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5/pgconn"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // UserHandler is a gRPC handler that implements the `UserServer` interface
@@ -22,16 +23,25 @@ import (
 // operations such as registration and login. The handler relies on the
 // `UserService` for the business logic and uses a `zap.Logger` for logging.
 // It also uses a JWT key (`JWTkey`) for creating JWT tokens during user
-// registration and login.
+// registration and login. The passwords are hashed by `Passwords`, with bcrypt
+// by default. The passkey calls need the WebAuthn relying party
+// and the store of their sessions, without them the calls are disabled.
 type UserHandler struct {
 	proto.UnimplementedUserServer
-	Svc    services.UserService
-	Logger *zap.Logger
-	JWTkey string
+	Svc       services.UserService
+	Logger    *zap.Logger
+	JWTkey    string
+	Passwords PasswordHasher
+	WebAuthn  *webauthn.WebAuthn
+	Sessions  *WebAuthnSessions
+	// RefreshGrace is how long after the expiry a token can still be
+	// refreshed, zero accepts only unexpired tokens.
+	RefreshGrace time.Duration
 }
 
 // Register handles the user registration gRPC call. It creates a new user
-// with the provided login and hashed password using the `UserService`.
+// with the provided login, optional email and hashed password using the `UserService`
+// together with the vault key of the user wrapped under the password.
 // If registration is successful, it generates a JWT token for the user.
 // Errors during registration or token generation are logged and returned
 // as error responses.
@@ -43,14 +53,28 @@ func (h UserHandler) Register(ctx context.Context, in *proto.RegiserRequest) (*p
 		return &res, nil
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(in.Password), bcrypt.DefaultCost)
+	if in.Email != "" {
+		if err := domain.ValidateEmail(in.Email); err != nil {
+			res.Error = err.Error()
+			return &res, nil
+		}
+	}
+
+	hash, err := h.Passwords.Hash(in.Password)
 	if err != nil {
 		h.Logger.With(zap.Error(err)).Error("failed get hash from password")
 		res.Error = "internal server error"
 		return &res, nil
 	}
 
-	user, err := h.Svc.CreateUser(in.Login, string(hash))
+	key, err := newVaultKey(in.Password)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed create vault key")
+		res.Error = "internal server error"
+		return &res, nil
+	}
+
+	user, err := h.Svc.CreateUserWithVaultKey(in.Login, in.Email, hash, key)
 	if err != nil {
 		h.Logger.With(zap.Error(err)).Error("failed create user")
 
@@ -58,12 +82,15 @@ func (h UserHandler) Register(ctx context.Context, in *proto.RegiserRequest) (*p
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
 			res.Error = "this user exists"
+			if pgErr.ConstraintName == "idx_users_email" {
+				res.Error = "this email is used by another user"
+			}
 		}
 
 		return &res, nil
 	}
 
-	token, err := getJWT(h.JWTkey, user.ID, user.Login)
+	token, err := getJWT(h.JWTkey, user.ID, user.Login, middleware.ScopeFull)
 	if err != nil {
 		h.Logger.With(zap.Error(err)).Error("failed create jwt token")
 		res.Error = "failed create jwt token"
@@ -76,11 +103,22 @@ func (h UserHandler) Register(ctx context.Context, in *proto.RegiserRequest) (*p
 }
 
 // Login handles the user login gRPC call. It verifies the user's credentials
-// using the `UserService`. If the credentials are valid, it generates a JWT token
-// for the user. Errors during login verification or token generation are logged
+// using the `UserService`, the user is found by the login or the email. If the credentials are valid, it generates a JWT token
+// for the user with the requested scope, full access by default. A hash of another algorithm than the configured one
+// is replaced with the password just verified. Errors during login verification or token generation are logged
 // and returned as error responses.
 func (h UserHandler) Login(ctx context.Context, in *proto.LoginRequest) (*proto.LoginResponse, error) {
 	var res proto.LoginResponse
+
+	scope := in.Scope
+	if scope == "" {
+		scope = middleware.ScopeFull
+	}
+	if scope != middleware.ScopeFull && scope != middleware.ScopeRead {
+		res.Error = "unknown token scope"
+		return &res, nil
+	}
+
 	user, err := h.Svc.FindUserByLogin(in.Login)
 	if err != nil {
 		h.Logger.With(zap.Error(err)).Error("failed get user")
@@ -93,13 +131,158 @@ func (h UserHandler) Login(ctx context.Context, in *proto.LoginRequest) (*proto.
 		return &res, nil
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Hash), []byte(in.Password)); err != nil {
+	if err := h.Passwords.Verify(user.Hash, in.Password); err != nil {
 		res.Error = "login or password incorrect"
 		//nolint:nilerr // This legal return
 		return &res, nil
 	}
 
-	token, err := getJWT(h.JWTkey, user.ID, user.Login)
+	if h.Passwords.NeedsRehash(user.Hash) {
+		h.rehashPassword(user, in.Password)
+	}
+
+	token, err := getJWT(h.JWTkey, user.ID, user.Login, scope)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed create jwt token")
+		res.Error = "failed create jwt token"
+
+		return &res, nil
+	}
+
+	res.Jwt = *token
+
+	return &res, nil
+}
+
+// ChangePassword handles the password change gRPC call. It verifies the
+// current password like `Login`, then replaces the password hash and wraps
+// the vault key of the user under the new password. The data encryption key
+// stays the same. A user registered before the vault keys gets a new key.
+// The issued tokens stay valid.
+func (h UserHandler) ChangePassword(ctx context.Context, in *proto.ChangePasswordRequest) (*proto.ChangePasswordResponse, error) {
+	var res proto.ChangePasswordResponse
+
+	if in.Login == "" || in.Password == "" || in.NewPassword == "" {
+		res.Error = "login or password incorrect"
+		return &res, nil
+	}
+
+	user, err := h.Svc.FindUserByLogin(in.Login)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed get user")
+		res.Error = "failed get user"
+		return &res, nil
+	}
+
+	if user == nil {
+		res.Error = "user not found"
+		return &res, nil
+	}
+
+	if err := h.Passwords.Verify(user.Hash, in.Password); err != nil {
+		res.Error = "login or password incorrect"
+		//nolint:nilerr // This legal return
+		return &res, nil
+	}
+
+	hash, err := h.Passwords.Hash(in.NewPassword)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed get hash from password")
+		res.Error = "internal server error"
+		return &res, nil
+	}
+
+	key, err := h.rewrapVaultKey(user.ID, in.Password, in.NewPassword)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed rotate vault key")
+		res.Error = "failed rotate vault key"
+		return &res, nil
+	}
+
+	if err := h.Svc.UpdatePassword(user.ID, hash, key); err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed update password")
+		res.Error = "failed update password"
+		return &res, nil
+	}
+
+	return &res, nil
+}
+
+// rehashPassword replaces the password hash of the user with a hash of the
+// configured algorithm. A failure is only logged, the login goes on with
+// the old hash.
+func (h UserHandler) rehashPassword(user *domain.User, password string) {
+	hash, err := h.Passwords.Hash(password)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed get hash from password")
+		return
+	}
+
+	if err := h.Svc.UpdatePasswordHash(user.ID, hash); err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed upgrade password hash")
+		return
+	}
+
+	h.Logger.Info("password hash upgraded", zap.Int("user", user.ID), zap.String("algorithm", h.Passwords.Algorithm))
+}
+
+// rewrapVaultKey wraps the vault key of the user under the new password.
+// If the user has no vault key yet, a new one is generated.
+func (h UserHandler) rewrapVaultKey(user int, password string, newPassword string) (domain.VaultKey, error) {
+	key, err := h.Svc.FindVaultKey(user)
+	if err != nil {
+		return domain.VaultKey{}, fmt.Errorf("failed get vault key: %w", err)
+	}
+
+	if key == nil {
+		return newVaultKey(newPassword)
+	}
+
+	dek, err := UnwrapVaultKey(*key, password)
+	if err != nil {
+		return domain.VaultKey{}, err
+	}
+
+	return wrapVaultKey(dek, newPassword)
+}
+
+// Refresh handles the token refresh gRPC call. It accepts an unexpired
+// token, or one expired within `RefreshGrace`, and returns a new token of
+// the same user with a new expiration time.
+// The scope and the authentication time of the token are kept, so a refresh
+// doesn't count as entering the password. A deleted user can't refresh.
+func (h UserHandler) Refresh(ctx context.Context, in *proto.RefreshRequest) (*proto.RefreshResponse, error) {
+	var res proto.RefreshResponse
+
+	claims := &middleware.JWTclaims{}
+	_, err := jwt.ParseWithClaims(in.Jwt, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(h.JWTkey), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(),
+		jwt.WithLeeway(h.RefreshGrace))
+	if err != nil {
+		res.Error = "invalid token"
+		//nolint:nilerr // This legal return
+		return &res, nil
+	}
+
+	user, err := h.Svc.FindUserByLogin(claims.Login)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed get user")
+		res.Error = "failed get user"
+		return &res, nil
+	}
+
+	if user == nil || user.ID != claims.ID {
+		res.Error = "user not found"
+		return &res, nil
+	}
+
+	token, err := signJWT(h.JWTkey, &middleware.JWTclaims{
+		ID:       claims.ID,
+		Login:    claims.Login,
+		AuthTime: claims.AuthTime,
+		Scope:    claims.Scope,
+	}, time.Now())
 	if err != nil {
 		h.Logger.With(zap.Error(err)).Error("failed create jwt token")
 		res.Error = "failed create jwt token"
@@ -113,18 +296,36 @@ func (h UserHandler) Login(ctx context.Context, in *proto.LoginRequest) (*proto.
 }
 
 // getJWT generates a JWT token for the specified user ID and login using the
-// provided JWT key. The token includes the user's ID, login, and expiration
-// time (defaulting to 30 minutes). If token generation fails, it returns an error.
-func getJWT(jwtKey string, id int, login string) (*string, error) {
+// provided JWT key. The token includes the user's ID, login, authentication time,
+// scope, issue time and expiration time (defaulting to 30 minutes). If token generation fails,
+// it returns an error.
+func getJWT(jwtKey string, id int, login string, scope string) (*string, error) {
+	now := time.Now()
+
+	return signJWT(jwtKey, &middleware.JWTclaims{
+		ID:       id,
+		Login:    login,
+		AuthTime: now.Unix(),
+		Scope:    scope,
+	}, now)
+}
+
+// GetAdminJWT generates a JWT token of the admin scope for the calls of the
+// `Admin` service. The token belongs to no user and expires as the tokens of
+// the users.
+func GetAdminJWT(jwtKey string) (*string, error) {
+	return getJWT(jwtKey, 0, "", middleware.ScopeAdmin)
+}
+
+// signJWT sets the issue time of the claims to `now` and the expiration time
+// 30 minutes later and signs them.
+func signJWT(jwtKey string, claims *middleware.JWTclaims, now time.Time) (*string, error) {
 	var DefaultSession = 30
-	var DefaultExpTime = time.Now().Add(time.Duration(DefaultSession) * time.Minute)
-
-	claims := &middleware.JWTclaims{
-		ID:    id,
-		Login: login,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(DefaultExpTime),
-		},
+	var DefaultExpTime = now.Add(time.Duration(DefaultSession) * time.Minute)
+
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(DefaultExpTime),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/Renal37/goph-keeper/internal/server/core/services"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// parseTestJWT parses a token signed with the key without checking its times.
+func parseTestJWT(t *testing.T, key string, token string) *middleware.JWTclaims {
+	t.Helper()
+
+	claims := &middleware.JWTclaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(key), nil
+	}, jwt.WithoutClaimsValidation())
+	require.NoError(t, err)
+
+	return claims
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+
+	repo := &userRepo{}
+	_, err := repo.CreateUser("alice", "hash")
+	require.NoError(t, err)
+
+	h := UserHandler{Svc: *services.NewUserService(repo), Logger: zap.NewNop(), JWTkey: "12345"}
+
+	// The password was entered an hour ago, the token expires in a minute
+	authTime := time.Now().Add(-time.Hour)
+	old, err := signJWT(h.JWTkey, &middleware.JWTclaims{ID: 1, Login: "alice", AuthTime: authTime.Unix(),
+		Scope: middleware.ScopeRead}, time.Now().Add(-29*time.Minute))
+	require.NoError(t, err)
+
+	r, err := h.Refresh(ctx, &proto.RefreshRequest{Jwt: *old})
+	require.NoError(t, err)
+	require.Empty(t, r.Error)
+
+	claims := parseTestJWT(t, h.JWTkey, r.Jwt)
+	assert.Equal(t, 1, claims.ID)
+	assert.Equal(t, "alice", claims.Login)
+	assert.Equal(t, middleware.ScopeRead, claims.Scope)
+	assert.Equal(t, authTime.Unix(), claims.AuthTime)
+	assert.WithinDuration(t, time.Now().Add(30*time.Minute), claims.ExpiresAt.Time, time.Minute)
+
+	// An expired token can't be refreshed
+	expired, err := signJWT(h.JWTkey, &middleware.JWTclaims{ID: 1, Login: "alice"}, time.Now().Add(-31*time.Minute))
+	require.NoError(t, err)
+
+	r, err = h.Refresh(ctx, &proto.RefreshRequest{Jwt: *expired})
+	require.NoError(t, err)
+	assert.Equal(t, "invalid token", r.Error)
+	assert.Empty(t, r.Jwt)
+
+	// Within the grace window it can, but not after it
+	h.RefreshGrace = 5 * time.Minute
+	r, err = h.Refresh(ctx, &proto.RefreshRequest{Jwt: *expired})
+	require.NoError(t, err)
+	require.Empty(t, r.Error)
+	assert.WithinDuration(t, time.Now().Add(30*time.Minute), parseTestJWT(t, h.JWTkey, r.Jwt).ExpiresAt.Time, time.Minute)
+
+	longExpired, err := signJWT(h.JWTkey, &middleware.JWTclaims{ID: 1, Login: "alice"}, time.Now().Add(-36*time.Minute))
+	require.NoError(t, err)
+
+	r, err = h.Refresh(ctx, &proto.RefreshRequest{Jwt: *longExpired})
+	require.NoError(t, err)
+	assert.Equal(t, "invalid token", r.Error)
+	h.RefreshGrace = 0
+
+	// Neither can a token signed with another key or of an unknown user
+	forged, err := signJWT("other", &middleware.JWTclaims{ID: 1, Login: "alice"}, time.Now())
+	require.NoError(t, err)
+
+	r, err = h.Refresh(ctx, &proto.RefreshRequest{Jwt: *forged})
+	require.NoError(t, err)
+	assert.Equal(t, "invalid token", r.Error)
+
+	deleted, err := signJWT(h.JWTkey, &middleware.JWTclaims{ID: 2, Login: "bob"}, time.Now())
+	require.NoError(t, err)
+
+	r, err = h.Refresh(ctx, &proto.RefreshRequest{Jwt: *deleted})
+	require.NoError(t, err)
+	assert.Equal(t, "user not found", r.Error)
+}
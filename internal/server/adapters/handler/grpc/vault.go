@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
+	"golang.org/x/crypto/argon2"
+)
+
+// vaultKeySize is the size of the data encryption key of a user in bytes.
+var vaultKeySize = 32
+
+// vaultSaltSize is the size of the salt of the key derivation in bytes.
+var vaultSaltSize = 16
+
+// Parameters of the argon2id derivation of the key wrapping the vault key
+// from the password.
+var (
+	vaultArgonTime    uint32 = 1
+	vaultArgonMemory  uint32 = 64 * 1024
+	vaultArgonThreads uint8  = 4
+)
+
+// vaultCipher wraps the vault keys.
+var vaultCipher Cipher = chaCha20Poly1305{}
+
+// newVaultKey generates a new data encryption key and wraps it under the password.
+func newVaultKey(password string) (domain.VaultKey, error) {
+	dek, err := generateRandom(vaultKeySize)
+	if err != nil {
+		return domain.VaultKey{}, fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+
+	return wrapVaultKey(dek, password)
+}
+
+// wrapVaultKey wraps the data encryption key under a key derived from the
+// password with a new random salt.
+func wrapVaultKey(dek []byte, password string) (domain.VaultKey, error) {
+	salt, err := generateRandom(vaultSaltSize)
+	if err != nil {
+		return domain.VaultKey{}, fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+
+	key, err := vaultCipher.Encrypt(deriveVaultKEK(password, salt), dek, nil)
+	if err != nil {
+		return domain.VaultKey{}, fmt.Errorf("failed wrap vault key: %w", err)
+	}
+
+	return domain.VaultKey{
+		Key:  key,
+		Salt: base64.StdEncoding.EncodeToString(salt),
+	}, nil
+}
+
+// UnwrapVaultKey returns the data encryption key of the vault key.
+// It fails if the password is not the one the key was wrapped under.
+func UnwrapVaultKey(key domain.VaultKey, password string) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(key.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("failed decode base64: %w", err)
+	}
+
+	dek, err := vaultCipher.Decrypt(deriveVaultKEK(password, salt), key.Key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed unwrap vault key: %w", err)
+	}
+
+	return dek, nil
+}
+
+// deriveVaultKEK derives the key wrapping the vault key from the password.
+func deriveVaultKEK(password string, salt []byte) []byte {
+	return argon2.IDKey([]byte(password), salt, vaultArgonTime, vaultArgonMemory, vaultArgonThreads, uint32(vaultKeySize))
+}
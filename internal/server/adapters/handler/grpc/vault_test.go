@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVaultKeyRewrap(t *testing.T) {
+	key, err := newVaultKey("old password")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, key.Salt)
+
+	dek, err := UnwrapVaultKey(key, "old password")
+	assert.NoError(t, err)
+	assert.Len(t, dek, vaultKeySize)
+
+	_, err = UnwrapVaultKey(key, "wrong password")
+	assert.Error(t, err)
+
+	// The rewrapped key has a new salt, but the same data encryption key
+	rotated, err := wrapVaultKey(dek, "new password")
+	assert.NoError(t, err)
+	assert.NotEqual(t, key.Salt, rotated.Salt)
+
+	got, err := UnwrapVaultKey(rotated, "new password")
+	assert.NoError(t, err)
+	assert.Equal(t, dek, got)
+
+	_, err = UnwrapVaultKey(rotated, "old password")
+	assert.Error(t, err)
+
+	// Every user gets an own key
+	other, err := newVaultKey("old password")
+	assert.NoError(t, err)
+	otherDEK, err := UnwrapVaultKey(other, "old password")
+	assert.NoError(t, err)
+	assert.NotEqual(t, dek, otherDEK)
+}
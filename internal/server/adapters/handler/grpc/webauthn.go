@@ -0,0 +1,413 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// webAuthnTimeout is the time the user has to complete a WebAuthn ceremony.
+var webAuthnTimeout = 5 * time.Minute
+
+// webAuthnSessionSize is the size of the random ID of a ceremony in bytes.
+var webAuthnSessionSize = 32
+
+// ErrWebAuthnDisabled is returned by the WebAuthn calls when the relying party is not configured.
+var ErrWebAuthnDisabled = status.Error(codes.Unimplemented, "webauthn is not configured")
+
+// NewWebAuthn creates the WebAuthn relying party of the server with the ID,
+// usually the domain of the server, and the origins allowed to use it.
+func NewWebAuthn(rpID string, origins []string) (*webauthn.WebAuthn, error) {
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: webAuthnTimeout, TimeoutUVD: webAuthnTimeout}
+
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: "goph-keeper",
+		RPOrigins:     origins,
+		Timeouts:      webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed create webauthn: %w", err)
+	}
+
+	return w, nil
+}
+
+// WebAuthnSessions holds the WebAuthn ceremonies started by the Begin calls
+// until they are finished. A session can be finished only once, so a
+// response of the authenticator can't be replayed.
+type WebAuthnSessions struct {
+	mu       sync.Mutex
+	sessions map[string]webAuthnSession
+}
+
+// webAuthnSession is a started ceremony of the user.
+type webAuthnSession struct {
+	user         domain.User
+	registration bool
+	data         webauthn.SessionData
+}
+
+// NewWebAuthnSessions creates an empty store of the ceremonies.
+func NewWebAuthnSessions() *WebAuthnSessions {
+	return &WebAuthnSessions{sessions: make(map[string]webAuthnSession)}
+}
+
+// put stores the ceremony and returns its ID. The expired ceremonies are dropped.
+func (s *WebAuthnSessions) put(session webAuthnSession) (string, error) {
+	b := make([]byte, webAuthnSessionSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed generate session: %w", err)
+	}
+	id := base64.RawURLEncoding.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, v := range s.sessions {
+		if now.After(v.data.Expires) {
+			delete(s.sessions, k)
+		}
+	}
+
+	s.sessions[id] = session
+
+	return id, nil
+}
+
+// take removes the ceremony and returns it if it was not expired.
+func (s *WebAuthnSessions) take(id string, registration bool) (webAuthnSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || session.registration != registration {
+		return webAuthnSession{}, false
+	}
+
+	delete(s.sessions, id)
+
+	return session, time.Now().Before(session.data.Expires)
+}
+
+// webAuthnUser is a user with the WebAuthn credentials, as needed by the
+// WebAuthn library.
+type webAuthnUser struct {
+	user        *domain.User
+	credentials []webauthn.Credential
+}
+
+// WebAuthnID returns the user handle, the ID of the user.
+func (u webAuthnUser) WebAuthnID() []byte {
+	return []byte(strconv.Itoa(u.user.ID))
+}
+
+// WebAuthnName returns the login of the user.
+func (u webAuthnUser) WebAuthnName() string {
+	return u.user.Login
+}
+
+// WebAuthnDisplayName returns the login of the user.
+func (u webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Login
+}
+
+// WebAuthnCredentials returns the registered credentials of the user.
+func (u webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+// WebAuthnIcon is deprecated by WebAuthn and empty.
+func (u webAuthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+// BeginRegistration starts the registration of a passkey. The user proves
+// the account with the password like in `Login`. The response has the
+// options for `navigator.credentials.create` and the session to pass to
+// `FinishRegistration`.
+func (h UserHandler) BeginRegistration(ctx context.Context, in *proto.BeginRegistrationRequest) (*proto.BeginRegistrationResponse, error) {
+	var res proto.BeginRegistrationResponse
+
+	if h.WebAuthn == nil {
+		return nil, ErrWebAuthnDisabled
+	}
+
+	user, err := h.Svc.FindUserByLogin(in.Login)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed get user")
+		res.Error = "failed get user"
+		return &res, nil
+	}
+
+	if user == nil {
+		res.Error = "user not found"
+		return &res, nil
+	}
+
+	if err := h.Passwords.Verify(user.Hash, in.Password); err != nil {
+		res.Error = "login or password incorrect"
+		//nolint:nilerr // This legal return
+		return &res, nil
+	}
+
+	wu, err := h.webAuthnUser(user)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed get webauthn credentials")
+		res.Error = "failed get webauthn credentials"
+		return &res, nil
+	}
+
+	// An authenticator that already has a credential of the user refuses to register again
+	exclude := make([]protocol.CredentialDescriptor, 0, len(wu.credentials))
+	for _, c := range wu.credentials {
+		exclude = append(exclude, c.Descriptor())
+	}
+
+	options, data, err := h.WebAuthn.BeginRegistration(wu, webauthn.WithExclusions(exclude))
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed begin webauthn registration")
+		res.Error = "failed begin registration"
+		return &res, nil
+	}
+
+	res.Options, res.Session, err = h.startSession(*user, true, options, data)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed start webauthn session")
+		res.Error = "internal server error"
+	}
+
+	return &res, nil
+}
+
+// FinishRegistration verifies the response of the authenticator to the
+// registration and stores the new credential of the user.
+func (h UserHandler) FinishRegistration(ctx context.Context, in *proto.FinishRegistrationRequest) (*proto.FinishRegistrationResponse, error) {
+	var res proto.FinishRegistrationResponse
+
+	if h.WebAuthn == nil {
+		return nil, ErrWebAuthnDisabled
+	}
+
+	session, ok := h.Sessions.take(in.Session, true)
+	if !ok {
+		res.Error = "session not found or expired"
+		return &res, nil
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(in.Credential))
+	if err != nil {
+		res.Error = "invalid credential"
+		//nolint:nilerr // This legal return
+		return &res, nil
+	}
+
+	wu, err := h.webAuthnUser(&session.user)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed get webauthn credentials")
+		res.Error = "failed get webauthn credentials"
+		return &res, nil
+	}
+
+	cred, err := h.WebAuthn.CreateCredential(wu, session.data, parsed)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Info("webauthn registration rejected")
+		res.Error = "credential verification failed"
+		return &res, nil
+	}
+
+	data, err := json.Marshal(cred)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed encode webauthn credential")
+		res.Error = "internal server error"
+		return &res, nil
+	}
+
+	err = h.Svc.CreateWebAuthnCredential(&domain.WebAuthnCredential{UserID: session.user.ID, CredentialID: cred.ID, Data: data})
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed save webauthn credential")
+		res.Error = "failed save credential"
+		return &res, nil
+	}
+
+	return &res, nil
+}
+
+// BeginLogin starts the login with a passkey. The response has the options
+// for `navigator.credentials.get` and the session to pass to `FinishLogin`.
+func (h UserHandler) BeginLogin(ctx context.Context, in *proto.BeginLoginRequest) (*proto.BeginLoginResponse, error) {
+	var res proto.BeginLoginResponse
+
+	if h.WebAuthn == nil {
+		return nil, ErrWebAuthnDisabled
+	}
+
+	user, err := h.Svc.FindUserByLogin(in.Login)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed get user")
+		res.Error = "failed get user"
+		return &res, nil
+	}
+
+	if user == nil {
+		res.Error = "user not found"
+		return &res, nil
+	}
+
+	wu, err := h.webAuthnUser(user)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed get webauthn credentials")
+		res.Error = "failed get webauthn credentials"
+		return &res, nil
+	}
+
+	if len(wu.credentials) == 0 {
+		res.Error = "no passkeys registered"
+		return &res, nil
+	}
+
+	options, data, err := h.WebAuthn.BeginLogin(wu)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed begin webauthn login")
+		res.Error = "failed begin login"
+		return &res, nil
+	}
+
+	res.Options, res.Session, err = h.startSession(*user, false, options, data)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed start webauthn session")
+		res.Error = "internal server error"
+	}
+
+	return &res, nil
+}
+
+// FinishLogin verifies the assertion of the authenticator and issues a token
+// with the requested scope, full access by default. A login of an
+// authenticator with a signature counter behind the stored one is rejected,
+// as the credential may be cloned.
+func (h UserHandler) FinishLogin(ctx context.Context, in *proto.FinishLoginRequest) (*proto.FinishLoginResponse, error) {
+	var res proto.FinishLoginResponse
+
+	if h.WebAuthn == nil {
+		return nil, ErrWebAuthnDisabled
+	}
+
+	scope := in.Scope
+	if scope == "" {
+		scope = middleware.ScopeFull
+	}
+	if scope != middleware.ScopeFull && scope != middleware.ScopeRead {
+		res.Error = "unknown token scope"
+		return &res, nil
+	}
+
+	session, ok := h.Sessions.take(in.Session, false)
+	if !ok {
+		res.Error = "session not found or expired"
+		return &res, nil
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(in.Credential))
+	if err != nil {
+		res.Error = "invalid credential"
+		//nolint:nilerr // This legal return
+		return &res, nil
+	}
+
+	wu, err := h.webAuthnUser(&session.user)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed get webauthn credentials")
+		res.Error = "failed get webauthn credentials"
+		return &res, nil
+	}
+
+	cred, err := h.WebAuthn.ValidateLogin(wu, session.data, parsed)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Info("webauthn login rejected")
+		res.Error = "credential verification failed"
+		return &res, nil
+	}
+
+	if cred.Authenticator.CloneWarning {
+		h.Logger.Warn("webauthn credential may be cloned", zap.Int("user", session.user.ID))
+		res.Error = "credential verification failed"
+		return &res, nil
+	}
+
+	data, err := json.Marshal(cred)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed encode webauthn credential")
+		res.Error = "internal server error"
+		return &res, nil
+	}
+
+	if err := h.Svc.UpdateWebAuthnCredential(session.user.ID, cred.ID, data); err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed update webauthn credential")
+		res.Error = "failed update credential"
+		return &res, nil
+	}
+
+	token, err := getJWT(h.JWTkey, session.user.ID, session.user.Login, scope)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed create jwt token")
+		res.Error = "failed create jwt token"
+		return &res, nil
+	}
+
+	res.Jwt = *token
+
+	return &res, nil
+}
+
+// startSession stores the started ceremony of the user and returns the
+// encoded options for the authenticator and the ID of the session.
+func (h UserHandler) startSession(user domain.User, registration bool, options any, data *webauthn.SessionData) ([]byte, string, error) {
+	b, err := json.Marshal(options)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed encode options: %w", err)
+	}
+
+	session, err := h.Sessions.put(webAuthnSession{user: user, registration: registration, data: *data})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return b, session, nil
+}
+
+// webAuthnUser loads the WebAuthn credentials of the user.
+func (h UserHandler) webAuthnUser(user *domain.User) (webAuthnUser, error) {
+	stored, err := h.Svc.FindWebAuthnCredentials(user.ID)
+	if err != nil {
+		return webAuthnUser{}, fmt.Errorf("failed get credentials: %w", err)
+	}
+
+	creds := make([]webauthn.Credential, 0, len(stored))
+	for _, s := range stored {
+		var c webauthn.Credential
+		if err := json.Unmarshal(s.Data, &c); err != nil {
+			return webAuthnUser{}, fmt.Errorf("failed decode credential %v: %w", s.ID, err)
+		}
+
+		creds = append(creds, c)
+	}
+
+	return webAuthnUser{user: user, credentials: creds}, nil
+}
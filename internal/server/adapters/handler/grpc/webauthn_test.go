@@ -0,0 +1,334 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/Renal37/goph-keeper/internal/server/core/services"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "https://localhost"
+)
+
+// userRepo is an in-memory `UserRepository` for the WebAuthn calls.
+type userRepo struct {
+	users []domain.User
+	creds []domain.WebAuthnCredential
+}
+
+func (r *userRepo) FindUserByLogin(login string) (*domain.User, error) {
+	for i := range r.users {
+		if r.users[i].Login == login {
+			return &r.users[i], nil
+		}
+	}
+
+	//nolint:nilnil // This legal return
+	return nil, nil
+}
+
+func (r *userRepo) CreateUser(login, hash string) (*domain.User, error) {
+	r.users = append(r.users, domain.User{ID: len(r.users) + 1, Login: login, Hash: hash})
+	return &r.users[len(r.users)-1], nil
+}
+
+func (r *userRepo) CreateUserWithVaultKey(login, email, hash string, key domain.VaultKey) (*domain.User, error) {
+	return r.CreateUser(login, hash)
+}
+
+func (r *userRepo) FindVaultKey(user int) (*domain.VaultKey, error) {
+	//nolint:nilnil // This legal return
+	return nil, nil
+}
+
+func (r *userRepo) UpdatePassword(user int, hash string, key domain.VaultKey) error {
+	return nil
+}
+
+func (r *userRepo) UpdatePasswordHash(user int, hash string) error {
+	for i := range r.users {
+		if r.users[i].ID == user {
+			r.users[i].Hash = hash
+			return nil
+		}
+	}
+
+	return domain.ErrNotFound
+}
+
+func (r *userRepo) CreateWebAuthnCredential(cred *domain.WebAuthnCredential) error {
+	for _, c := range r.creds {
+		if bytes.Equal(c.CredentialID, cred.CredentialID) {
+			return assert.AnError
+		}
+	}
+
+	cred.ID = len(r.creds) + 1
+	r.creds = append(r.creds, *cred)
+
+	return nil
+}
+
+func (r *userRepo) FindWebAuthnCredentials(user int) ([]domain.WebAuthnCredential, error) {
+	var creds []domain.WebAuthnCredential
+	for _, c := range r.creds {
+		if c.UserID == user {
+			creds = append(creds, c)
+		}
+	}
+
+	return creds, nil
+}
+
+func (r *userRepo) UpdateWebAuthnCredential(user int, credentialID []byte, data []byte) error {
+	for i, c := range r.creds {
+		if c.UserID == user && bytes.Equal(c.CredentialID, credentialID) {
+			r.creds[i].Data = data
+			return nil
+		}
+	}
+
+	return domain.ErrNotFound
+}
+
+// virtualAuthenticator is a software authenticator with a single P-256
+// credential and the "none" attestation, as a browser would use it.
+type virtualAuthenticator struct {
+	key     *ecdsa.PrivateKey
+	id      []byte
+	counter uint32
+}
+
+func newVirtualAuthenticator(t *testing.T) *virtualAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	require.NoError(t, err)
+
+	return &virtualAuthenticator{key: key, id: id}
+}
+
+// authData returns the authenticator data, with the credential for a registration.
+func (a *virtualAuthenticator) authData(t *testing.T, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+
+	// User present and verified
+	flags := byte(0x01 | 0x04)
+	if attested {
+		flags |= 0x40
+	}
+
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.counter)
+	if !attested {
+		return data
+	}
+
+	key, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1,
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(t, err)
+
+	data = append(data, make([]byte, 16)...)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(a.id)))
+	data = append(data, a.id...)
+
+	return append(data, key...)
+}
+
+// clientData returns the client data of the ceremony with the challenge of the options.
+func (a *virtualAuthenticator) clientData(t *testing.T, typ string, options []byte) []byte {
+	var opts struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+		} `json:"publicKey"`
+	}
+	require.NoError(t, json.Unmarshal(options, &opts))
+
+	data, err := json.Marshal(map[string]string{"type": typ, "challenge": opts.PublicKey.Challenge, "origin": testOrigin})
+	require.NoError(t, err)
+
+	return data
+}
+
+// create answers the registration options like `navigator.credentials.create`.
+func (a *virtualAuthenticator) create(t *testing.T, options []byte) []byte {
+	att, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authData(t, true),
+	})
+	require.NoError(t, err)
+
+	return a.response(t, map[string]string{
+		"clientDataJSON":    b64(a.clientData(t, "webauthn.create", options)),
+		"attestationObject": b64(att),
+	})
+}
+
+// get answers the login options like `navigator.credentials.get`.
+func (a *virtualAuthenticator) get(t *testing.T, options []byte) []byte {
+	a.counter++
+
+	authData := a.authData(t, false)
+	clientData := a.clientData(t, "webauthn.get", options)
+
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	require.NoError(t, err)
+
+	return a.response(t, map[string]string{
+		"clientDataJSON":    b64(clientData),
+		"authenticatorData": b64(authData),
+		"signature":         b64(sig),
+	})
+}
+
+func (a *virtualAuthenticator) response(t *testing.T, response map[string]string) []byte {
+	data, err := json.Marshal(map[string]any{
+		"id":       b64(a.id),
+		"rawId":    b64(a.id),
+		"type":     "public-key",
+		"response": response,
+	})
+	require.NoError(t, err)
+
+	return data
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func TestWebAuthn(t *testing.T) {
+	ctx := context.Background()
+
+	repo := &userRepo{}
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	_, err = repo.CreateUser("alice", string(hash))
+	require.NoError(t, err)
+
+	w, err := NewWebAuthn(testRPID, []string{testOrigin})
+	require.NoError(t, err)
+
+	h := UserHandler{
+		Svc:      *services.NewUserService(repo),
+		Logger:   zap.NewNop(),
+		JWTkey:   "12345",
+		WebAuthn: w,
+		Sessions: NewWebAuthnSessions(),
+	}
+	auth := newVirtualAuthenticator(t)
+
+	t.Run("Disabled", func(t *testing.T) {
+		_, err := UserHandler{}.BeginLogin(ctx, &proto.BeginLoginRequest{Login: "alice"})
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+	})
+
+	t.Run("Login without passkeys", func(t *testing.T) {
+		out, err := h.BeginLogin(ctx, &proto.BeginLoginRequest{Login: "alice"})
+		assert.NoError(t, err)
+		assert.Equal(t, "no passkeys registered", out.Error)
+	})
+
+	t.Run("Registration needs the password", func(t *testing.T) {
+		out, err := h.BeginRegistration(ctx, &proto.BeginRegistrationRequest{Login: "alice", Password: "wrong"})
+		assert.NoError(t, err)
+		assert.Equal(t, "login or password incorrect", out.Error)
+	})
+
+	t.Run("Register", func(t *testing.T) {
+		begin, err := h.BeginRegistration(ctx, &proto.BeginRegistrationRequest{Login: "alice", Password: "password"})
+		require.NoError(t, err)
+		require.Empty(t, begin.Error)
+
+		credential := auth.create(t, begin.Options)
+
+		out, err := h.FinishRegistration(ctx, &proto.FinishRegistrationRequest{Session: begin.Session, Credential: credential})
+		assert.NoError(t, err)
+		assert.Empty(t, out.Error)
+		assert.Len(t, repo.creds, 1)
+
+		// The session is finished only once
+		out, err = h.FinishRegistration(ctx, &proto.FinishRegistrationRequest{Session: begin.Session, Credential: credential})
+		assert.NoError(t, err)
+		assert.Equal(t, "session not found or expired", out.Error)
+	})
+
+	t.Run("Login", func(t *testing.T) {
+		begin, err := h.BeginLogin(ctx, &proto.BeginLoginRequest{Login: "alice"})
+		require.NoError(t, err)
+		require.Empty(t, begin.Error)
+
+		out, err := h.FinishLogin(ctx, &proto.FinishLoginRequest{Session: begin.Session, Credential: auth.get(t, begin.Options)})
+		assert.NoError(t, err)
+		assert.Empty(t, out.Error)
+		assert.NotEmpty(t, out.Jwt)
+	})
+
+	t.Run("Login with another key", func(t *testing.T) {
+		begin, err := h.BeginLogin(ctx, &proto.BeginLoginRequest{Login: "alice"})
+		require.NoError(t, err)
+
+		forged := newVirtualAuthenticator(t)
+		forged.id = auth.id
+
+		out, err := h.FinishLogin(ctx, &proto.FinishLoginRequest{Session: begin.Session, Credential: forged.get(t, begin.Options)})
+		assert.NoError(t, err)
+		assert.Equal(t, "credential verification failed", out.Error)
+		assert.Empty(t, out.Jwt)
+	})
+
+	t.Run("Login of a cloned authenticator", func(t *testing.T) {
+		begin, err := h.BeginLogin(ctx, &proto.BeginLoginRequest{Login: "alice"})
+		require.NoError(t, err)
+
+		// The counter is behind the last login
+		clone := *auth
+		clone.counter = 0
+
+		out, err := h.FinishLogin(ctx, &proto.FinishLoginRequest{Session: begin.Session, Credential: clone.get(t, begin.Options)})
+		assert.NoError(t, err)
+		assert.Equal(t, "credential verification failed", out.Error)
+	})
+
+	t.Run("Login session is not a registration", func(t *testing.T) {
+		begin, err := h.BeginLogin(ctx, &proto.BeginLoginRequest{Login: "alice"})
+		require.NoError(t, err)
+
+		out, err := h.FinishRegistration(ctx, &proto.FinishRegistrationRequest{Session: begin.Session, Credential: auth.create(t, begin.Options)})
+		assert.NoError(t, err)
+		assert.Equal(t, "session not found or expired", out.Error)
+	})
+}
@@ -5,29 +5,69 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
 	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/auth"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// DefaultLeeway is the default clock skew tolerance of the token times.
+const DefaultLeeway = 30 * time.Second
+
+// AuthOption configures the authenticator.
+type AuthOption func(*authOptions)
+
+type authOptions struct {
+	readGrace  time.Duration
+	readPolicy Policy
+}
+
+// WithReadGrace accepts the tokens expired within the grace window for the
+// methods that need only the read scope in the policy, so a token expiring
+// during a refresh does not fail the reads of an interactive user. The other
+// methods still need an unexpired token.
+func WithReadGrace(grace time.Duration, p Policy) AuthOption {
+	return func(o *authOptions) {
+		o.readGrace = grace
+		o.readPolicy = p
+	}
+}
+
 // GetAuthenticator returns a function for authenticating gRPC requests using JWT tokens.
 // It uses the `AuthFromMD` function to extract the token from the metadata and verifies
 // the token using `verifyJWTandGetPayload`. If the token is valid, it sets the token's
 // claims in the context and returns the enhanced context. If an error occurs, it returns
-// an unauthenticated error.
-func GetAuthenticator(jwtKey string) func(ctx context.Context) (context.Context, error) {
+// an unauthenticated error. The `leeway` tolerates the clock skew between the
+// client and the server, zero means `DefaultLeeway`.
+func GetAuthenticator(jwtKey string, leeway time.Duration, opts ...AuthOption) func(ctx context.Context) (context.Context, error) {
+	if leeway == 0 {
+		leeway = DefaultLeeway
+	}
+
+	var o authOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	return func(ctx context.Context) (context.Context, error) {
 		token, err := auth.AuthFromMD(ctx, "bearer")
 		if err != nil {
 			return nil, fmt.Errorf("AuthFromMD has error: %w", err)
 		}
 
-		pl, err := verifyJWTandGetPayload(jwtKey, token)
+		pl, err := verifyJWTandGetPayload(jwtKey, token, leeway)
+		if errors.Is(err, jwt.ErrTokenExpired) && o.readGrace > 0 {
+			// Only an expired token of a read gets the grace window
+			if method, ok := grpc.Method(ctx); ok && o.readPolicy.IsRead(method) {
+				pl, err = verifyJWTandGetPayload(jwtKey, token, leeway+o.readGrace)
+			}
+		}
 		if err != nil {
 			//nolint:wrapcheck // This legal return
 			return nil, status.Error(codes.Unauthenticated, err.Error())
@@ -42,6 +82,8 @@ func GetAuthenticator(jwtKey string) func(ctx context.Context) (context.Context,
 // AuthMatcher is a function that determines whether a given gRPC call should
 // require authentication. It returns `true` if the service name does not match
 // the `User_ServiceDesc.ServiceName`, indicating that authentication is required.
+// The `Admin` service is authenticated too, besides being served only on
+// admin listeners.
 func AuthMatcher(ctx context.Context, callMeta interceptors.CallMeta) bool {
 	return proto.User_ServiceDesc.ServiceName != callMeta.Service
 }
@@ -49,13 +91,14 @@ func AuthMatcher(ctx context.Context, callMeta interceptors.CallMeta) bool {
 // verifyJWTandGetPayload verifies a JWT token and returns its claims as `JWTclaims`.
 // It uses the provided `jwtKey` to parse and validate the token. If the token
 // is valid, it returns the claims. If an error occurs during parsing or verification,
-// it returns the error.
-func verifyJWTandGetPayload(jwtKey string, token string) (middleware.JWTclaims, error) {
+// it returns the error. The expiration and not before times are checked with
+// the `leeway`, so a small clock skew does not reject the token.
+func verifyJWTandGetPayload(jwtKey string, token string, leeway time.Duration) (middleware.JWTclaims, error) {
 	claims := &middleware.JWTclaims{}
 
 	tkn, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
 		return []byte(jwtKey), nil
-	})
+	}, jwt.WithLeeway(leeway))
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrSignatureInvalid) {
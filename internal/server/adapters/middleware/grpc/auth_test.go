@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestVerifyJWTLeeway(t *testing.T) {
+	jwtKey := "12345"
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		notBefore time.Time
+		expiresAt time.Time
+		valid     bool
+	}{
+		{name: "Valid token", notBefore: now, expiresAt: now.Add(time.Minute), valid: true},
+		{name: "Not before within leeway", notBefore: now.Add(10 * time.Second), expiresAt: now.Add(time.Minute), valid: true},
+		{name: "Not before beyond leeway", notBefore: now.Add(2 * time.Minute), expiresAt: now.Add(time.Hour), valid: false},
+		{name: "Expired within leeway", notBefore: now.Add(-time.Hour), expiresAt: now.Add(-10 * time.Second), valid: true},
+		{name: "Expired beyond leeway", notBefore: now.Add(-time.Hour), expiresAt: now.Add(-2 * time.Minute), valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := &middleware.JWTclaims{
+				ID:    1,
+				Login: "test",
+				RegisteredClaims: jwt.RegisteredClaims{
+					NotBefore: jwt.NewNumericDate(tt.notBefore),
+					ExpiresAt: jwt.NewNumericDate(tt.expiresAt),
+				},
+			}
+
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(jwtKey))
+			assert.NoError(t, err)
+
+			pl, err := verifyJWTandGetPayload(jwtKey, token, DefaultLeeway)
+			if !tt.valid {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, "test", pl.Login)
+		})
+	}
+}
+
+// methodStream is the transport stream of a call of the method, as set by the server.
+type methodStream struct {
+	grpc.ServerTransportStream
+	method string
+}
+
+func (s methodStream) Method() string {
+	return s.method
+}
+
+func TestAuthenticatorReadGrace(t *testing.T) {
+	jwtKey := "12345"
+	grace := 5 * time.Minute
+	authenticate := GetAuthenticator(jwtKey, time.Second, WithReadGrace(grace, DefaultPolicy))
+
+	tests := []struct {
+		name    string
+		method  string
+		expired time.Duration
+		valid   bool
+	}{
+		{name: "Read inside grace", method: proto.Storage_ReadRecord_FullMethodName, expired: grace - time.Minute, valid: true},
+		{name: "Read outside grace", method: proto.Storage_ReadRecord_FullMethodName, expired: grace + time.Minute},
+		{name: "Write inside grace", method: proto.Storage_WriteRecord_FullMethodName, expired: grace - time.Minute},
+		{name: "Write outside grace", method: proto.Storage_WriteRecord_FullMethodName, expired: grace + time.Minute},
+		{name: "Write of unexpired token", method: proto.Storage_WriteRecord_FullMethodName, expired: -time.Minute, valid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := &middleware.JWTclaims{
+				ID:    1,
+				Login: "test",
+				RegisteredClaims: jwt.RegisteredClaims{
+					ExpiresAt: jwt.NewNumericDate(time.Now().Add(-tt.expired)),
+				},
+			}
+
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(jwtKey))
+			assert.NoError(t, err)
+
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "bearer "+token))
+			ctx = grpc.NewContextWithServerTransportStream(ctx, methodStream{method: tt.method})
+
+			ctx, err = authenticate(ctx)
+			if !tt.valid {
+				assert.Equal(t, codes.Unauthenticated, status.Code(err))
+				return
+			}
+
+			assert.NoError(t, err)
+			pl, ok := middleware.GetTokenFromContext(ctx)
+			assert.True(t, ok)
+			assert.Equal(t, "test", pl.Login)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	grpcmiddleware "github.com/grpc-ecosystem/go-grpc-middleware/v2"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultDeadlineUnaryInterceptor returns an interceptor that gives the calls
+// sent without a deadline the `timeout`, so a slow handler can't run without
+// a limit. The deadline of the client is kept when it has one. A handler
+// stopped by the deadline gets the `DeadlineExceeded` code.
+func DefaultDeadlineUnaryInterceptor(lg *zap.Logger, timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, cancel := withDefaultDeadline(ctx, lg, info.FullMethod, timeout)
+		defer cancel()
+
+		resp, err := handler(ctx, req)
+
+		return resp, deadlineError(err)
+	}
+}
+
+// DefaultDeadlineStreamInterceptor is `DefaultDeadlineUnaryInterceptor` for
+// streaming calls. The uploads of records get `uploadTimeout` instead, as
+// they last as long as the data takes to send; zero leaves them without
+// a deadline.
+func DefaultDeadlineStreamInterceptor(lg *zap.Logger, timeout time.Duration, uploadTimeout time.Duration) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		limit := timeout
+		if uploadMethods[info.FullMethod] {
+			limit = uploadTimeout
+		}
+
+		if limit <= 0 {
+			return handler(srv, ss)
+		}
+
+		ctx, cancel := withDefaultDeadline(ss.Context(), lg, info.FullMethod, limit)
+		defer cancel()
+
+		wrapped := grpcmiddleware.WrapServerStream(ss)
+		wrapped.WrappedContext = ctx
+
+		return deadlineError(handler(srv, wrapped))
+	}
+}
+
+// withDefaultDeadline sets the deadline of a call without one.
+func withDefaultDeadline(ctx context.Context, lg *zap.Logger, method string, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+
+	lg.Info("default deadline applied", zap.String("grpc.method", method), zap.Duration("timeout", timeout))
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// deadlineError turns a context error returned by a handler into the status
+// of the call, other errors are kept.
+func deadlineError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		if _, ok := status.FromError(err); !ok {
+			return status.FromContextError(err).Err()
+		}
+	}
+
+	return err
+}
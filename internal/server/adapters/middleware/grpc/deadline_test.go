@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// slowHandler waits for the deadline of the call, like a runaway query
+// respecting its context.
+func slowHandler(ctx context.Context, req any) (any, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(time.Minute):
+		return "done", nil
+	}
+}
+
+func TestDefaultDeadlineUnaryInterceptor(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	interceptor := DefaultDeadlineUnaryInterceptor(zap.New(core), 20*time.Millisecond)
+	info := &grpc.UnaryServerInfo{FullMethod: proto.Storage_ReadRecord_FullMethodName}
+
+	// A call without a deadline is stopped by the default one
+	start := time.Now()
+	_, err := interceptor(context.Background(), nil, info, slowHandler)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.Less(t, time.Since(start), time.Second)
+
+	entries := logs.FilterMessage("default deadline applied").All()
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, proto.Storage_ReadRecord_FullMethodName, entries[0].ContextMap()["grpc.method"])
+	}
+
+	// The deadline of the client is kept, even a longer one
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	resp, err := interceptor(ctx, nil, info, func(ctx context.Context, req any) (any, error) {
+		deadline, ok := ctx.Deadline()
+		assert.True(t, ok)
+		assert.Greater(t, time.Until(deadline), time.Second)
+		return "done", nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "done", resp)
+	assert.Len(t, logs.FilterMessage("default deadline applied").All(), 1)
+
+	// The errors of the handler are kept
+	_, err = interceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestDefaultDeadlineStreamInterceptor(t *testing.T) {
+	interceptor := DefaultDeadlineStreamInterceptor(zap.NewNop(), 20*time.Millisecond, 0)
+
+	slowStream := func(srv any, ss grpc.ServerStream) error {
+		_, err := slowHandler(ss.Context(), nil)
+		return err
+	}
+
+	stream := contextStream{ctx: context.Background()}
+
+	err := interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: "/test.Service/Watch"}, slowStream)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	// The uploads are left without a deadline
+	err = interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: proto.Storage_WriteRecord_FullMethodName},
+		func(srv any, ss grpc.ServerStream) error {
+			_, ok := ss.Context().Deadline()
+			assert.False(t, ok)
+			return nil
+		})
+	assert.NoError(t, err)
+
+	// or get their own
+	interceptor = DefaultDeadlineStreamInterceptor(zap.NewNop(), time.Minute, 20*time.Millisecond)
+	err = interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: proto.Storage_WriteRecord_FullMethodName}, slowStream)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
@@ -0,0 +1,92 @@
+// Package middleware provides various middlewares for the server.
+package middleware
+
+import (
+	"context"
+
+	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Policy maps the full names of the authenticated methods to the scope the
+// token needs to call them. A method missing in the policy is denied, so a
+// new method is not callable until its scope is declared.
+type Policy map[string]string
+
+// DefaultPolicy is the authorization policy of the `Storage` and `Admin`
+// services. The `Admin` service needs a token of the admin scope.
+var DefaultPolicy = Policy{
+	proto.Storage_ReadRecord_FullMethodName:     middleware.ScopeRead,
+	proto.Storage_ReadRecordMeta_FullMethodName: middleware.ScopeRead,
+	proto.Storage_ReadRecords_FullMethodName:    middleware.ScopeRead,
+	proto.Storage_ReadAllRecord_FullMethodName:  middleware.ScopeRead,
+	proto.Storage_ReadCategories_FullMethodName: middleware.ScopeRead,
+	proto.Storage_WriteRecord_FullMethodName:    middleware.ScopeFull,
+	proto.Storage_UpdateRecord_FullMethodName:   middleware.ScopeFull,
+	proto.Storage_UpdateMeta_FullMethodName:     middleware.ScopeFull,
+	proto.Storage_TagRecords_FullMethodName:     middleware.ScopeFull,
+	proto.Storage_DeleteRecord_FullMethodName:   middleware.ScopeFull,
+	proto.Storage_TransferRecord_FullMethodName: middleware.ScopeFull,
+	proto.Storage_ReadShares_FullMethodName:     middleware.ScopeRead,
+	proto.Storage_RevokeShare_FullMethodName:    middleware.ScopeFull,
+	proto.Storage_ValidateRecord_FullMethodName: middleware.ScopeFull,
+
+	proto.Admin_SetReadOnly_FullMethodName:       middleware.ScopeAdmin,
+	proto.Admin_DeleteOlderThan_FullMethodName:   middleware.ScopeAdmin,
+	proto.Admin_ReencryptAll_FullMethodName:      middleware.ScopeAdmin,
+	proto.Admin_RepairRecordTypes_FullMethodName: middleware.ScopeAdmin,
+}
+
+// Authorize checks that the token of the context allows calling the method.
+// It must run after the authentication, which puts the token in the context.
+func (p Policy) Authorize(ctx context.Context, method string) error {
+	token, ok := middleware.GetTokenFromContext(ctx)
+	if !ok {
+		//nolint:wrapcheck // This legal return
+		return status.Error(codes.Unauthenticated, "token not found")
+	}
+
+	scope, ok := p[method]
+	if !ok {
+		//nolint:wrapcheck // This legal return
+		return status.Errorf(codes.PermissionDenied, "method %s is not allowed", method)
+	}
+
+	if !token.HasScope(scope) {
+		//nolint:wrapcheck // This legal return
+		return status.Errorf(codes.PermissionDenied, "method %s requires the %s scope", method, scope)
+	}
+
+	return nil
+}
+
+// IsRead reports whether the method needs only the read scope.
+func (p Policy) IsRead(method string) bool {
+	return p[method] == middleware.ScopeRead
+}
+
+// PolicyUnaryInterceptor returns an interceptor that rejects the unary calls
+// not allowed by the policy with the `PermissionDenied` code.
+func PolicyUnaryInterceptor(p Policy) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := p.Authorize(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// PolicyStreamInterceptor is `PolicyUnaryInterceptor` for streaming calls.
+func PolicyStreamInterceptor(p Policy) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := p.Authorize(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
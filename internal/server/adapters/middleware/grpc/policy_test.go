@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestPolicyAuthorize(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		scope  string
+		code   codes.Code
+	}{
+		{name: "Read with read scope", method: proto.Storage_ReadRecord_FullMethodName, scope: middleware.ScopeRead, code: codes.OK},
+		{name: "Read with full scope", method: proto.Storage_ReadAllRecord_FullMethodName, scope: middleware.ScopeFull, code: codes.OK},
+		{name: "Read without scope", method: proto.Storage_ReadCategories_FullMethodName, scope: "", code: codes.OK},
+		{name: "Write with full scope", method: proto.Storage_WriteRecord_FullMethodName, scope: middleware.ScopeFull, code: codes.OK},
+		{name: "Write without scope", method: proto.Storage_DeleteRecord_FullMethodName, scope: "", code: codes.OK},
+		{name: "Write with read scope", method: proto.Storage_WriteRecord_FullMethodName, scope: middleware.ScopeRead, code: codes.PermissionDenied},
+		{name: "Transfer with read scope", method: proto.Storage_TransferRecord_FullMethodName, scope: middleware.ScopeRead, code: codes.PermissionDenied},
+		{name: "Read with admin scope", method: proto.Storage_ReadRecord_FullMethodName, scope: middleware.ScopeAdmin, code: codes.PermissionDenied},
+		{name: "Write with admin scope", method: proto.Storage_WriteRecord_FullMethodName, scope: middleware.ScopeAdmin, code: codes.PermissionDenied},
+		{name: "Admin with admin scope", method: proto.Admin_ReencryptAll_FullMethodName, scope: middleware.ScopeAdmin, code: codes.OK},
+		{name: "Admin with full scope", method: proto.Admin_SetReadOnly_FullMethodName, scope: middleware.ScopeFull, code: codes.PermissionDenied},
+		{name: "Admin without scope", method: proto.Admin_DeleteOlderThan_FullMethodName, scope: "", code: codes.PermissionDenied},
+		{name: "Unknown method", method: "/proto.Storage/Unknown", scope: middleware.ScopeFull, code: codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := middleware.SetTokenToContext(context.Background(), middleware.JWTclaims{ID: 1, Scope: tt.scope})
+
+			called := false
+			_, err := PolicyUnaryInterceptor(DefaultPolicy)(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method},
+				func(ctx context.Context, req any) (any, error) {
+					called = true
+					return nil, nil
+				})
+
+			assert.Equal(t, tt.code, status.Code(err))
+			assert.Equal(t, tt.code == codes.OK, called)
+		})
+	}
+
+	t.Run("Without token", func(t *testing.T) {
+		err := DefaultPolicy.Authorize(context.Background(), proto.Storage_ReadRecord_FullMethodName)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+}
+
+func TestDefaultPolicyCoversServices(t *testing.T) {
+	for _, desc := range []grpc.ServiceDesc{proto.Storage_ServiceDesc, proto.Admin_ServiceDesc} {
+		for _, m := range desc.Methods {
+			assert.Contains(t, DefaultPolicy, "/"+desc.ServiceName+"/"+m.MethodName)
+		}
+
+		for _, s := range desc.Streams {
+			assert.Contains(t, DefaultPolicy, "/"+desc.ServiceName+"/"+s.StreamName)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Package middleware provides various middlewares for the server.
+package middleware
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Keys of the response trailers with the quota of the user, so clients can
+// pace their requests instead of retrying blindly.
+const (
+	// RateLimitLimitKey is the number of calls allowed in a window.
+	RateLimitLimitKey = "ratelimit-limit"
+	// RateLimitRemainingKey is the number of calls left in the current window.
+	RateLimitRemainingKey = "ratelimit-remaining"
+	// RateLimitResetKey is the Unix time in seconds the quota is restored at.
+	RateLimitResetKey = "ratelimit-reset"
+)
+
+// DefaultRateLimitWindow is the default window of the rate limit.
+const DefaultRateLimitWindow = time.Minute
+
+// rateWindow is the usage of the quota of a user in a window.
+type rateWindow struct {
+	start time.Time
+	used  int
+}
+
+// RateLimiter allows every user `limit` calls per window. The quota is
+// restored at the end of the window that began with the first call.
+type RateLimiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	windows map[int]*rateWindow
+	swept   time.Time
+}
+
+// NewRateLimiter creates a limiter of `limit` calls per window of every user.
+// Zero window means DefaultRateLimitWindow.
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	if window == 0 {
+		window = DefaultRateLimitWindow
+	}
+
+	return &RateLimiter{
+		limit:   limit,
+		window:  window,
+		now:     time.Now,
+		windows: make(map[int]*rateWindow),
+	}
+}
+
+// take counts a call of the user. It returns the calls left in the window,
+// the time the window ends and whether the call is allowed.
+func (l *RateLimiter) take(user int) (int, time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+
+	// The windows of the users who stopped calling are dropped now and then
+	if now.Sub(l.swept) >= l.window {
+		for id, w := range l.windows {
+			if now.Sub(w.start) >= l.window {
+				delete(l.windows, id)
+			}
+		}
+		l.swept = now
+	}
+
+	w, ok := l.windows[user]
+	if !ok || now.Sub(w.start) >= l.window {
+		w = &rateWindow{start: now}
+		l.windows[user] = w
+	}
+
+	reset := w.start.Add(l.window)
+	if w.used >= l.limit {
+		return 0, reset, false
+	}
+
+	w.used++
+
+	return l.limit - w.used, reset, true
+}
+
+// allow counts the call of the user of the context and returns the trailer
+// with the quota. A call beyond the quota gets a `ResourceExhausted` error.
+func (l *RateLimiter) allow(ctx context.Context) (metadata.MD, error) {
+	token, ok := middleware.GetTokenFromContext(ctx)
+	if !ok {
+		//nolint:wrapcheck // This legal return
+		return nil, status.Error(codes.Unauthenticated, "token not found")
+	}
+
+	remaining, reset, ok := l.take(token.ID)
+	md := metadata.Pairs(
+		RateLimitLimitKey, strconv.Itoa(l.limit),
+		RateLimitRemainingKey, strconv.Itoa(remaining),
+		RateLimitResetKey, strconv.FormatInt(reset.Unix(), 10),
+	)
+	if !ok {
+		//nolint:wrapcheck // This legal return
+		return md, status.Errorf(codes.ResourceExhausted, "rate limit of %v calls per %v exceeded, retry after %v",
+			l.limit, l.window, reset.UTC().Format(time.RFC3339))
+	}
+
+	return md, nil
+}
+
+// UnaryInterceptor returns an interceptor limiting the unary calls. It must
+// run after the authentication, which puts the token in the context.
+func (l *RateLimiter) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, err := l.allow(ctx)
+		if md != nil {
+			// The trailer is only lost if the stream is already gone
+			_ = grpc.SetTrailer(ctx, md)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor is `UnaryInterceptor` for streaming calls, a stream
+// counts as one call.
+func (l *RateLimiter) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		md, err := l.allow(ss.Context())
+		if md != nil {
+			ss.SetTrailer(md)
+		}
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterWindow(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(2, time.Minute)
+	l.now = func() time.Time { return now }
+
+	remaining, reset, ok := l.take(1)
+	assert.True(t, ok)
+	assert.Equal(t, 1, remaining)
+	assert.Equal(t, now.Add(time.Minute), reset)
+
+	now = now.Add(30 * time.Second)
+	remaining, _, ok = l.take(1)
+	assert.True(t, ok)
+	assert.Zero(t, remaining)
+
+	_, reset, ok = l.take(1)
+	assert.False(t, ok)
+	assert.Equal(t, now.Add(30*time.Second), reset)
+
+	// Users have their own quota
+	_, _, ok = l.take(2)
+	assert.True(t, ok)
+
+	// The quota is restored with the next window
+	now = now.Add(30 * time.Second)
+	remaining, _, ok = l.take(1)
+	assert.True(t, ok)
+	assert.Equal(t, 1, remaining)
+}
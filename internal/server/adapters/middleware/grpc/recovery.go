@@ -0,0 +1,37 @@
+// Package middleware provides various middlewares for the server.
+package middleware
+
+import (
+	"context"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/recovery"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errInternal is returned to the client instead of the panic of a handler.
+var errInternal = status.Error(codes.Internal, "internal error")
+
+// RecoveryUnaryInterceptor returns an interceptor that recovers from panics
+// of unary handlers, so a single call can't crash the server. The panic is
+// logged with the stack trace and the client gets the `Internal` code.
+func RecoveryUnaryInterceptor(lg *zap.Logger) grpc.UnaryServerInterceptor {
+	return recovery.UnaryServerInterceptor(recovery.WithRecoveryHandlerContext(recoveryHandler(lg)))
+}
+
+// RecoveryStreamInterceptor is `RecoveryUnaryInterceptor` for streaming handlers.
+func RecoveryStreamInterceptor(lg *zap.Logger) grpc.StreamServerInterceptor {
+	return recovery.StreamServerInterceptor(recovery.WithRecoveryHandlerContext(recoveryHandler(lg)))
+}
+
+// recoveryHandler logs the recovered panic. It runs in the deferred recover,
+// so the stack trace still has the frames of the panic.
+func recoveryHandler(lg *zap.Logger) recovery.RecoveryHandlerFuncContext {
+	return func(ctx context.Context, p any) error {
+		lg.Error("recovered from panic", zap.Any("panic", p), zap.Stack("stack"))
+
+		return errInternal
+	}
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	grpcmiddleware "github.com/grpc-ecosystem/go-grpc-middleware/v2"
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
+	"google.golang.org/grpc"
+)
+
+// grpcErrorField is the field of the logs of the calls finished with an error.
+const grpcErrorField = "grpc.error"
+
+// sampleKey is the context key of the sampling decision of a call.
+type sampleKey struct{}
+
+// sample is the sampling decision of a call.
+type sample struct {
+	logged bool
+	start  time.Time
+}
+
+// LogSampler reduces the logs of the calls on busy servers: only 1 in `rate`
+// calls is logged. The calls finished with an error and the calls slower
+// than the threshold are always logged, so no failure is lost.
+type LogSampler struct {
+	rate  uint64
+	slow  time.Duration
+	calls atomic.Uint64
+	now   func() time.Time
+}
+
+// NewLogSampler creates a sampler logging 1 in `rate` calls and the calls
+// lasting at least `slow`. Zero slow disables the logs of the slow calls.
+func NewLogSampler(rate int, slow time.Duration) *LogSampler {
+	if rate < 1 {
+		rate = 1
+	}
+
+	return &LogSampler{rate: uint64(rate), slow: slow, now: time.Now}
+}
+
+// Logger wraps the logger of the logging interceptors, it drops the logs of
+// the calls not sampled by the interceptors of the sampler.
+func (s *LogSampler) Logger(l logging.Logger) logging.Logger {
+	return logging.LoggerFunc(func(ctx context.Context, lvl logging.Level, msg string, fields ...any) {
+		if s.keep(ctx, lvl, fields) {
+			l.Log(ctx, lvl, msg, fields...)
+		}
+	})
+}
+
+// keep decides whether a log of a call is written.
+func (s *LogSampler) keep(ctx context.Context, lvl logging.Level, fields []any) bool {
+	decision, ok := ctx.Value(sampleKey{}).(*sample)
+	if !ok || decision.logged || lvl >= logging.LevelError {
+		return true
+	}
+
+	for i := 0; i < len(fields); i += 2 {
+		if fields[i] == grpcErrorField {
+			return true
+		}
+	}
+
+	return s.slow > 0 && s.now().Sub(decision.start) >= s.slow
+}
+
+// decide samples a call and puts the decision in the context.
+func (s *LogSampler) decide(ctx context.Context) context.Context {
+	n := s.calls.Add(1)
+
+	return context.WithValue(ctx, sampleKey{}, &sample{logged: (n-1)%s.rate == 0, start: s.now()})
+}
+
+// UnaryInterceptor returns an interceptor sampling the unary calls. It must
+// run before the logging interceptor.
+func (s *LogSampler) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(s.decide(ctx), req)
+	}
+}
+
+// StreamInterceptor is `UnaryInterceptor` for streaming calls.
+func (s *LogSampler) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		wrapped := grpcmiddleware.WrapServerStream(ss)
+		wrapped.WrappedContext = s.decide(ss.Context())
+
+		return handler(srv, wrapped)
+	}
+}
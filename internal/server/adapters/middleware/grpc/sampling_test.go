@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLogSampler(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s := NewLogSampler(5, time.Second)
+	s.now = func() time.Time { return now }
+
+	finished := 0
+	logger := s.Logger(logging.LoggerFunc(func(_ context.Context, _ logging.Level, msg string, _ ...any) {
+		if msg == "finished call" {
+			finished++
+		}
+	}))
+
+	sampled := s.UnaryInterceptor()
+	logged := logging.UnaryServerInterceptor(logger, logging.WithLogOnEvents(logging.StartCall, logging.FinishCall))
+	info := &grpc.UnaryServerInfo{FullMethod: "/proto.Storage/ReadRecord"}
+
+	call := func(handler grpc.UnaryHandler) {
+		_, _ = sampled(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+			return logged(ctx, req, info, handler)
+		})
+	}
+	ok := func(context.Context, any) (any, error) { return "ok", nil }
+
+	// 1 in 5 calls is logged
+	for i := 0; i < 20; i++ {
+		call(ok)
+	}
+	assert.Equal(t, 4, finished)
+
+	// The failed calls are always logged
+	finished = 0
+	for i := 0; i < 4; i++ {
+		call(func(context.Context, any) (any, error) {
+			return nil, status.Error(codes.NotFound, "record not found")
+		})
+	}
+	assert.Equal(t, 4, finished)
+
+	// The slow calls are always logged
+	finished = 0
+	for i := 0; i < 4; i++ {
+		call(func(context.Context, any) (any, error) {
+			now = now.Add(2 * time.Second)
+			return "ok", nil
+		})
+	}
+	assert.Equal(t, 4, finished)
+
+	// Without sampling every call is logged
+	s = NewLogSampler(0, 0)
+	assert.True(t, s.keep(s.decide(context.Background()), logging.LevelInfo, nil))
+	assert.True(t, s.keep(s.decide(context.Background()), logging.LevelInfo, nil))
+}
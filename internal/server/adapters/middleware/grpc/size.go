@@ -0,0 +1,43 @@
+// Package middleware provides various middlewares for the server.
+package middleware
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// DefaultMaxCredentialsSize is the default maximum size in bytes of a
+// unary request carrying user credentials.
+const DefaultMaxCredentialsSize = 4096
+
+// MaxRequestSize returns a unary interceptor that rejects requests larger
+// than `limit` bytes with an `InvalidArgument` error before they reach
+// the handler. It keeps oversized logins and passwords from being hashed
+// and stored.
+func MaxRequestSize(limit int) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if msg, ok := req.(protobuf.Message); ok {
+			if size := protobuf.Size(msg); size > limit {
+				//nolint:wrapcheck // This legal return
+				return nil, status.Error(codes.InvalidArgument,
+					fmt.Sprintf("request size %v bytes exceeds the limit of %v bytes", size, limit))
+			}
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// CredentialsMatcher is a function that determines whether a given gRPC call
+// carries user credentials. It returns `true` for the calls of the
+// `User_ServiceDesc.ServiceName` service.
+func CredentialsMatcher(ctx context.Context, callMeta interceptors.CallMeta) bool {
+	return proto.User_ServiceDesc.ServiceName == callMeta.Service
+}
@@ -0,0 +1,65 @@
+// Package middleware provides various middlewares for the server.
+package middleware
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// uploadMethods are the streaming calls sending the data of a record, which
+// the server holds in memory until the stream ends.
+var uploadMethods = map[string]bool{
+	proto.Storage_WriteRecord_FullMethodName:  true,
+	proto.Storage_UpdateRecord_FullMethodName: true,
+}
+
+// MaxConcurrentUploads returns a stream interceptor that lets every user have
+// at most `limit` uploads open at once. An upload beyond the limit is
+// rejected with the `ResourceExhausted` code, so a single client can't
+// exhaust the memory of the server. It must run after the authentication,
+// which puts the token in the context.
+func MaxConcurrentUploads(limit int) grpc.StreamServerInterceptor {
+	var mu sync.Mutex
+	open := make(map[int]int)
+
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		token, ok := middleware.GetTokenFromContext(ss.Context())
+		if !ok {
+			//nolint:wrapcheck // This legal return
+			return status.Error(codes.Unauthenticated, "token not found")
+		}
+
+		mu.Lock()
+		if open[token.ID] >= limit {
+			mu.Unlock()
+			//nolint:wrapcheck // This legal return
+			return status.Errorf(codes.ResourceExhausted, "at most %v concurrent uploads are allowed", limit)
+		}
+		open[token.ID]++
+		mu.Unlock()
+
+		defer func() {
+			mu.Lock()
+			if open[token.ID]--; open[token.ID] == 0 {
+				delete(open, token.ID)
+			}
+			mu.Unlock()
+		}()
+
+		return handler(srv, ss)
+	}
+}
+
+// UploadMatcher is a function that determines whether a given gRPC call
+// uploads the data of a record. It returns `true` for `WriteRecord` and
+// `UpdateRecord` of the `Storage` service.
+func UploadMatcher(ctx context.Context, callMeta interceptors.CallMeta) bool {
+	return uploadMethods[callMeta.FullMethod()]
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// contextStream is a server stream with the given context.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestMaxConcurrentUploads(t *testing.T) {
+	limit := 2
+	interceptor := MaxConcurrentUploads(limit)
+	info := &grpc.StreamServerInfo{FullMethod: proto.Storage_WriteRecord_FullMethodName}
+
+	stream := func(user int) grpc.ServerStream {
+		return contextStream{ctx: middleware.SetTokenToContext(context.Background(), middleware.JWTclaims{ID: user})}
+	}
+
+	// The uploads stay open until release is closed
+	release := make(chan struct{})
+	started := make(chan struct{}, limit+3)
+	handler := func(srv any, ss grpc.ServerStream) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, limit+3)
+	for range limit {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- interceptor(nil, stream(1), info, handler)
+		}()
+	}
+	for range limit {
+		<-started
+	}
+
+	// The excess uploads of the user are rejected
+	for range 3 {
+		err := interceptor(nil, stream(1), info, handler)
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	}
+
+	// Another user has its own limit
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		errs <- interceptor(nil, stream(2), info, handler)
+	}()
+	<-started
+
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	// The finished uploads free their slots
+	err := interceptor(nil, stream(1), info, func(srv any, ss grpc.ServerStream) error { return nil })
+	assert.NoError(t, err)
+
+	err = interceptor(nil, contextStream{ctx: context.Background()}, info, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
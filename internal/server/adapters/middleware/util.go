@@ -3,6 +3,7 @@ package middleware
 
 import (
 	"context"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -11,14 +12,59 @@ import (
 // Using a custom type helps avoid collisions with other context keys.
 type contextKey int
 
+// Scopes of a JWT token. A token without a scope has full access.
+const (
+	// ScopeFull allows all operations.
+	ScopeFull = "full"
+	// ScopeRead allows only reading records.
+	ScopeRead = "read"
+	// ScopeAdmin allows only the calls of the Admin service, it gives no
+	// access to the records.
+	ScopeAdmin = "admin"
+)
+
 // JWTclaims represents the claims from a JWT token, including the user ID,
-// login, and standard JWT registered claims.
+// login, the time the user entered the password, the scope of the token and
+// standard JWT registered claims.
 type JWTclaims struct {
-	ID    int    `json:"id"`
-	Login string `json:"login"`
+	ID       int    `json:"id"`
+	Login    string `json:"login"`
+	AuthTime int64  `json:"auth_time,omitempty"`
+	Scope    string `json:"scope,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// CanWrite reports whether the token allows changing records.
+func (c JWTclaims) CanWrite() bool {
+	return c.Scope != ScopeRead && c.Scope != ScopeAdmin
+}
+
+// HasScope reports whether the token allows the operations of the scope.
+// The full scope includes the read scope, the admin scope includes neither.
+func (c JWTclaims) HasScope(scope string) bool {
+	switch scope {
+	case ScopeRead:
+		return c.Scope != ScopeAdmin
+	case ScopeFull:
+		return c.CanWrite()
+	case ScopeAdmin:
+		return c.Scope == ScopeAdmin
+	}
+
+	return false
+}
+
+// AuthenticatedWithin reports whether the user entered the password no
+// earlier than `window` ago. Tokens without the authentication time are
+// treated as stale.
+func (c JWTclaims) AuthenticatedWithin(window time.Duration) bool {
+	if c.AuthTime == 0 {
+		return false
+	}
+
+	return time.Since(time.Unix(c.AuthTime, 0)) <= window
+}
+
 // Enumeration of context keys used for storing values in context.
 const (
 	ContextKeyToken contextKey = iota
@@ -0,0 +1,147 @@
+// Package repository contains the data access layer for the application,
+// providing functions to interact with the database and perform operations
+// related to the domain entities such as `User` and `Storage`. This package
+// serves as an interface between the application services and the database,
+// utilizing an ORM (such as GORM) to execute queries and manage transactions.
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
+	"gorm.io/gorm"
+)
+
+// ErrNotEmpty is returned when a backup is imported into a database that
+// already has users or records.
+var ErrNotEmpty = errors.New("database is not empty")
+
+// ExportAll reads all users, records, previous versions of records, teams, vault keys
+// and WebAuthn credentials.
+// The tables are read in a single read-only repeatable read transaction,
+// so the copy is consistent even while the server is running.
+func (s *DB) ExportAll() (*domain.Backup, error) {
+	var b domain.Backup
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Order("id").Find(&b.Users).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Order("id").Find(&b.Records).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Order("id").Find(&b.Versions).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Order("id").Find(&b.Teams).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Order("team_id, user_id").Find(&b.Members).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Order("user_id").Find(&b.VaultKeys).Error; err != nil {
+			return err
+		}
+
+		return tx.Order("id").Find(&b.Passkeys).Error
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
+
+// ImportAll restores users, records, previous versions of records, teams, vault keys and WebAuthn credentials with
+// their original IDs in a single transaction. The database must not have
+// users or records, otherwise `ErrNotEmpty` is returned. The ID sequences
+// are moved past the restored rows, so new rows get fresh IDs.
+func (s *DB) ImportAll(b *domain.Backup) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var users, records int64
+		if err := tx.Model(&domain.User{}).Count(&users).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&domain.Storage{}).Count(&records).Error; err != nil {
+			return err
+		}
+		if users != 0 || records != 0 {
+			return ErrNotEmpty
+		}
+
+		//nolint:gomnd // This legal number
+		batch := 100
+
+		if len(b.Users) > 0 {
+			if err := tx.CreateInBatches(b.Users, batch).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(b.Records) > 0 {
+			if err := tx.CreateInBatches(b.Records, batch).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(b.Versions) > 0 {
+			if err := tx.CreateInBatches(b.Versions, batch).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(b.Teams) > 0 {
+			if err := tx.CreateInBatches(b.Teams, batch).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(b.Members) > 0 {
+			if err := tx.CreateInBatches(b.Members, batch).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(b.VaultKeys) > 0 {
+			if err := tx.CreateInBatches(b.VaultKeys, batch).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(b.Passkeys) > 0 {
+			if err := tx.CreateInBatches(b.Passkeys, batch).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, model := range []interface{}{&domain.User{}, &domain.Storage{}, &domain.StorageVersion{}, &domain.Team{},
+			&domain.WebAuthnCredential{}} {
+			if err := resetSequence(tx, model); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// resetSequence moves the ID sequence of the model table past its largest ID.
+func resetSequence(tx *gorm.DB, model interface{}) error {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(model); err != nil {
+		return fmt.Errorf("failed parse model: %w", err)
+	}
+
+	table := stmt.Schema.Table
+
+	return tx.Exec(
+		fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE(MAX(id), 1), MAX(id) IS NOT NULL) FROM %[1]s", table),
+	).Error
+}
@@ -16,8 +16,11 @@ import (
 	"gorm.io/gorm/logger"
 )
 
+// DB holds the database sessions. Writes always go to the primary session `db`,
+// while record reads go to `read`, which is either a read replica or the primary.
 type DB struct {
-	db *gorm.DB
+	db   *gorm.DB
+	read *gorm.DB
 }
 
 // NewDB initializes a new database session using the given DSN (Data Source Name).
@@ -25,39 +28,66 @@ type DB struct {
 // If the connection is successful, it proceeds to migrate the schema using
 // AutoMigrate for the `User` and `Storage` domain models. If an error occurs during
 // initialization or migration, an error is returned along with a partially initialized `DB` instance.
-func NewDB(ctx context.Context, lg *zap.Logger, dsn string) (*DB, error) {
-	db, err := gorm.Open(postgres.New(postgres.Config{
-		DSN: dsn,
-	}), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Silent),
-	})
+// When `readDSN` is not empty, a second session to the read replica is opened and used
+// for record reads. Otherwise reads fall back to the primary session.
+func NewDB(ctx context.Context, lg *zap.Logger, dsn string, readDSN string) (*DB, error) {
+	db, err := open(dsn)
 	if err != nil {
 		return &DB{}, fmt.Errorf("failed init db session: %w", err)
 	}
 
 	// Migrate the schema
-	err = db.AutoMigrate(&domain.User{}, &domain.Storage{})
+	err = db.AutoMigrate(&domain.User{}, &domain.Storage{}, &domain.StorageVersion{}, &domain.IdempotencyKey{},
+		&domain.Team{}, &domain.TeamMember{}, &domain.VaultKey{}, &domain.WebAuthnCredential{})
 	if err != nil {
 		return &DB{}, fmt.Errorf("failed migrate models: %w", err)
 	}
 
 	lg.Info(("Connection to postgre: success"))
 
+	read := db
+	if readDSN != "" {
+		read, err = open(readDSN)
+		if err != nil {
+			return &DB{db: db, read: db}, fmt.Errorf("failed init read replica session: %w", err)
+		}
+
+		lg.Info(("Connection to postgre read replica: success"))
+	}
+
 	return &DB{
-		db: db,
+		db:   db,
+		read: read,
 	}, nil
 }
 
-// Close close database connection.
+// open opens a GORM session to PostgreSQL with the logger in silent mode.
+func open(dsn string) (*gorm.DB, error) {
+	//nolint:wrapcheck // This legal return
+	return gorm.Open(postgres.New(postgres.Config{
+		DSN: dsn,
+	}), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+}
+
+// Close close database connections.
 func (s DB) Close() error {
-	sqlDB, err := s.db.DB()
-	if err != nil {
-		return fmt.Errorf("failed get sql db: %w", err)
+	sessions := []*gorm.DB{s.db}
+	if s.read != s.db {
+		sessions = append(sessions, s.read)
 	}
 
-	err = sqlDB.Close()
-	if err != nil {
-		return fmt.Errorf("failed close db: %w", err)
+	for _, session := range sessions {
+		sqlDB, err := session.DB()
+		if err != nil {
+			return fmt.Errorf("failed get sql db: %w", err)
+		}
+
+		err = sqlDB.Close()
+		if err != nil {
+			return fmt.Errorf("failed close db: %w", err)
+		}
 	}
 
 	return nil
@@ -6,22 +6,47 @@
 package repository
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/Renal37/goph-keeper/internal/server/core/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// ReadAllRecord retrieves all storage records for a specific owner.
+// accessible is the condition for the records a user can read:
+// own records and the records of the user's teams.
+const accessible = "(owner = ? OR team IN (?))"
+
+// storageTable is the table of the `Storage` records.
+const storageTable = "storages"
+
+// memberTeams returns a subquery selecting the IDs of the user's teams.
+func memberTeams(db *gorm.DB, user int) *gorm.DB {
+	return db.Model(&domain.TeamMember{}).Select("team_id").Where("user_id = ?", user)
+}
+
+// ReadAllRecord retrieves all storage records for a specific owner together
+// with the records of the owner's teams.
+// The query is served by the read session, which may be a replica.
+// Only the records matching the filter on the plaintext attributes are returned,
+// ordered by the sort.
+// The encrypted data key is selected as well, as encrypted names are
+// decrypted with it.
 // It uses the `Find` method to query the database for storage records
 // that match the specified owner. If no records are found, it returns
-// nil for both the slice of records and the error. If an error occurs
-// during the query, it returns the error.
-func (s *DB) ReadAllRecord(owner int) ([]*domain.Storage, error) {
+// an empty, non-nil slice and a nil error, so the error is returned only
+// when the query fails.
+func (s *DB) ReadAllRecord(owner int, filter domain.RecordFilter, sort domain.RecordSort) ([]*domain.Storage, error) {
 	docs := []*domain.Storage{}
 
-	req := s.db.Select("id", "name", "owner").Find(&docs, "owner = ?", owner)
-	if req.RowsAffected == 0 {
-		return nil, nil
+	query, err := orderQuery(s.listQuery(owner, filter), sort, domain.PageCursor{})
+	if err != nil {
+		return nil, err
 	}
 
+	req := query.Find(&docs)
 	if req.Error != nil {
 		return nil, req.Error
 	}
@@ -29,7 +54,137 @@ func (s *DB) ReadAllRecord(owner int) ([]*domain.Storage, error) {
 	return docs, nil
 }
 
+// ReadRecordPage retrieves a page of the records returned by `ReadAllRecord`.
+// The records are ordered by the sort, the page has at most `limit` records
+// following the `after` cursor. The sort values and the ID of the last record
+// are the cursor of the next page, so the pages stay consistent while records
+// are added or deleted.
+func (s *DB) ReadRecordPage(owner int, filter domain.RecordFilter, sort domain.RecordSort, after domain.PageCursor, limit int) ([]*domain.Storage, error) {
+	docs := []*domain.Storage{}
+
+	query, err := orderQuery(s.listQuery(owner, filter), sort, after)
+	if err != nil {
+		return nil, err
+	}
+
+	req := query.Limit(limit).Find(&docs)
+	if req.Error != nil {
+		return nil, req.Error
+	}
+
+	return docs, nil
+}
+
+// listQuery selects the listed columns of the records a user can read
+// matching the filter.
+func (s *DB) listQuery(owner int, filter domain.RecordFilter) *gorm.DB {
+	query := s.read.Select("id", "name", "name_encrypted", "key", "key_id", "algorithm", "bound", "type", "owner", "category", "folder", "version", "meta",
+		"team", "requires_confirmation", "created_at", "last_accessed_at", "mime_type", "uid").
+		Where(accessible, owner, memberTeams(s.read, owner))
+
+	return filterQuery(query, filter)
+}
+
+// filterQuery selects the records matching the filter. The tags are matched
+// by the JSON containment of the indexed metadata, the name by a
+// case-insensitive pattern with the wildcards of the filter escaped. The
+// folder matches itself and, by the prefix up to the separator, its nested
+// folders, so "work/aws" doesn't match "work/aws-old".
+func filterQuery(query *gorm.DB, filter domain.RecordFilter) *gorm.DB {
+	if filter.Category != "" {
+		query = query.Where("category = ?", filter.Category)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if len(filter.Tags) > 0 {
+		query = query.Where("meta @> ?::jsonb", filter.Tags)
+	}
+	if filter.Name != "" {
+		query = query.Where("name_encrypted = false AND name ILIKE ?", "%"+likeEscaper.Replace(filter.Name)+"%")
+	}
+	if filter.Folder != "" {
+		query = query.Where("(folder = ? OR folder LIKE ?)", filter.Folder,
+			likeEscaper.Replace(filter.Folder+domain.FolderSeparator)+"%")
+	}
+
+	return query
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// sortColumns maps the sort keys to the columns. Only these columns get into
+// the order clause, which can't be passed as a query parameter.
+var sortColumns = map[string]string{
+	domain.SortName:         "name",
+	domain.SortType:         "type",
+	domain.SortCreatedAt:    "created_at",
+	domain.SortLastAccessed: "last_accessed_at",
+}
+
+// orderQuery orders the query by the columns of the sort and the ID and
+// selects the records following the cursor. The row comparison works as
+// all columns share the direction.
+func orderQuery(query *gorm.DB, sort domain.RecordSort, after domain.PageCursor) (*gorm.DB, error) {
+	dir, cmp := "ASC", ">"
+	if sort.Desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	columns := make([]string, 0, len(sort.Keys)+1)
+	for _, key := range sort.Keys {
+		column, ok := sortColumns[key]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", domain.ErrInvalidSort, key)
+		}
+
+		columns = append(columns, column)
+	}
+	columns = append(columns, "id")
+
+	for _, column := range columns {
+		query = query.Order(column + " " + dir)
+	}
+
+	if after.ID == 0 {
+		return query, nil
+	}
+
+	values, err := sort.CursorValues(after)
+	if err != nil {
+		return nil, err
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+
+	return query.Where("("+strings.Join(columns, ", ")+") "+cmp+" ("+placeholders+")", values...), nil
+}
+
+// ReadCategories retrieves the distinct categories of an owner's records
+// and the records of the owner's teams together with the number of records
+// in each one, ordered by name.
+// Records without a category are not counted.
+func (s *DB) ReadCategories(owner int) ([]domain.CategoryCount, error) {
+	categories := []domain.CategoryCount{}
+
+	req := s.read.Model(&domain.Storage{}).
+		Select("category AS name", "count(*) AS count").
+		Where(accessible, owner, memberTeams(s.read, owner)).
+		Where("category <> ''").
+		Group("category").
+		Order("category").
+		Scan(&categories)
+	if req.Error != nil {
+		return nil, req.Error
+	}
+
+	return categories, nil
+}
+
 // ReadRecord retrieves a specific storage record by its ID and owner.
+// A member of the record's team can read it as well.
+// The query is served by the read session, which may be a replica.
 // It uses the `First` method to query the database for a storage record
 // that matches the specified ID and owner. If no record is found, it returns
 // nil for both the record and the error. If an error occurs during the query,
@@ -37,7 +192,7 @@ func (s *DB) ReadAllRecord(owner int) ([]*domain.Storage, error) {
 func (s *DB) ReadRecord(id int, owner int) (*domain.Storage, error) {
 	doc := domain.Storage{}
 
-	req := s.db.First(&doc, "id = ? AND owner = ?", id, owner)
+	req := s.read.Where(accessible, owner, memberTeams(s.read, owner)).First(&doc, "id = ?", id)
 	if req.RowsAffected == 0 {
 		//nolint:nilnil // This legal return
 		return nil, nil
@@ -50,11 +205,125 @@ func (s *DB) ReadRecord(id int, owner int) (*domain.Storage, error) {
 	return &doc, nil
 }
 
+// ReadRecords retrieves the records with the given IDs owned by `owner`
+// or shared with the owner's teams.
+// The records of other owners and unknown IDs are left out.
+// The query is served by the read session, which may be a replica.
+func (s *DB) ReadRecords(ids []int, owner int) ([]domain.Storage, error) {
+	var docs []domain.Storage
+
+	req := s.read.Where(accessible, owner, memberTeams(s.read, owner)).Find(&docs, "id IN ?", ids)
+	if req.Error != nil {
+		return nil, req.Error
+	}
+
+	return docs, nil
+}
+
+// ResolveRecordUIDs maps the UUIDs of the records the user can read to their
+// IDs. The UUIDs of other users' records and unknown UUIDs are left out.
+// The query is served by the read session, which may be a replica.
+func (s *DB) ResolveRecordUIDs(uids []string, user int) (map[string]int, error) {
+	var docs []domain.Storage
+
+	req := s.read.Select("id", "uid").Where(accessible, user, memberTeams(s.read, user)).Find(&docs, "uid IN ?", uids)
+	if req.Error != nil {
+		return nil, req.Error
+	}
+
+	ids := make(map[string]int, len(docs))
+	for _, doc := range docs {
+		ids[doc.UID] = doc.ID
+	}
+
+	return ids, nil
+}
+
+// AssignRecordUIDs gives a random UUID to the records written before the
+// server used UUID record IDs and returns their number.
+func (s *DB) AssignRecordUIDs() (int, error) {
+	req := s.db.Model(&domain.Storage{}).Where("uid = ''").Update("uid", gorm.Expr("gen_random_uuid()::text"))
+	if req.Error != nil {
+		return 0, req.Error
+	}
+
+	return int(req.RowsAffected), nil
+}
+
+// NextRecordID reserves the ID of a new record from the sequence of the IDs,
+// so the record can be encrypted before it is written. A reserved ID that is
+// never written is just skipped.
+func (s *DB) NextRecordID() (int, error) {
+	var id int
+
+	err := s.db.Raw("SELECT nextval(pg_get_serial_sequence(?, 'id'))", storageTable).Scan(&id).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
 // WriteRecord adds a new storage record to the database.
-// It uses the `Create` method to insert the record. If an error occurs
-// during the insertion, it returns the error.
-func (s *DB) WriteRecord(doc domain.Storage) error {
+// It uses the `Create` method to insert the record and returns the ID
+// of the created record. If an error occurs during the insertion, it
+// returns the error.
+func (s *DB) WriteRecord(doc domain.Storage) (int, error) {
 	req := s.db.Create(&doc)
+	if req.Error != nil {
+		return 0, req.Error
+	}
+
+	return doc.ID, nil
+}
+
+// WriteRecordWithKey adds a new storage record together with the idempotency
+// key of the write request. Both rows are created in a single transaction, so
+// a key is never stored without its record. If the key already exists for the
+// owner, the transaction is rolled back and the unique violation is returned.
+func (s *DB) WriteRecordWithKey(doc domain.Storage, key string) (int, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&doc).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&domain.IdempotencyKey{
+			Key:      key,
+			Owner:    doc.Owner,
+			RecordID: doc.ID,
+		}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return doc.ID, nil
+}
+
+// FindIdempotencyKey retrieves an idempotency key by its value and owner
+// created after the given time, the older keys have expired.
+// If no key is found, it returns nil for both the key and the error.
+func (s *DB) FindIdempotencyKey(key string, owner int, after time.Time) (*domain.IdempotencyKey, error) {
+	k := domain.IdempotencyKey{}
+
+	req := s.db.First(&k, "key = ? AND owner = ? AND created_at >= ?", key, owner, after)
+	if req.RowsAffected == 0 {
+		//nolint:nilnil // This legal return
+		return nil, nil
+	}
+
+	if req.Error != nil {
+		return nil, req.Error
+	}
+
+	return &k, nil
+}
+
+// DeleteIdempotencyKeys removes the idempotency keys of the owner created
+// before the given time. Expired keys no longer protect against duplicate
+// writes, and a removed key can be used again.
+func (s *DB) DeleteIdempotencyKeys(owner int, before time.Time) error {
+	req := s.db.Delete(&domain.IdempotencyKey{}, "owner = ? AND created_at < ?", owner, before)
 	if req.Error != nil {
 		return req.Error
 	}
@@ -62,16 +331,419 @@ func (s *DB) WriteRecord(doc domain.Storage) error {
 	return nil
 }
 
-// DeleteRecord removes a storage record from the database by its ID and owner.
-// It uses the `Delete` method to remove the record. If an error occurs during
+// UpdateRecord replaces the name, type and encrypted value of a record owned
+// by `doc.Owner`, but only if the record still has the expected version.
+// The replaced contents are kept as a previous version of the record.
+// The record is marked as accessed.
+// On success the version is incremented and the new version is returned.
+// It returns `domain.ErrNotFound` if the record does not exist and
+// `domain.ErrVersionConflict` if it was changed by someone else in between.
+func (s *DB) UpdateRecord(doc domain.Storage, version int) (int, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		cur := domain.Storage{}
+
+		req := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "name", "name_encrypted", "type", "value", "key", "key_id", "algorithm", "bound", "owner", "version", "mime_type").
+			Find(&cur, "id = ? AND owner = ?", doc.ID, doc.Owner)
+		if req.Error != nil {
+			return req.Error
+		}
+
+		if req.RowsAffected == 0 {
+			return domain.ErrNotFound
+		}
+
+		if cur.Version != version {
+			return domain.ErrVersionConflict
+		}
+
+		err := tx.Create(&domain.StorageVersion{
+			RecordID:      cur.ID,
+			Version:       cur.Version,
+			Owner:         cur.Owner,
+			Name:          cur.Name,
+			Type:          cur.Type,
+			Value:         cur.Value,
+			Key:           cur.Key,
+			Algorithm:     cur.Algorithm,
+			KeyID:         cur.KeyID,
+			NameEncrypted: cur.NameEncrypted,
+			Bound:         cur.Bound,
+			MimeType:      cur.MimeType,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&domain.Storage{}).
+			Where("id = ?", doc.ID).
+			Updates(map[string]interface{}{
+				"name":             doc.Name,
+				"name_encrypted":   doc.NameEncrypted,
+				"type":             doc.Type,
+				"value":            doc.Value,
+				"key":              doc.Key,
+				"algorithm":        doc.Algorithm,
+				"key_id":           doc.KeyID,
+				"bound":            doc.Bound,
+				"mime_type":        doc.MimeType,
+				"version":          version + 1,
+				"last_accessed_at": time.Now(),
+			}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return version + 1, nil
+}
+
+// ReadRecordVersion retrieves a previous version of a record owned by `owner`.
+// The query is served by the read session, which may be a replica.
+// The current version of the record is not kept in the history, use
+// `ReadRecord` for it. The versions require the confirmation of a read as
+// the current record does. If the version is not found, it returns nil for
+// both the record and the error.
+func (s *DB) ReadRecordVersion(id int, owner int, version int) (*domain.Storage, error) {
+	v := domain.StorageVersion{}
+
+	req := s.read.First(&v, "record_id = ? AND owner = ? AND version = ?", id, owner, version)
+	if req.RowsAffected == 0 {
+		//nolint:nilnil // This legal return
+		return nil, nil
+	}
+
+	if req.Error != nil {
+		return nil, req.Error
+	}
+
+	var current domain.Storage
+	err := s.read.Select("requires_confirmation", "uid").Where("id = ?", id).Take(&current).Error
+	if err != nil {
+		return nil, err
+	}
+
+	doc := v.Record()
+	doc.RequiresConfirmation = current.RequiresConfirmation
+	doc.UID = current.UID
+
+	return &doc, nil
+}
+
+// sealedColumns returns the columns of the encrypted contents of a record.
+func sealedColumns(doc domain.Storage) map[string]any {
+	return map[string]any{
+		"name":           doc.Name,
+		"name_encrypted": doc.NameEncrypted,
+		"value":          doc.Value,
+		"key":            doc.Key,
+		"algorithm":      doc.Algorithm,
+		"key_id":         doc.KeyID,
+		"bound":          doc.Bound,
+	}
+}
+
+// UpdateMeta changes the metadata of a record owned by `owner` and returns
+// the resulting metadata. The record row is locked for the duration of the
+// transaction, so concurrent metadata updates do not lose each other's changes.
+// With `replace` the metadata is replaced by `set`, otherwise `set` is merged
+// into it; the `remove` keys are deleted in both cases. The encrypted value and
+// key of the record are not touched. If the record is not found, it returns
+// `domain.ErrNotFound`.
+func (s *DB) UpdateMeta(id int, owner int, set domain.Meta, remove []string, replace bool) (domain.Meta, error) {
+	var meta domain.Meta
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		doc := domain.Storage{}
+
+		req := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "meta").
+			Find(&doc, "id = ? AND owner = ?", id, owner)
+		if req.Error != nil {
+			return req.Error
+		}
+
+		if req.RowsAffected == 0 {
+			return domain.ErrNotFound
+		}
+
+		meta = doc.Meta.Apply(set, remove, replace)
+
+		return tx.Model(&domain.Storage{}).Where("id = ?", id).Update("meta", meta).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+}
+
+// TagRecords merges the tags into the metadata of the records of the owner
+// matching the filter and sets their category, an empty category is not
+// changed. All records are updated by a single statement. It returns the
+// number of updated records.
+func (s *DB) TagRecords(owner int, filter domain.RecordFilter, set domain.Meta, category string) (int, error) {
+	updates := map[string]any{}
+	if len(set) > 0 {
+		updates["meta"] = gorm.Expr("meta || ?::jsonb", set)
+	}
+	if category != "" {
+		updates["category"] = category
+	}
+
+	req := filterQuery(s.db.Model(&domain.Storage{}).Where("owner = ?", owner), filter).Updates(updates)
+	if req.Error != nil {
+		return 0, req.Error
+	}
+
+	return int(req.RowsAffected), nil
+}
+
+// TransferRecord makes the user with the login the owner of a record owned
+// by `owner`. The previous versions of the record move with it, and the
+// idempotency keys of the record are forgotten, so a retried write of the
+// previous owner can't return the record anymore. The encryption of the
+// record and its versions is bound to the owner, `rebind` encrypts them for
+// the new owner; if it fails, nothing is changed. It returns
+// `domain.ErrUserNotFound` if there is no user with the login and
+// `domain.ErrNotFound` if the record is not found.
+func (s *DB) TransferRecord(id int, owner int, login string, rebind func(doc *domain.Storage, owner int) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		user := domain.User{}
+
+		req := tx.Select("id").Find(&user, "login = ?", login)
+		if req.Error != nil {
+			return req.Error
+		}
+
+		if req.RowsAffected == 0 {
+			return domain.ErrUserNotFound
+		}
+
+		doc := domain.Storage{}
+
+		req = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Find(&doc, "id = ? AND owner = ?", id, owner)
+		if req.Error != nil {
+			return req.Error
+		}
+
+		if req.RowsAffected == 0 {
+			return domain.ErrNotFound
+		}
+
+		if err := rebind(&doc, user.ID); err != nil {
+			return err
+		}
+
+		columns := sealedColumns(doc)
+		columns["owner"] = user.ID
+
+		if err := tx.Model(&domain.Storage{}).Where("id = ?", id).Updates(columns).Error; err != nil {
+			return err
+		}
+
+		var versions []domain.StorageVersion
+		if err := tx.Find(&versions, "record_id = ?", id).Error; err != nil {
+			return err
+		}
+
+		for _, v := range versions {
+			doc := v.Record()
+			if err := rebind(&doc, user.ID); err != nil {
+				return err
+			}
+
+			columns := sealedColumns(doc)
+			columns["owner"] = user.ID
+
+			if err := tx.Model(&domain.StorageVersion{}).Where("id = ?", v.ID).Updates(columns).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(&domain.IdempotencyKey{}, "record_id = ?", id).Error
+	})
+}
+
+// DeleteRecord removes a storage record from the database by its ID and owner
+// together with its previous versions and idempotency keys, so a retried write
+// with the key of the record writes a new record. If an error occurs during
 // the deletion, it returns the error.
 func (s *DB) DeleteRecord(id int, owner int) error {
-	doc := domain.Storage{}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Delete(&domain.StorageVersion{}, "record_id = ? AND owner = ?", id, owner).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Delete(&domain.IdempotencyKey{}, "record_id = ? AND owner = ?", id, owner).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Delete(&domain.Storage{}, "id = ? AND owner = ?", id, owner).Error
+	})
+}
+
+// TouchRecords sets the time of the last access of the records with the given IDs.
+func (s *DB) TouchRecords(ids []int, at time.Time) error {
+	return s.db.Model(&domain.Storage{}).Where("id IN ?", ids).Update("last_accessed_at", at).Error
+}
+
+// ReadRecordsToReencrypt retrieves at most `limit` records with an ID greater
+// than `after` whose data is encrypted with an algorithm other than the given
+// one, or whose data key is encrypted with a master key other than `keyID`,
+// or encrypted with the legacy AES-128 (without the "v2:" marker), ordered
+// by the ID.
+func (s *DB) ReadRecordsToReencrypt(algorithm string, keyID string, after int, limit int) ([]domain.Storage, error) {
+	docs := []domain.Storage{}
 
-	req := s.db.Delete(&doc, "id = ? AND owner = ?", id, owner)
+	req := s.db.Select("id", "owner", "name", "name_encrypted", "value", "key", "key_id", "algorithm", "bound", "version").
+		Where("(algorithm <> ? OR key_id <> ? OR (algorithm = 'aes-gcm' AND key NOT LIKE 'v2:%')) AND id > ?",
+			algorithm, keyID, after).
+		Order("id").Limit(limit).Find(&docs)
+	if req.Error != nil {
+		return nil, req.Error
+	}
+
+	return docs, nil
+}
+
+// ReencryptRecord replaces the encrypted value, key and name of a record and
+// its algorithm. The record keeps its version, as the data is not changed.
+// If the record was updated or deleted since it was read at `version`, it
+// returns `domain.ErrNotFound`.
+func (s *DB) ReencryptRecord(doc domain.Storage, version int) error {
+	req := s.db.Model(&domain.Storage{}).
+		Where("id = ? AND version = ?", doc.ID, version).
+		Updates(sealedColumns(doc))
+	if req.Error != nil {
+		return req.Error
+	}
+
+	if req.RowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+// ReadVersionsToReencrypt retrieves at most `limit` versions of the history
+// with an ID greater than `after` that need re-encryption by the same rules
+// as `ReadRecordsToReencrypt`, ordered by the ID of the version.
+func (s *DB) ReadVersionsToReencrypt(algorithm string, keyID string, after int, limit int) ([]domain.StorageVersion, error) {
+	versions := []domain.StorageVersion{}
+
+	req := s.db.Select("id", "record_id", "version", "owner", "name", "name_encrypted", "value", "key", "key_id", "algorithm", "bound").
+		Where("(algorithm <> ? OR key_id <> ? OR (algorithm = 'aes-gcm' AND key NOT LIKE 'v2:%')) AND id > ?",
+			algorithm, keyID, after).
+		Order("id").Limit(limit).Find(&versions)
+	if req.Error != nil {
+		return nil, req.Error
+	}
+
+	return versions, nil
+}
+
+// ReencryptVersion replaces the encrypted value, key and name of the version
+// of the history with the ID and its algorithm. The versions are not changed
+// otherwise, so only a version deleted with its record since it was read
+// returns `domain.ErrNotFound`.
+func (s *DB) ReencryptVersion(id int, doc domain.Storage) error {
+	req := s.db.Model(&domain.StorageVersion{}).
+		Where("id = ?", id).
+		Updates(sealedColumns(doc))
+	if req.Error != nil {
+		return req.Error
+	}
+
+	if req.RowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+// ReadRecordsWithInvalidType retrieves at most `limit` records with an ID
+// greater than `after` whose type is empty or not one of the types, ordered
+// by the ID.
+func (s *DB) ReadRecordsWithInvalidType(types []string, after int, limit int) ([]domain.Storage, error) {
+	docs := []domain.Storage{}
+
+	req := s.db.Select("id", "owner", "type", "value", "key", "key_id", "algorithm", "bound").
+		Where("type NOT IN ? AND id > ?", types, after).
+		Order("id").Limit(limit).Find(&docs)
+	if req.Error != nil {
+		return nil, req.Error
+	}
+
+	return docs, nil
+}
+
+// UpdateRecordType changes the type of a record from `from` to `to`. If the
+// record was deleted or its type changed since it was read, it returns
+// `domain.ErrNotFound`.
+func (s *DB) UpdateRecordType(id int, from string, to string) error {
+	req := s.db.Model(&domain.Storage{}).Where("id = ? AND type = ?", id, from).Update("type", to)
 	if req.Error != nil {
 		return req.Error
 	}
 
+	if req.RowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+
 	return nil
 }
+
+// DeleteRecordsBefore removes the records older than the cutoff together with
+// their previous versions and idempotency keys. Every batch of at most `batch`
+// records is removed in its own transaction, so the rows are not locked for
+// the whole cleanup and concurrent calls skip the rows locked by each other.
+// It returns the number of removed records, including the batches removed
+// before an error.
+func (s *DB) DeleteRecordsBefore(cutoff domain.RetentionCutoff, batch int) (int, error) {
+	column := "created_at"
+	if cutoff.LastAccessed {
+		column = "last_accessed_at"
+	}
+
+	deleted := 0
+	for {
+		var ids []int
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			query := tx.Model(&domain.Storage{}).
+				Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where(column+" < ?", cutoff.Before)
+			if cutoff.Owner != 0 {
+				query = query.Where("owner = ?", cutoff.Owner)
+			}
+
+			if err := query.Order("id").Limit(batch).Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+
+			if len(ids) == 0 {
+				return nil
+			}
+
+			if err := tx.Delete(&domain.StorageVersion{}, "record_id IN ?", ids).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Delete(&domain.IdempotencyKey{}, "record_id IN ?", ids).Error; err != nil {
+				return err
+			}
+
+			return tx.Delete(&domain.Storage{}, "id IN ?", ids).Error
+		})
+		if err != nil {
+			return deleted, err
+		}
+
+		deleted += len(ids)
+		if len(ids) < batch {
+			return deleted, nil
+		}
+	}
+}
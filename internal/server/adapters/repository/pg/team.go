@@ -0,0 +1,187 @@
+// Package repository contains the data access layer for the application,
+// providing functions to interact with the database and perform operations
+// related to the domain entities such as `User` and `Storage`. This package
+// serves as an interface between the application services and the database,
+// utilizing an ORM (such as GORM) to execute queries and manage transactions.
+package repository
+
+import (
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
+	"gorm.io/gorm/clause"
+)
+
+// CreateTeam creates a new team with the given name.
+// If an error occurs during the database operation, it returns `nil` for
+// the team and the error, e.g. when the name is already taken.
+func (s *DB) CreateTeam(name string) (*domain.Team, error) {
+	team := domain.Team{Name: name}
+
+	req := s.db.Create(&team)
+	if req.Error != nil {
+		return nil, req.Error
+	}
+
+	return &team, nil
+}
+
+// FindTeamByName retrieves a team by its name. If the team is not found,
+// it returns `nil` for both the team and error.
+func (s *DB) FindTeamByName(name string) (*domain.Team, error) {
+	team := domain.Team{}
+
+	req := s.db.First(&team, "name = ?", name)
+	if req.RowsAffected == 0 {
+		//nolint:nilnil // This legal return
+		return nil, nil
+	}
+
+	if req.Error != nil {
+		return nil, req.Error
+	}
+
+	return &team, nil
+}
+
+// AddTeamMember adds the user to the team. Adding an existing member does nothing.
+func (s *DB) AddTeamMember(team int, user int) error {
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&domain.TeamMember{TeamID: team, UserID: user}).Error
+}
+
+// RemoveTeamMember removes the user from the team. The records the user
+// wrote to the team stay in the team.
+func (s *DB) RemoveTeamMember(team int, user int) error {
+	return s.db.Delete(&domain.TeamMember{}, "team_id = ? AND user_id = ?", team, user).Error
+}
+
+// IsTeamMember reports whether the user is a member of the team.
+func (s *DB) IsTeamMember(team int, user int) (bool, error) {
+	var count int64
+
+	req := s.db.Model(&domain.TeamMember{}).Where("team_id = ? AND user_id = ?", team, user).Count(&count)
+	if req.Error != nil {
+		return false, req.Error
+	}
+
+	return count > 0, nil
+}
+
+// shareColumns are the columns of the shared records. The data is left out,
+// the data key is selected as encrypted names are decrypted with it.
+var shareColumns = []string{"id", "uid", "name", "name_encrypted", "key", "key_id", "algorithm", "bound", "type", "owner", "team"}
+
+// ReadSharesOut retrieves the records of the owner shared with a team,
+// ordered by ID, together with the logins of the other members of the team.
+// The query is served by the read session, which may be a replica.
+func (s *DB) ReadSharesOut(owner int) ([]domain.Share, error) {
+	var docs []domain.Storage
+
+	req := s.read.Select(shareColumns).Where("owner = ? AND team <> 0", owner).Order("id").Find(&docs)
+	if req.Error != nil {
+		return nil, req.Error
+	}
+
+	var members []struct {
+		TeamID int
+		Login  string
+	}
+
+	req = s.read.Model(&domain.TeamMember{}).
+		Select("team_members.team_id", "users.login").
+		Joins("JOIN users ON users.id = team_members.user_id").
+		Where("team_members.team_id IN (?) AND team_members.user_id <> ?", teamsOf(docs), owner).
+		Order("users.login").
+		Scan(&members)
+	if req.Error != nil {
+		return nil, req.Error
+	}
+
+	logins := make(map[int][]string)
+	for _, m := range members {
+		logins[m.TeamID] = append(logins[m.TeamID], m.Login)
+	}
+
+	return s.shares(docs, func(doc domain.Storage) []string {
+		return logins[doc.Team]
+	})
+}
+
+// ReadSharesIn retrieves the records of other users shared with the teams of
+// the user, ordered by ID, together with the logins of their owners.
+// The query is served by the read session, which may be a replica.
+func (s *DB) ReadSharesIn(user int) ([]domain.Share, error) {
+	var docs []domain.Storage
+
+	req := s.read.Select(shareColumns).
+		Where("owner <> ? AND team IN (?)", user, memberTeams(s.read, user)).
+		Order("id").
+		Find(&docs)
+	if req.Error != nil {
+		return nil, req.Error
+	}
+
+	owners := make([]int, 0, len(docs))
+	for _, doc := range docs {
+		owners = append(owners, doc.Owner)
+	}
+
+	var users []domain.User
+	if err := s.read.Select("id", "login").Find(&users, "id IN (?)", owners).Error; err != nil {
+		return nil, err
+	}
+
+	logins := make(map[int]string, len(users))
+	for _, u := range users {
+		logins[u.ID] = u.Login
+	}
+
+	return s.shares(docs, func(doc domain.Storage) []string {
+		return []string{logins[doc.Owner]}
+	})
+}
+
+// shares pairs the shared records with the names of their teams and the logins.
+func (s *DB) shares(docs []domain.Storage, logins func(doc domain.Storage) []string) ([]domain.Share, error) {
+	var teams []domain.Team
+	if err := s.read.Find(&teams, "id IN (?)", teamsOf(docs)).Error; err != nil {
+		return nil, err
+	}
+
+	names := make(map[int]string, len(teams))
+	for _, t := range teams {
+		names[t.ID] = t.Name
+	}
+
+	shares := make([]domain.Share, 0, len(docs))
+	for _, doc := range docs {
+		shares = append(shares, domain.Share{Record: doc, TeamName: names[doc.Team], Logins: logins(doc)})
+	}
+
+	return shares, nil
+}
+
+// teamsOf returns the teams of the records.
+func teamsOf(docs []domain.Storage) []int {
+	teams := make([]int, 0, len(docs))
+	for _, doc := range docs {
+		teams = append(teams, doc.Team)
+	}
+
+	return teams
+}
+
+// RevokeShare makes a shared record of the owner private again, the members
+// of its team can't read it anymore. It returns `domain.ErrNotFound` if the
+// owner has no such shared record.
+func (s *DB) RevokeShare(id int, owner int) error {
+	req := s.db.Model(&domain.Storage{}).Where("id = ? AND owner = ? AND team <> 0", id, owner).Update("team", 0)
+	if req.Error != nil {
+		return req.Error
+	}
+
+	if req.RowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
@@ -7,16 +7,22 @@ package repository
 
 import (
 	"github.com/Renal37/goph-keeper/internal/server/core/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// FindUserByLogin retrieves a user by their login. It uses the ORM `First` method
-// to find a user with the specified login in the database. If the user is not found,
+// FindUserByLogin retrieves a user by their login or email. It uses the ORM `First` method
+// to find a user with the specified login or email in the database. The user with
+// the login is preferred over the user with the email. If the user is not found,
 // it returns `nil` for both the user and error. If an error occurs during the
 // database operation, it returns `nil` for the user and the error.
 func (s *DB) FindUserByLogin(login string) (*domain.User, error) {
 	user := domain.User{}
 
-	req := s.db.First(&user, "login = ?", login)
+	// A login matching the email of another user still selects its owner
+	req := s.db.Where("login = ? OR (email <> '' AND email = ?)", login, login).
+		Order(clause.OrderBy{Expression: clause.Expr{SQL: "login = ? DESC", Vars: []any{login}}}).
+		First(&user)
 	if req.RowsAffected == 0 {
 		//nolint:nilnil // This legal return
 		return nil, nil
@@ -46,3 +52,116 @@ func (s *DB) CreateUser(login, hash string) (*domain.User, error) {
 
 	return &user, nil
 }
+
+// CreateUserWithVaultKey creates a new user together with the vault key of
+// the user. Both rows are created in a single transaction, so a user is
+// never stored without the key. The `UserID` of the key is set to the ID
+// of the created user.
+func (s *DB) CreateUserWithVaultKey(login, email, hash string, key domain.VaultKey) (*domain.User, error) {
+	user := domain.User{
+		Login: login,
+		Email: email,
+		Hash:  hash,
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+
+		key.UserID = user.ID
+
+		return tx.Create(&key).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// FindVaultKey retrieves the vault key of the user. If the user has no key,
+// e.g. was registered before the keys were introduced, it returns `nil`
+// for both the key and error.
+func (s *DB) FindVaultKey(user int) (*domain.VaultKey, error) {
+	key := domain.VaultKey{}
+
+	req := s.db.First(&key, "user_id = ?", user)
+	if req.RowsAffected == 0 {
+		//nolint:nilnil // This legal return
+		return nil, nil
+	}
+
+	if req.Error != nil {
+		return nil, req.Error
+	}
+
+	return &key, nil
+}
+
+// UpdatePassword replaces the password hash and the vault key of the user
+// in a single transaction, so the key is always wrapped under the current
+// password. A missing vault key is created.
+func (s *DB) UpdatePassword(user int, hash string, key domain.VaultKey) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&domain.User{}).Where("id = ?", user).Update("hash", hash).Error
+		if err != nil {
+			return err
+		}
+
+		key.UserID = user
+
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&key).Error
+	})
+}
+
+// UpdatePasswordHash replaces the password hash of the user, e.g. with a
+// hash of another algorithm. The vault key stays the same as the password
+// does. It returns `domain.ErrNotFound` if the user does not exist.
+func (s *DB) UpdatePasswordHash(user int, hash string) error {
+	req := s.db.Model(&domain.User{}).Where("id = ?", user).Update("hash", hash)
+	if req.Error != nil {
+		return req.Error
+	}
+
+	if req.RowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+// CreateWebAuthnCredential stores a new WebAuthn credential of the user.
+func (s *DB) CreateWebAuthnCredential(cred *domain.WebAuthnCredential) error {
+	return s.db.Create(cred).Error
+}
+
+// FindWebAuthnCredentials retrieves the WebAuthn credentials of the user
+// in the order they were registered.
+func (s *DB) FindWebAuthnCredentials(user int) ([]domain.WebAuthnCredential, error) {
+	var creds []domain.WebAuthnCredential
+
+	if err := s.db.Order("id").Find(&creds, "user_id = ?", user).Error; err != nil {
+		return nil, err
+	}
+
+	return creds, nil
+}
+
+// UpdateWebAuthnCredential replaces the data of the credential of the user,
+// e.g. the signature counter after a login. If the user has no credential
+// with the ID, it returns `domain.ErrNotFound`.
+func (s *DB) UpdateWebAuthnCredential(user int, credentialID []byte, data []byte) error {
+	req := s.db.Model(&domain.WebAuthnCredential{}).
+		Where("user_id = ? AND credential_id = ?", user, credentialID).
+		Update("data", data)
+	if req.Error != nil {
+		return req.Error
+	}
+
+	if req.RowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,236 @@
+// Package webhook delivers the events of record access to the URLs configured
+// by the users, so they are notified when their secrets are read or changed.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Kinds of the record events.
+const (
+	// EventRead is sent when the data of a record is read.
+	EventRead = "record.read"
+	// EventWrite is sent when a record is written or updated.
+	EventWrite = "record.write"
+)
+
+// Defaults of the delivery.
+const (
+	defaultQueueSize = 1024
+	defaultAttempts  = 5
+	defaultBackoff   = 500 * time.Millisecond
+	defaultTimeout   = 10 * time.Second
+)
+
+// Config contains settings of the webhooks.
+type Config struct {
+	// URL receives the events of all users, the webhooks are disabled when
+	// it is empty and no user has a URL.
+	URL string `json:"url" env:"URL"`
+	// Users maps the login of a user to the URL receiving the events of the
+	// user instead of the global URL.
+	Users map[string]string `json:"users"`
+	// Attempts is the number of delivery attempts of an event, 5 by default.
+	Attempts int `json:"attempts" env:"ATTEMPTS"`
+}
+
+// Enabled reports whether any URL is configured.
+func (c Config) Enabled() bool {
+	return c.URL != "" || len(c.Users) > 0
+}
+
+// Event is the JSON body posted to the webhook. It never contains the data
+// or the name of the record.
+type Event struct {
+	Event    string    `json:"event"`
+	RecordID int32     `json:"record_id"`
+	UserID   int       `json:"user_id"`
+	Time     time.Time `json:"time"`
+}
+
+// delivery is a queued event with the URL it is posted to.
+type delivery struct {
+	url   string
+	event Event
+}
+
+// Notifier posts the events to the webhooks in the background. The events
+// are queued, so a slow webhook doesn't block the RPC; a failed post is
+// retried with an exponential backoff.
+type Notifier struct {
+	cfg     Config
+	logger  *zap.Logger
+	client  *http.Client
+	backoff time.Duration
+
+	queue  chan delivery
+	done   chan struct{}
+	wg     sync.WaitGroup
+	closed sync.Once
+}
+
+// Option configures the notifier built by `New`.
+type Option func(*Notifier)
+
+// WithBackoff sets the delay before the first retry, it doubles with every
+// next retry.
+func WithBackoff(backoff time.Duration) Option {
+	return func(n *Notifier) {
+		n.backoff = backoff
+	}
+}
+
+// WithHTTPClient sets the client posting the events.
+func WithHTTPClient(client *http.Client) Option {
+	return func(n *Notifier) {
+		n.client = client
+	}
+}
+
+// New creates a notifier and starts its delivery goroutine. Close stops it.
+func New(cfg Config, logger *zap.Logger, opts ...Option) *Notifier {
+	if cfg.Attempts <= 0 {
+		cfg.Attempts = defaultAttempts
+	}
+
+	n := &Notifier{
+		cfg:     cfg,
+		logger:  logger,
+		client:  &http.Client{Timeout: defaultTimeout},
+		backoff: defaultBackoff,
+		queue:   make(chan delivery, defaultQueueSize),
+		done:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+
+	n.wg.Add(1)
+	go n.run()
+
+	return n
+}
+
+// Notify queues the event for the webhook of the user with the login. The
+// event is dropped when the user has no webhook or the queue is full.
+func (n *Notifier) Notify(login string, e Event) {
+	if n == nil {
+		return
+	}
+
+	url, ok := n.cfg.Users[login]
+	if !ok {
+		url = n.cfg.URL
+	}
+	if url == "" {
+		return
+	}
+
+	select {
+	case <-n.done:
+	case n.queue <- delivery{url: url, event: e}:
+	default:
+		n.logger.Warn("webhook queue is full, event dropped",
+			zap.String("event", e.Event), zap.Int32("record_id", e.RecordID))
+	}
+}
+
+// Close stops the delivery. The queued events are still delivered until
+// the context is done.
+func (n *Notifier) Close(ctx context.Context) error {
+	if n == nil {
+		return nil
+	}
+
+	n.closed.Do(func() {
+		close(n.done)
+	})
+
+	stopped := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("webhook events not delivered: %w", ctx.Err())
+	}
+}
+
+// run delivers the queued events one by one until the notifier is closed
+// and the queue is empty.
+func (n *Notifier) run() {
+	defer n.wg.Done()
+
+	for {
+		select {
+		case d := <-n.queue:
+			n.deliver(d)
+		case <-n.done:
+			for {
+				select {
+				case d := <-n.queue:
+					n.deliver(d)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver posts the event, retrying a failed post with a doubling delay.
+func (n *Notifier) deliver(d delivery) {
+	body, err := json.Marshal(d.event)
+	if err != nil {
+		n.logger.With(zap.Error(err)).Error("failed marshal webhook event")
+		return
+	}
+
+	backoff := n.backoff
+	for attempt := 1; ; attempt++ {
+		err = n.post(d.url, body)
+		if err == nil {
+			return
+		}
+
+		if attempt >= n.cfg.Attempts {
+			n.logger.With(zap.Error(err)).Error("failed deliver webhook event",
+				zap.String("event", d.event.Event), zap.Int32("record_id", d.event.RecordID))
+			return
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// errStatus means the webhook answered with a status other than 2xx.
+var errStatus = errors.New("unexpected webhook status")
+
+// post sends the body to the URL once.
+func (n *Notifier) post(url string, body []byte) error {
+	resp, err := n.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed post webhook event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("%w: %s", errStatus, resp.Status)
+	}
+
+	return nil
+}
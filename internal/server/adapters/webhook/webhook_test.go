@@ -0,0 +1,109 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// receiver is a local webhook collecting the posted events.
+type receiver struct {
+	mu     sync.Mutex
+	events []map[string]any
+	// fail is the number of the first posts answered with an error.
+	fail atomic.Int32
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.fail.Add(-1) >= 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	var e map[string]any
+	if err := json.NewDecoder(req.Body).Decode(&e); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	r.mu.Lock()
+	r.events = append(r.events, e)
+	r.mu.Unlock()
+}
+
+func (r *receiver) received() []map[string]any {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]map[string]any(nil), r.events...)
+}
+
+func TestNotifier(t *testing.T) {
+	global := &receiver{}
+	globalServer := httptest.NewServer(global)
+	defer globalServer.Close()
+
+	personal := &receiver{}
+	personalServer := httptest.NewServer(personal)
+	defer personalServer.Close()
+
+	// The first two posts fail and are retried
+	global.fail.Store(2)
+
+	n := New(Config{URL: globalServer.URL, Users: map[string]string{"alice": personalServer.URL}},
+		zap.NewNop(), WithBackoff(time.Millisecond))
+
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	n.Notify("bob", Event{Event: EventRead, RecordID: 7, UserID: 2, Time: at})
+	n.Notify("alice", Event{Event: EventWrite, RecordID: 8, UserID: 1, Time: at})
+
+	assert.NoError(t, n.Close(context.Background()))
+
+	events := global.received()
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, map[string]any{
+			"event":     EventRead,
+			"record_id": float64(7),
+			"user_id":   float64(2),
+			"time":      "2024-05-01T12:00:00Z",
+		}, events[0])
+	}
+
+	events = personal.received()
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, EventWrite, events[0]["event"])
+		assert.Equal(t, float64(8), events[0]["record_id"])
+	}
+}
+
+func TestNotifierGiveUp(t *testing.T) {
+	r := &receiver{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	r.fail.Store(10)
+
+	n := New(Config{URL: server.URL, Attempts: 3}, zap.NewNop(), WithBackoff(time.Millisecond))
+	n.Notify("bob", Event{Event: EventRead, RecordID: 1})
+	assert.NoError(t, n.Close(context.Background()))
+
+	assert.Empty(t, r.received())
+	assert.Equal(t, int32(7), r.fail.Load())
+}
+
+func TestNotifierDisabled(t *testing.T) {
+	var n *Notifier
+	n.Notify("bob", Event{Event: EventRead, RecordID: 1})
+	assert.NoError(t, n.Close(context.Background()))
+
+	assert.False(t, Config{}.Enabled())
+	assert.True(t, Config{Users: map[string]string{"bob": "http://localhost"}}.Enabled())
+}
@@ -3,49 +3,295 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"math"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/Renal37/goph-keeper/internal/logger"
+	"github.com/Renal37/goph-keeper/internal/server/adapters/webhook"
 	env "github.com/caarlos0/env/v6"
 )
 
 // ConfigENV contains app settings.
 type ConfigENV struct {
-	JWTkey             string `json:"jwt_key" env:"JWT_KEY"`
-	Host               string `json:"host" env:"HOST"`
-	DSN                string `json:"dsn" env:"DSN"`
+	JWTkey             string      `json:"jwt_key" env:"JWT_KEY"`
+	Host               string      `json:"host" env:"HOST"`
+	DSN                string      `json:"dsn" env:"DSN"`
+	ReadDSN            string      `json:"read_dsn" env:"READ_DSN"`
+	CertificatePath    string      `json:"certificate"`
+	CertificateKeyPath string      `json:"certificate_key"`
+	ReauthWindow       Duration    `json:"reauth_window" env:"REAUTH_WINDOW"`
+	JWTLeeway          Duration    `json:"jwt_leeway" env:"JWT_LEEWAY"`
+	JWTReadGrace       Duration    `json:"jwt_read_grace" env:"JWT_READ_GRACE"`
+	JWTRefreshGrace    Duration    `json:"jwt_refresh_grace" env:"JWT_REFRESH_GRACE"`
+	Listeners          []Listener  `json:"listeners"`
+	MaxNameLength      int         `json:"max_name_length" env:"MAX_NAME_LENGTH"`
+	MaxRecordSize      int64       `json:"max_record_size" env:"MAX_RECORD_SIZE"`
+	MaxCredentialsSize int         `json:"max_credentials_size" env:"MAX_CREDENTIALS_SIZE"`
+	LogEncoding        string      `json:"log_encoding" env:"LOG_ENCODING"`
+	LogFile            logger.File `json:"log_file" envPrefix:"LOG_FILE_"`
+	Algorithm          string      `json:"algorithm" env:"ALGORITHM"`
+	ReadOnly           bool        `json:"read_only" env:"READ_ONLY"`
+	EncryptNames       bool        `json:"encrypt_names" env:"ENCRYPT_NAMES"`
+	// AccessLog logs every read record at the level: info or warn, empty
+	// disables the events.
+	AccessLog string `json:"access_log" env:"ACCESS_LOG"`
+	// Webhook receives the events of reading and writing records.
+	Webhook webhook.Config `json:"webhook" envPrefix:"WEBHOOK_"`
+	// MaxConcurrentUploads is the number of uploads a user can have open
+	// at once, zero means no limit.
+	MaxConcurrentUploads int `json:"max_concurrent_uploads" env:"MAX_CONCURRENT_UPLOADS"`
+	// RateLimit is the number of calls a user can make per window, zero
+	// means no limit.
+	RateLimit       int      `json:"rate_limit" env:"RATE_LIMIT"`
+	RateLimitWindow Duration `json:"rate_limit_window" env:"RATE_LIMIT_WINDOW"`
+	// LogSampleRate logs only 1 in N calls, the failed calls and the calls
+	// slower than LogSlowCall are always logged. Zero logs every call.
+	LogSampleRate int      `json:"log_sample_rate" env:"LOG_SAMPLE_RATE"`
+	LogSlowCall   Duration `json:"log_slow_call" env:"LOG_SLOW_CALL"`
+	// MaxConnections is the limit of the open connections of each listener,
+	// ReadTimeout drops the clients sending nothing for longer. Zero disables.
+	MaxConnections int      `json:"max_connections" env:"MAX_CONNECTIONS"`
+	ReadTimeout    Duration `json:"read_timeout" env:"READ_TIMEOUT"`
+	// DefaultDeadline is the deadline of the calls sent without one,
+	// UploadDeadline the one of the uploads. Zero disables.
+	DefaultDeadline Duration `json:"default_deadline" env:"DEFAULT_DEADLINE"`
+	UploadDeadline  Duration `json:"upload_deadline" env:"UPLOAD_DEADLINE"`
+	// RecordIDs is the scheme of the record IDs shown to the clients:
+	// int (default) or uuid.
+	RecordIDs string `json:"record_ids" env:"RECORD_IDS"`
+	// PasswordHash is the algorithm of the new password hashes: bcrypt
+	// (default) or argon2id with the parameters, the memory is in KiB.
+	PasswordHash string `json:"password_hash" env:"PASSWORD_HASH"`
+	ArgonTime    uint32 `json:"argon_time" env:"ARGON_TIME"`
+	ArgonMemory  uint32 `json:"argon_memory" env:"ARGON_MEMORY"`
+	ArgonThreads uint8  `json:"argon_threads" env:"ARGON_THREADS"`
+	// WebAuthnRPID is the domain of the relying party of the passkeys,
+	// the passkey login is disabled without it.
+	WebAuthnRPID    string   `json:"webauthn_rp_id" env:"WEBAUTHN_RP_ID"`
+	WebAuthnOrigins []string `json:"webauthn_origins" env:"WEBAUTHN_ORIGINS"`
+	MasterKey       string
+	// MasterKeyMinEntropy is the minimum Shannon entropy of the master key
+	// in bits per character, zero disables the check of the strength.
+	MasterKeyMinEntropy float64 `json:"master_key_min_entropy" env:"MASTER_KEY_MIN_ENTROPY"`
+	// MasterKeyID is the ID of the master key stored with the written
+	// records, empty for the key used before the IDs.
+	MasterKeyID string
+	// MasterKeys are the previous master keys by their IDs, kept to read
+	// the records written with them.
+	MasterKeys map[string]string
+	Command    string
+	File       string
+	// Settings of the certificate generated by the gen-cert command.
+	CertCommonName string
+	CertHosts      string
+	CertValidity   time.Duration
+	// Team and the login of the user for the team commands.
+	Team  string
+	Login string
+	// BaseDir is the directory the config, certificates and other local
+	// files are resolved against. Empty means the current directory.
+	BaseDir string
+}
+
+// ParseMasterKeys parses comma separated id=key pairs of master keys. The
+// key used before the IDs has an empty ID, e.g. "=key".
+func ParseMasterKeys(s string) (map[string]string, error) {
+	keys := make(map[string]string)
+	for i, pair := range strings.Split(s, ",") {
+		// The pair is not shown, it may be a key
+		id, key, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid master key %d, use id=key", i+1)
+		}
+
+		if _, ok := keys[id]; ok {
+			return nil, fmt.Errorf("duplicate master key ID %q", id)
+		}
+		keys[id] = key
+	}
+
+	return keys, nil
+}
+
+// ErrWeakMasterKey means the master key is easy to guess.
+var ErrWeakMasterKey = errors.New("weak master key")
+
+// CheckMasterKeyStrength rejects a master key of a single repeated character
+// and a key with the Shannon entropy of its characters below the minimum,
+// in bits per character. A random key of letters and digits has about 5
+// bits, "aaaaaaaaaaaaaaaa" has 0 and "1234567812345678" has 3.
+func CheckMasterKeyStrength(key string, minEntropy float64) error {
+	if minEntropy <= 0 {
+		return nil
+	}
+
+	// The key is not shown, only its entropy
+	entropy := shannonEntropy(key)
+	if entropy == 0 {
+		return fmt.Errorf("%w: the key repeats a single character", ErrWeakMasterKey)
+	}
+
+	if entropy < minEntropy {
+		return fmt.Errorf("%w: entropy %.2f bits per character, minimum is %.2f", ErrWeakMasterKey, entropy, minEntropy)
+	}
+
+	return nil
+}
+
+// shannonEntropy returns the Shannon entropy of the characters of the string
+// in bits per character.
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+
+	var entropy float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		entropy -= p * math.Log2(p)
+	}
+
+	return entropy
+}
+
+// Listener contains settings of an address the server listens on.
+// Empty certificate paths mean the common certificate of the server.
+type Listener struct {
+	// Network is "tcp" (default) or "unix".
+	Network string `json:"network"`
+	Address string `json:"address"`
+	// Insecure serves the listener without TLS, e.g. a unix socket for local administration.
+	Insecure bool `json:"insecure"`
+	// Admin also serves the Admin service, which needs a token of the admin
+	// scope. Use it only on a unix socket or a private address.
+	Admin              bool   `json:"admin"`
 	CertificatePath    string `json:"certificate"`
 	CertificateKeyPath string `json:"certificate_key"`
-	MasterKey          string
 }
 
+// configPath is the path of the config file relative to the base directory.
+var configPath = "config/server.json"
+
 // GetConfig get app settings.
 func GetConfig() (*ConfigENV, error) {
 	var eCfg ConfigENV
-	configPath := "config/server.json"
 
 	flag.StringVar(&eCfg.MasterKey, "mk", "", "master key for encryption keys")
+	flag.StringVar(&eCfg.MasterKeyID, "mk-id", "", "ID of the master key, stored with the written records")
+	flag.Func("mks", "previous master keys as comma separated id=key pairs, to read the records written with them", func(s string) error {
+		keys, err := ParseMasterKeys(s)
+		eCfg.MasterKeys = keys
+		return err
+	})
+	flag.StringVar(&eCfg.Command, "c", "", "administration command to run instead of the server: export, import, gen-cert, admin-token, team-create, team-add or team-remove")
+	flag.StringVar(&eCfg.File, "f", "", "file of the command, stdout or stdin by default")
+	flag.StringVar(&eCfg.BaseDir, "dir", "", "base directory of the config, certificates and log files, the current directory by default")
+	flag.StringVar(&eCfg.CertCommonName, "cn", "localhost", "common name of the certificate generated by gen-cert")
+	flag.StringVar(&eCfg.CertHosts, "san", "localhost,127.0.0.1", "comma separated DNS names and IP addresses of the certificate generated by gen-cert")
+	flag.DurationVar(&eCfg.CertValidity, "validity", 0, "validity of the certificate generated by gen-cert, one year by default")
+	flag.StringVar(&eCfg.Team, "team", "", "name of the team for the team commands")
+	flag.StringVar(&eCfg.Login, "login", "", "login of the user added to or removed from the team")
 	flag.Parse()
 
-	file, err := os.Open(configPath)
+	if err := loadConfig(&eCfg); err != nil {
+		return nil, err
+	}
+
+	return &eCfg, nil
+}
+
+// loadConfig reads the config file and the environment variables and
+// resolves the relative paths of the config against the base directory.
+func loadConfig(eCfg *ConfigENV) error {
+	if eCfg.BaseDir != "" {
+		if err := validateDir(eCfg.BaseDir); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Open(resolvePath(eCfg.BaseDir, configPath))
 	if err != nil {
-		return nil, fmt.Errorf("failed to open config file: %w", err)
+		return fmt.Errorf("failed to open config file: %w", err)
 	}
 
 	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&eCfg); err != nil {
-		return nil, fmt.Errorf("failed to decode config file: %w", err)
+	if err := decoder.Decode(eCfg); err != nil {
+		return fmt.Errorf("failed to decode config file: %w", err)
 	}
 
 	if err := file.Close(); err != nil {
-		return nil, fmt.Errorf("failed close config file: %w", err)
+		return fmt.Errorf("failed close config file: %w", err)
 	}
 
-	err = env.Parse(&eCfg)
+	err = env.Parse(eCfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed parsing environment variables: %w", err)
+		return fmt.Errorf("failed parsing environment variables: %w", err)
 	}
 
-	return &eCfg, nil
+	eCfg.resolvePaths()
+
+	return nil
+}
+
+// resolvePaths makes the local paths of the config relative to the base directory.
+func (c *ConfigENV) resolvePaths() {
+	c.CertificatePath = resolvePath(c.BaseDir, c.CertificatePath)
+	c.CertificateKeyPath = resolvePath(c.BaseDir, c.CertificateKeyPath)
+	c.LogFile.Path = resolvePath(c.BaseDir, c.LogFile.Path)
+
+	for i := range c.Listeners {
+		l := &c.Listeners[i]
+		l.CertificatePath = resolvePath(c.BaseDir, l.CertificatePath)
+		l.CertificateKeyPath = resolvePath(c.BaseDir, l.CertificateKeyPath)
+
+		// The address of a unix socket is a file
+		if l.Network == "unix" {
+			l.Address = resolvePath(c.BaseDir, l.Address)
+		}
+	}
+}
+
+// resolvePath joins a relative path to the base directory. Empty and absolute
+// paths are kept as they are.
+func resolvePath(base string, path string) string {
+	if base == "" || path == "" || filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(base, path)
+}
+
+// validateDir checks that the directory exists and can be read.
+func validateDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed open base directory: %w", err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed read stat of base directory: %w", err)
+	}
+
+	if !fi.IsDir() {
+		return fmt.Errorf("base directory %s is not a directory", dir)
+	}
+
+	// Reading an entry checks the permission to list the directory
+	if _, err := f.Readdirnames(1); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed read base directory: %w", err)
+	}
+
+	return nil
 }
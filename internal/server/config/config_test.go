@@ -0,0 +1,94 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfigBaseDir(t *testing.T) {
+	base := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(base, "config"), 0700))
+
+	abs := filepath.Join(t.TempDir(), "key.pem")
+	data := `{
+  "certificate": "cert/server-cert.pem",
+  "certificate_key": "` + abs + `",
+  "log_file": {"path": "logs/server.log"},
+  "listeners": [
+    {"network": "unix", "address": "run/admin.sock", "insecure": true},
+    {"address": ":3200", "certificate": "cert/public.pem"}
+  ]
+}`
+	assert.NoError(t, os.WriteFile(filepath.Join(base, configPath), []byte(data), 0600))
+
+	cfg := ConfigENV{BaseDir: base}
+	assert.NoError(t, loadConfig(&cfg))
+
+	assert.Equal(t, filepath.Join(base, "cert/server-cert.pem"), cfg.CertificatePath)
+	// Absolute paths are kept
+	assert.Equal(t, abs, cfg.CertificateKeyPath)
+	assert.Equal(t, filepath.Join(base, "logs/server.log"), cfg.LogFile.Path)
+	assert.Equal(t, filepath.Join(base, "run/admin.sock"), cfg.Listeners[0].Address)
+	// A network address is not a path
+	assert.Equal(t, ":3200", cfg.Listeners[1].Address)
+	assert.Equal(t, filepath.Join(base, "cert/public.pem"), cfg.Listeners[1].CertificatePath)
+	assert.Empty(t, cfg.Listeners[1].CertificateKeyPath)
+}
+
+func TestLoadConfigInvalidBaseDir(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, os.WriteFile(file, nil, 0600))
+
+	for _, dir := range []string{filepath.Join(t.TempDir(), "missing"), file} {
+		cfg := ConfigENV{BaseDir: dir}
+		assert.Error(t, loadConfig(&cfg), dir)
+	}
+}
+
+func TestResolvePathCurrentDir(t *testing.T) {
+	// Without the base directory the paths stay relative to the current directory
+	assert.Equal(t, "cert/server-cert.pem", resolvePath("", "cert/server-cert.pem"))
+	assert.Equal(t, "", resolvePath("/srv", ""))
+}
+
+func TestParseMasterKeys(t *testing.T) {
+	keys, err := ParseMasterKeys("=1234567812345678,2023=8765432187654321")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"": "1234567812345678", "2023": "8765432187654321"}, keys)
+
+	// The key without an ID is not shown in the error
+	_, err = ParseMasterKeys("2023=8765432187654321,1234567812345678")
+	assert.EqualError(t, err, "invalid master key 2, use id=key")
+	assert.NotContains(t, err.Error(), "12345678")
+
+	_, err = ParseMasterKeys("2023=")
+	assert.Error(t, err)
+
+	_, err = ParseMasterKeys("2023=1234567812345678,2023=8765432187654321")
+	assert.EqualError(t, err, `duplicate master key ID "2023"`)
+}
+
+func TestCheckMasterKeyStrength(t *testing.T) {
+	weak := []string{"aaaaaaaaaaaaaaaa", "abababababababab", "1234567812345678", "passwordpassword"}
+	strong := []string{"kT9#vQ2!mZ7@xR4$wL6^", "x9VfQ2mZ7LrB4wT6yH1cN8pK"}
+
+	// The check is off by default, only the length is checked
+	for _, key := range weak {
+		assert.NoError(t, CheckMasterKeyStrength(key, 0), key)
+	}
+
+	for _, key := range weak {
+		assert.ErrorIs(t, CheckMasterKeyStrength(key, 3.5), ErrWeakMasterKey, key)
+	}
+	for _, key := range strong {
+		assert.NoError(t, CheckMasterKeyStrength(key, 3.5), key)
+	}
+
+	// The threshold decides, a key of one character is never strong
+	assert.NoError(t, CheckMasterKeyStrength("1234567812345678", 3))
+	assert.ErrorContains(t, CheckMasterKeyStrength("1234567812345678", 3.01), "entropy 3.00 bits per character")
+	assert.ErrorContains(t, CheckMasterKeyStrength("aaaaaaaaaaaaaaaa", 0.01), "single character")
+}
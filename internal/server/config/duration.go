@@ -0,0 +1,27 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Duration is a `time.Duration` that is read from the config file and
+// environment variables in the `time.ParseDuration` format, e.g. "15m".
+type Duration time.Duration
+
+// UnmarshalText parses the duration from its text form.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("failed parse duration: %w", err)
+	}
+
+	*d = Duration(v)
+
+	return nil
+}
+
+// Std returns the duration as `time.Duration`.
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
@@ -0,0 +1,204 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/server/config"
+	"go.uber.org/zap"
+)
+
+// DefaultCertValidity is the validity of generated certificates.
+const DefaultCertValidity = 365 * 24 * time.Hour
+
+// caCertName is the file name of the generated CA certificate, it is written
+// next to the server certificate.
+var caCertName = "ca-cert.pem"
+
+var certPermission fs.FileMode = 0644
+var keyPermission fs.FileMode = 0600
+var certDirPermission fs.FileMode = 0700
+
+// CertRequest describes the certificate generated by `GenerateCertificates`.
+type CertRequest struct {
+	// CommonName is the subject common name of the server certificate.
+	CommonName string
+	// Hosts are the DNS names and IP addresses of the server.
+	Hosts []string
+	// Validity is how long the certificates are valid.
+	Validity time.Duration
+}
+
+// RunGenCert generates the certificates of the server at the configured paths.
+func RunGenCert(lg *zap.Logger, cfg *config.ConfigENV) error {
+	req := CertRequest{
+		CommonName: cfg.CertCommonName,
+		Hosts:      strings.Split(cfg.CertHosts, ","),
+		Validity:   cfg.CertValidity,
+	}
+
+	caPath, err := GenerateCertificates(cfg.CertificatePath, cfg.CertificateKeyPath, req)
+	if err != nil {
+		return err
+	}
+
+	lg.Info("Certificates generated",
+		zap.String("certificate", cfg.CertificatePath),
+		zap.String("certificate_key", cfg.CertificateKeyPath),
+		zap.String("ca_certificate", caPath))
+
+	return nil
+}
+
+// GenerateCertificates generates a CA and a server certificate signed by it.
+// The server certificate and key are written to the given paths, the CA
+// certificate, which the agent needs to trust the server, is written next to
+// the server certificate and its path is returned. The key of the CA is not
+// kept, so it can't be used to issue other certificates. Existing files are
+// not overwritten.
+func GenerateCertificates(certPath string, keyPath string, req CertRequest) (string, error) {
+	if certPath == "" || keyPath == "" {
+		return "", fmt.Errorf("certificate paths are not configured")
+	}
+
+	if req.Validity <= 0 {
+		req.Validity = DefaultCertValidity
+	}
+
+	notBefore := time.Now().Add(-time.Minute)
+	notAfter := notBefore.Add(req.Validity)
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("failed generate CA key: %w", err)
+	}
+
+	caTmpl, err := certTemplate(pkix.Name{CommonName: "GophKeeper CA"}, notBefore, notAfter)
+	if err != nil {
+		return "", err
+	}
+	caTmpl.IsCA = true
+	caTmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	caTmpl.BasicConstraintsValid = true
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		return "", fmt.Errorf("failed create CA certificate: %w", err)
+	}
+
+	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("failed generate server key: %w", err)
+	}
+
+	serverTmpl, err := certTemplate(pkix.Name{CommonName: req.CommonName}, notBefore, notAfter)
+	if err != nil {
+		return "", err
+	}
+	serverTmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	serverTmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	serverTmpl.BasicConstraintsValid = true
+
+	for _, h := range req.Hosts {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+
+		if ip := net.ParseIP(h); ip != nil {
+			serverTmpl.IPAddresses = append(serverTmpl.IPAddresses, ip)
+		} else {
+			serverTmpl.DNSNames = append(serverTmpl.DNSNames, h)
+		}
+	}
+
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return "", fmt.Errorf("failed parse CA certificate: %w", err)
+	}
+
+	serverDER, err := x509.CreateCertificate(rand.Reader, serverTmpl, caCert, &serverKey.PublicKey, caKey)
+	if err != nil {
+		return "", fmt.Errorf("failed create server certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(serverKey)
+	if err != nil {
+		return "", fmt.Errorf("failed marshal server key: %w", err)
+	}
+
+	caPath := filepath.Join(filepath.Dir(certPath), caCertName)
+
+	files := []struct {
+		path string
+		typ  string
+		der  []byte
+		perm fs.FileMode
+	}{
+		{path: keyPath, typ: "PRIVATE KEY", der: keyDER, perm: keyPermission},
+		{path: certPath, typ: "CERTIFICATE", der: serverDER, perm: certPermission},
+		{path: caPath, typ: "CERTIFICATE", der: caDER, perm: certPermission},
+	}
+
+	// Check all files first, so nothing is written if one of them exists
+	for _, f := range files {
+		if _, err := os.Stat(f.path); err == nil {
+			return "", fmt.Errorf("file %s already exists", f.path)
+		}
+	}
+
+	for _, f := range files {
+		if err := writePEM(f.path, f.typ, f.der, f.perm); err != nil {
+			return "", err
+		}
+	}
+
+	return caPath, nil
+}
+
+// certTemplate returns a certificate template with a random serial number.
+func certTemplate(subject pkix.Name, notBefore time.Time, notAfter time.Time) (*x509.Certificate, error) {
+	//nolint:gomnd // This legal number
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed generate serial number: %w", err)
+	}
+
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}, nil
+}
+
+// writePEM writes a PEM block to a new file, an existing file is not overwritten.
+func writePEM(path string, typ string, der []byte, perm fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), certDirPermission); err != nil {
+		return fmt.Errorf("failed create dir: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return fmt.Errorf("failed create %s: %w", path, err)
+	}
+	defer file.Close()
+
+	if err := pem.Encode(file, &pem.Block{Type: typ, Bytes: der}); err != nil {
+		return fmt.Errorf("failed write %s: %w", path, err)
+	}
+
+	return nil
+}
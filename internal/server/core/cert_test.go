@@ -0,0 +1,76 @@
+package core
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateCertificates(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cert")
+	certPath := filepath.Join(dir, "server-cert.pem")
+	keyPath := filepath.Join(dir, "server-key.pem")
+
+	caPath, err := GenerateCertificates(certPath, keyPath, CertRequest{
+		CommonName: "keeper.example",
+		Hosts:      []string{"keeper.example", " localhost", "127.0.0.1", ""},
+		Validity:   48 * time.Hour,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, caCertName), caPath)
+
+	// The key and the certificate make a TLS key pair
+	_, err = tls.LoadX509KeyPair(certPath, keyPath)
+	assert.NoError(t, err)
+
+	fi, err := os.Stat(keyPath)
+	assert.NoError(t, err)
+	assert.Equal(t, keyPermission, fi.Mode().Perm())
+
+	cert := parseCertificate(t, certPath)
+	assert.Equal(t, "keeper.example", cert.Subject.CommonName)
+	assert.Equal(t, []string{"keeper.example", "localhost"}, cert.DNSNames)
+	if assert.Len(t, cert.IPAddresses, 1) {
+		assert.True(t, cert.IPAddresses[0].Equal(net.ParseIP("127.0.0.1")))
+	}
+	assert.WithinDuration(t, time.Now().Add(48*time.Hour), cert.NotAfter, 2*time.Minute)
+
+	// The agent trusts the server by the CA certificate
+	roots := x509.NewCertPool()
+	roots.AddCert(parseCertificate(t, caPath))
+	for _, host := range []string{"keeper.example", "localhost", "127.0.0.1"} {
+		_, err = cert.Verify(x509.VerifyOptions{DNSName: host, Roots: roots})
+		assert.NoError(t, err, host)
+	}
+
+	_, err = cert.Verify(x509.VerifyOptions{DNSName: "other.example", Roots: roots})
+	assert.Error(t, err)
+
+	// Existing certificates are not overwritten
+	_, err = GenerateCertificates(certPath, keyPath, CertRequest{CommonName: "localhost"})
+	assert.Error(t, err)
+}
+
+func parseCertificate(t *testing.T, path string) *x509.Certificate {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	block, _ := pem.Decode(data)
+	if !assert.NotNil(t, block) {
+		t.FailNow()
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.NoError(t, err)
+
+	return cert
+}
@@ -0,0 +1,140 @@
+// Package core contains basic app logic.
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	handler "github.com/Renal37/goph-keeper/internal/server/adapters/handler/grpc"
+	repository "github.com/Renal37/goph-keeper/internal/server/adapters/repository/pg"
+	"github.com/Renal37/goph-keeper/internal/server/config"
+	"github.com/Renal37/goph-keeper/internal/server/core/services"
+	"go.uber.org/zap"
+)
+
+// backupPermission is the permission of backup files, they contain password hashes.
+var backupPermission fs.FileMode = 0600
+
+var (
+	errTeamRequired   = errors.New("team name not found, please use flag -team")
+	errLoginRequired  = errors.New("user login not found, please use flag -login")
+	errJWTKeyRequired = errors.New("jwt key not found, please set jwt_key")
+)
+
+// RunCommand runs an administration command instead of the gRPC server.
+//
+//	export - write all users and records to the file (stdout by default)
+//	import - restore users and records from the file (stdin by default) into an empty database
+//	team-create - create the team
+//	team-add - add the user to the team
+//	team-remove - remove the user from the team
+func RunCommand(lg *zap.Logger, cfg *config.ConfigENV, repo *repository.DB) error {
+	defer func() {
+		if err := repo.Close(); err != nil {
+			lg.Info(err.Error())
+		}
+	}()
+
+	backupSvc := services.NewBackupService(repo)
+	teamSvc := services.NewTeamService(repo, repo)
+
+	switch cfg.Command {
+	case "export":
+		var w io.Writer = os.Stdout
+		if cfg.File != "" {
+			file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, backupPermission)
+			if err != nil {
+				return fmt.Errorf("failed open backup file: %w", err)
+			}
+			defer file.Close()
+
+			w = file
+		}
+
+		if err := backupSvc.Export(w); err != nil {
+			return fmt.Errorf("failed export: %w", err)
+		}
+
+		lg.Info("Export finished")
+	case "import":
+		var r io.Reader = os.Stdin
+		if cfg.File != "" {
+			file, err := os.Open(cfg.File)
+			if err != nil {
+				return fmt.Errorf("failed open backup file: %w", err)
+			}
+			defer file.Close()
+
+			r = file
+		}
+
+		if err := backupSvc.Import(r); err != nil {
+			return fmt.Errorf("failed import: %w", err)
+		}
+
+		lg.Info("Import finished")
+	case "team-create":
+		if cfg.Team == "" {
+			return errTeamRequired
+		}
+
+		team, err := teamSvc.CreateTeam(cfg.Team)
+		if err != nil {
+			return fmt.Errorf("failed create team: %w", err)
+		}
+
+		lg.Info("Team created", zap.String("team", team.Name), zap.Int("id", team.ID))
+	case "team-add", "team-remove":
+		if cfg.Team == "" {
+			return errTeamRequired
+		}
+
+		if cfg.Login == "" {
+			return errLoginRequired
+		}
+
+		if cfg.Command == "team-add" {
+			if err := teamSvc.AddMember(cfg.Team, cfg.Login); err != nil {
+				return fmt.Errorf("failed add team member: %w", err)
+			}
+
+			lg.Info("Team member added", zap.String("team", cfg.Team), zap.String("login", cfg.Login))
+
+			return nil
+		}
+
+		if err := teamSvc.RemoveMember(cfg.Team, cfg.Login); err != nil {
+			return fmt.Errorf("failed remove team member: %w", err)
+		}
+
+		lg.Info("Team member removed", zap.String("team", cfg.Team), zap.String("login", cfg.Login))
+	default:
+		return fmt.Errorf("command %s not found", cfg.Command)
+	}
+
+	return nil
+}
+
+// RunAdminToken writes a token of the admin scope for the calls of the
+// `Admin` service to `w`. The token is signed with the JWT key of the server.
+func RunAdminToken(lg *zap.Logger, cfg *config.ConfigENV, w io.Writer) error {
+	if cfg.JWTkey == "" {
+		return errJWTKeyRequired
+	}
+
+	token, err := handler.GetAdminJWT(cfg.JWTkey)
+	if err != nil {
+		return fmt.Errorf("failed create admin token: %w", err)
+	}
+
+	if _, err := fmt.Fprintln(w, *token); err != nil {
+		return fmt.Errorf("failed write admin token: %w", err)
+	}
+
+	lg.Info("Admin token created")
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Renal37/goph-keeper/internal/server/adapters/middleware"
+	"github.com/Renal37/goph-keeper/internal/server/config"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestRunAdminToken(t *testing.T) {
+	var out bytes.Buffer
+	assert.ErrorIs(t, RunAdminToken(zap.NewNop(), &config.ConfigENV{}, &out), errJWTKeyRequired)
+	assert.Empty(t, out.String())
+
+	assert.NoError(t, RunAdminToken(zap.NewNop(), &config.ConfigENV{JWTkey: "12345"}, &out))
+
+	claims := &middleware.JWTclaims{}
+	_, err := jwt.ParseWithClaims(strings.TrimSpace(out.String()), claims, func(*jwt.Token) (interface{}, error) {
+		return []byte("12345"), nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, middleware.ScopeAdmin, claims.Scope)
+	assert.True(t, claims.HasScope(middleware.ScopeAdmin))
+	assert.False(t, claims.HasScope(middleware.ScopeRead))
+	assert.Zero(t, claims.ID)
+}
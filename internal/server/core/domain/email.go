@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// maxEmailLength is the maximum length of an email address, it matches the
+// size of the email column.
+const maxEmailLength = 256
+
+// ErrInvalidEmail means the email address of a user is malformed.
+var ErrInvalidEmail = errors.New("invalid email")
+
+// ValidateEmail checks that the email is a bare address, e.g. alice@example.com,
+// without a display name or comments, with a domain name.
+func ValidateEmail(email string) error {
+	if len(email) > maxEmailLength {
+		return fmt.Errorf("%w: %v characters, maximum is %v", ErrInvalidEmail, len(email), maxEmailLength)
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return fmt.Errorf("%w: %q is not an address", ErrInvalidEmail, email)
+	}
+
+	_, host, _ := strings.Cut(email, "@")
+	if !strings.Contains(host, ".") || strings.HasPrefix(host, "[") {
+		return fmt.Errorf("%w: %q has no domain name", ErrInvalidEmail, email)
+	}
+
+	return nil
+}
@@ -0,0 +1,18 @@
+package domain
+
+import "errors"
+
+// Errors returned by the repositories and services, so the handlers can
+// tell expected conditions apart from failures of the data layer.
+var (
+	// ErrNotFound means the requested record does not exist for the owner.
+	ErrNotFound = errors.New("record not found")
+	// ErrVersionConflict means the record was changed after the caller read it.
+	ErrVersionConflict = errors.New("record version conflict")
+	// ErrNotTeamMember means the user writes a record to a team they are not a member of.
+	ErrNotTeamMember = errors.New("not a member of the team")
+	// ErrTeamNotFound means the team with the given name does not exist.
+	ErrTeamNotFound = errors.New("team not found")
+	// ErrUserNotFound means the user with the given login does not exist.
+	ErrUserNotFound = errors.New("user not found")
+)
@@ -0,0 +1,156 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RecordFilter selects the listed records by their indexable attributes.
+// A record is split into the plaintext attributes - name, type, category
+// and tags - and the encrypted value, so the server filters on the
+// attributes without decrypting anything. Empty fields match every record.
+type RecordFilter struct {
+	// Category is the exact category of the records.
+	Category string
+	// Type is the exact type of the records, e.g. "text" or "credentials".
+	Type string
+	// Tags are the tags the records must have, all with the given values.
+	Tags Meta
+	// Name is a part of the name, matched case-insensitively. It can't be
+	// used when the names are encrypted.
+	Name string
+	// Folder is the folder of the records, the records of its nested
+	// folders match as well.
+	Folder string
+}
+
+// IsEmpty reports whether the filter matches every record.
+func (f RecordFilter) IsEmpty() bool {
+	return f.Category == "" && f.Type == "" && len(f.Tags) == 0 && f.Name == "" && f.Folder == ""
+}
+
+// The keys the listed records can be sorted by.
+const (
+	SortName         = "name"
+	SortType         = "type"
+	SortCreatedAt    = "created_at"
+	SortLastAccessed = "last_accessed"
+)
+
+// sortKeys is the allowlist of the sort keys, the time keys are true.
+var sortKeys = map[string]bool{
+	SortName:         false,
+	SortType:         false,
+	SortCreatedAt:    true,
+	SortLastAccessed: true,
+}
+
+// ErrInvalidSort is returned for a sort key that is not in the allowlist.
+var ErrInvalidSort = errors.New("invalid sort key")
+
+// RecordSort orders the listed records by the keys in the order of the
+// keys, the ID of the record breaks the ties. All keys share the direction.
+// The zero value orders the records by ID.
+type RecordSort struct {
+	Keys []string
+	Desc bool
+}
+
+// ParseRecordSort parses the comma separated sort keys, e.g. "type,name".
+// The keys are checked against the allowlist, so they are safe to map to
+// the columns of the order clause.
+func ParseRecordSort(keys string, desc bool) (RecordSort, error) {
+	s := RecordSort{Desc: desc}
+	if keys == "" {
+		return s, nil
+	}
+
+	for _, key := range strings.Split(keys, ",") {
+		key = strings.TrimSpace(key)
+		if _, ok := sortKeys[key]; !ok {
+			return RecordSort{}, fmt.Errorf("%w: %q", ErrInvalidSort, key)
+		}
+
+		if s.Has(key) {
+			return RecordSort{}, fmt.Errorf("%w: %q is repeated", ErrInvalidSort, key)
+		}
+
+		s.Keys = append(s.Keys, key)
+	}
+
+	return s, nil
+}
+
+// Has reports whether the records are sorted by the key.
+func (s RecordSort) Has(key string) bool {
+	for _, k := range s.Keys {
+		if k == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// String returns the keys and the direction of the sort.
+func (s RecordSort) String() string {
+	dir := "asc"
+	if s.Desc {
+		dir = "desc"
+	}
+
+	return strings.Join(append(append([]string{}, s.Keys...), dir), ",")
+}
+
+// PageCursor is the position of the last record of a page: the values of
+// its sort keys and its ID. The zero value is the start of the list.
+type PageCursor struct {
+	ID     int
+	Values []string
+}
+
+// Cursor returns the position of the record in the sorted list.
+func (s RecordSort) Cursor(rec *Storage) PageCursor {
+	c := PageCursor{ID: rec.ID}
+	for _, key := range s.Keys {
+		switch key {
+		case SortName:
+			c.Values = append(c.Values, rec.Name)
+		case SortType:
+			c.Values = append(c.Values, rec.Type)
+		case SortCreatedAt:
+			c.Values = append(c.Values, rec.CreatedAt.UTC().Format(time.RFC3339Nano))
+		case SortLastAccessed:
+			c.Values = append(c.Values, rec.AccessedAt.UTC().Format(time.RFC3339Nano))
+		}
+	}
+
+	return c
+}
+
+// CursorValues returns the values of the cursor as compared with the
+// columns, the times are parsed. It fails when the cursor doesn't match
+// the keys of the sort.
+func (s RecordSort) CursorValues(c PageCursor) ([]any, error) {
+	if len(c.Values) != len(s.Keys) {
+		return nil, fmt.Errorf("cursor has %v values for %v sort keys", len(c.Values), len(s.Keys))
+	}
+
+	values := make([]any, 0, len(c.Values)+1)
+	for i, key := range s.Keys {
+		if !sortKeys[key] {
+			values = append(values, c.Values[i])
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339Nano, c.Values[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed parse cursor time: %w", err)
+		}
+		values = append(values, t)
+	}
+
+	return append(values, c.ID), nil
+}
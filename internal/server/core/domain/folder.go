@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxFolderLength is the maximum length of a folder path in characters. It
+// matches the size of the folder column.
+const MaxFolderLength = 1024
+
+// FolderSeparator separates the names of the nested folders of a path.
+const FolderSeparator = "/"
+
+// ErrInvalidFolder means the folder path of a record has a wrong syntax.
+var ErrInvalidFolder = errors.New("invalid folder")
+
+// ValidateFolder checks the folder path of a record: folder names separated
+// by "/", e.g. "work/aws/prod". The empty path means the record is in no
+// folder. The path has no leading or trailing "/", no empty, "." or ".."
+// names and no control characters, so every path has one spelling and the
+// prefix of a path is a folder.
+func ValidateFolder(folder string) error {
+	if folder == "" {
+		return nil
+	}
+
+	if !utf8.ValidString(folder) {
+		return fmt.Errorf("%w: not valid UTF-8", ErrInvalidFolder)
+	}
+
+	if n := utf8.RuneCountInString(folder); n > MaxFolderLength {
+		return fmt.Errorf("%w: %v characters, maximum is %v", ErrInvalidFolder, n, MaxFolderLength)
+	}
+
+	for _, name := range strings.Split(folder, FolderSeparator) {
+		switch name {
+		case "":
+			return fmt.Errorf("%w: %q has an empty folder name", ErrInvalidFolder, folder)
+		case ".", "..":
+			return fmt.Errorf("%w: %q has a dot folder name", ErrInvalidFolder, folder)
+		}
+
+		if strings.TrimSpace(name) != name {
+			return fmt.Errorf("%w: folder name %q starts or ends with a space", ErrInvalidFolder, name)
+		}
+
+		for _, r := range name {
+			if unicode.IsControl(r) {
+				return fmt.Errorf("%w: control character %U", ErrInvalidFolder, r)
+			}
+		}
+	}
+
+	return nil
+}
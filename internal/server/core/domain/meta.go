@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Meta is a set of free-form key-value attributes (tags) of a record.
+// It is stored in plaintext as a JSON object, so it must not contain secrets.
+type Meta map[string]string
+
+// Value implements the `driver.Valuer` interface and stores the metadata as JSON.
+func (m Meta) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed marshal meta: %w", err)
+	}
+
+	return string(b), nil
+}
+
+// Scan implements the `sql.Scanner` interface and reads the metadata from JSON.
+func (m *Meta) Scan(src interface{}) error {
+	var b []byte
+
+	switch v := src.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	case nil:
+		*m = Meta{}
+		return nil
+	default:
+		return fmt.Errorf("unsupported meta type: %T", src)
+	}
+
+	if err := json.Unmarshal(b, m); err != nil {
+		return fmt.Errorf("failed unmarshal meta: %w", err)
+	}
+
+	return nil
+}
+
+// Apply returns new metadata built from `m`. With `replace` the result
+// contains only the `set` attributes, otherwise `set` is merged into a copy
+// of `m`, overwriting existing keys. The `remove` keys are deleted last.
+func (m Meta) Apply(set Meta, remove []string, replace bool) Meta {
+	res := make(Meta, len(m)+len(set))
+	if !replace {
+		for k, v := range m {
+			res[k] = v
+		}
+	}
+
+	for k, v := range set {
+		res[k] = v
+	}
+
+	for _, k := range remove {
+		delete(res, k)
+	}
+
+	return res
+}
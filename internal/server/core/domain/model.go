@@ -5,6 +5,8 @@
 // using an ORM (such as GORM).
 package domain
 
+import "time"
+
 // User represents a user in the system. It includes an ID,
 // login, hashed password, and additional data for working with
 // the database. The `Password` field has the tag `gorm:"-:all"`
@@ -14,18 +16,188 @@ type User struct {
 	Login    string `json:"login" gorm:"type:string;size:256;unique;not null"`
 	Password string `json:"password" gorm:"-:all"`
 	Hash     string `gorm:"type:string;size:1000;not null"`
+	// Email is the optional email address the user can log in with instead
+	// of the login. It is unique among the users who set it.
+	Email string `json:"email" gorm:"type:string;size:256;not null;default:'';uniqueIndex:idx_users_email,where:email <> ''"`
 }
 
 // Storage represents a data storage entry in the system.
-// It includes an ID, name, type, value, key, and owner (user ID).
+// It includes an ID, name, type, value, key, owner (user ID) and category.
 // This structure is used to represent various types of data stored
 // in the system. All fields have corresponding tags for JSON and
 // ORM GORM, ensuring proper data storage and serialization.
+// The name, type, category and metadata (tags) are the indexable attributes
+// of the record: they are stored in plaintext, so the server can filter by
+// them (see `RecordFilter`), and must not contain secrets. The name is
+// encrypted as well when the name encryption is enabled. Only the value is
+// always encrypted, with the data key of the record stored in `Key`.
+// The version is incremented on every update and is used for optimistic
+// concurrency control.
+// A record with a team is shared with the members of the team, the owner
+// is still the user who wrote it.
+// The creation and last access times are kept for the retention cleanup.
 type Storage struct {
-	ID    int    `json:"id"    gorm:"type:serial;autoIncrement;primaryKey;unique;not null"`
-	Name  string `json:"name"  gorm:"type:string;size:256;not null"`
-	Type  string `json:"type"  gorm:"type:string;size:256;not null"`
-	Value string `json:"text"  gorm:"type:string;not null"`
-	Key   string `gorm:"type:string;size:1000;not null"`
-	Owner int    `json:"owner" gorm:"type:int;not null"`
+	ID       int    `json:"id"       gorm:"type:serial;autoIncrement;primaryKey;unique;not null"`
+	Name     string `json:"name"     gorm:"type:string;size:2048;not null"`
+	Type     string `json:"type"     gorm:"type:string;size:256;not null;index"`
+	Value    string `json:"text"     gorm:"type:string;not null"`
+	Key      string `gorm:"type:string;size:1000;not null"`
+	Owner    int    `json:"owner"    gorm:"type:int;not null"`
+	Category string `json:"category" gorm:"type:string;size:256;not null;default:'';index"`
+	Version  int    `json:"version"  gorm:"type:int;not null;default:1"`
+	Meta     Meta   `json:"meta"     gorm:"type:jsonb;not null;default:'{}';index:,type:gin"`
+	// Folder is the folder path of the record, e.g. "work/aws/prod", empty
+	// for a record in no folder. Like the category it is not encrypted.
+	Folder string `json:"folder" gorm:"type:string;size:1024;not null;default:'';index"`
+	// Algorithm is the algorithm the value and key are encrypted with.
+	Algorithm string `json:"algorithm" gorm:"type:string;size:64;not null;default:'aes-gcm'"`
+	// KeyID is the ID of the master key the data key is encrypted with,
+	// empty for the records written before the master keys had IDs.
+	KeyID string `json:"key_id" gorm:"type:string;size:64;not null;default:''"`
+	// Team is the ID of the team the record is shared with, zero for a private record.
+	Team int `json:"team" gorm:"type:int;not null;default:0;index"`
+	// NameEncrypted means the name is encrypted with the data key of the record.
+	NameEncrypted bool `json:"name_encrypted" gorm:"not null;default:false"`
+	// RequiresConfirmation means the record is only read after the owner
+	// confirms the read with a challenge.
+	RequiresConfirmation bool `json:"requires_confirmation" gorm:"not null;default:false"`
+	// CreatedAt is the time the record was written.
+	CreatedAt time.Time `json:"created_at" gorm:"not null;default:now();index"`
+	// AccessedAt is the time the record was last read or written.
+	AccessedAt time.Time `json:"last_accessed_at" gorm:"column:last_accessed_at;autoCreateTime;not null;default:now();index"`
+	// Bound means the encryption is bound to the owner and ID of the record,
+	// so its value and key can't be moved to another record.
+	Bound bool `json:"bound" gorm:"not null;default:false"`
+	// MimeType is the MIME type of the data of a file, empty for other records.
+	MimeType string `json:"mime_type" gorm:"type:string;size:256;not null;default:''"`
+	// UID is the random ID of the record the clients address it by when the
+	// server uses UUID record IDs, see `RecordIDsUUID`. The sequential ID is
+	// still the primary key.
+	UID string `json:"uid" gorm:"type:string;size:36;not null;default:'';uniqueIndex:idx_storages_uid,where:uid <> ''"`
+}
+
+// Team represents a group of users sharing records, e.g. a team vault.
+// Teams are created and managed by the administrator of the server.
+type Team struct {
+	ID   int    `json:"id"   gorm:"type:serial;autoIncrement;primaryKey;unique;not null"`
+	Name string `json:"name" gorm:"type:string;size:256;unique;not null"`
+}
+
+// TeamMember represents the membership of a user in a team.
+// The members can read all records of the team.
+type TeamMember struct {
+	TeamID int `json:"team_id" gorm:"type:int;primaryKey"`
+	UserID int `json:"user_id" gorm:"type:int;primaryKey;index"`
+}
+
+// Share is a record shared with a team together with the users on the other
+// side of the sharing: the members of the team for a record the user shared,
+// the owner for a record shared with the user.
+type Share struct {
+	Record   Storage
+	TeamName string
+	Logins   []string
+}
+
+// CategoryCount represents a distinct record category of an owner
+// together with the number of records in it.
+type CategoryCount struct {
+	Name  string
+	Count int
+}
+
+// IdempotencyKey represents a key supplied by the client with a write request.
+// It binds the key to the record created for it, so a retried write with the
+// same key returns the existing record instead of creating a duplicate.
+// Keys are unique per owner and expire after a configured window.
+type IdempotencyKey struct {
+	ID        int       `gorm:"type:serial;autoIncrement;primaryKey;unique;not null"`
+	Key       string    `gorm:"type:string;size:256;not null;uniqueIndex:idx_idempotency_owner_key"`
+	Owner     int       `gorm:"type:int;not null;uniqueIndex:idx_idempotency_owner_key"`
+	RecordID  int       `gorm:"type:int;not null"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+// StorageVersion represents a previous version of a storage record.
+// Before a record is updated, its name, type and encrypted value are copied
+// here, so earlier versions can still be read and compared.
+type StorageVersion struct {
+	ID        int       `gorm:"type:serial;autoIncrement;primaryKey;unique;not null"`
+	RecordID  int       `gorm:"type:int;not null;uniqueIndex:idx_storage_version"`
+	Version   int       `gorm:"type:int;not null;uniqueIndex:idx_storage_version"`
+	Owner     int       `gorm:"type:int;not null"`
+	Name      string    `gorm:"type:string;size:2048;not null"`
+	Type      string    `gorm:"type:string;size:256;not null"`
+	Value     string    `gorm:"type:string;not null"`
+	Key       string    `gorm:"type:string;size:1000;not null"`
+	Algorithm string    `gorm:"type:string;size:64;not null;default:'aes-gcm'"`
+	KeyID     string    `gorm:"type:string;size:64;not null;default:''"`
+	CreatedAt time.Time `gorm:"not null"`
+	// NameEncrypted means the name is encrypted with the data key of the version.
+	NameEncrypted bool `gorm:"not null;default:false"`
+	// Bound means the encryption is bound to the owner and ID of the record.
+	Bound bool `gorm:"not null;default:false"`
+	// MimeType is the MIME type of the data of the version.
+	MimeType string `gorm:"type:string;size:256;not null;default:''"`
+}
+
+// Record returns the version as a record with the ID of its record.
+func (v StorageVersion) Record() Storage {
+	return Storage{
+		ID:            v.RecordID,
+		Name:          v.Name,
+		Type:          v.Type,
+		Value:         v.Value,
+		Key:           v.Key,
+		Algorithm:     v.Algorithm,
+		KeyID:         v.KeyID,
+		Owner:         v.Owner,
+		Version:       v.Version,
+		NameEncrypted: v.NameEncrypted,
+		Bound:         v.Bound,
+		MimeType:      v.MimeType,
+	}
+}
+
+// VaultKey holds the data encryption key of a user wrapped under a key
+// derived from the user's password. The key is created at registration and
+// wrapped again with a new salt when the password changes, so the data
+// encryption key itself stays the same.
+type VaultKey struct {
+	UserID    int       `json:"user_id"    gorm:"type:int;primaryKey"`
+	Key       string    `json:"key"        gorm:"type:string;size:1000;not null"`
+	Salt      string    `json:"salt"       gorm:"type:string;size:256;not null"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"not null"`
+}
+
+// WebAuthnCredential is a passkey of a user registered with WebAuthn. The
+// credential is kept as encoded by the WebAuthn library, its ID is stored
+// apart to find the credential of a login.
+type WebAuthnCredential struct {
+	ID           int       `json:"id"            gorm:"type:int;primaryKey"`
+	UserID       int       `json:"user_id"       gorm:"type:int;not null;index"`
+	CredentialID []byte    `json:"credential_id" gorm:"not null;uniqueIndex"`
+	Data         []byte    `json:"data"          gorm:"not null"`
+	CreatedAt    time.Time `json:"created_at"    gorm:"not null"`
+	UpdatedAt    time.Time `json:"updated_at"    gorm:"not null"`
+}
+
+// TableName returns the name of the table of the WebAuthn credentials.
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
+
+// Backup is a portable copy of all users and records of the server.
+// Record values stay encrypted, so restoring a backup needs the same
+// master key to read them.
+type Backup struct {
+	Version   int                  `json:"version"`
+	CreatedAt time.Time            `json:"created_at"`
+	Users     []User               `json:"users"`
+	Records   []Storage            `json:"records"`
+	Versions  []StorageVersion     `json:"versions"`
+	Teams     []Team               `json:"teams"`
+	Members   []TeamMember         `json:"team_members"`
+	VaultKeys []VaultKey           `json:"vault_keys"`
+	Passkeys  []WebAuthnCredential `json:"webauthn_credentials"`
 }
@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultMaxNameLength is the default maximum length of a record name in
+// characters. It matches the size of the name column.
+const DefaultMaxNameLength = 256
+
+// ErrInvalidName means the record name is too long or has forbidden characters.
+var ErrInvalidName = errors.New("invalid record name")
+
+// ValidateName checks that a record name is valid UTF-8, has at most
+// `maxLength` characters and contains no control characters, which could
+// break listings and logs.
+func ValidateName(name string, maxLength int) error {
+	if !utf8.ValidString(name) {
+		return fmt.Errorf("%w: not valid UTF-8", ErrInvalidName)
+	}
+
+	if n := utf8.RuneCountInString(name); n > maxLength {
+		return fmt.Errorf("%w: %v characters, maximum is %v", ErrInvalidName, n, maxLength)
+	}
+
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("%w: control character %U", ErrInvalidName, r)
+		}
+	}
+
+	return nil
+}
+
+// ValidateFileName checks that the name of a file record is a single path
+// element, as the clients save the file under its name. A name with a path
+// separator or a dot name could write outside the download directory.
+func ValidateFileName(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return fmt.Errorf("%w: %q is not a file name", ErrInvalidName, name)
+	}
+
+	if strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("%w: file name contains a path separator", ErrInvalidName)
+	}
+
+	return nil
+}
@@ -21,8 +21,14 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	User_Register_FullMethodName = "/proto.User/Register"
-	User_Login_FullMethodName    = "/proto.User/Login"
+	User_Register_FullMethodName           = "/proto.User/Register"
+	User_Login_FullMethodName              = "/proto.User/Login"
+	User_ChangePassword_FullMethodName     = "/proto.User/ChangePassword"
+	User_BeginRegistration_FullMethodName  = "/proto.User/BeginRegistration"
+	User_FinishRegistration_FullMethodName = "/proto.User/FinishRegistration"
+	User_BeginLogin_FullMethodName         = "/proto.User/BeginLogin"
+	User_FinishLogin_FullMethodName        = "/proto.User/FinishLogin"
+	User_Refresh_FullMethodName            = "/proto.User/Refresh"
 )
 
 // UserClient is the client API for User service.
@@ -31,6 +37,12 @@ const (
 type UserClient interface {
 	Register(ctx context.Context, in *RegiserRequest, opts ...grpc.CallOption) (*RegisterResponse, error)
 	Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (*LoginResponse, error)
+	ChangePassword(ctx context.Context, in *ChangePasswordRequest, opts ...grpc.CallOption) (*ChangePasswordResponse, error)
+	BeginRegistration(ctx context.Context, in *BeginRegistrationRequest, opts ...grpc.CallOption) (*BeginRegistrationResponse, error)
+	FinishRegistration(ctx context.Context, in *FinishRegistrationRequest, opts ...grpc.CallOption) (*FinishRegistrationResponse, error)
+	BeginLogin(ctx context.Context, in *BeginLoginRequest, opts ...grpc.CallOption) (*BeginLoginResponse, error)
+	FinishLogin(ctx context.Context, in *FinishLoginRequest, opts ...grpc.CallOption) (*FinishLoginResponse, error)
+	Refresh(ctx context.Context, in *RefreshRequest, opts ...grpc.CallOption) (*RefreshResponse, error)
 }
 
 type userClient struct {
@@ -59,12 +71,72 @@ func (c *userClient) Login(ctx context.Context, in *LoginRequest, opts ...grpc.C
 	return out, nil
 }
 
+func (c *userClient) ChangePassword(ctx context.Context, in *ChangePasswordRequest, opts ...grpc.CallOption) (*ChangePasswordResponse, error) {
+	out := new(ChangePasswordResponse)
+	err := c.cc.Invoke(ctx, User_ChangePassword_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) BeginRegistration(ctx context.Context, in *BeginRegistrationRequest, opts ...grpc.CallOption) (*BeginRegistrationResponse, error) {
+	out := new(BeginRegistrationResponse)
+	err := c.cc.Invoke(ctx, User_BeginRegistration_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) FinishRegistration(ctx context.Context, in *FinishRegistrationRequest, opts ...grpc.CallOption) (*FinishRegistrationResponse, error) {
+	out := new(FinishRegistrationResponse)
+	err := c.cc.Invoke(ctx, User_FinishRegistration_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) BeginLogin(ctx context.Context, in *BeginLoginRequest, opts ...grpc.CallOption) (*BeginLoginResponse, error) {
+	out := new(BeginLoginResponse)
+	err := c.cc.Invoke(ctx, User_BeginLogin_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) FinishLogin(ctx context.Context, in *FinishLoginRequest, opts ...grpc.CallOption) (*FinishLoginResponse, error) {
+	out := new(FinishLoginResponse)
+	err := c.cc.Invoke(ctx, User_FinishLogin_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) Refresh(ctx context.Context, in *RefreshRequest, opts ...grpc.CallOption) (*RefreshResponse, error) {
+	out := new(RefreshResponse)
+	err := c.cc.Invoke(ctx, User_Refresh_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // UserServer is the server API for User service.
 // All implementations must embed UnimplementedUserServer
 // for forward compatibility
 type UserServer interface {
 	Register(context.Context, *RegiserRequest) (*RegisterResponse, error)
 	Login(context.Context, *LoginRequest) (*LoginResponse, error)
+	ChangePassword(context.Context, *ChangePasswordRequest) (*ChangePasswordResponse, error)
+	BeginRegistration(context.Context, *BeginRegistrationRequest) (*BeginRegistrationResponse, error)
+	FinishRegistration(context.Context, *FinishRegistrationRequest) (*FinishRegistrationResponse, error)
+	BeginLogin(context.Context, *BeginLoginRequest) (*BeginLoginResponse, error)
+	FinishLogin(context.Context, *FinishLoginRequest) (*FinishLoginResponse, error)
+	Refresh(context.Context, *RefreshRequest) (*RefreshResponse, error)
 	mustEmbedUnimplementedUserServer()
 }
 
@@ -78,6 +150,24 @@ func (UnimplementedUserServer) Register(context.Context, *RegiserRequest) (*Regi
 func (UnimplementedUserServer) Login(context.Context, *LoginRequest) (*LoginResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Login not implemented")
 }
+func (UnimplementedUserServer) ChangePassword(context.Context, *ChangePasswordRequest) (*ChangePasswordResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChangePassword not implemented")
+}
+func (UnimplementedUserServer) BeginRegistration(context.Context, *BeginRegistrationRequest) (*BeginRegistrationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BeginRegistration not implemented")
+}
+func (UnimplementedUserServer) FinishRegistration(context.Context, *FinishRegistrationRequest) (*FinishRegistrationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FinishRegistration not implemented")
+}
+func (UnimplementedUserServer) BeginLogin(context.Context, *BeginLoginRequest) (*BeginLoginResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BeginLogin not implemented")
+}
+func (UnimplementedUserServer) FinishLogin(context.Context, *FinishLoginRequest) (*FinishLoginResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FinishLogin not implemented")
+}
+func (UnimplementedUserServer) Refresh(context.Context, *RefreshRequest) (*RefreshResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Refresh not implemented")
+}
 func (UnimplementedUserServer) mustEmbedUnimplementedUserServer() {}
 
 // UnsafeUserServer may be embedded to opt out of forward compatibility for this service.
@@ -127,6 +217,114 @@ func _User_Login_Handler(srv interface{}, ctx context.Context, dec func(interfac
 	return interceptor(ctx, in, info, handler)
 }
 
+func _User_ChangePassword_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChangePasswordRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).ChangePassword(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: User_ChangePassword_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).ChangePassword(ctx, req.(*ChangePasswordRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_BeginRegistration_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BeginRegistrationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).BeginRegistration(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: User_BeginRegistration_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).BeginRegistration(ctx, req.(*BeginRegistrationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_FinishRegistration_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FinishRegistrationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).FinishRegistration(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: User_FinishRegistration_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).FinishRegistration(ctx, req.(*FinishRegistrationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_BeginLogin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BeginLoginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).BeginLogin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: User_BeginLogin_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).BeginLogin(ctx, req.(*BeginLoginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_FinishLogin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FinishLoginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).FinishLogin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: User_FinishLogin_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).FinishLogin(ctx, req.(*FinishLoginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_Refresh_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RefreshRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).Refresh(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: User_Refresh_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).Refresh(ctx, req.(*RefreshRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // User_ServiceDesc is the grpc.ServiceDesc for User service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -142,16 +340,50 @@ var User_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Login",
 			Handler:    _User_Login_Handler,
 		},
+		{
+			MethodName: "ChangePassword",
+			Handler:    _User_ChangePassword_Handler,
+		},
+		{
+			MethodName: "BeginRegistration",
+			Handler:    _User_BeginRegistration_Handler,
+		},
+		{
+			MethodName: "FinishRegistration",
+			Handler:    _User_FinishRegistration_Handler,
+		},
+		{
+			MethodName: "BeginLogin",
+			Handler:    _User_BeginLogin_Handler,
+		},
+		{
+			MethodName: "FinishLogin",
+			Handler:    _User_FinishLogin_Handler,
+		},
+		{
+			MethodName: "Refresh",
+			Handler:    _User_Refresh_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "internal/server/core/domain/proto/model.proto",
 }
 
 const (
-	Storage_ReadRecord_FullMethodName    = "/proto.Storage/ReadRecord"
-	Storage_ReadAllRecord_FullMethodName = "/proto.Storage/ReadAllRecord"
-	Storage_WriteRecord_FullMethodName   = "/proto.Storage/WriteRecord"
-	Storage_DeleteRecord_FullMethodName  = "/proto.Storage/DeleteRecord"
+	Storage_ReadRecord_FullMethodName     = "/proto.Storage/ReadRecord"
+	Storage_ReadRecordMeta_FullMethodName = "/proto.Storage/ReadRecordMeta"
+	Storage_ReadRecords_FullMethodName    = "/proto.Storage/ReadRecords"
+	Storage_ReadAllRecord_FullMethodName  = "/proto.Storage/ReadAllRecord"
+	Storage_WriteRecord_FullMethodName    = "/proto.Storage/WriteRecord"
+	Storage_UpdateRecord_FullMethodName   = "/proto.Storage/UpdateRecord"
+	Storage_UpdateMeta_FullMethodName     = "/proto.Storage/UpdateMeta"
+	Storage_TagRecords_FullMethodName     = "/proto.Storage/TagRecords"
+	Storage_DeleteRecord_FullMethodName   = "/proto.Storage/DeleteRecord"
+	Storage_ReadCategories_FullMethodName = "/proto.Storage/ReadCategories"
+	Storage_TransferRecord_FullMethodName = "/proto.Storage/TransferRecord"
+	Storage_ReadShares_FullMethodName     = "/proto.Storage/ReadShares"
+	Storage_RevokeShare_FullMethodName    = "/proto.Storage/RevokeShare"
+	Storage_ValidateRecord_FullMethodName = "/proto.Storage/ValidateRecord"
 )
 
 // StorageClient is the client API for Storage service.
@@ -159,9 +391,19 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type StorageClient interface {
 	ReadRecord(ctx context.Context, in *ReadRecordRequest, opts ...grpc.CallOption) (*ReadRecordResponse, error)
+	ReadRecordMeta(ctx context.Context, in *ReadRecordMetaRequest, opts ...grpc.CallOption) (*ReadRecordMetaResponse, error)
+	ReadRecords(ctx context.Context, in *ReadRecordsRequest, opts ...grpc.CallOption) (*ReadRecordsResponse, error)
 	ReadAllRecord(ctx context.Context, in *ReadAllRecordRequest, opts ...grpc.CallOption) (*ReadAllRecordResponse, error)
 	WriteRecord(ctx context.Context, opts ...grpc.CallOption) (Storage_WriteRecordClient, error)
+	UpdateRecord(ctx context.Context, opts ...grpc.CallOption) (Storage_UpdateRecordClient, error)
+	UpdateMeta(ctx context.Context, in *UpdateMetaRequest, opts ...grpc.CallOption) (*UpdateMetaResponse, error)
+	TagRecords(ctx context.Context, in *TagRecordsRequest, opts ...grpc.CallOption) (*TagRecordsResponse, error)
 	DeleteRecord(ctx context.Context, in *DeleteRecordRequest, opts ...grpc.CallOption) (*DeleteRecordResponse, error)
+	ReadCategories(ctx context.Context, in *ReadCategoriesRequest, opts ...grpc.CallOption) (*ReadCategoriesResponse, error)
+	TransferRecord(ctx context.Context, in *TransferRecordRequest, opts ...grpc.CallOption) (*TransferRecordResponse, error)
+	ReadShares(ctx context.Context, in *ReadSharesRequest, opts ...grpc.CallOption) (*ReadSharesResponse, error)
+	RevokeShare(ctx context.Context, in *RevokeShareRequest, opts ...grpc.CallOption) (*RevokeShareResponse, error)
+	ValidateRecord(ctx context.Context, in *ValidateRecordRequest, opts ...grpc.CallOption) (*ValidateRecordResponse, error)
 }
 
 type storageClient struct {
@@ -181,6 +423,24 @@ func (c *storageClient) ReadRecord(ctx context.Context, in *ReadRecordRequest, o
 	return out, nil
 }
 
+func (c *storageClient) ReadRecordMeta(ctx context.Context, in *ReadRecordMetaRequest, opts ...grpc.CallOption) (*ReadRecordMetaResponse, error) {
+	out := new(ReadRecordMetaResponse)
+	err := c.cc.Invoke(ctx, Storage_ReadRecordMeta_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storageClient) ReadRecords(ctx context.Context, in *ReadRecordsRequest, opts ...grpc.CallOption) (*ReadRecordsResponse, error) {
+	out := new(ReadRecordsResponse)
+	err := c.cc.Invoke(ctx, Storage_ReadRecords_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *storageClient) ReadAllRecord(ctx context.Context, in *ReadAllRecordRequest, opts ...grpc.CallOption) (*ReadAllRecordResponse, error) {
 	out := new(ReadAllRecordResponse)
 	err := c.cc.Invoke(ctx, Storage_ReadAllRecord_FullMethodName, in, out, opts...)
@@ -224,6 +484,58 @@ func (x *storageWriteRecordClient) CloseAndRecv() (*WriteRecordResponse, error)
 	return m, nil
 }
 
+func (c *storageClient) UpdateRecord(ctx context.Context, opts ...grpc.CallOption) (Storage_UpdateRecordClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Storage_ServiceDesc.Streams[1], Storage_UpdateRecord_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &storageUpdateRecordClient{stream}
+	return x, nil
+}
+
+type Storage_UpdateRecordClient interface {
+	Send(*UpdateRecordRequest) error
+	CloseAndRecv() (*UpdateRecordResponse, error)
+	grpc.ClientStream
+}
+
+type storageUpdateRecordClient struct {
+	grpc.ClientStream
+}
+
+func (x *storageUpdateRecordClient) Send(m *UpdateRecordRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *storageUpdateRecordClient) CloseAndRecv() (*UpdateRecordResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(UpdateRecordResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *storageClient) UpdateMeta(ctx context.Context, in *UpdateMetaRequest, opts ...grpc.CallOption) (*UpdateMetaResponse, error) {
+	out := new(UpdateMetaResponse)
+	err := c.cc.Invoke(ctx, Storage_UpdateMeta_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storageClient) TagRecords(ctx context.Context, in *TagRecordsRequest, opts ...grpc.CallOption) (*TagRecordsResponse, error) {
+	out := new(TagRecordsResponse)
+	err := c.cc.Invoke(ctx, Storage_TagRecords_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *storageClient) DeleteRecord(ctx context.Context, in *DeleteRecordRequest, opts ...grpc.CallOption) (*DeleteRecordResponse, error) {
 	out := new(DeleteRecordResponse)
 	err := c.cc.Invoke(ctx, Storage_DeleteRecord_FullMethodName, in, out, opts...)
@@ -233,14 +545,69 @@ func (c *storageClient) DeleteRecord(ctx context.Context, in *DeleteRecordReques
 	return out, nil
 }
 
+func (c *storageClient) ReadCategories(ctx context.Context, in *ReadCategoriesRequest, opts ...grpc.CallOption) (*ReadCategoriesResponse, error) {
+	out := new(ReadCategoriesResponse)
+	err := c.cc.Invoke(ctx, Storage_ReadCategories_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storageClient) TransferRecord(ctx context.Context, in *TransferRecordRequest, opts ...grpc.CallOption) (*TransferRecordResponse, error) {
+	out := new(TransferRecordResponse)
+	err := c.cc.Invoke(ctx, Storage_TransferRecord_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storageClient) ReadShares(ctx context.Context, in *ReadSharesRequest, opts ...grpc.CallOption) (*ReadSharesResponse, error) {
+	out := new(ReadSharesResponse)
+	err := c.cc.Invoke(ctx, Storage_ReadShares_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storageClient) RevokeShare(ctx context.Context, in *RevokeShareRequest, opts ...grpc.CallOption) (*RevokeShareResponse, error) {
+	out := new(RevokeShareResponse)
+	err := c.cc.Invoke(ctx, Storage_RevokeShare_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storageClient) ValidateRecord(ctx context.Context, in *ValidateRecordRequest, opts ...grpc.CallOption) (*ValidateRecordResponse, error) {
+	out := new(ValidateRecordResponse)
+	err := c.cc.Invoke(ctx, Storage_ValidateRecord_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // StorageServer is the server API for Storage service.
 // All implementations must embed UnimplementedStorageServer
 // for forward compatibility
 type StorageServer interface {
 	ReadRecord(context.Context, *ReadRecordRequest) (*ReadRecordResponse, error)
+	ReadRecordMeta(context.Context, *ReadRecordMetaRequest) (*ReadRecordMetaResponse, error)
+	ReadRecords(context.Context, *ReadRecordsRequest) (*ReadRecordsResponse, error)
 	ReadAllRecord(context.Context, *ReadAllRecordRequest) (*ReadAllRecordResponse, error)
 	WriteRecord(Storage_WriteRecordServer) error
+	UpdateRecord(Storage_UpdateRecordServer) error
+	UpdateMeta(context.Context, *UpdateMetaRequest) (*UpdateMetaResponse, error)
+	TagRecords(context.Context, *TagRecordsRequest) (*TagRecordsResponse, error)
 	DeleteRecord(context.Context, *DeleteRecordRequest) (*DeleteRecordResponse, error)
+	ReadCategories(context.Context, *ReadCategoriesRequest) (*ReadCategoriesResponse, error)
+	TransferRecord(context.Context, *TransferRecordRequest) (*TransferRecordResponse, error)
+	ReadShares(context.Context, *ReadSharesRequest) (*ReadSharesResponse, error)
+	RevokeShare(context.Context, *RevokeShareRequest) (*RevokeShareResponse, error)
+	ValidateRecord(context.Context, *ValidateRecordRequest) (*ValidateRecordResponse, error)
 	mustEmbedUnimplementedStorageServer()
 }
 
@@ -251,15 +618,45 @@ type UnimplementedStorageServer struct {
 func (UnimplementedStorageServer) ReadRecord(context.Context, *ReadRecordRequest) (*ReadRecordResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ReadRecord not implemented")
 }
+func (UnimplementedStorageServer) ReadRecordMeta(context.Context, *ReadRecordMetaRequest) (*ReadRecordMetaResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReadRecordMeta not implemented")
+}
+func (UnimplementedStorageServer) ReadRecords(context.Context, *ReadRecordsRequest) (*ReadRecordsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReadRecords not implemented")
+}
 func (UnimplementedStorageServer) ReadAllRecord(context.Context, *ReadAllRecordRequest) (*ReadAllRecordResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ReadAllRecord not implemented")
 }
 func (UnimplementedStorageServer) WriteRecord(Storage_WriteRecordServer) error {
 	return status.Errorf(codes.Unimplemented, "method WriteRecord not implemented")
 }
+func (UnimplementedStorageServer) UpdateRecord(Storage_UpdateRecordServer) error {
+	return status.Errorf(codes.Unimplemented, "method UpdateRecord not implemented")
+}
+func (UnimplementedStorageServer) UpdateMeta(context.Context, *UpdateMetaRequest) (*UpdateMetaResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateMeta not implemented")
+}
+func (UnimplementedStorageServer) TagRecords(context.Context, *TagRecordsRequest) (*TagRecordsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TagRecords not implemented")
+}
 func (UnimplementedStorageServer) DeleteRecord(context.Context, *DeleteRecordRequest) (*DeleteRecordResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteRecord not implemented")
 }
+func (UnimplementedStorageServer) ReadCategories(context.Context, *ReadCategoriesRequest) (*ReadCategoriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReadCategories not implemented")
+}
+func (UnimplementedStorageServer) TransferRecord(context.Context, *TransferRecordRequest) (*TransferRecordResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TransferRecord not implemented")
+}
+func (UnimplementedStorageServer) ReadShares(context.Context, *ReadSharesRequest) (*ReadSharesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReadShares not implemented")
+}
+func (UnimplementedStorageServer) RevokeShare(context.Context, *RevokeShareRequest) (*RevokeShareResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeShare not implemented")
+}
+func (UnimplementedStorageServer) ValidateRecord(context.Context, *ValidateRecordRequest) (*ValidateRecordResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ValidateRecord not implemented")
+}
 func (UnimplementedStorageServer) mustEmbedUnimplementedStorageServer() {}
 
 // UnsafeStorageServer may be embedded to opt out of forward compatibility for this service.
@@ -291,6 +688,42 @@ func _Storage_ReadRecord_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Storage_ReadRecordMeta_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadRecordMetaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StorageServer).ReadRecordMeta(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Storage_ReadRecordMeta_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StorageServer).ReadRecordMeta(ctx, req.(*ReadRecordMetaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Storage_ReadRecords_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadRecordsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StorageServer).ReadRecords(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Storage_ReadRecords_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StorageServer).ReadRecords(ctx, req.(*ReadRecordsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Storage_ReadAllRecord_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ReadAllRecordRequest)
 	if err := dec(in); err != nil {
@@ -335,6 +768,68 @@ func (x *storageWriteRecordServer) Recv() (*WriteRecordRequest, error) {
 	return m, nil
 }
 
+func _Storage_UpdateRecord_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(StorageServer).UpdateRecord(&storageUpdateRecordServer{stream})
+}
+
+type Storage_UpdateRecordServer interface {
+	SendAndClose(*UpdateRecordResponse) error
+	Recv() (*UpdateRecordRequest, error)
+	grpc.ServerStream
+}
+
+type storageUpdateRecordServer struct {
+	grpc.ServerStream
+}
+
+func (x *storageUpdateRecordServer) SendAndClose(m *UpdateRecordResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *storageUpdateRecordServer) Recv() (*UpdateRecordRequest, error) {
+	m := new(UpdateRecordRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Storage_UpdateMeta_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateMetaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StorageServer).UpdateMeta(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Storage_UpdateMeta_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StorageServer).UpdateMeta(ctx, req.(*UpdateMetaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Storage_TagRecords_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TagRecordsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StorageServer).TagRecords(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Storage_TagRecords_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StorageServer).TagRecords(ctx, req.(*TagRecordsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Storage_DeleteRecord_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(DeleteRecordRequest)
 	if err := dec(in); err != nil {
@@ -353,6 +848,96 @@ func _Storage_DeleteRecord_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Storage_ReadCategories_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadCategoriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StorageServer).ReadCategories(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Storage_ReadCategories_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StorageServer).ReadCategories(ctx, req.(*ReadCategoriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Storage_TransferRecord_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TransferRecordRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StorageServer).TransferRecord(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Storage_TransferRecord_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StorageServer).TransferRecord(ctx, req.(*TransferRecordRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Storage_ReadShares_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadSharesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StorageServer).ReadShares(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Storage_ReadShares_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StorageServer).ReadShares(ctx, req.(*ReadSharesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Storage_RevokeShare_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeShareRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StorageServer).RevokeShare(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Storage_RevokeShare_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StorageServer).RevokeShare(ctx, req.(*RevokeShareRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Storage_ValidateRecord_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ValidateRecordRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StorageServer).ValidateRecord(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Storage_ValidateRecord_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StorageServer).ValidateRecord(ctx, req.(*ValidateRecordRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Storage_ServiceDesc is the grpc.ServiceDesc for Storage service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -364,14 +949,50 @@ var Storage_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ReadRecord",
 			Handler:    _Storage_ReadRecord_Handler,
 		},
+		{
+			MethodName: "ReadRecordMeta",
+			Handler:    _Storage_ReadRecordMeta_Handler,
+		},
+		{
+			MethodName: "ReadRecords",
+			Handler:    _Storage_ReadRecords_Handler,
+		},
 		{
 			MethodName: "ReadAllRecord",
 			Handler:    _Storage_ReadAllRecord_Handler,
 		},
+		{
+			MethodName: "UpdateMeta",
+			Handler:    _Storage_UpdateMeta_Handler,
+		},
+		{
+			MethodName: "TagRecords",
+			Handler:    _Storage_TagRecords_Handler,
+		},
 		{
 			MethodName: "DeleteRecord",
 			Handler:    _Storage_DeleteRecord_Handler,
 		},
+		{
+			MethodName: "ReadCategories",
+			Handler:    _Storage_ReadCategories_Handler,
+		},
+		{
+			MethodName: "TransferRecord",
+			Handler:    _Storage_TransferRecord_Handler,
+		},
+		{
+			MethodName: "ReadShares",
+			Handler:    _Storage_ReadShares_Handler,
+		},
+		{
+			MethodName: "RevokeShare",
+			Handler:    _Storage_RevokeShare_Handler,
+		},
+		{
+			MethodName: "ValidateRecord",
+			Handler:    _Storage_ValidateRecord_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -379,6 +1000,212 @@ var Storage_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _Storage_WriteRecord_Handler,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "UpdateRecord",
+			Handler:       _Storage_UpdateRecord_Handler,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "internal/server/core/domain/proto/model.proto",
 }
+
+const (
+	Admin_SetReadOnly_FullMethodName       = "/proto.Admin/SetReadOnly"
+	Admin_DeleteOlderThan_FullMethodName   = "/proto.Admin/DeleteOlderThan"
+	Admin_ReencryptAll_FullMethodName      = "/proto.Admin/ReencryptAll"
+	Admin_RepairRecordTypes_FullMethodName = "/proto.Admin/RepairRecordTypes"
+)
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AdminClient interface {
+	SetReadOnly(ctx context.Context, in *SetReadOnlyRequest, opts ...grpc.CallOption) (*SetReadOnlyResponse, error)
+	DeleteOlderThan(ctx context.Context, in *DeleteOlderThanRequest, opts ...grpc.CallOption) (*DeleteOlderThanResponse, error)
+	ReencryptAll(ctx context.Context, in *ReencryptAllRequest, opts ...grpc.CallOption) (*ReencryptAllResponse, error)
+	RepairRecordTypes(ctx context.Context, in *RepairRecordTypesRequest, opts ...grpc.CallOption) (*RepairRecordTypesResponse, error)
+}
+
+type adminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminClient(cc grpc.ClientConnInterface) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) SetReadOnly(ctx context.Context, in *SetReadOnlyRequest, opts ...grpc.CallOption) (*SetReadOnlyResponse, error) {
+	out := new(SetReadOnlyResponse)
+	err := c.cc.Invoke(ctx, Admin_SetReadOnly_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) DeleteOlderThan(ctx context.Context, in *DeleteOlderThanRequest, opts ...grpc.CallOption) (*DeleteOlderThanResponse, error) {
+	out := new(DeleteOlderThanResponse)
+	err := c.cc.Invoke(ctx, Admin_DeleteOlderThan_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ReencryptAll(ctx context.Context, in *ReencryptAllRequest, opts ...grpc.CallOption) (*ReencryptAllResponse, error) {
+	out := new(ReencryptAllResponse)
+	err := c.cc.Invoke(ctx, Admin_ReencryptAll_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) RepairRecordTypes(ctx context.Context, in *RepairRecordTypesRequest, opts ...grpc.CallOption) (*RepairRecordTypesResponse, error) {
+	out := new(RepairRecordTypesResponse)
+	err := c.cc.Invoke(ctx, Admin_RepairRecordTypes_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for Admin service.
+// All implementations must embed UnimplementedAdminServer
+// for forward compatibility
+type AdminServer interface {
+	SetReadOnly(context.Context, *SetReadOnlyRequest) (*SetReadOnlyResponse, error)
+	DeleteOlderThan(context.Context, *DeleteOlderThanRequest) (*DeleteOlderThanResponse, error)
+	ReencryptAll(context.Context, *ReencryptAllRequest) (*ReencryptAllResponse, error)
+	RepairRecordTypes(context.Context, *RepairRecordTypesRequest) (*RepairRecordTypesResponse, error)
+	mustEmbedUnimplementedAdminServer()
+}
+
+// UnimplementedAdminServer must be embedded to have forward compatible implementations.
+type UnimplementedAdminServer struct {
+}
+
+func (UnimplementedAdminServer) SetReadOnly(context.Context, *SetReadOnlyRequest) (*SetReadOnlyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetReadOnly not implemented")
+}
+func (UnimplementedAdminServer) DeleteOlderThan(context.Context, *DeleteOlderThanRequest) (*DeleteOlderThanResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteOlderThan not implemented")
+}
+func (UnimplementedAdminServer) ReencryptAll(context.Context, *ReencryptAllRequest) (*ReencryptAllResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReencryptAll not implemented")
+}
+func (UnimplementedAdminServer) RepairRecordTypes(context.Context, *RepairRecordTypesRequest) (*RepairRecordTypesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RepairRecordTypes not implemented")
+}
+func (UnimplementedAdminServer) mustEmbedUnimplementedAdminServer() {}
+
+// UnsafeAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServer will
+// result in compilation errors.
+type UnsafeAdminServer interface {
+	mustEmbedUnimplementedAdminServer()
+}
+
+func RegisterAdminServer(s grpc.ServiceRegistrar, srv AdminServer) {
+	s.RegisterService(&Admin_ServiceDesc, srv)
+}
+
+func _Admin_SetReadOnly_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetReadOnlyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SetReadOnly(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_SetReadOnly_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SetReadOnly(ctx, req.(*SetReadOnlyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_DeleteOlderThan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteOlderThanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).DeleteOlderThan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_DeleteOlderThan_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).DeleteOlderThan(ctx, req.(*DeleteOlderThanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ReencryptAll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReencryptAllRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ReencryptAll(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ReencryptAll_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ReencryptAll(ctx, req.(*ReencryptAllRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_RepairRecordTypes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RepairRecordTypesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).RepairRecordTypes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_RepairRecordTypes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).RepairRecordTypes(ctx, req.(*RepairRecordTypesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Admin_ServiceDesc is the grpc.ServiceDesc for Admin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Admin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SetReadOnly",
+			Handler:    _Admin_SetReadOnly_Handler,
+		},
+		{
+			MethodName: "DeleteOlderThan",
+			Handler:    _Admin_DeleteOlderThan_Handler,
+		},
+		{
+			MethodName: "ReencryptAll",
+			Handler:    _Admin_ReencryptAll_Handler,
+		},
+		{
+			MethodName: "RepairRecordTypes",
+			Handler:    _Admin_RepairRecordTypes_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "internal/server/core/domain/proto/model.proto",
+}
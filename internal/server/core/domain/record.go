@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"unicode/utf8"
+)
+
+// DefaultMaxRecordSize is the default maximum size of the data of a record
+// in bytes. It matches the maximum message size of the client.
+const DefaultMaxRecordSize = 100 << 20
+
+// The schemes of the record IDs shown to the clients. The sequential IDs
+// are the default, the UUIDs don't leak the number of records and can't be
+// guessed.
+const (
+	RecordIDsInt  = "int"
+	RecordIDsUUID = "uuid"
+)
+
+// ErrUnknownRecordIDs means the scheme of the record IDs is not supported.
+var ErrUnknownRecordIDs = errors.New("unknown record ID scheme")
+
+// ValidateRecordIDs checks the scheme of the record IDs, empty is `RecordIDsInt`.
+func ValidateRecordIDs(scheme string) error {
+	if scheme != "" && scheme != RecordIDsInt && scheme != RecordIDsUUID {
+		return fmt.Errorf("%w %q, use %s or %s", ErrUnknownRecordIDs, scheme, RecordIDsInt, RecordIDsUUID)
+	}
+
+	return nil
+}
+
+// ErrInvalidRecord means the data of the record is too large or doesn't
+// have the structure of its type.
+var ErrInvalidRecord = errors.New("invalid record data")
+
+// RecordTypes are the types of the records written by the clients.
+var RecordTypes = []string{"text", "credentials", "json", "file"}
+
+// IsRecordType reports whether the type is one of `RecordTypes`.
+func IsRecordType(typ string) bool {
+	return slices.Contains(RecordTypes, typ)
+}
+
+// InferRecordType guesses the type of a record from its data, e.g. of a
+// record stored without a type. A JSON object with a login or a password is
+// credentials, another JSON object or array is json, UTF-8 text is text and
+// the rest is a file.
+func InferRecordType(data []byte) string {
+	var c map[string]json.RawMessage
+	if json.Unmarshal(data, &c) == nil && ValidateRecordData("credentials", data) == nil {
+		if _, ok := c["login"]; ok {
+			return "credentials"
+		}
+		if _, ok := c["password"]; ok {
+			return "credentials"
+		}
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+		return "json"
+	}
+
+	if utf8.Valid(data) {
+		return "text"
+	}
+
+	return "file"
+}
+
+// ValidateRecordSize checks that the data of a record has at most `maxSize` bytes.
+func ValidateRecordSize(size int64, maxSize int64) error {
+	if size > maxSize {
+		return fmt.Errorf("%w: %v bytes, maximum is %v", ErrInvalidRecord, size, maxSize)
+	}
+
+	return nil
+}
+
+// ValidateRecordData checks the structure of the data of the typed records:
+// a json record must be well-formed JSON and a credentials record a JSON
+// object with string fields. The data of other types is not checked.
+func ValidateRecordData(typ string, data []byte) error {
+	switch typ {
+	case "json":
+		if !json.Valid(data) {
+			return fmt.Errorf("%w: not well-formed JSON", ErrInvalidRecord)
+		}
+	case "credentials":
+		var c struct {
+			Login    string `json:"login"`
+			Password string `json:"password"`
+			URL      string `json:"url"`
+			Notes    string `json:"notes"`
+		}
+		if err := json.Unmarshal(data, &c); err != nil {
+			return fmt.Errorf("%w: credentials must be a JSON object with login and password: %w", ErrInvalidRecord, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// RetentionCutoff selects the records removed by the retention cleanup:
+// the records created, or last accessed, before the time.
+type RetentionCutoff struct {
+	// Before is the time the selected records are older than.
+	Before time.Time
+	// LastAccessed compares the time of the last access instead of the creation.
+	LastAccessed bool
+	// Owner limits the cleanup to the records of the user, zero for all users.
+	Owner int
+}
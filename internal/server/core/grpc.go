@@ -10,10 +10,14 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	handler "github.com/Renal37/goph-keeper/internal/server/adapters/handler/grpc"
 	interceptors "github.com/Renal37/goph-keeper/internal/server/adapters/middleware/grpc"
 	repository "github.com/Renal37/goph-keeper/internal/server/adapters/repository/pg"
+	"github.com/Renal37/goph-keeper/internal/server/adapters/webhook"
+	"github.com/Renal37/goph-keeper/internal/server/config"
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
 	"github.com/Renal37/goph-keeper/internal/server/core/domain/proto"
 	"github.com/Renal37/goph-keeper/internal/server/core/services"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/auth"
@@ -22,109 +26,323 @@ import (
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+
+	// Register the gzip compressor, so clients may compress calls on the wire
+	_ "google.golang.org/grpc/encoding/gzip"
 )
 
+// webhookCloseTimeout is how long the queued webhook events are still
+// delivered after the server stops.
+const webhookCloseTimeout = 10 * time.Second
+
 // RunGRPCserver run gRPC server.
-func RunGRPCserver(
-	lg *zap.Logger,
-	host string,
-	pathCert string,
-	pathKey string,
-	jwtKey string,
-	mk string,
-	repo *repository.DB,
-) error {
-	lg.Info("gRPC server start...", zap.String("address", host))
-
-	// Load certificates
-	tlsCredentials, err := loadTLSCredentials(pathCert, pathKey)
-	if err != nil {
-		return fmt.Errorf("failed load tls: %w", err)
+func RunGRPCserver(lg *zap.Logger, cfg *config.ConfigENV, repo *repository.DB) error {
+	defer func() {
+		if err := repo.Close(); err != nil {
+			lg.Info(err.Error())
+		}
+	}()
+
+	// Fail on start instead of on the first write
+	if _, err := handler.GetCipher(cfg.Algorithm); err != nil {
+		return fmt.Errorf("failed config: %w", err)
 	}
 
-	// Listen port
-	listen, err := net.Listen("tcp", host)
-	if err != nil {
-		return fmt.Errorf("failde listen grpc port: %w", err)
+	if err := domain.ValidateRecordIDs(cfg.RecordIDs); err != nil {
+		return fmt.Errorf("failed config: %w", err)
+	}
+
+	if err := handler.ValidateAccessLog(cfg.AccessLog); err != nil {
+		return fmt.Errorf("failed config: %w", err)
+	}
+
+	passwords := handler.PasswordHasher{
+		Algorithm:    cfg.PasswordHash,
+		ArgonTime:    cfg.ArgonTime,
+		ArgonMemory:  cfg.ArgonMemory,
+		ArgonThreads: cfg.ArgonThreads,
+	}
+	if err := passwords.Validate(); err != nil {
+		return fmt.Errorf("failed config: %w", err)
 	}
 
 	opts := []logging.Option{
 		logging.WithLogOnEvents(logging.StartCall, logging.FinishCall),
 	}
 
-	// Create gRPC server
-	s := grpc.NewServer(
-		grpc.Creds(tlsCredentials),
-		grpc.ChainUnaryInterceptor(
-			logging.UnaryServerInterceptor(interceptors.InterceptorLogger(lg), opts...),
-			selector.UnaryServerInterceptor(
-				auth.UnaryServerInterceptor(interceptors.GetAuthenticator(jwtKey)),
-				selector.MatchFunc(interceptors.AuthMatcher),
-			),
+	// Create services, they are shared by the servers of all listeners
+	userHandler := &handler.UserHandler{
+		Svc:          *services.NewUserService(repo),
+		Logger:       lg,
+		JWTkey:       cfg.JWTkey,
+		Passwords:    passwords,
+		RefreshGrace: cfg.JWTRefreshGrace.Std(),
+	}
+	if cfg.WebAuthnRPID != "" {
+		w, err := handler.NewWebAuthn(cfg.WebAuthnRPID, cfg.WebAuthnOrigins)
+		if err != nil {
+			return fmt.Errorf("failed config: %w", err)
+		}
+		userHandler.WebAuthn = w
+		userHandler.Sessions = handler.NewWebAuthnSessions()
+	}
+	readOnlyMode := handler.NewReadOnlyMode(lg, cfg.ReadOnly)
+
+	var notifier *webhook.Notifier
+	if cfg.Webhook.Enabled() {
+		notifier = webhook.New(cfg.Webhook, lg)
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), webhookCloseTimeout)
+			defer cancel()
+
+			if err := notifier.Close(ctx); err != nil {
+				lg.Info(err.Error())
+			}
+		}()
+	}
+
+	storageSvc := services.NewStorageService(repo)
+	if cfg.RecordIDs == domain.RecordIDsUUID {
+		// The records written before are addressed by UUID as well
+		n, err := storageSvc.AssignRecordUIDs()
+		if err != nil {
+			return fmt.Errorf("failed assign record UUIDs: %w", err)
+		}
+		if n > 0 {
+			lg.Info("record UUIDs assigned", zap.Int("records", n))
+		}
+	}
+	adminHandler := &handler.AdminHandler{
+		ReadOnlyMode: readOnlyMode,
+		Storage:      storageSvc,
+		Users:        &userHandler.Svc,
+		Logger:       lg,
+		MasterKey:    cfg.MasterKey,
+		MasterKeyID:  cfg.MasterKeyID,
+		MasterKeys:   cfg.MasterKeys,
+		Algorithm:    cfg.Algorithm,
+	}
+	storageHandler := &handler.StorageHandler{
+		Svc:           *storageSvc,
+		Logger:        lg,
+		MasterKey:     cfg.MasterKey,
+		MasterKeyID:   cfg.MasterKeyID,
+		MasterKeys:    cfg.MasterKeys,
+		ReauthWindow:  cfg.ReauthWindow.Std(),
+		MaxNameLength: cfg.MaxNameLength,
+		MaxRecordSize: cfg.MaxRecordSize,
+		Algorithm:     cfg.Algorithm,
+		EncryptNames:  cfg.EncryptNames,
+		ReadOnlyMode:  readOnlyMode,
+		Notifier:      notifier,
+		RecordIDs:     cfg.RecordIDs,
+		AccessLog:     cfg.AccessLog,
+	}
+
+	maxCredentialsSize := cfg.MaxCredentialsSize
+	if maxCredentialsSize == 0 {
+		maxCredentialsSize = interceptors.DefaultMaxCredentialsSize
+	}
+
+	authenticate := interceptors.GetAuthenticator(cfg.JWTkey, cfg.JWTLeeway.Std(),
+		interceptors.WithReadGrace(cfg.JWTReadGrace.Std(), interceptors.DefaultPolicy))
+
+	var servers []*grpc.Server
+	var listens []net.Listener
+
+	// With sampling only some calls are logged, besides the failed and slow ones
+	callLogger := interceptors.InterceptorLogger(lg)
+	var sampler *interceptors.LogSampler
+	if cfg.LogSampleRate > 1 {
+		sampler = interceptors.NewLogSampler(cfg.LogSampleRate, cfg.LogSlowCall.Std())
+		callLogger = sampler.Logger(callLogger)
+	}
+
+	streamInterceptors := []grpc.StreamServerInterceptor{
+		logging.StreamServerInterceptor(callLogger, opts...),
+		interceptors.RecoveryStreamInterceptor(lg),
+		selector.StreamServerInterceptor(
+			auth.StreamServerInterceptor(authenticate),
+			selector.MatchFunc(interceptors.AuthMatcher),
+		),
+		selector.StreamServerInterceptor(
+			interceptors.PolicyStreamInterceptor(interceptors.DefaultPolicy),
+			selector.MatchFunc(interceptors.AuthMatcher),
+		),
+	}
+	unaryInterceptors := []grpc.UnaryServerInterceptor{
+		logging.UnaryServerInterceptor(callLogger, opts...),
+		interceptors.RecoveryUnaryInterceptor(lg),
+		selector.UnaryServerInterceptor(
+			interceptors.MaxRequestSize(maxCredentialsSize),
+			selector.MatchFunc(interceptors.CredentialsMatcher),
 		),
-		grpc.ChainStreamInterceptor(
-			logging.StreamServerInterceptor(interceptors.InterceptorLogger(lg), opts...),
-			selector.StreamServerInterceptor(
-				auth.StreamServerInterceptor(interceptors.GetAuthenticator(jwtKey)),
-				selector.MatchFunc(interceptors.AuthMatcher),
-			),
+		selector.UnaryServerInterceptor(
+			auth.UnaryServerInterceptor(authenticate),
+			selector.MatchFunc(interceptors.AuthMatcher),
 		),
-	)
+		selector.UnaryServerInterceptor(
+			interceptors.PolicyUnaryInterceptor(interceptors.DefaultPolicy),
+			selector.MatchFunc(interceptors.AuthMatcher),
+		),
+	}
+	if sampler != nil {
+		// The sampling decision must be made before the logging interceptor
+		streamInterceptors = append([]grpc.StreamServerInterceptor{sampler.StreamInterceptor()}, streamInterceptors...)
+		unaryInterceptors = append([]grpc.UnaryServerInterceptor{sampler.UnaryInterceptor()}, unaryInterceptors...)
+	}
+	if cfg.RateLimit > 0 {
+		limiter := interceptors.NewRateLimiter(cfg.RateLimit, cfg.RateLimitWindow.Std())
+		unaryInterceptors = append(unaryInterceptors, selector.UnaryServerInterceptor(
+			limiter.UnaryInterceptor(),
+			selector.MatchFunc(interceptors.AuthMatcher),
+		))
+		streamInterceptors = append(streamInterceptors, selector.StreamServerInterceptor(
+			limiter.StreamInterceptor(),
+			selector.MatchFunc(interceptors.AuthMatcher),
+		))
+	}
+	if cfg.DefaultDeadline > 0 {
+		unaryInterceptors = append(unaryInterceptors,
+			interceptors.DefaultDeadlineUnaryInterceptor(lg, cfg.DefaultDeadline.Std()))
+		streamInterceptors = append(streamInterceptors,
+			interceptors.DefaultDeadlineStreamInterceptor(lg, cfg.DefaultDeadline.Std(), cfg.UploadDeadline.Std()))
+	}
+	if cfg.MaxConcurrentUploads > 0 {
+		streamInterceptors = append(streamInterceptors, selector.StreamServerInterceptor(
+			interceptors.MaxConcurrentUploads(cfg.MaxConcurrentUploads),
+			selector.MatchFunc(interceptors.UploadMatcher),
+		))
+	}
+
+	for _, l := range listeners(cfg) {
+		serverOpts := []grpc.ServerOption{
+			grpc.ChainUnaryInterceptor(unaryInterceptors...),
+			grpc.ChainStreamInterceptor(streamInterceptors...),
+		}
+		if cfg.ReadTimeout > 0 {
+			// Ping the idle clients, so the healthy ones answer in time and
+			// keep the connection
+			serverOpts = append(serverOpts, grpc.KeepaliveParams(keepalive.ServerParameters{
+				Time:    cfg.ReadTimeout.Std() / 2,
+				Timeout: cfg.ReadTimeout.Std() / 2,
+			}))
+		}
 
-	// Create user service
-	userSvc := services.NewUserService(repo)
-	proto.RegisterUserServer(s, &handler.UserHandler{
-		Svc:    *userSvc,
-		Logger: lg,
-		JWTkey: jwtKey,
-	})
+		// Load certificates
+		if !l.Insecure {
+			tlsCredentials, err := loadTLSCredentials(l.CertificatePath, l.CertificateKeyPath)
+			if err != nil {
+				closeListeners(lg, listens)
+				return fmt.Errorf("failed load tls: %w", err)
+			}
 
-	// Create storage service
-	storageSvc := services.NewStorageService(repo)
-	proto.RegisterStorageServer(s, &handler.StorageHandler{
-		Svc:       *storageSvc,
-		Logger:    lg,
-		MasterKey: mk,
-	})
+			serverOpts = append(serverOpts, grpc.Creds(tlsCredentials))
+		}
+
+		// Listen port
+		listen, err := net.Listen(l.Network, l.Address)
+		if err != nil {
+			closeListeners(lg, listens)
+			return fmt.Errorf("failde listen grpc port: %w", err)
+		}
+		listens = append(listens, limitConnections(listen, cfg.MaxConnections, cfg.ReadTimeout.Std(), lg))
+
+		// Create gRPC server
+		s := grpc.NewServer(serverOpts...)
+		proto.RegisterUserServer(s, userHandler)
+		proto.RegisterStorageServer(s, storageHandler)
+		if l.Admin {
+			proto.RegisterAdminServer(s, adminHandler)
+		}
+		servers = append(servers, s)
+
+		lg.Info("gRPC server start...",
+			zap.String("network", l.Network), zap.String("address", l.Address),
+			zap.Bool("insecure", l.Insecure), zap.Bool("admin", l.Admin))
+	}
 
 	// Graceful server
-	var wg sync.WaitGroup
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
-	errCh := make(chan error, 1)
+	defer stop()
 
-	wg.Add(1)
+	return serve(ctx, servers, listens)
+}
 
-	go func() {
-		defer func() {
-			if err := repo.Close(); err != nil {
-				lg.Info(err.Error())
-			}
+// listeners returns the listeners from the settings. Without them the server
+// listens on the host with the common certificate. Listeners without their own
+// certificate use the common one.
+func listeners(cfg *config.ConfigENV) []config.Listener {
+	if len(cfg.Listeners) == 0 {
+		return []config.Listener{{
+			Network:            "tcp",
+			Address:            cfg.Host,
+			CertificatePath:    cfg.CertificatePath,
+			CertificateKeyPath: cfg.CertificateKeyPath,
+		}}
+	}
 
-			stop()
-			wg.Done()
-		}()
+	res := make([]config.Listener, 0, len(cfg.Listeners))
+	for _, l := range cfg.Listeners {
+		if l.Network == "" {
+			l.Network = "tcp"
+		}
+		if l.CertificatePath == "" {
+			l.CertificatePath = cfg.CertificatePath
+		}
+		if l.CertificateKeyPath == "" {
+			l.CertificateKeyPath = cfg.CertificateKeyPath
+		}
 
-		<-ctx.Done()
-	}()
+		res = append(res, l)
+	}
 
-	// Start gRPC server
-	go func() {
-		if err := s.Serve(listen); err != nil {
-			errCh <- err
-			return
-		}
-	}()
+	return res
+}
+
+// serve serves every server on its listener until the context is done or
+// one of the servers fails. Then all the servers are gracefully stopped.
+func serve(ctx context.Context, servers []*grpc.Server, listens []net.Listener) error {
+	errCh := make(chan error, len(servers))
+
+	var wg sync.WaitGroup
+	for i, s := range servers {
+		wg.Add(1)
+
+		// Start gRPC server
+		go func(s *grpc.Server, l net.Listener) {
+			defer wg.Done()
+
+			if err := s.Serve(l); err != nil {
+				errCh <- err
+			}
+		}(s, listens[i])
+	}
 
+	var err error
 	select {
-	case err := <-errCh:
-		if err != nil {
-			return fmt.Errorf("failde create grpc server: %w", err)
-		}
+	case err = <-errCh:
+		err = fmt.Errorf("failde create grpc server: %w", err)
 	case <-ctx.Done():
 	}
 
+	for _, s := range servers {
+		s.GracefulStop()
+	}
+
 	wg.Wait()
-	return nil
+
+	return err
+}
+
+// closeListeners closes the listeners opened before a failed start.
+func closeListeners(lg *zap.Logger, listens []net.Listener) {
+	for _, l := range listens {
+		if err := l.Close(); err != nil {
+			lg.Info(err.Error())
+		}
+	}
 }
 
 // loadTLSCredentials loading cert.
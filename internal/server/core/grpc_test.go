@@ -0,0 +1,87 @@
+package core
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestServeMultipleListeners(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	socket := filepath.Join(t.TempDir(), "admin.sock")
+	unix, err := net.Listen("unix", socket)
+	assert.NoError(t, err)
+
+	// Both servers share the same handler
+	hs := health.NewServer()
+	var servers []*grpc.Server
+	for range []net.Listener{tcp, unix} {
+		s := grpc.NewServer()
+		healthpb.RegisterHealthServer(s, hs)
+		servers = append(servers, s)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, servers, []net.Listener{tcp, unix})
+	}()
+
+	tests := []struct {
+		name   string
+		target string
+	}{
+		{
+			name:   "Public TCP listener",
+			target: tcp.Addr().String(),
+		},
+		{
+			name:   "Local unix socket",
+			target: "unix://" + socket,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := grpc.Dial(tt.target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			assert.NoError(t, err)
+			defer conn.Close()
+
+			out, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+			assert.NoError(t, err)
+			assert.Equal(t, healthpb.HealthCheckResponse_SERVING, out.Status)
+		})
+	}
+
+	// Shutdown stops all the listeners
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("servers were not stopped")
+	}
+
+	for _, tt := range tests {
+		conn, err := grpc.Dial(tt.target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		assert.Error(t, err, tt.name)
+
+		cancel()
+		conn.Close()
+	}
+}
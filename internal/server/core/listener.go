@@ -0,0 +1,96 @@
+package core
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// limitListener caps the number of open connections of a listener and drops
+// the clients that send nothing for the read timeout, so slow clients can't
+// hold the connections of the server, e.g. stalling in the middle of an upload.
+type limitListener struct {
+	net.Listener
+	maxConns    int
+	readTimeout time.Duration
+	logger      *zap.Logger
+	active      atomic.Int64
+}
+
+// limitConnections wraps the listener with the limits. Zero `maxConns` means
+// no limit of the connections, zero `readTimeout` no timeout of the reads.
+func limitConnections(l net.Listener, maxConns int, readTimeout time.Duration, lg *zap.Logger) net.Listener {
+	if maxConns <= 0 && readTimeout <= 0 {
+		return l
+	}
+
+	return &limitListener{Listener: l, maxConns: maxConns, readTimeout: readTimeout, logger: lg}
+}
+
+// Accept waits for a connection under the limit. The connections beyond the
+// limit are closed right away.
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			//nolint:wrapcheck // This legal return
+			return nil, err
+		}
+
+		active := l.active.Add(1)
+		if l.maxConns > 0 && active > int64(l.maxConns) {
+			l.active.Add(-1)
+			l.logger.Warn("Connection rejected, the limit of connections is reached",
+				zap.String("remote", c.RemoteAddr().String()), zap.Int("max_connections", l.maxConns))
+
+			if err := c.Close(); err != nil {
+				l.logger.Info(err.Error())
+			}
+			continue
+		}
+
+		return &limitConn{Conn: c, listener: l}, nil
+	}
+}
+
+// limitConn is a connection of the limitListener.
+type limitConn struct {
+	net.Conn
+	listener *limitListener
+	closed   sync.Once
+}
+
+// Read fails if the client sends nothing for the read timeout, the server
+// closes the connection then.
+func (c *limitConn) Read(b []byte) (int, error) {
+	if c.listener.readTimeout > 0 {
+		if err := c.Conn.SetReadDeadline(time.Now().Add(c.listener.readTimeout)); err != nil {
+			//nolint:wrapcheck // This legal return
+			return 0, err
+		}
+	}
+
+	n, err := c.Conn.Read(b)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		c.listener.logger.Warn("Slow client dropped",
+			zap.String("remote", c.RemoteAddr().String()), zap.Duration("read_timeout", c.listener.readTimeout))
+	}
+
+	//nolint:wrapcheck // This legal return
+	return n, err
+}
+
+// Close closes the connection and frees its place under the limit.
+func (c *limitConn) Close() error {
+	c.closed.Do(func() {
+		c.listener.active.Add(-1)
+	})
+
+	//nolint:wrapcheck // This legal return
+	return c.Conn.Close()
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestLimitConnectionsDropsStalledClient(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	l := limitConnections(tcp, 0, 100*time.Millisecond, zap.NewNop())
+	defer l.Close()
+
+	client, err := net.Dial("tcp", tcp.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	conn, err := l.Accept()
+	require.NoError(t, err)
+
+	// The client sends a part of the data and stalls
+	_, err = client.Write([]byte("part"))
+	require.NoError(t, err)
+
+	buf := make([]byte, 16)
+	n, err := conn.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "part", string(buf[:n]))
+
+	_, err = conn.Read(buf)
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded))
+	assert.NoError(t, conn.Close())
+
+	// The client sees the closed connection
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = client.Read(buf)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestLimitConnectionsRejectsOverLimit(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	l := limitConnections(tcp, 1, 0, zap.NewNop())
+	defer l.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	first, err := net.Dial("tcp", tcp.Addr().String())
+	require.NoError(t, err)
+	defer first.Close()
+	conn := <-accepted
+
+	// The second connection is closed by the server
+	second, err := net.Dial("tcp", tcp.Addr().String())
+	require.NoError(t, err)
+	defer second.Close()
+
+	require.NoError(t, second.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = second.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Closing the first connection frees the place
+	assert.NoError(t, conn.Close())
+	third, err := net.Dial("tcp", tcp.Addr().String())
+	require.NoError(t, err)
+	defer third.Close()
+
+	select {
+	case c := <-accepted:
+		assert.NoError(t, c.Close())
+	case <-time.After(time.Second):
+		t.Fatal("connection under the limit not accepted")
+	}
+
+	// Without limits the listener is not wrapped
+	assert.Equal(t, tcp, limitConnections(tcp, 0, 0, zap.NewNop()))
+}
@@ -4,20 +4,78 @@
 // storage repositories for `User` and `Storage` domain entities.
 package ports
 
-import "github.com/Renal37/goph-keeper/internal/server/core/domain"
+import (
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
+)
 
 // UserRepository represents the interface for user-related data storage.
-// It provides methods for finding a user by login and creating a new user.
+// It provides methods for finding a user by login, creating a new user,
+// changing the password together with the vault key of the user, upgrading
+// the password hash and
+// managing the WebAuthn credentials of the user.
 type UserRepository interface {
 	FindUserByLogin(login string) (*domain.User, error)
 	CreateUser(login, hash string) (*domain.User, error)
+	CreateUserWithVaultKey(login, email, hash string, key domain.VaultKey) (*domain.User, error)
+	FindVaultKey(user int) (*domain.VaultKey, error)
+	UpdatePassword(user int, hash string, key domain.VaultKey) error
+	UpdatePasswordHash(user int, hash string) error
+	CreateWebAuthnCredential(cred *domain.WebAuthnCredential) error
+	FindWebAuthnCredentials(user int) ([]domain.WebAuthnCredential, error)
+	UpdateWebAuthnCredential(user int, credentialID []byte, data []byte) error
+}
+
+// TeamRepository represents the interface for team-related data storage.
+// It provides methods for creating teams and managing their members.
+type TeamRepository interface {
+	CreateTeam(name string) (*domain.Team, error)
+	FindTeamByName(name string) (*domain.Team, error)
+	AddTeamMember(team int, user int) error
+	RemoveTeamMember(team int, user int) error
+}
+
+// BackupRepository represents the interface for copying the whole data storage.
+// It provides methods for exporting all users and records and for restoring them.
+type BackupRepository interface {
+	ExportAll() (*domain.Backup, error)
+	ImportAll(b *domain.Backup) error
 }
 
 // StorageRepository represents the interface for storage-related data storage.
-// It provides methods for reading, writing, and deleting storage records.
+// It provides methods for reading, writing, updating and deleting storage
+// records, for the retention cleanup and for tracking the idempotency keys
+// of processed writes.
 type StorageRepository interface {
 	ReadRecord(id int, owner int) (*domain.Storage, error)
-	ReadAllRecord(owner int) ([]*domain.Storage, error)
-	WriteRecord(doc domain.Storage) error
+	ReadRecords(ids []int, owner int) ([]domain.Storage, error)
+	ReadRecordVersion(id int, owner int, version int) (*domain.Storage, error)
+	ReadAllRecord(owner int, filter domain.RecordFilter, sort domain.RecordSort) ([]*domain.Storage, error)
+	ReadRecordPage(owner int, filter domain.RecordFilter, sort domain.RecordSort, after domain.PageCursor, limit int) ([]*domain.Storage, error)
+	ReadCategories(owner int) ([]domain.CategoryCount, error)
+	ResolveRecordUIDs(uids []string, user int) (map[string]int, error)
+	AssignRecordUIDs() (int, error)
+	NextRecordID() (int, error)
+	WriteRecord(doc domain.Storage) (int, error)
+	WriteRecordWithKey(doc domain.Storage, key string) (int, error)
+	UpdateRecord(doc domain.Storage, version int) (int, error)
+	UpdateMeta(id int, owner int, set domain.Meta, remove []string, replace bool) (domain.Meta, error)
+	TagRecords(owner int, filter domain.RecordFilter, set domain.Meta, category string) (int, error)
 	DeleteRecord(id int, owner int) error
+	TouchRecords(ids []int, at time.Time) error
+	DeleteRecordsBefore(cutoff domain.RetentionCutoff, batch int) (int, error)
+	ReadRecordsToReencrypt(algorithm string, keyID string, after int, limit int) ([]domain.Storage, error)
+	ReencryptRecord(doc domain.Storage, version int) error
+	ReadVersionsToReencrypt(algorithm string, keyID string, after int, limit int) ([]domain.StorageVersion, error)
+	ReencryptVersion(id int, doc domain.Storage) error
+	ReadRecordsWithInvalidType(types []string, after int, limit int) ([]domain.Storage, error)
+	UpdateRecordType(id int, from string, to string) error
+	TransferRecord(id int, owner int, login string, rebind func(doc *domain.Storage, owner int) error) error
+	ReadSharesOut(owner int) ([]domain.Share, error)
+	ReadSharesIn(user int) ([]domain.Share, error)
+	RevokeShare(id int, owner int) error
+	FindIdempotencyKey(key string, owner int, after time.Time) (*domain.IdempotencyKey, error)
+	DeleteIdempotencyKeys(owner int, before time.Time) error
+	IsTeamMember(team int, user int) (bool, error)
 }
@@ -0,0 +1,68 @@
+// Package services contains the application services that implement
+// business logic using the repository interfaces defined in the
+// `ports` package. These services serve as an intermediary layer
+// between the domain logic and the data layer, providing methods
+// for operations such as finding, creating, updating, and deleting
+// users and storage records.
+//
+//nolint:wrapcheck // This legal return
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
+	"github.com/Renal37/goph-keeper/internal/server/core/ports"
+)
+
+// backupVersion is the version of the backup format.
+var backupVersion = 1
+
+// BackupService represents a service for backing up the whole server.
+// It uses the `BackupRepository` interface to read and restore all data.
+type BackupService struct {
+	repo ports.BackupRepository
+}
+
+// NewBackupService creates a new instance of `BackupService`
+// with the given `BackupRepository`.
+func NewBackupService(repo ports.BackupRepository) *BackupService {
+	return &BackupService{
+		repo: repo,
+	}
+}
+
+// Export writes all users and records as JSON. Record values are written
+// as they are stored, encrypted.
+func (s *BackupService) Export(w io.Writer) error {
+	b, err := s.repo.ExportAll()
+	if err != nil {
+		return err
+	}
+
+	b.Version = backupVersion
+	b.CreatedAt = time.Now().UTC()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(b)
+}
+
+// Import reads a backup written by `Export` and restores it into an empty
+// database.
+func (s *BackupService) Import(r io.Reader) error {
+	var b domain.Backup
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return fmt.Errorf("failed decode backup: %w", err)
+	}
+
+	if b.Version != backupVersion {
+		return fmt.Errorf("unsupported backup version: %v", b.Version)
+	}
+
+	return s.repo.ImportAll(&b)
+}
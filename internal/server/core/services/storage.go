@@ -9,6 +9,8 @@
 package services
 
 import (
+	"time"
+
 	"github.com/Renal37/goph-keeper/internal/server/core/domain"
 	"github.com/Renal37/goph-keeper/internal/server/core/ports"
 )
@@ -28,10 +30,25 @@ func NewStorageService(repo ports.StorageRepository) *StorageService {
 	}
 }
 
-// ReadAllRecord retrieves all storage records for the specified owner.
+// ReadAllRecord retrieves all storage records for the specified owner
+// matching the filter in the order of the sort. No records give an empty,
+// non-nil slice.
 // It uses the `ReadAllRecord` method from the `StorageRepository` interface.
-func (s *StorageService) ReadAllRecord(owner int) ([]*domain.Storage, error) {
-	return s.repo.ReadAllRecord(owner)
+func (s *StorageService) ReadAllRecord(owner int, filter domain.RecordFilter, sort domain.RecordSort) ([]*domain.Storage, error) {
+	return s.repo.ReadAllRecord(owner, filter, sort)
+}
+
+// ReadRecordPage retrieves a page of the records of the owner in the order
+// of the sort, starting after the cursor.
+// It uses the `ReadRecordPage` method from the `StorageRepository` interface.
+func (s *StorageService) ReadRecordPage(owner int, filter domain.RecordFilter, sort domain.RecordSort, after domain.PageCursor, limit int) ([]*domain.Storage, error) {
+	return s.repo.ReadRecordPage(owner, filter, sort, after, limit)
+}
+
+// ReadCategories retrieves the categories of the owner's records with counts.
+// It uses the `ReadCategories` method from the `StorageRepository` interface.
+func (s *StorageService) ReadCategories(owner int) ([]domain.CategoryCount, error) {
+	return s.repo.ReadCategories(owner)
 }
 
 // ReadRecord retrieves a specific storage record by ID and owner.
@@ -40,10 +57,113 @@ func (s *StorageService) ReadRecord(id int, owner int) (*domain.Storage, error)
 	return s.repo.ReadRecord(id, owner)
 }
 
-// WriteRecord adds a new storage record.
-// It uses the `WriteRecord` method from the `StorageRepository` interface.
-func (s *StorageService) WriteRecord(doc domain.Storage) error {
-	return s.repo.WriteRecord(doc)
+// ReadRecords retrieves the storage records with the given IDs owned by `owner`.
+// It uses the `ReadRecords` method from the `StorageRepository` interface.
+func (s *StorageService) ReadRecords(ids []int, owner int) ([]domain.Storage, error) {
+	return s.repo.ReadRecords(ids, owner)
+}
+
+// ReadRecordVersion retrieves the given version of a record by ID and owner.
+// The current version is read from the record itself, earlier ones from
+// the history of the record. A team member reading a team record gets
+// the history kept for the owner of the record.
+func (s *StorageService) ReadRecordVersion(id int, owner int, version int) (*domain.Storage, error) {
+	rec, err := s.repo.ReadRecord(id, owner)
+	if err != nil || rec == nil || rec.Version == version {
+		return rec, err
+	}
+
+	return s.repo.ReadRecordVersion(id, rec.Owner, version)
+}
+
+// ResolveRecordUIDs maps the UUIDs of the records the user can read to their IDs.
+// It uses the `ResolveRecordUIDs` method from the `StorageRepository` interface.
+func (s *StorageService) ResolveRecordUIDs(uids []string, user int) (map[string]int, error) {
+	return s.repo.ResolveRecordUIDs(uids, user)
+}
+
+// AssignRecordUIDs gives a UUID to the records without one.
+// It uses the `AssignRecordUIDs` method from the `StorageRepository` interface.
+func (s *StorageService) AssignRecordUIDs() (int, error) {
+	return s.repo.AssignRecordUIDs()
+}
+
+// NextRecordID reserves the ID of a new record.
+// It uses the `NextRecordID` method from the `StorageRepository` interface.
+func (s *StorageService) NextRecordID() (int, error) {
+	return s.repo.NextRecordID()
+}
+
+// WriteRecord adds a new storage record and returns its ID.
+// When a non-empty idempotency key is given and a record has already been
+// written with the same key by the same owner within the ttl window, the ID
+// of that record is returned instead of creating a duplicate.
+// A record of a team can be written only by a member of the team,
+// otherwise `domain.ErrNotTeamMember` is returned.
+func (s *StorageService) WriteRecord(doc domain.Storage, key string, ttl time.Duration) (int, error) {
+	if doc.Team != 0 {
+		member, err := s.repo.IsTeamMember(doc.Team, doc.Owner)
+		if err != nil {
+			return 0, err
+		}
+
+		if !member {
+			return 0, domain.ErrNotTeamMember
+		}
+	}
+
+	if key == "" {
+		return s.repo.WriteRecord(doc)
+	}
+
+	// Forget the keys of the owner that are older than the window, so an
+	// expired key can be stored again. The lookup ignores them anyway.
+	after := time.Now().Add(-ttl)
+	if err := s.repo.DeleteIdempotencyKeys(doc.Owner, after); err != nil {
+		return 0, err
+	}
+
+	k, err := s.repo.FindIdempotencyKey(key, doc.Owner, after)
+	if err != nil {
+		return 0, err
+	}
+
+	if k != nil {
+		return k.RecordID, nil
+	}
+
+	id, err := s.repo.WriteRecordWithKey(doc, key)
+	if err != nil {
+		// A concurrent retry may have stored the same key first
+		k, findErr := s.repo.FindIdempotencyKey(key, doc.Owner, after)
+		if findErr == nil && k != nil {
+			return k.RecordID, nil
+		}
+
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// UpdateRecord replaces the contents of a record if it still has the
+// expected version and returns the new version.
+// It uses the `UpdateRecord` method from the `StorageRepository` interface.
+func (s *StorageService) UpdateRecord(doc domain.Storage, version int) (int, error) {
+	return s.repo.UpdateRecord(doc, version)
+}
+
+// UpdateMeta merges or replaces the metadata of a record and returns the result.
+// It uses the `UpdateMeta` method from the `StorageRepository` interface.
+func (s *StorageService) UpdateMeta(id int, owner int, set domain.Meta, remove []string, replace bool) (domain.Meta, error) {
+	return s.repo.UpdateMeta(id, owner, set, remove, replace)
+}
+
+// TagRecords merges the tags into the metadata of the records matching the
+// filter and sets their category. It returns the number of updated records.
+// It uses the `TagRecords` method from the `StorageRepository` interface.
+func (s *StorageService) TagRecords(owner int, filter domain.RecordFilter, set domain.Meta, category string) (int, error) {
+	return s.repo.TagRecords(owner, filter, set, category)
 }
 
 // DeleteRecord removes a storage record by ID and owner.
@@ -51,3 +171,83 @@ func (s *StorageService) WriteRecord(doc domain.Storage) error {
 func (s *StorageService) DeleteRecord(id int, owner int) error {
 	return s.repo.DeleteRecord(id, owner)
 }
+
+// TouchRecords marks the records with the given IDs as accessed now.
+// It uses the `TouchRecords` method from the `StorageRepository` interface.
+func (s *StorageService) TouchRecords(ids []int) error {
+	return s.repo.TouchRecords(ids, time.Now())
+}
+
+// DeleteOlderThan removes the records older than the cutoff in batches of
+// at most `batch` records and returns the number of removed records.
+// It uses the `DeleteRecordsBefore` method from the `StorageRepository` interface.
+func (s *StorageService) DeleteOlderThan(cutoff domain.RetentionCutoff, batch int) (int, error) {
+	return s.repo.DeleteRecordsBefore(cutoff, batch)
+}
+
+// ReadRecordsToReencrypt retrieves at most `limit` records after the ID that
+// are not encrypted with the algorithm or the master key with the ID.
+// It uses the `ReadRecordsToReencrypt` method from the `StorageRepository` interface.
+func (s *StorageService) ReadRecordsToReencrypt(algorithm string, keyID string, after int, limit int) ([]domain.Storage, error) {
+	return s.repo.ReadRecordsToReencrypt(algorithm, keyID, after, limit)
+}
+
+// ReencryptRecord saves the record encrypted again, unless it was changed
+// since it was read at the version.
+// It uses the `ReencryptRecord` method from the `StorageRepository` interface.
+func (s *StorageService) ReencryptRecord(doc domain.Storage, version int) error {
+	return s.repo.ReencryptRecord(doc, version)
+}
+
+// ReadVersionsToReencrypt retrieves at most `limit` versions of the history
+// after the ID that are not encrypted with the algorithm or the master key
+// with the ID.
+// It uses the `ReadVersionsToReencrypt` method from the `StorageRepository` interface.
+func (s *StorageService) ReadVersionsToReencrypt(algorithm string, keyID string, after int, limit int) ([]domain.StorageVersion, error) {
+	return s.repo.ReadVersionsToReencrypt(algorithm, keyID, after, limit)
+}
+
+// ReencryptVersion saves the version of the history with the ID encrypted again.
+// It uses the `ReencryptVersion` method from the `StorageRepository` interface.
+func (s *StorageService) ReencryptVersion(id int, doc domain.Storage) error {
+	return s.repo.ReencryptVersion(id, doc)
+}
+
+// ReadRecordsWithInvalidType retrieves at most `limit` records after the ID
+// with a type that is not one of the types.
+// It uses the `ReadRecordsWithInvalidType` method from the `StorageRepository` interface.
+func (s *StorageService) ReadRecordsWithInvalidType(types []string, after int, limit int) ([]domain.Storage, error) {
+	return s.repo.ReadRecordsWithInvalidType(types, after, limit)
+}
+
+// UpdateRecordType changes the type of the record, unless it was changed
+// since it was read.
+// It uses the `UpdateRecordType` method from the `StorageRepository` interface.
+func (s *StorageService) UpdateRecordType(id int, from string, to string) error {
+	return s.repo.UpdateRecordType(id, from, to)
+}
+
+// TransferRecord makes the user with the login the owner of the record,
+// `rebind` encrypts the record and its versions for the new owner.
+// It uses the `TransferRecord` method from the `StorageRepository` interface.
+func (s *StorageService) TransferRecord(id int, owner int, login string, rebind func(doc *domain.Storage, owner int) error) error {
+	return s.repo.TransferRecord(id, owner, login, rebind)
+}
+
+// ReadShares retrieves the records shared with the user when `incoming` is
+// set, the records the user shared otherwise.
+// It uses the `ReadSharesIn` and `ReadSharesOut` methods from the
+// `StorageRepository` interface.
+func (s *StorageService) ReadShares(user int, incoming bool) ([]domain.Share, error) {
+	if incoming {
+		return s.repo.ReadSharesIn(user)
+	}
+
+	return s.repo.ReadSharesOut(user)
+}
+
+// RevokeShare makes a shared record of the owner private again.
+// It uses the `RevokeShare` method from the `StorageRepository` interface.
+func (s *StorageService) RevokeShare(id int, owner int) error {
+	return s.repo.RevokeShare(id, owner)
+}
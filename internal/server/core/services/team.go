@@ -0,0 +1,84 @@
+// Package services contains the application services that implement
+// business logic using the repository interfaces defined in the
+// `ports` package. These services serve as an intermediary layer
+// between the domain logic and the data layer, providing methods
+// for operations such as finding, creating, updating, and deleting
+// users and storage records.
+//
+//nolint:wrapcheck // This legal return
+package services
+
+import (
+	"github.com/Renal37/goph-keeper/internal/server/core/domain"
+	"github.com/Renal37/goph-keeper/internal/server/core/ports"
+)
+
+// TeamService represents a service for administration of teams.
+// Teams and members are referred to by names and logins, the service
+// resolves them to IDs.
+type TeamService struct {
+	teams ports.TeamRepository
+	users ports.UserRepository
+}
+
+// NewTeamService creates a new instance of `TeamService`
+// with the given team and user repositories.
+func NewTeamService(teams ports.TeamRepository, users ports.UserRepository) *TeamService {
+	return &TeamService{
+		teams: teams,
+		users: users,
+	}
+}
+
+// CreateTeam creates a new team with the given name.
+// It uses the `CreateTeam` method from the `TeamRepository` interface.
+func (t *TeamService) CreateTeam(name string) (*domain.Team, error) {
+	return t.teams.CreateTeam(name)
+}
+
+// AddMember adds the user with the login to the team.
+// It returns `domain.ErrTeamNotFound` or `domain.ErrUserNotFound`
+// if the team or the user does not exist.
+func (t *TeamService) AddMember(team string, login string) error {
+	teamID, userID, err := t.resolve(team, login)
+	if err != nil {
+		return err
+	}
+
+	return t.teams.AddTeamMember(teamID, userID)
+}
+
+// RemoveMember removes the user with the login from the team.
+// It returns `domain.ErrTeamNotFound` or `domain.ErrUserNotFound`
+// if the team or the user does not exist.
+func (t *TeamService) RemoveMember(team string, login string) error {
+	teamID, userID, err := t.resolve(team, login)
+	if err != nil {
+		return err
+	}
+
+	return t.teams.RemoveTeamMember(teamID, userID)
+}
+
+// resolve finds the IDs of the team and the user.
+func (t *TeamService) resolve(team string, login string) (int, int, error) {
+	tm, err := t.teams.FindTeamByName(team)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if tm == nil {
+		return 0, 0, domain.ErrTeamNotFound
+	}
+
+	user, err := t.users.FindUserByLogin(login)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if user == nil {
+		return 0, 0, domain.ErrUserNotFound
+	}
+
+	return tm.ID, user.ID, nil
+}
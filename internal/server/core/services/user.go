@@ -27,7 +27,7 @@ func NewUserService(repo ports.UserRepository) *UserService {
 	}
 }
 
-// FindUserByLogin retrieves a user by their login.
+// FindUserByLogin retrieves a user by their login or email.
 // It uses the `FindUserByLogin` method from the `UserRepository` interface.
 func (u *UserService) FindUserByLogin(login string) (*domain.User, error) {
 	return u.repo.FindUserByLogin(login)
@@ -38,3 +38,46 @@ func (u *UserService) FindUserByLogin(login string) (*domain.User, error) {
 func (u *UserService) CreateUser(login, hash string) (*domain.User, error) {
 	return u.repo.CreateUser(login, hash)
 }
+
+// CreateUserWithVaultKey creates a new user with the given login, optional
+// email, hashed password and vault key.
+// It uses the `CreateUserWithVaultKey` method from the `UserRepository` interface.
+func (u *UserService) CreateUserWithVaultKey(login, email, hash string, key domain.VaultKey) (*domain.User, error) {
+	return u.repo.CreateUserWithVaultKey(login, email, hash, key)
+}
+
+// FindVaultKey retrieves the vault key of the user.
+// It uses the `FindVaultKey` method from the `UserRepository` interface.
+func (u *UserService) FindVaultKey(user int) (*domain.VaultKey, error) {
+	return u.repo.FindVaultKey(user)
+}
+
+// UpdatePassword replaces the password hash and the vault key of the user.
+// It uses the `UpdatePassword` method from the `UserRepository` interface.
+func (u *UserService) UpdatePassword(user int, hash string, key domain.VaultKey) error {
+	return u.repo.UpdatePassword(user, hash, key)
+}
+
+// UpdatePasswordHash replaces the password hash of the user, the password stays the same.
+// It uses the `UpdatePasswordHash` method from the `UserRepository` interface.
+func (u *UserService) UpdatePasswordHash(user int, hash string) error {
+	return u.repo.UpdatePasswordHash(user, hash)
+}
+
+// CreateWebAuthnCredential stores a new WebAuthn credential of the user.
+// It uses the `CreateWebAuthnCredential` method from the `UserRepository` interface.
+func (u *UserService) CreateWebAuthnCredential(cred *domain.WebAuthnCredential) error {
+	return u.repo.CreateWebAuthnCredential(cred)
+}
+
+// FindWebAuthnCredentials retrieves the WebAuthn credentials of the user.
+// It uses the `FindWebAuthnCredentials` method from the `UserRepository` interface.
+func (u *UserService) FindWebAuthnCredentials(user int) ([]domain.WebAuthnCredential, error) {
+	return u.repo.FindWebAuthnCredentials(user)
+}
+
+// UpdateWebAuthnCredential replaces the data of the credential of the user.
+// It uses the `UpdateWebAuthnCredential` method from the `UserRepository` interface.
+func (u *UserService) UpdateWebAuthnCredential(user int, credentialID []byte, data []byte) error {
+	return u.repo.UpdateWebAuthnCredential(user, credentialID, data)
+}